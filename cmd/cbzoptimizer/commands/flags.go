@@ -2,8 +2,15 @@ package commands
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/belphemur/CBZOptimizer/v2/internal/pagefilter"
+	"github.com/belphemur/CBZOptimizer/v2/internal/utils"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/webp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/thediveo/enumflag/v2"
@@ -51,12 +58,46 @@ func setupQualityFlag(cmd *cobra.Command, defaultValue uint8, bindViper bool) {
 //   - defaultValue: The default override value
 //   - bindViper: If true, binds the flag to viper for configuration file support
 func setupOverrideFlag(cmd *cobra.Command, defaultValue bool, bindViper bool) {
-	cmd.Flags().BoolP("override", "o", defaultValue, "Override the original CBZ/CBR files")
+	cmd.Flags().BoolP("override", "o", defaultValue, "Override the original comic archives (archives other than CBZ are replaced by a CBZ)")
 	if bindViper {
 		_ = viper.BindPFlag("override", cmd.Flags().Lookup("override"))
 	}
 }
 
+// setupIncludeArchivesFlag sets up the include-archives flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the include-archives flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupIncludeArchivesFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("include-archives", false, "Also optimize plain .zip, .rar and .7z archives as comic archives")
+	if bindViper {
+		_ = viper.BindPFlag("include-archives", cmd.Flags().Lookup("include-archives"))
+	}
+}
+
+// setupFolderFlags sets up the folders and remove-folders flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupFolderFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("folders", false, "Also optimize folders containing only images, writing each one to a CBZ of the same name next to it")
+	cmd.Flags().Bool("remove-folders", false, "Delete each image folder once its CBZ has been written and verified (requires --folders)")
+	if bindViper {
+		_ = viper.BindPFlag("folders", cmd.Flags().Lookup("folders"))
+		_ = viper.BindPFlag("remove-folders", cmd.Flags().Lookup("remove-folders"))
+	}
+}
+
+// validateFolders checks the values of the flags set up by setupFolderFlags.
+func validateFolders(folders bool, removeFolders bool) error {
+	if removeFolders && !folders {
+		return fmt.Errorf("invalid remove-folders: requires --folders")
+	}
+	return nil
+}
+
 // setupSplitFlag sets up the split flag for a command.
 //
 // Parameters:
@@ -83,6 +124,18 @@ func setupKeepFilenamesFlag(cmd *cobra.Command, defaultValue bool, bindViper boo
 	}
 }
 
+// setupLegacyPageOrderFlag sets up the legacy-page-order flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the legacy-page-order flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupLegacyPageOrderFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("legacy-page-order", false, "Number pages in the order they are stored in the archive instead of natural filename order")
+	if bindViper {
+		_ = viper.BindPFlag("legacy-page-order", cmd.Flags().Lookup("legacy-page-order"))
+	}
+}
+
 // setupTimeoutFlag sets up the timeout flag for a command.
 //
 // Parameters:
@@ -95,20 +148,465 @@ func setupTimeoutFlag(cmd *cobra.Command, bindViper bool) {
 	}
 }
 
+// setupWebPModeFlags sets up the webp-mode and near-lossless-level flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - webpMode: Pointer to the WebPMode variable that will store the webp-mode flag value
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupWebPModeFlags(cmd *cobra.Command, webpMode *constant.WebPMode, bindViper bool) {
+	modeFlag := enumflag.New(webpMode, "webp-mode", constant.WebPModeValue, enumflag.EnumCaseInsensitive)
+	_ = modeFlag.RegisterCompletion(cmd, "webp-mode", constant.WebPModeHelpText)
+
+	cmd.Flags().Var(
+		modeFlag,
+		"webp-mode",
+		"WebP compression mode: lossy, lossless, near-lossless or auto (lossless for palette-like pages when smaller)")
+	cmd.Flags().Uint8("near-lossless-level", options.DefaultNearLosslessLevel, "Near-lossless preprocessing level for --webp-mode=near-lossless (0-100, lower is smaller)")
+
+	if bindViper {
+		_ = viper.BindPFlag("webp-mode", cmd.Flags().Lookup("webp-mode"))
+		_ = viper.BindPFlag("near-lossless-level", cmd.Flags().Lookup("near-lossless-level"))
+	}
+}
+
+// setupWebPEncoderFlag sets up the webp-encoder flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flag to
+//   - webpEncoder: Pointer to the WebPEncoder variable that will store the webp-encoder flag value
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupWebPEncoderFlag(cmd *cobra.Command, webpEncoder *constant.WebPEncoder, bindViper bool) {
+	encoderFlag := enumflag.New(webpEncoder, "webp-encoder", constant.WebPEncoderValue, enumflag.EnumCaseInsensitive)
+	_ = encoderFlag.RegisterCompletion(cmd, "webp-encoder", constant.WebPEncoderHelpText)
+
+	cmd.Flags().Var(
+		encoderFlag,
+		"webp-encoder",
+		"WebP encoder: auto (cwebp, or the built-in encoder when cwebp cannot be provisioned), cwebp or native (built-in, no external binary)")
+
+	if bindViper {
+		_ = viper.BindPFlag("webp-encoder", cmd.Flags().Lookup("webp-encoder"))
+	}
+}
+
+// setupTargetQualityFlags sets up the target-ssim, min-quality and max-quality flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupTargetQualityFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Float64("target-ssim", 0, "Encode each WebP page at the lowest quality reaching this SSIM (0-1) against the source instead of --quality. 0 disables the search")
+	cmd.Flags().Uint8("min-quality", options.DefaultMinQuality, "Lowest quality tried by --target-ssim (0-100)")
+	cmd.Flags().Uint8("max-quality", options.DefaultMaxQuality, "Highest quality tried by --target-ssim (0-100)")
+	if bindViper {
+		_ = viper.BindPFlag("target-ssim", cmd.Flags().Lookup("target-ssim"))
+		_ = viper.BindPFlag("min-quality", cmd.Flags().Lookup("min-quality"))
+		_ = viper.BindPFlag("max-quality", cmd.Flags().Lookup("max-quality"))
+	}
+}
+
+// setupContentAwareFlag sets up the content-aware flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the content-aware flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupContentAwareFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("content-aware", false, "Classify each WebP page as text, drawing or photo and adapt the cwebp preset and quality to it")
+	if bindViper {
+		_ = viper.BindPFlag("content-aware", cmd.Flags().Lookup("content-aware"))
+	}
+}
+
+// setupSliceFlags sets up the split-height, slice-height and slice-overlap flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupSliceFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Int("split-height", 0, "With --split, also split pages taller than this many pixels (after resizing). 0 splits only pages too tall for the format")
+	cmd.Flags().Int("slice-height", options.DefaultSliceHeight, "Height in pixels of the parts a split page is cut into")
+	cmd.Flags().Int("slice-overlap", 0, "Number of pixels each part of a split page repeats from the end of the previous one")
+	if bindViper {
+		_ = viper.BindPFlag("split-height", cmd.Flags().Lookup("split-height"))
+		_ = viper.BindPFlag("slice-height", cmd.Flags().Lookup("slice-height"))
+		_ = viper.BindPFlag("slice-overlap", cmd.Flags().Lookup("slice-overlap"))
+	}
+}
+
+// setupWebtoonFlag sets up the webtoon flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the webtoon flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupWebtoonFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("webtoon", false, "Stitch the pages of each chapter into one strip and cut it again into pages of --slice-height, at panel gutters where possible")
+	if bindViper {
+		_ = viper.BindPFlag("webtoon", cmd.Flags().Lookup("webtoon"))
+	}
+}
+
+// setupRemovePagesFlags sets up the remove-blank, remove-like and remove-distance flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the page removal flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupRemovePagesFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("remove-blank", false, "Remove blank pages before converting")
+	cmd.Flags().StringSlice("remove-like", nil, "Remove pages that look like these reference images (files or directories of images), such as credit or recruitment pages")
+	cmd.Flags().Int("remove-distance", pagefilter.DefaultMaxDistance, "Largest perceptual hash distance (0-64) at which a page still matches a --remove-like image")
+	if bindViper {
+		_ = viper.BindPFlag("remove-blank", cmd.Flags().Lookup("remove-blank"))
+		_ = viper.BindPFlag("remove-like", cmd.Flags().Lookup("remove-like"))
+		_ = viper.BindPFlag("remove-distance", cmd.Flags().Lookup("remove-distance"))
+	}
+}
+
+// validateSlices checks the values of the flags set up by setupSliceFlags.
+func validateSlices(splitHeight int, sliceHeight int, sliceOverlap int) error {
+	if splitHeight < 0 {
+		return fmt.Errorf("invalid split-height: must not be negative")
+	}
+	if sliceHeight <= 0 || sliceOverlap < 0 || sliceOverlap >= sliceHeight {
+		return fmt.Errorf("invalid slices: slice-height must be positive and slice-overlap between 0 and slice-height")
+	}
+	if sliceHeight+sliceOverlap > options.MaxSliceHeight {
+		return fmt.Errorf("invalid slices: slice-height plus slice-overlap must not exceed %d", options.MaxSliceHeight)
+	}
+	return nil
+}
+
+// setupResizeFlags sets up the max-width, max-height and max-megapixels flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupResizeFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Int("max-width", 0, "Downscale pages wider than this many pixels, keeping the aspect ratio. 0 means no limit")
+	cmd.Flags().Int("max-height", 0, "Downscale pages taller than this many pixels, keeping the aspect ratio. 0 means no limit")
+	cmd.Flags().Float64("max-megapixels", 0, "Downscale pages larger than this many megapixels, keeping the aspect ratio. 0 means no limit")
+	if bindViper {
+		_ = viper.BindPFlag("max-width", cmd.Flags().Lookup("max-width"))
+		_ = viper.BindPFlag("max-height", cmd.Flags().Lookup("max-height"))
+		_ = viper.BindPFlag("max-megapixels", cmd.Flags().Lookup("max-megapixels"))
+	}
+}
+
+// validateResize checks the values of the flags set up by setupResizeFlags.
+func validateResize(maxWidth int, maxHeight int, maxMegapixels float64) error {
+	if maxWidth < 0 || maxHeight < 0 || maxMegapixels < 0 {
+		return fmt.Errorf("invalid resize limits: max-width, max-height and max-megapixels must not be negative")
+	}
+	return nil
+}
+
+// setupGrayscaleFlags sets up the grayscale, detect-grayscale and grayscale-tolerance flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupGrayscaleFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("grayscale", false, "Convert every page to grayscale before encoding, for monochrome reading devices")
+	cmd.Flags().Bool("detect-grayscale", false, "Encode near-grayscale pages as grayscale, leaving color pages untouched")
+	cmd.Flags().Uint8("grayscale-tolerance", options.DefaultGrayscaleTolerance, "Largest spread between the R, G and B values of a pixel (0-255) still considered gray by --detect-grayscale")
+	if bindViper {
+		_ = viper.BindPFlag("grayscale", cmd.Flags().Lookup("grayscale"))
+		_ = viper.BindPFlag("detect-grayscale", cmd.Flags().Lookup("detect-grayscale"))
+		_ = viper.BindPFlag("grayscale-tolerance", cmd.Flags().Lookup("grayscale-tolerance"))
+	}
+}
+
+// setupEnhanceFlags sets up the auto-levels, levels-clip and gamma flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupEnhanceFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("auto-levels", false, "Stretch the tones of each page to full black and white, for faded scans")
+	cmd.Flags().Float64("levels-clip", options.DefaultLevelsClip, "Percentage of pixels (0-50) --auto-levels lets clip to pure black and to pure white")
+	cmd.Flags().Float64("gamma", 1, "Gamma applied to each page: above 1 lightens the midtones, below 1 darkens them. 1 leaves them alone")
+	if bindViper {
+		_ = viper.BindPFlag("auto-levels", cmd.Flags().Lookup("auto-levels"))
+		_ = viper.BindPFlag("levels-clip", cmd.Flags().Lookup("levels-clip"))
+		_ = viper.BindPFlag("gamma", cmd.Flags().Lookup("gamma"))
+	}
+}
+
+// validateEnhance checks the values of the flags set up by setupEnhanceFlags.
+func validateEnhance(levelsClip float64, gamma float64) error {
+	if levelsClip < 0 || levelsClip >= 50 {
+		return fmt.Errorf("invalid levels-clip value: must be at least 0 and below 50")
+	}
+	if gamma <= 0 || gamma > 10 {
+		return fmt.Errorf("invalid gamma value: must be above 0 and at most 10")
+	}
+	return nil
+}
+
+// setupQuantizeFlags sets up the gray-levels and dither flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - dither: Pointer to the Dither variable that will store the dither flag value
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupQuantizeFlags(cmd *cobra.Command, dither *constant.Dither, bindViper bool) {
+	ditherFlag := enumflag.New(dither, "dither", constant.DitherValue, enumflag.EnumCaseInsensitive)
+	_ = ditherFlag.RegisterCompletion(cmd, "dither", constant.DitherHelpText)
+
+	cmd.Flags().Int("gray-levels", 0, "Reduce pages to this many gray levels (2-255) for e-ink screens, e.g. 16. 0 keeps full 8-bit gray")
+	cmd.Flags().Var(
+		ditherFlag,
+		"dither",
+		"Dithering used by --gray-levels: floyd-steinberg, ordered or none")
+
+	if bindViper {
+		_ = viper.BindPFlag("gray-levels", cmd.Flags().Lookup("gray-levels"))
+		_ = viper.BindPFlag("dither", cmd.Flags().Lookup("dither"))
+	}
+}
+
+// validateGrayLevels checks the value of the gray-levels flag.
+func validateGrayLevels(grayLevels int) error {
+	if grayLevels != 0 && (grayLevels < 2 || grayLevels > 255) {
+		return fmt.Errorf("invalid gray-levels value: must be 0 or between 2 and 255")
+	}
+	return nil
+}
+
+// setupAutoCropFlags sets up the auto-crop, auto-crop-threshold and auto-crop-margin flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupAutoCropFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("auto-crop", false, "Trim uniform white or black borders from each page before encoding")
+	cmd.Flags().Uint8("auto-crop-threshold", options.DefaultAutoCropThreshold, "How far from pure white or black (0-255) a pixel may be and still count as border for --auto-crop")
+	cmd.Flags().Int("auto-crop-margin", options.DefaultAutoCropMargin, "Pixels of border kept around the content by --auto-crop")
+	if bindViper {
+		_ = viper.BindPFlag("auto-crop", cmd.Flags().Lookup("auto-crop"))
+		_ = viper.BindPFlag("auto-crop-threshold", cmd.Flags().Lookup("auto-crop-threshold"))
+		_ = viper.BindPFlag("auto-crop-margin", cmd.Flags().Lookup("auto-crop-margin"))
+	}
+}
+
+// setupProfileFlag sets up the profile flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the profile flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupProfileFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().String("profile", "", "Device profile setting the resolution, grayscale, quality and split defaults (e.g. kindle-paperwhite, kobo-libra, tablet). Profiles can be added under 'profiles' in the config file")
+	_ = cmd.RegisterFlagCompletionFunc("profile", func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		all, err := profiles()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return profileNames(all), cobra.ShellCompDirectiveNoFileComp
+	})
+	if bindViper {
+		_ = viper.BindPFlag("profile", cmd.Flags().Lookup("profile"))
+	}
+}
+
+// setupKeepSmallerFlags sets up the keep-smaller and min-savings flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupKeepSmallerFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("keep-smaller", false, "Keep a page in its original format when converting it does not save at least --min-savings percent")
+	cmd.Flags().Uint8("min-savings", 0, "Minimum size reduction in percent (0-100) a converted page must reach with --keep-smaller")
+	if bindViper {
+		_ = viper.BindPFlag("keep-smaller", cmd.Flags().Lookup("keep-smaller"))
+		_ = viper.BindPFlag("min-savings", cmd.Flags().Lookup("min-savings"))
+	}
+}
+
+// validateTargetQuality checks the values of the flags set up by
+// setupTargetQualityFlags.
+func validateTargetQuality(targetSSIM float64, minQuality uint8, maxQuality uint8) error {
+	if targetSSIM < 0 || targetSSIM >= 1 {
+		return fmt.Errorf("invalid target-ssim value: must be between 0 and 1")
+	}
+	if maxQuality > 100 || minQuality > maxQuality {
+		return fmt.Errorf("invalid quality range: min-quality must not exceed max-quality (0-100)")
+	}
+	return nil
+}
+
+// setupMaxSizeFlag sets up the max-size flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the max-size flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupMaxSizeFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().String("max-size", "", "Maximum size of each output CBZ (e.g. 50MB, 200MiB). Quality is lowered until the chapter fits. Empty means no limit")
+	if bindViper {
+		_ = viper.BindPFlag("max-size", cmd.Flags().Lookup("max-size"))
+	}
+}
+
+// setupSpreadFlags sets up the split-spreads, reading-direction and keep-spreads flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - readingDirection: Pointer to the ReadingDirection variable that will store the reading-direction flag value
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupSpreadFlags(cmd *cobra.Command, readingDirection *constant.ReadingDirection, bindViper bool) {
+	directionFlag := enumflag.New(readingDirection, "reading-direction", constant.ReadingDirectionValue, enumflag.EnumCaseInsensitive)
+	_ = directionFlag.RegisterCompletion(cmd, "reading-direction", constant.ReadingDirectionHelpText)
+
+	cmd.Flags().Bool("split-spreads", false, "Split double-page spreads (pages wider than tall) into their two halves")
+	cmd.Flags().Var(
+		directionFlag,
+		"reading-direction",
+		"Order of the halves of a split spread: auto (from the ComicInfo Manga field), ltr or rtl")
+	cmd.Flags().Bool("keep-spreads", false, "Keep the whole spread before its halves when splitting spreads")
+
+	if bindViper {
+		_ = viper.BindPFlag("split-spreads", cmd.Flags().Lookup("split-spreads"))
+		_ = viper.BindPFlag("reading-direction", cmd.Flags().Lookup("reading-direction"))
+		_ = viper.BindPFlag("keep-spreads", cmd.Flags().Lookup("keep-spreads"))
+	}
+}
+
+// setupFlattenAnimationsFlag sets up the flatten-animations flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flatten-animations flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupFlattenAnimationsFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("flatten-animations", false, "Keep only the first frame of animated GIFs instead of converting them to animated WebP")
+	if bindViper {
+		_ = viper.BindPFlag("flatten-animations", cmd.Flags().Lookup("flatten-animations"))
+	}
+}
+
+// setupKeepICCFlag sets up the keep-icc flag for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the keep-icc flag to
+//   - bindViper: If true, binds the flag to viper for configuration file support
+func setupKeepICCFlag(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Bool("keep-icc", false, "Keep embedded ICC color profiles instead of converting pages to sRGB")
+	if bindViper {
+		_ = viper.BindPFlag("keep-icc", cmd.Flags().Lookup("keep-icc"))
+	}
+}
+
+// setupCoverFlags sets up the cover-quality, cover-format and cover-no-downscale flags for a command.
+//
+// Parameters:
+//   - cmd: The Cobra command to add the flags to
+//   - bindViper: If true, binds the flags to viper for configuration file support
+func setupCoverFlags(cmd *cobra.Command, bindViper bool) {
+	cmd.Flags().Uint8("cover-quality", 0, "Quality for the cover page (0-100). 0 uses --quality")
+	cmd.Flags().String("cover-format", "", fmt.Sprintf("Format to convert the cover page to: %s. Empty uses --format", constant.ListAll()))
+	cmd.Flags().Bool("cover-no-downscale", false, "Do not apply the resize limits to the cover page")
+	if bindViper {
+		_ = viper.BindPFlag("cover-quality", cmd.Flags().Lookup("cover-quality"))
+		_ = viper.BindPFlag("cover-format", cmd.Flags().Lookup("cover-format"))
+		_ = viper.BindPFlag("cover-no-downscale", cmd.Flags().Lookup("cover-no-downscale"))
+	}
+}
+
+// prepareConverter prepares chapterConverter for the run. With
+// --webp-encoder cwebp the WebP converter requires cwebp, so a host without
+// it fails here instead of falling back to the built-in encoder.
+func prepareConverter(chapterConverter converter.Converter, webpEncoder constant.WebPEncoder) error {
+	if webpConverter, ok := chapterConverter.(*webp.Converter); ok && webpEncoder == constant.WebPEncoderCWebP {
+		return webpConverter.RequireCWebP()
+	}
+	return chapterConverter.PrepareConverter()
+}
+
+// newCoverOptions builds the cover settings from the values of the flags set
+// up by setupCoverFlags, preparing the cover converter when a cover format
+// is given. Returns nil when the cover is converted like the other pages.
+func newCoverOptions(quality uint8, format string, noDownscale bool, webpEncoder constant.WebPEncoder) (*utils.CoverOptions, error) {
+	if quality > 100 {
+		return nil, fmt.Errorf("invalid cover-quality value")
+	}
+	if quality == 0 && format == "" && !noDownscale {
+		return nil, nil
+	}
+
+	cover := &utils.CoverOptions{Quality: quality, NoDownscale: noDownscale}
+	if format == "" {
+		return cover, nil
+	}
+	for coverFormat, names := range constant.CommandValue {
+		if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, format) }) {
+			continue
+		}
+		coverConverter, err := converter.Get(coverFormat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cover converter: %w", err)
+		}
+		if err := prepareConverter(coverConverter, webpEncoder); err != nil {
+			return nil, fmt.Errorf("failed to prepare cover converter: %w", err)
+		}
+		cover.Converter = coverConverter
+		return cover, nil
+	}
+	return nil, fmt.Errorf("invalid cover-format value: must be one of %s", constant.ListAll())
+}
+
+// commonFlags holds what setupCommonFlags needs besides the command: the
+// variables the enum flags store their value in, and the defaults that
+// differ between the optimize and watch commands.
+type commonFlags struct {
+	// converterType, webpMode, webpEncoder, readingDirection and dither
+	// store the values of the format, webp-mode, webp-encoder,
+	// reading-direction and dither flags.
+	converterType    *constant.ConversionFormat
+	webpMode         *constant.WebPMode
+	webpEncoder      *constant.WebPEncoder
+	readingDirection *constant.ReadingDirection
+	dither           *constant.Dither
+	// qualityDefault is the default quality value (0-100).
+	qualityDefault uint8
+	// overrideDefault and splitDefault are the defaults of the override
+	// and split flags.
+	overrideDefault bool
+	splitDefault    bool
+	// bindViper binds all flags to viper for configuration file support.
+	bindViper bool
+}
+
 // setupCommonFlags sets up all common flags for optimize and watch commands.
 //
 // Parameters:
 //   - cmd: The Cobra command to add the flags to
-//   - converterType: Pointer to the ConversionFormat variable that will store the format flag value
-//   - qualityDefault: The default quality value (0-100)
-//   - overrideDefault: The default override value
-//   - splitDefault: The default split value
-//   - bindViper: If true, binds all flags to viper for configuration file support
-func setupCommonFlags(cmd *cobra.Command, converterType *constant.ConversionFormat, qualityDefault uint8, overrideDefault bool, splitDefault bool, bindViper bool) {
-	setupFormatFlag(cmd, converterType, bindViper)
-	setupQualityFlag(cmd, qualityDefault, bindViper)
-	setupOverrideFlag(cmd, overrideDefault, bindViper)
-	setupSplitFlag(cmd, splitDefault, bindViper)
+//   - flags: The flag value variables and defaults, see commonFlags
+func setupCommonFlags(cmd *cobra.Command, flags commonFlags) {
+	bindViper := flags.bindViper
+	setupProfileFlag(cmd, bindViper)
+	setupFormatFlag(cmd, flags.converterType, bindViper)
+	setupQualityFlag(cmd, flags.qualityDefault, bindViper)
+	setupWebPModeFlags(cmd, flags.webpMode, bindViper)
+	setupWebPEncoderFlag(cmd, flags.webpEncoder, bindViper)
+	setupTargetQualityFlags(cmd, bindViper)
+	setupContentAwareFlag(cmd, bindViper)
+	setupOverrideFlag(cmd, flags.overrideDefault, bindViper)
+	setupIncludeArchivesFlag(cmd, bindViper)
+	setupFolderFlags(cmd, bindViper)
+	setupSplitFlag(cmd, flags.splitDefault, bindViper)
+	setupSliceFlags(cmd, bindViper)
+	setupWebtoonFlag(cmd, bindViper)
+	setupRemovePagesFlags(cmd, bindViper)
+	setupResizeFlags(cmd, bindViper)
+	setupGrayscaleFlags(cmd, bindViper)
+	setupEnhanceFlags(cmd, bindViper)
+	setupQuantizeFlags(cmd, flags.dither, bindViper)
+	setupAutoCropFlags(cmd, bindViper)
+	setupSpreadFlags(cmd, flags.readingDirection, bindViper)
+	setupFlattenAnimationsFlag(cmd, bindViper)
+	setupKeepICCFlag(cmd, bindViper)
+	setupCoverFlags(cmd, bindViper)
+	setupKeepSmallerFlags(cmd, bindViper)
+	setupMaxSizeFlag(cmd, bindViper)
 	setupKeepFilenamesFlag(cmd, false, bindViper)
+	setupLegacyPageOrderFlag(cmd, bindViper)
 	setupTimeoutFlag(cmd, bindViper)
 }
@@ -7,26 +7,40 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/belphemur/CBZOptimizer/v2/internal/cbz"
+	"github.com/belphemur/CBZOptimizer/v2/internal/pagefilter"
 	utils2 "github.com/belphemur/CBZOptimizer/v2/internal/utils"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
 var converterType constant.ConversionFormat
+var webpMode constant.WebPMode
+var webpEncoder constant.WebPEncoder
+var readingDirection constant.ReadingDirection
+var dither constant.Dither
 
 func init() {
 	command := &cobra.Command{
 		Use:   "optimize [folder]",
-		Short: "Optimize all CBZ/CBR files in a folder recursively",
-		Long:  "Optimize all CBZ/CBR files in a folder recursively.\nIt will take all the different pages in the CBZ/CBR files and convert them to the given format.\nThe original CBZ/CBR files will be kept intact depending if you choose to override or not.",
+		Short: "Optimize all CBZ/CBR/CB7/CBT files in a folder recursively",
+		Long:  "Optimize all CBZ/CBR/CB7/CBT files in a folder recursively.\nIt will take all the different pages in the CBZ/CBR/CB7/CBT files and convert them to the given format.\nThe original files will be kept intact depending if you choose to override or not.",
 		RunE:  ConvertCbzCommand,
 		Args:  cobra.ExactArgs(1),
 	}
 
-	// Setup common flags (format, quality, override, split, timeout)
-	setupCommonFlags(command, &converterType, 85, false, false, false)
+	// Setup common flags (format, quality, webp-mode, override, split, timeout)
+	setupCommonFlags(command, commonFlags{
+		converterType:    &converterType,
+		webpMode:         &webpMode,
+		webpEncoder:      &webpEncoder,
+		readingDirection: &readingDirection,
+		dither:           &dither,
+		qualityDefault:   85,
+	})
 
 	// Setup optimize-specific flags
 	command.Flags().IntP("parallelism", "n", 2, "Number of chapters to convert in parallel")
@@ -52,6 +66,16 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 
 	log.Debug().Msg("Parsing command-line flags")
 
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse profile flag")
+		return fmt.Errorf("invalid profile value")
+	}
+	if err := applyProfile(cmd, profile, cmd.Flags().Changed); err != nil {
+		log.Error().Err(err).Str("profile", profile).Msg("Failed to apply profile")
+		return err
+	}
+
 	quality, err := cmd.Flags().GetUint8("quality")
 	if err != nil || quality <= 0 || quality > 100 {
 		log.Error().Err(err).Uint8("quality", quality).Msg("Invalid quality value")
@@ -59,6 +83,13 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Uint8("quality", quality).Msg("Quality parameter validated")
 
+	nearLosslessLevel, err := cmd.Flags().GetUint8("near-lossless-level")
+	if err != nil || nearLosslessLevel > 100 {
+		log.Error().Err(err).Uint8("near_lossless_level", nearLosslessLevel).Msg("Invalid near-lossless-level value")
+		return fmt.Errorf("invalid near-lossless-level value")
+	}
+	log.Debug().Str("webp_mode", webpMode.String()).Str("webp_encoder", webpEncoder.String()).Uint8("near_lossless_level", nearLosslessLevel).Msg("WebP mode parameters validated")
+
 	override, err := cmd.Flags().GetBool("override")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse override flag")
@@ -66,6 +97,29 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Bool("override", override).Msg("Override parameter parsed")
 
+	includeArchives, err := cmd.Flags().GetBool("include-archives")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse include-archives flag")
+		return fmt.Errorf("invalid include-archives value")
+	}
+	log.Debug().Bool("include-archives", includeArchives).Msg("Include-archives parameter parsed")
+
+	folders, err := cmd.Flags().GetBool("folders")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse folders flag")
+		return fmt.Errorf("invalid folders value")
+	}
+	removeFolders, err := cmd.Flags().GetBool("remove-folders")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse remove-folders flag")
+		return fmt.Errorf("invalid remove-folders value")
+	}
+	if err := validateFolders(folders, removeFolders); err != nil {
+		log.Error().Err(err).Bool("folders", folders).Bool("remove_folders", removeFolders).Msg("Invalid folder parameters")
+		return err
+	}
+	log.Debug().Bool("folders", folders).Bool("remove_folders", removeFolders).Msg("Folder parameters validated")
+
 	split, err := cmd.Flags().GetBool("split")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse split flag")
@@ -73,6 +127,232 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Bool("split", split).Msg("Split parameter parsed")
 
+	splitHeight, err := cmd.Flags().GetInt("split-height")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse split-height flag")
+		return fmt.Errorf("invalid split-height value")
+	}
+	sliceHeight, err := cmd.Flags().GetInt("slice-height")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse slice-height flag")
+		return fmt.Errorf("invalid slice-height value")
+	}
+	sliceOverlap, err := cmd.Flags().GetInt("slice-overlap")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse slice-overlap flag")
+		return fmt.Errorf("invalid slice-overlap value")
+	}
+	if err := validateSlices(splitHeight, sliceHeight, sliceOverlap); err != nil {
+		log.Error().Err(err).Int("split_height", splitHeight).Int("slice_height", sliceHeight).Int("slice_overlap", sliceOverlap).Msg("Invalid slice values")
+		return err
+	}
+	log.Debug().Int("split_height", splitHeight).Int("slice_height", sliceHeight).Int("slice_overlap", sliceOverlap).Msg("Slice parameters parsed")
+
+	webtoon, err := cmd.Flags().GetBool("webtoon")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse webtoon flag")
+		return fmt.Errorf("invalid webtoon value")
+	}
+	log.Debug().Bool("webtoon", webtoon).Msg("Webtoon parameter parsed")
+
+	removeBlank, err := cmd.Flags().GetBool("remove-blank")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse remove-blank flag")
+		return fmt.Errorf("invalid remove-blank value")
+	}
+	removeLike, err := cmd.Flags().GetStringSlice("remove-like")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse remove-like flag")
+		return fmt.Errorf("invalid remove-like value")
+	}
+	removeDistance, err := cmd.Flags().GetInt("remove-distance")
+	if err != nil || removeDistance < 0 || removeDistance > 64 {
+		log.Error().Err(err).Int("remove_distance", removeDistance).Msg("Failed to parse remove-distance flag")
+		return fmt.Errorf("invalid remove-distance value")
+	}
+	pageFilter, err := pagefilter.New(removeBlank, removeLike, removeDistance)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load reference images")
+		return err
+	}
+	log.Debug().Bool("remove_blank", removeBlank).Strs("remove_like", removeLike).Int("remove_distance", removeDistance).Msg("Page removal parameters parsed")
+
+	targetSSIM, err := cmd.Flags().GetFloat64("target-ssim")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse target-ssim flag")
+		return fmt.Errorf("invalid target-ssim value")
+	}
+	minQuality, err := cmd.Flags().GetUint8("min-quality")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse min-quality flag")
+		return fmt.Errorf("invalid min-quality value")
+	}
+	maxQuality, err := cmd.Flags().GetUint8("max-quality")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse max-quality flag")
+		return fmt.Errorf("invalid max-quality value")
+	}
+	if err := validateTargetQuality(targetSSIM, minQuality, maxQuality); err != nil {
+		log.Error().Err(err).Float64("target_ssim", targetSSIM).Uint8("min_quality", minQuality).Uint8("max_quality", maxQuality).Msg("Invalid target quality parameters")
+		return err
+	}
+	log.Debug().Float64("target_ssim", targetSSIM).Uint8("min_quality", minQuality).Uint8("max_quality", maxQuality).Msg("Target quality parameters validated")
+
+	contentAware, err := cmd.Flags().GetBool("content-aware")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse content-aware flag")
+		return fmt.Errorf("invalid content-aware value")
+	}
+	log.Debug().Bool("content_aware", contentAware).Msg("Content-aware parameter parsed")
+
+	maxWidth, err := cmd.Flags().GetInt("max-width")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse max-width flag")
+		return fmt.Errorf("invalid max-width value")
+	}
+	maxHeight, err := cmd.Flags().GetInt("max-height")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse max-height flag")
+		return fmt.Errorf("invalid max-height value")
+	}
+	maxMegapixels, err := cmd.Flags().GetFloat64("max-megapixels")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse max-megapixels flag")
+		return fmt.Errorf("invalid max-megapixels value")
+	}
+	if err := validateResize(maxWidth, maxHeight, maxMegapixels); err != nil {
+		log.Error().Err(err).Int("max_width", maxWidth).Int("max_height", maxHeight).Float64("max_megapixels", maxMegapixels).Msg("Invalid resize parameters")
+		return err
+	}
+	log.Debug().Int("max_width", maxWidth).Int("max_height", maxHeight).Float64("max_megapixels", maxMegapixels).Msg("Resize parameters validated")
+
+	grayscale, err := cmd.Flags().GetBool("grayscale")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse grayscale flag")
+		return fmt.Errorf("invalid grayscale value")
+	}
+	detectGrayscale, err := cmd.Flags().GetBool("detect-grayscale")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse detect-grayscale flag")
+		return fmt.Errorf("invalid detect-grayscale value")
+	}
+	grayscaleTolerance, err := cmd.Flags().GetUint8("grayscale-tolerance")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse grayscale-tolerance flag")
+		return fmt.Errorf("invalid grayscale-tolerance value")
+	}
+	log.Debug().Bool("grayscale", grayscale).Bool("detect_grayscale", detectGrayscale).Uint8("grayscale_tolerance", grayscaleTolerance).Msg("Grayscale parameters parsed")
+
+	autoLevels, err := cmd.Flags().GetBool("auto-levels")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse auto-levels flag")
+		return fmt.Errorf("invalid auto-levels value")
+	}
+	levelsClip, err := cmd.Flags().GetFloat64("levels-clip")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse levels-clip flag")
+		return fmt.Errorf("invalid levels-clip value")
+	}
+	gamma, err := cmd.Flags().GetFloat64("gamma")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse gamma flag")
+		return fmt.Errorf("invalid gamma value")
+	}
+	if err := validateEnhance(levelsClip, gamma); err != nil {
+		log.Error().Err(err).Float64("levels_clip", levelsClip).Float64("gamma", gamma).Msg("Invalid enhancement parameters")
+		return err
+	}
+	log.Debug().Bool("auto_levels", autoLevels).Float64("levels_clip", levelsClip).Float64("gamma", gamma).Msg("Enhancement parameters validated")
+
+	grayLevels, err := cmd.Flags().GetInt("gray-levels")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse gray-levels flag")
+		return fmt.Errorf("invalid gray-levels value")
+	}
+	if err := validateGrayLevels(grayLevels); err != nil {
+		log.Error().Err(err).Int("gray_levels", grayLevels).Msg("Invalid gray-levels value")
+		return err
+	}
+	log.Debug().Int("gray_levels", grayLevels).Str("dither", dither.String()).Msg("Quantization parameters parsed")
+
+	autoCrop, err := cmd.Flags().GetBool("auto-crop")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse auto-crop flag")
+		return fmt.Errorf("invalid auto-crop value")
+	}
+	autoCropThreshold, err := cmd.Flags().GetUint8("auto-crop-threshold")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse auto-crop-threshold flag")
+		return fmt.Errorf("invalid auto-crop-threshold value")
+	}
+	autoCropMargin, err := cmd.Flags().GetInt("auto-crop-margin")
+	if err != nil || autoCropMargin < 0 {
+		log.Error().Err(err).Int("auto_crop_margin", autoCropMargin).Msg("Invalid auto-crop-margin value")
+		return fmt.Errorf("invalid auto-crop-margin value")
+	}
+	log.Debug().Bool("auto_crop", autoCrop).Uint8("auto_crop_threshold", autoCropThreshold).Int("auto_crop_margin", autoCropMargin).Msg("Auto-crop parameters parsed")
+
+	splitSpreads, err := cmd.Flags().GetBool("split-spreads")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse split-spreads flag")
+		return fmt.Errorf("invalid split-spreads value")
+	}
+	keepSpreads, err := cmd.Flags().GetBool("keep-spreads")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse keep-spreads flag")
+		return fmt.Errorf("invalid keep-spreads value")
+	}
+	log.Debug().Bool("split_spreads", splitSpreads).Str("reading_direction", readingDirection.String()).Bool("keep_spreads", keepSpreads).Msg("Spread parameters parsed")
+
+	flattenAnimations, err := cmd.Flags().GetBool("flatten-animations")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse flatten-animations flag")
+		return fmt.Errorf("invalid flatten-animations value")
+	}
+	log.Debug().Bool("flatten_animations", flattenAnimations).Msg("Flatten-animations parameter parsed")
+
+	keepICC, err := cmd.Flags().GetBool("keep-icc")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse keep-icc flag")
+		return fmt.Errorf("invalid keep-icc value")
+	}
+	log.Debug().Bool("keep_icc", keepICC).Msg("Keep-icc parameter parsed")
+
+	coverQuality, err := cmd.Flags().GetUint8("cover-quality")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse cover-quality flag")
+		return fmt.Errorf("invalid cover-quality value")
+	}
+	coverFormat, err := cmd.Flags().GetString("cover-format")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse cover-format flag")
+		return fmt.Errorf("invalid cover-format value")
+	}
+	coverNoDownscale, err := cmd.Flags().GetBool("cover-no-downscale")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse cover-no-downscale flag")
+		return fmt.Errorf("invalid cover-no-downscale value")
+	}
+	cover, err := newCoverOptions(coverQuality, coverFormat, coverNoDownscale, webpEncoder)
+	if err != nil {
+		log.Error().Err(err).Uint8("cover_quality", coverQuality).Str("cover_format", coverFormat).Msg("Invalid cover parameters")
+		return err
+	}
+	log.Debug().Uint8("cover_quality", coverQuality).Str("cover_format", coverFormat).Bool("cover_no_downscale", coverNoDownscale).Msg("Cover parameters parsed")
+
+	keepSmaller, err := cmd.Flags().GetBool("keep-smaller")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse keep-smaller flag")
+		return fmt.Errorf("invalid keep-smaller value")
+	}
+
+	minSavings, err := cmd.Flags().GetUint8("min-savings")
+	if err != nil || minSavings > 100 {
+		log.Error().Err(err).Uint8("min_savings", minSavings).Msg("Invalid min-savings value")
+		return fmt.Errorf("invalid min-savings value")
+	}
+	log.Debug().Bool("keep_smaller", keepSmaller).Uint8("min_savings", minSavings).Msg("Keep-smaller parameters parsed")
+
 	keepFilenames, err := cmd.Flags().GetBool("keep-filenames")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse keep-filenames flag")
@@ -80,6 +360,25 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	}
 	log.Debug().Bool("keep-filenames", keepFilenames).Msg("Keep-filenames parameter parsed")
 
+	legacyPageOrder, err := cmd.Flags().GetBool("legacy-page-order")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse legacy-page-order flag")
+		return fmt.Errorf("invalid legacy-page-order value")
+	}
+	log.Debug().Bool("legacy-page-order", legacyPageOrder).Msg("Legacy-page-order parameter parsed")
+
+	maxSizeFlag, err := cmd.Flags().GetString("max-size")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse max-size flag")
+		return fmt.Errorf("invalid max-size value")
+	}
+	maxSize, err := utils2.ParseSize(maxSizeFlag)
+	if err != nil {
+		log.Error().Err(err).Str("max_size", maxSizeFlag).Msg("Invalid max-size value")
+		return fmt.Errorf("invalid max-size value: %w", err)
+	}
+	log.Debug().Int64("max_size", maxSize).Msg("Max-size parameter parsed")
+
 	timeout, err := cmd.Flags().GetDuration("timeout")
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse timeout flag")
@@ -103,7 +402,7 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	log.Debug().Str("converter_format", converterType.String()).Msg("Converter initialized successfully")
 
 	log.Debug().Msg("Preparing converter")
-	err = chapterConverter.PrepareConverter()
+	err = prepareConverter(chapterConverter, webpEncoder)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to prepare converter")
 		return fmt.Errorf("failed to prepare converter: %v", err)
@@ -131,11 +430,50 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 				err := utils2.Optimize(&utils2.OptimizeOptions{
 					ChapterConverter: chapterConverter,
 					Path:             path,
-					Quality:          quality,
-					Override:         override,
-					Split:            split,
-					KeepFilenames:    keepFilenames,
-					Timeout:          timeout,
+					Conversion: options.Conversion{
+						Quality:            quality,
+						Split:              split,
+						SplitHeight:        splitHeight,
+						SliceHeight:        sliceHeight,
+						SliceOverlap:       sliceOverlap,
+						WebPMode:           webpMode,
+						WebPEncoder:        webpEncoder,
+						NearLosslessLevel:  nearLosslessLevel,
+						TargetSSIM:         targetSSIM,
+						MinQuality:         minQuality,
+						MaxQuality:         maxQuality,
+						ContentAware:       contentAware,
+						MaxWidth:           maxWidth,
+						MaxHeight:          maxHeight,
+						MaxMegapixels:      maxMegapixels,
+						Grayscale:          grayscale,
+						DetectGrayscale:    detectGrayscale,
+						GrayscaleTolerance: grayscaleTolerance,
+						AutoLevels:         autoLevels,
+						LevelsClip:         levelsClip,
+						Gamma:              gamma,
+						GrayLevels:         grayLevels,
+						Dither:             dither,
+						AutoCrop:           autoCrop,
+						AutoCropThreshold:  autoCropThreshold,
+						AutoCropMargin:     autoCropMargin,
+						SplitSpreads:       splitSpreads,
+						ReadingDirection:   readingDirection,
+						KeepSpreads:        keepSpreads,
+						FlattenAnimations:  flattenAnimations,
+						KeepICC:            keepICC,
+						KeepSmaller:        keepSmaller,
+						MinSavingsPercent:  minSavings,
+					},
+					Override:        override,
+					KeepFilenames:   keepFilenames,
+					RemoveFolder:    removeFolders,
+					LegacyPageOrder: legacyPageOrder,
+					Webtoon:         webtoon,
+					PageFilter:      pageFilter,
+					Cover:           cover,
+					Timeout:         timeout,
+					MaxSize:         maxSize,
 				})
 				if err != nil {
 					log.Error().Int("worker_id", workerID).Str("file_path", path).Err(err).Msg("Worker encountered error")
@@ -152,17 +490,26 @@ func ConvertCbzCommand(cmd *cobra.Command, args []string) error {
 	log.Debug().Int("worker_count", parallelism).Msg("All worker goroutines started")
 
 	// Walk the path and send files to the channel
-	log.Debug().Str("search_path", path).Msg("Starting filesystem walk for CBZ/CBR files")
+	log.Debug().Str("search_path", path).Msg("Starting filesystem walk for comic archives")
 	err = filepath.WalkDir(path, func(filePath string, info os.DirEntry, err error) error {
 		if err != nil {
 			log.Error().Str("file_path", filePath).Err(err).Msg("Error during filesystem walk")
 			return err
 		}
 
+		// A folder of images is a chapter; its files are not walked
+		// since the folder may be removed once converted. The input path
+		// itself is not one: it is where the CBZ would be written from.
+		if info.IsDir() && folders && filePath != path && cbz.IsImageFolder(filePath) {
+			log.Debug().Str("file_path", filePath).Msg("Found image folder")
+			fileChan <- filePath
+			return filepath.SkipDir
+		}
+
 		if !info.IsDir() {
 			fileName := strings.ToLower(info.Name())
-			if strings.HasSuffix(fileName, ".cbz") || strings.HasSuffix(fileName, ".cbr") {
-				log.Debug().Str("file_path", filePath).Str("file_name", fileName).Msg("Found CBZ/CBR file")
+			if cbz.IsChapterArchive(fileName, includeArchives) {
+				log.Debug().Str("file_path", filePath).Str("file_name", fileName).Msg("Found comic archive")
 				fileChan <- filePath
 			}
 		}
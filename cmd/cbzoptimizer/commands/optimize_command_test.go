@@ -15,13 +15,14 @@ import (
 	"github.com/belphemur/CBZOptimizer/v2/internal/utils/errs"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/spf13/cobra"
 )
 
 // MockConverter is a mock implementation of the Converter interface
 type MockConverter struct{}
 
-func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
 	chapter.IsConverted = true
 	chapter.ConvertedTime = time.Now()
 	return chapter, nil
@@ -83,11 +84,33 @@ func TestConvertCbzCommand(t *testing.T) {
 		Use: "optimize",
 	}
 	cmd.Flags().Uint8P("quality", "q", 85, "Quality for conversion (0-100)")
+	setupWebPModeFlags(cmd, &webpMode, false)
+	setupWebPEncoderFlag(cmd, &webpEncoder, false)
+	setupTargetQualityFlags(cmd, false)
+	setupContentAwareFlag(cmd, false)
 	cmd.Flags().IntP("parallelism", "n", 2, "Number of chapters to convert in parallel")
 	cmd.Flags().BoolP("override", "o", false, "Override the original CBZ/CBR files")
+	setupIncludeArchivesFlag(cmd, false)
+	setupFolderFlags(cmd, false)
 	cmd.Flags().BoolP("split", "s", false, "Split long pages into smaller chunks")
+	setupSliceFlags(cmd, false)
+	setupWebtoonFlag(cmd, false)
+	setupRemovePagesFlags(cmd, false)
+	setupResizeFlags(cmd, false)
+	setupGrayscaleFlags(cmd, false)
+	setupEnhanceFlags(cmd, false)
+	setupQuantizeFlags(cmd, &dither, false)
+	setupAutoCropFlags(cmd, false)
+	setupSpreadFlags(cmd, &readingDirection, false)
+	setupFlattenAnimationsFlag(cmd, false)
+	setupKeepICCFlag(cmd, false)
+	setupCoverFlags(cmd, false)
+	setupProfileFlag(cmd, false)
+	setupKeepSmallerFlags(cmd, false)
 	cmd.Flags().Bool("keep-filenames", false, "Preserve original page filenames instead of renumbering to sequential indices")
+	setupLegacyPageOrderFlag(cmd, false)
 	cmd.Flags().DurationP("timeout", "t", 0, "Maximum time allowed for converting a single chapter (e.g., 30s, 5m, 1h). 0 means no timeout")
+	setupMaxSizeFlag(cmd, false)
 
 	// Execute the command
 	err = ConvertCbzCommand(cmd, []string{tempDir})
@@ -195,11 +218,33 @@ func setupTestCommand(t *testing.T) (*cobra.Command, func()) {
 		Use: "optimize",
 	}
 	cmd.Flags().Uint8P("quality", "q", 85, "Quality for conversion (0-100)")
+	setupWebPModeFlags(cmd, &webpMode, false)
+	setupWebPEncoderFlag(cmd, &webpEncoder, false)
+	setupTargetQualityFlags(cmd, false)
+	setupContentAwareFlag(cmd, false)
 	cmd.Flags().IntP("parallelism", "n", 1, "Number of chapters to convert in parallel")
 	cmd.Flags().BoolP("override", "o", false, "Override the original CBZ/CBR files")
+	setupIncludeArchivesFlag(cmd, false)
+	setupFolderFlags(cmd, false)
 	cmd.Flags().BoolP("split", "s", false, "Split long pages into smaller chunks")
+	setupSliceFlags(cmd, false)
+	setupWebtoonFlag(cmd, false)
+	setupRemovePagesFlags(cmd, false)
+	setupResizeFlags(cmd, false)
+	setupGrayscaleFlags(cmd, false)
+	setupEnhanceFlags(cmd, false)
+	setupQuantizeFlags(cmd, &dither, false)
+	setupAutoCropFlags(cmd, false)
+	setupSpreadFlags(cmd, &readingDirection, false)
+	setupFlattenAnimationsFlag(cmd, false)
+	setupKeepICCFlag(cmd, false)
+	setupCoverFlags(cmd, false)
+	setupProfileFlag(cmd, false)
+	setupKeepSmallerFlags(cmd, false)
 	cmd.Flags().Bool("keep-filenames", false, "Preserve original page filenames instead of renumbering to sequential indices")
+	setupLegacyPageOrderFlag(cmd, false)
 	cmd.Flags().DurationP("timeout", "t", 0, "Maximum time allowed for converting a single chapter")
+	setupMaxSizeFlag(cmd, false)
 
 	// Reset converterType to default before test for consistency
 	converterType = constant.DefaultConversion
@@ -432,11 +477,33 @@ func TestConvertCbzCommand_ManyFiles_NoDeadlock(t *testing.T) {
 		Use: "optimize",
 	}
 	cmd.Flags().Uint8P("quality", "q", 85, "Quality for conversion (0-100)")
+	setupWebPModeFlags(cmd, &webpMode, false)
+	setupWebPEncoderFlag(cmd, &webpEncoder, false)
+	setupTargetQualityFlags(cmd, false)
+	setupContentAwareFlag(cmd, false)
 	cmd.Flags().IntP("parallelism", "n", 2, "Number of chapters to convert in parallel")
 	cmd.Flags().BoolP("override", "o", false, "Override the original CBZ/CBR files")
+	setupIncludeArchivesFlag(cmd, false)
+	setupFolderFlags(cmd, false)
 	cmd.Flags().BoolP("split", "s", false, "Split long pages into smaller chunks")
+	setupSliceFlags(cmd, false)
+	setupWebtoonFlag(cmd, false)
+	setupRemovePagesFlags(cmd, false)
+	setupResizeFlags(cmd, false)
+	setupGrayscaleFlags(cmd, false)
+	setupEnhanceFlags(cmd, false)
+	setupQuantizeFlags(cmd, &dither, false)
+	setupAutoCropFlags(cmd, false)
+	setupSpreadFlags(cmd, &readingDirection, false)
+	setupFlattenAnimationsFlag(cmd, false)
+	setupKeepICCFlag(cmd, false)
+	setupCoverFlags(cmd, false)
+	setupProfileFlag(cmd, false)
+	setupKeepSmallerFlags(cmd, false)
 	cmd.Flags().Bool("keep-filenames", false, "Preserve original page filenames instead of renumbering to sequential indices")
+	setupLegacyPageOrderFlag(cmd, false)
 	cmd.Flags().DurationP("timeout", "t", 0, "Maximum time allowed for converting a single chapter")
+	setupMaxSizeFlag(cmd, false)
 
 	converterType = constant.DefaultConversion
 	setupFormatFlag(cmd, &converterType, false)
@@ -535,11 +602,33 @@ func TestConvertCbzCommand_HighParallelism_NoDeadlock(t *testing.T) {
 		Use: "optimize",
 	}
 	cmd.Flags().Uint8P("quality", "q", 85, "Quality for conversion (0-100)")
+	setupWebPModeFlags(cmd, &webpMode, false)
+	setupWebPEncoderFlag(cmd, &webpEncoder, false)
+	setupTargetQualityFlags(cmd, false)
+	setupContentAwareFlag(cmd, false)
 	cmd.Flags().IntP("parallelism", "n", 8, "Number of chapters to convert in parallel")
 	cmd.Flags().BoolP("override", "o", false, "Override the original CBZ/CBR files")
+	setupIncludeArchivesFlag(cmd, false)
+	setupFolderFlags(cmd, false)
 	cmd.Flags().BoolP("split", "s", false, "Split long pages into smaller chunks")
+	setupSliceFlags(cmd, false)
+	setupWebtoonFlag(cmd, false)
+	setupRemovePagesFlags(cmd, false)
+	setupResizeFlags(cmd, false)
+	setupGrayscaleFlags(cmd, false)
+	setupEnhanceFlags(cmd, false)
+	setupQuantizeFlags(cmd, &dither, false)
+	setupAutoCropFlags(cmd, false)
+	setupSpreadFlags(cmd, &readingDirection, false)
+	setupFlattenAnimationsFlag(cmd, false)
+	setupKeepICCFlag(cmd, false)
+	setupCoverFlags(cmd, false)
+	setupProfileFlag(cmd, false)
+	setupKeepSmallerFlags(cmd, false)
 	cmd.Flags().Bool("keep-filenames", false, "Preserve original page filenames instead of renumbering to sequential indices")
+	setupLegacyPageOrderFlag(cmd, false)
 	cmd.Flags().DurationP("timeout", "t", 0, "Maximum time allowed for converting a single chapter")
+	setupMaxSizeFlag(cmd, false)
 
 	converterType = constant.DefaultConversion
 	setupFormatFlag(cmd, &converterType, false)
@@ -558,3 +647,215 @@ func TestConvertCbzCommand_HighParallelism_NoDeadlock(t *testing.T) {
 		t.Fatal("Deadlock detected with high parallelism")
 	}
 }
+
+func TestValidateTargetQuality(t *testing.T) {
+	tests := []struct {
+		name        string
+		targetSSIM  float64
+		minQuality  uint8
+		maxQuality  uint8
+		expectError bool
+	}{
+		{name: "disabled", targetSSIM: 0, minQuality: 50, maxQuality: 95},
+		{name: "valid target", targetSSIM: 0.98, minQuality: 50, maxQuality: 95},
+		{name: "single quality", targetSSIM: 0.98, minQuality: 80, maxQuality: 80},
+		{name: "negative target", targetSSIM: -0.1, minQuality: 50, maxQuality: 95, expectError: true},
+		{name: "target of one", targetSSIM: 1, minQuality: 50, maxQuality: 95, expectError: true},
+		{name: "inverted range", targetSSIM: 0.98, minQuality: 90, maxQuality: 60, expectError: true},
+		{name: "max above 100", targetSSIM: 0.98, minQuality: 50, maxQuality: 101, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTargetQuality(tt.targetSSIM, tt.minQuality, tt.maxQuality)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateFolders(t *testing.T) {
+	tests := []struct {
+		name          string
+		folders       bool
+		removeFolders bool
+		expectError   bool
+	}{
+		{name: "disabled"},
+		{name: "folders", folders: true},
+		{name: "folders removed", folders: true, removeFolders: true},
+		{name: "remove without folders", removeFolders: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFolders(tt.folders, tt.removeFolders)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestConvertCbzCommand_FoldersSkipInputPath checks that an input path that
+// is itself a folder of images is neither converted nor removed with
+// --folders --remove-folders: only the folders below it are chapters.
+func TestConvertCbzCommand_FoldersSkipInputPath(t *testing.T) {
+	tempDir := t.TempDir()
+	imagePath := filepath.Join(tempDir, "001.png")
+	if err := os.WriteFile(imagePath, []byte("page"), 0644); err != nil {
+		t.Fatalf("Failed to write image: %v", err)
+	}
+
+	originalGet := converter.Get
+	converter.Get = func(format constant.ConversionFormat) (converter.Converter, error) {
+		return &MockConverter{}, nil
+	}
+	defer func() { converter.Get = originalGet }()
+
+	cmd := &cobra.Command{
+		Use: "optimize",
+	}
+	cmd.Flags().Uint8P("quality", "q", 85, "Quality for conversion (0-100)")
+	setupWebPModeFlags(cmd, &webpMode, false)
+	setupWebPEncoderFlag(cmd, &webpEncoder, false)
+	setupTargetQualityFlags(cmd, false)
+	setupContentAwareFlag(cmd, false)
+	cmd.Flags().IntP("parallelism", "n", 1, "Number of chapters to convert in parallel")
+	cmd.Flags().BoolP("override", "o", false, "Override the original CBZ/CBR files")
+	setupIncludeArchivesFlag(cmd, false)
+	setupFolderFlags(cmd, false)
+	cmd.Flags().BoolP("split", "s", false, "Split long pages into smaller chunks")
+	setupSliceFlags(cmd, false)
+	setupWebtoonFlag(cmd, false)
+	setupRemovePagesFlags(cmd, false)
+	setupResizeFlags(cmd, false)
+	setupGrayscaleFlags(cmd, false)
+	setupEnhanceFlags(cmd, false)
+	setupQuantizeFlags(cmd, &dither, false)
+	setupAutoCropFlags(cmd, false)
+	setupSpreadFlags(cmd, &readingDirection, false)
+	setupFlattenAnimationsFlag(cmd, false)
+	setupKeepICCFlag(cmd, false)
+	setupCoverFlags(cmd, false)
+	setupProfileFlag(cmd, false)
+	setupKeepSmallerFlags(cmd, false)
+	cmd.Flags().Bool("keep-filenames", false, "Preserve original page filenames instead of renumbering to sequential indices")
+	setupLegacyPageOrderFlag(cmd, false)
+	cmd.Flags().DurationP("timeout", "t", 0, "Maximum time allowed for converting a single chapter")
+	setupMaxSizeFlag(cmd, false)
+
+	converterType = constant.DefaultConversion
+	setupFormatFlag(cmd, &converterType, false)
+
+	if err := cmd.Flags().Set("folders", "true"); err != nil {
+		t.Fatalf("Failed to set folders flag: %v", err)
+	}
+	if err := cmd.Flags().Set("remove-folders", "true"); err != nil {
+		t.Fatalf("Failed to set remove-folders flag: %v", err)
+	}
+
+	if err := ConvertCbzCommand(cmd, []string{tempDir}); err != nil {
+		t.Fatalf("Command execution failed: %v", err)
+	}
+
+	if _, err := os.Stat(imagePath); err != nil {
+		t.Errorf("Expected the input folder to be kept: %v", err)
+	}
+	if _, err := os.Stat(tempDir + ".cbz"); !os.IsNotExist(err) {
+		t.Errorf("Expected no CBZ to be written for the input folder, got %v", err)
+	}
+}
+
+func TestValidateResize(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxWidth      int
+		maxHeight     int
+		maxMegapixels float64
+		expectError   bool
+	}{
+		{name: "no limits"},
+		{name: "all limits", maxWidth: 1600, maxHeight: 2560, maxMegapixels: 4},
+		{name: "negative width", maxWidth: -1, expectError: true},
+		{name: "negative height", maxHeight: -1, expectError: true},
+		{name: "negative megapixels", maxMegapixels: -0.5, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResize(tt.maxWidth, tt.maxHeight, tt.maxMegapixels)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateSlices(t *testing.T) {
+	tests := []struct {
+		name         string
+		splitHeight  int
+		sliceHeight  int
+		sliceOverlap int
+		expectError  bool
+	}{
+		{name: "defaults", sliceHeight: 2000},
+		{name: "split height and overlap", splitHeight: 6000, sliceHeight: 3000, sliceOverlap: 100},
+		{name: "negative split height", splitHeight: -1, sliceHeight: 2000, expectError: true},
+		{name: "zero slice height", expectError: true},
+		{name: "negative overlap", sliceHeight: 2000, sliceOverlap: -1, expectError: true},
+		{name: "overlap as tall as the slice", sliceHeight: 2000, sliceOverlap: 2000, expectError: true},
+		{name: "parts too tall for WebP", sliceHeight: 16000, sliceOverlap: 500, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSlices(tt.splitHeight, tt.sliceHeight, tt.sliceOverlap)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateEnhance(t *testing.T) {
+	tests := []struct {
+		name        string
+		levelsClip  float64
+		gamma       float64
+		expectError bool
+	}{
+		{name: "defaults", levelsClip: 0.5, gamma: 1},
+		{name: "no clipping, dark gamma", levelsClip: 0, gamma: 0.6},
+		{name: "negative clip", levelsClip: -1, gamma: 1, expectError: true},
+		{name: "clipping half the pixels", levelsClip: 50, gamma: 1, expectError: true},
+		{name: "zero gamma", levelsClip: 0.5, gamma: 0, expectError: true},
+		{name: "gamma too high", levelsClip: 0.5, gamma: 11, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnhance(tt.levelsClip, tt.gamma)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
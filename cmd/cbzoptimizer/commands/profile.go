@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Profile bundles the settings suited to a reading device. Zero values leave
+// the corresponding setting alone, so a profile only needs to list what the
+// device cares about.
+type Profile struct {
+	MaxWidth   int   `mapstructure:"max-width"`
+	MaxHeight  int   `mapstructure:"max-height"`
+	Grayscale  bool  `mapstructure:"grayscale"`
+	GrayLevels int   `mapstructure:"gray-levels"`
+	Quality    uint8 `mapstructure:"quality"`
+	Split      bool  `mapstructure:"split"`
+}
+
+// builtinProfiles are the device profiles available without any
+// configuration. Resolutions are the portrait screen size of each device.
+var builtinProfiles = map[string]Profile{
+	"kindle-paperwhite": {MaxWidth: 1236, MaxHeight: 1648, Grayscale: true, Quality: 80, Split: true},
+	"kobo-clara":        {MaxWidth: 1072, MaxHeight: 1448, Grayscale: true, Quality: 80, Split: true},
+	"kobo-libra":        {MaxWidth: 1264, MaxHeight: 1680, Grayscale: true, Quality: 80, Split: true},
+	"tablet":            {MaxWidth: 1600, MaxHeight: 2560, Quality: 85, Split: true},
+}
+
+// profiles returns the built-in profiles merged with the ones defined under
+// the "profiles" key of the configuration file. A configured profile
+// replaces a built-in one with the same name.
+func profiles() (map[string]Profile, error) {
+	all := make(map[string]Profile, len(builtinProfiles))
+	for name, profile := range builtinProfiles {
+		all[name] = profile
+	}
+
+	var configured map[string]Profile
+	if err := viper.UnmarshalKey("profiles", &configured); err != nil {
+		return nil, fmt.Errorf("invalid profiles configuration: %w", err)
+	}
+	for name, profile := range configured {
+		all[strings.ToLower(name)] = profile
+	}
+	return all, nil
+}
+
+// profileNames returns the sorted names of all known profiles.
+func profileNames(all map[string]Profile) []string {
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// settings returns the flag values the profile sets, keyed by flag name.
+func (p Profile) settings() map[string]string {
+	values := make(map[string]string)
+	if p.MaxWidth > 0 {
+		values["max-width"] = strconv.Itoa(p.MaxWidth)
+	}
+	if p.MaxHeight > 0 {
+		values["max-height"] = strconv.Itoa(p.MaxHeight)
+	}
+	if p.Grayscale {
+		values["grayscale"] = "true"
+	}
+	if p.GrayLevels > 0 {
+		values["gray-levels"] = strconv.Itoa(p.GrayLevels)
+	}
+	if p.Quality > 0 {
+		values["quality"] = strconv.Itoa(int(p.Quality))
+	}
+	if p.Split {
+		values["split"] = "true"
+	}
+	return values
+}
+
+// applyProfile sets the flags of cmd to the values of the named profile.
+// Settings for which isSet returns true were chosen explicitly and are left
+// alone: a profile only replaces defaults. An empty name is a no-op.
+func applyProfile(cmd *cobra.Command, name string, isSet func(key string) bool) error {
+	if name == "" {
+		return nil
+	}
+
+	all, err := profiles()
+	if err != nil {
+		return err
+	}
+	profile, ok := all[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, available profiles: %s", name, strings.Join(profileNames(all), ", "))
+	}
+
+	for key, value := range profile.settings() {
+		if isSet(key) {
+			log.Debug().Str("profile", name).Str("setting", key).Msg("Setting given explicitly, ignoring profile value")
+			continue
+		}
+		if err := cmd.Flags().Set(key, value); err != nil {
+			return fmt.Errorf("failed to apply %s from profile %q: %w", key, name, err)
+		}
+	}
+	log.Debug().Str("profile", name).Msg("Profile applied")
+	return nil
+}
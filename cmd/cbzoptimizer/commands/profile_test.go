@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProfileTestCommand() *cobra.Command {
+	var format constant.ConversionFormat
+	var mode constant.WebPMode
+	var encoder constant.WebPEncoder
+	var direction constant.ReadingDirection
+	var dither constant.Dither
+	cmd := &cobra.Command{Use: "optimize"}
+	setupCommonFlags(cmd, commonFlags{
+		converterType:    &format,
+		webpMode:         &mode,
+		webpEncoder:      &encoder,
+		readingDirection: &direction,
+		dither:           &dither,
+		qualityDefault:   85,
+	})
+	return cmd
+}
+
+func TestApplyProfile_Builtin(t *testing.T) {
+	cmd := newProfileTestCommand()
+	require.NoError(t, applyProfile(cmd, "Kobo-Libra", cmd.Flags().Changed))
+
+	maxWidth, _ := cmd.Flags().GetInt("max-width")
+	maxHeight, _ := cmd.Flags().GetInt("max-height")
+	grayscale, _ := cmd.Flags().GetBool("grayscale")
+	quality, _ := cmd.Flags().GetUint8("quality")
+	split, _ := cmd.Flags().GetBool("split")
+
+	assert.Equal(t, 1264, maxWidth)
+	assert.Equal(t, 1680, maxHeight)
+	assert.True(t, grayscale)
+	assert.Equal(t, uint8(80), quality)
+	assert.True(t, split)
+}
+
+func TestApplyProfile_ExplicitFlagsWin(t *testing.T) {
+	cmd := newProfileTestCommand()
+	require.NoError(t, cmd.Flags().Set("quality", "95"))
+	require.NoError(t, cmd.Flags().Set("max-width", "1000"))
+	require.NoError(t, applyProfile(cmd, "kindle-paperwhite", cmd.Flags().Changed))
+
+	quality, _ := cmd.Flags().GetUint8("quality")
+	maxWidth, _ := cmd.Flags().GetInt("max-width")
+	maxHeight, _ := cmd.Flags().GetInt("max-height")
+
+	assert.Equal(t, uint8(95), quality)
+	assert.Equal(t, 1000, maxWidth)
+	assert.Equal(t, 1648, maxHeight, "settings not given explicitly still come from the profile")
+}
+
+func TestApplyProfile_Configured(t *testing.T) {
+	viper.Set("profiles", map[string]any{
+		"my-reader": map[string]any{"max-width": 800, "quality": 70, "gray-levels": 16},
+		"tablet":    map[string]any{"max-height": 2000},
+	})
+	defer viper.Set("profiles", nil)
+
+	cmd := newProfileTestCommand()
+	require.NoError(t, applyProfile(cmd, "my-reader", cmd.Flags().Changed))
+	maxWidth, _ := cmd.Flags().GetInt("max-width")
+	quality, _ := cmd.Flags().GetUint8("quality")
+	grayscale, _ := cmd.Flags().GetBool("grayscale")
+	grayLevels, _ := cmd.Flags().GetInt("gray-levels")
+	assert.Equal(t, 800, maxWidth)
+	assert.Equal(t, uint8(70), quality)
+	assert.False(t, grayscale)
+	assert.Equal(t, 16, grayLevels)
+
+	// A configured profile replaces the built-in one of the same name.
+	cmd = newProfileTestCommand()
+	require.NoError(t, applyProfile(cmd, "tablet", cmd.Flags().Changed))
+	maxWidth, _ = cmd.Flags().GetInt("max-width")
+	maxHeight, _ := cmd.Flags().GetInt("max-height")
+	assert.Equal(t, 0, maxWidth)
+	assert.Equal(t, 2000, maxHeight)
+}
+
+func TestApplyProfile_Unknown(t *testing.T) {
+	cmd := newProfileTestCommand()
+	err := applyProfile(cmd, "does-not-exist", cmd.Flags().Changed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "kobo-libra")
+}
+
+func TestApplyProfile_Empty(t *testing.T) {
+	cmd := newProfileTestCommand()
+	require.NoError(t, applyProfile(cmd, "", cmd.Flags().Changed))
+	assert.False(t, cmd.Flags().Changed("quality"))
+	assert.False(t, cmd.Flags().Changed("max-width"))
+}
@@ -7,14 +7,17 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
 
+	"github.com/belphemur/CBZOptimizer/v2/internal/cbz"
+	"github.com/belphemur/CBZOptimizer/v2/internal/pagefilter"
 	utils2 "github.com/belphemur/CBZOptimizer/v2/internal/utils"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -32,21 +35,30 @@ func init() {
 	}
 	command := &cobra.Command{
 		Use:   "watch [folder]",
-		Short: "Watch a folder for new CBZ/CBR files",
-		Long:  "Watch a folder for new CBZ/CBR files.\nIt will watch a folder for new CBZ/CBR files and optimize them.",
+		Short: "Watch a folder for new CBZ/CBR/CB7/CBT files",
+		Long:  "Watch a folder for new CBZ/CBR/CB7/CBT files.\nIt will watch a folder for new CBZ/CBR/CB7/CBT files and optimize them.",
 		RunE:  WatchCommand,
 		Args:  cobra.ExactArgs(1),
 	}
 
-	// Setup common flags (format, quality, override, split, timeout) with viper binding
-	setupCommonFlags(command, &converterType, 85, true, false, true)
+	// Setup common flags (format, quality, webp-mode, override, split, timeout) with viper binding
+	setupCommonFlags(command, commonFlags{
+		converterType:    &converterType,
+		webpMode:         &webpMode,
+		webpEncoder:      &webpEncoder,
+		readingDirection: &readingDirection,
+		dither:           &dither,
+		qualityDefault:   85,
+		overrideDefault:  true,
+		bindViper:        true,
+	})
 
-	command.Flags().Bool("backfill", false, "Optimize CBZ/CBR files that already exist in the watched folder at startup, before watching for new changes")
+	command.Flags().Bool("backfill", false, "Optimize comic archives that already exist in the watched folder at startup, before watching for new changes")
 	_ = viper.BindPFlag("backfill", command.Flags().Lookup("backfill"))
 
 	AddCommand(command)
 }
-func WatchCommand(_ *cobra.Command, args []string) error {
+func WatchCommand(cmd *cobra.Command, args []string) error {
 	path := args[0]
 	if path == "" {
 		return fmt.Errorf("path is required")
@@ -56,19 +68,124 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 		return fmt.Errorf("the path needs to be a folder")
 	}
 
+	profile := viper.GetString("profile")
+	if err := applyProfile(cmd, profile, viper.IsSet); err != nil {
+		return err
+	}
+
 	quality := uint8(viper.GetUint16("quality"))
 	if quality <= 0 || quality > 100 {
 		return fmt.Errorf("invalid quality value")
 	}
 
+	webpMode := constant.FindWebPMode(viper.GetString("webp-mode"))
+	webpEncoder := constant.FindWebPEncoder(viper.GetString("webp-encoder"))
+
+	nearLosslessLevel := viper.GetUint8("near-lossless-level")
+	if nearLosslessLevel > 100 {
+		return fmt.Errorf("invalid near-lossless-level value")
+	}
+
+	targetSSIM := viper.GetFloat64("target-ssim")
+	minQuality := viper.GetUint8("min-quality")
+	maxQuality := viper.GetUint8("max-quality")
+	if err := validateTargetQuality(targetSSIM, minQuality, maxQuality); err != nil {
+		return err
+	}
+	contentAware := viper.GetBool("content-aware")
+
+	maxWidth := viper.GetInt("max-width")
+	maxHeight := viper.GetInt("max-height")
+	maxMegapixels := viper.GetFloat64("max-megapixels")
+	if err := validateResize(maxWidth, maxHeight, maxMegapixels); err != nil {
+		return err
+	}
+
+	grayscale := viper.GetBool("grayscale")
+	detectGrayscale := viper.GetBool("detect-grayscale")
+	grayscaleTolerance := viper.GetUint8("grayscale-tolerance")
+
+	autoLevels := viper.GetBool("auto-levels")
+	levelsClip := viper.GetFloat64("levels-clip")
+	gamma := viper.GetFloat64("gamma")
+	if err := validateEnhance(levelsClip, gamma); err != nil {
+		return err
+	}
+
+	grayLevels := viper.GetInt("gray-levels")
+	if err := validateGrayLevels(grayLevels); err != nil {
+		return err
+	}
+	dither := constant.FindDither(viper.GetString("dither"))
+
+	autoCrop := viper.GetBool("auto-crop")
+	autoCropThreshold := viper.GetUint8("auto-crop-threshold")
+	autoCropMargin := viper.GetInt("auto-crop-margin")
+	if autoCropMargin < 0 {
+		return fmt.Errorf("invalid auto-crop-margin value")
+	}
+
+	splitSpreads := viper.GetBool("split-spreads")
+	readingDirection := constant.FindReadingDirection(viper.GetString("reading-direction"))
+	keepSpreads := viper.GetBool("keep-spreads")
+
+	flattenAnimations := viper.GetBool("flatten-animations")
+
+	keepICC := viper.GetBool("keep-icc")
+
+	coverQuality := viper.GetUint8("cover-quality")
+	coverFormat := viper.GetString("cover-format")
+	coverNoDownscale := viper.GetBool("cover-no-downscale")
+	cover, err := newCoverOptions(coverQuality, coverFormat, coverNoDownscale, webpEncoder)
+	if err != nil {
+		return err
+	}
+
+	keepSmaller := viper.GetBool("keep-smaller")
+
+	minSavings := viper.GetUint8("min-savings")
+	if minSavings > 100 {
+		return fmt.Errorf("invalid min-savings value")
+	}
+
 	override := viper.GetBool("override")
+	includeArchives := viper.GetBool("include-archives")
+	folders := viper.GetBool("folders")
+	removeFolders := viper.GetBool("remove-folders")
+	if err := validateFolders(folders, removeFolders); err != nil {
+		return err
+	}
 
 	split := viper.GetBool("split")
+	splitHeight := viper.GetInt("split-height")
+	sliceHeight := viper.GetInt("slice-height")
+	sliceOverlap := viper.GetInt("slice-overlap")
+	if err := validateSlices(splitHeight, sliceHeight, sliceOverlap); err != nil {
+		return err
+	}
+	webtoon := viper.GetBool("webtoon")
+
+	removeBlank := viper.GetBool("remove-blank")
+	removeLike := viper.GetStringSlice("remove-like")
+	removeDistance := viper.GetInt("remove-distance")
+	if removeDistance < 0 || removeDistance > 64 {
+		return fmt.Errorf("invalid remove-distance value")
+	}
+	pageFilter, err := pagefilter.New(removeBlank, removeLike, removeDistance)
+	if err != nil {
+		return err
+	}
 
 	keepFilenames := viper.GetBool("keep-filenames")
+	legacyPageOrder := viper.GetBool("legacy-page-order")
 
 	timeout := viper.GetDuration("timeout")
 
+	maxSize, err := utils2.ParseSize(viper.GetString("max-size"))
+	if err != nil {
+		return fmt.Errorf("invalid max-size value: %w", err)
+	}
+
 	backfill := viper.GetBool("backfill")
 
 	converterType := constant.FindConversionFormat(viper.GetString("format"))
@@ -77,11 +194,73 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get chapterConverter: %w", err)
 	}
 
-	err = chapterConverter.PrepareConverter()
+	err = prepareConverter(chapterConverter, webpEncoder)
 	if err != nil {
 		return fmt.Errorf("failed to prepare converter: %w", err)
 	}
-	log.Info().Str("path", path).Bool("override", override).Uint8("quality", quality).Str("format", converterType.String()).Bool("split", split).Bool("keep_filenames", keepFilenames).Bool("backfill", backfill).Msg("Watching directory")
+	// The settings are grouped by feature so the line stays readable.
+	log.Info().
+		Str("path", path).
+		Str("profile", profile).
+		Str("format", converterType.String()).
+		Uint8("quality", quality).
+		Bool("override", override).
+		Bool("backfill", backfill).
+		Dict("inputs", zerolog.Dict().
+			Bool("include_archives", includeArchives).
+			Bool("folders", folders).
+			Bool("remove_folders", removeFolders).
+			Bool("keep_filenames", keepFilenames).
+			Bool("legacy_page_order", legacyPageOrder)).
+		Dict("webp", zerolog.Dict().
+			Str("mode", webpMode.String()).
+			Str("encoder", webpEncoder.String()).
+			Uint8("near_lossless_level", nearLosslessLevel).
+			Float64("target_ssim", targetSSIM).
+			Bool("content_aware", contentAware)).
+		Dict("split", zerolog.Dict().
+			Bool("enabled", split).
+			Int("split_height", splitHeight).
+			Int("slice_height", sliceHeight).
+			Int("slice_overlap", sliceOverlap).
+			Bool("webtoon", webtoon)).
+		Dict("spreads", zerolog.Dict().
+			Bool("split", splitSpreads).
+			Str("reading_direction", readingDirection.String()).
+			Bool("keep", keepSpreads)).
+		Dict("remove", zerolog.Dict().
+			Bool("blank", removeBlank).
+			Strs("like", removeLike).
+			Int("distance", removeDistance)).
+		Dict("resize", zerolog.Dict().
+			Int("max_width", maxWidth).
+			Int("max_height", maxHeight).
+			Float64("max_megapixels", maxMegapixels)).
+		Dict("grayscale", zerolog.Dict().
+			Bool("enabled", grayscale).
+			Bool("detect", detectGrayscale).
+			Uint8("tolerance", grayscaleTolerance).
+			Int("gray_levels", grayLevels).
+			Str("dither", dither.String())).
+		Dict("enhance", zerolog.Dict().
+			Bool("auto_levels", autoLevels).
+			Float64("levels_clip", levelsClip).
+			Float64("gamma", gamma)).
+		Dict("auto_crop", zerolog.Dict().
+			Bool("enabled", autoCrop).
+			Uint8("threshold", autoCropThreshold).
+			Int("margin", autoCropMargin)).
+		Dict("cover", zerolog.Dict().
+			Uint8("quality", coverQuality).
+			Str("format", coverFormat).
+			Bool("no_downscale", coverNoDownscale)).
+		Dict("output", zerolog.Dict().
+			Bool("flatten_animations", flattenAnimations).
+			Bool("keep_icc", keepICC).
+			Bool("keep_smaller", keepSmaller).
+			Uint8("min_savings", minSavings).
+			Int64("max_size", maxSize)).
+		Msg("Watching directory")
 
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -97,17 +276,64 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 	// is never blocked waiting on a conversion.
 	queue := newOptimizeQueue(runtime.NumCPU(), &utils2.OptimizeOptions{
 		ChapterConverter: chapterConverter,
-		Quality:          quality,
-		Override:         override,
-		Split:            split,
-		KeepFilenames:    keepFilenames,
-		Timeout:          timeout,
-	})
+		Conversion: options.Conversion{
+			Quality:            quality,
+			Split:              split,
+			SplitHeight:        splitHeight,
+			SliceHeight:        sliceHeight,
+			SliceOverlap:       sliceOverlap,
+			WebPMode:           webpMode,
+			WebPEncoder:        webpEncoder,
+			NearLosslessLevel:  nearLosslessLevel,
+			TargetSSIM:         targetSSIM,
+			MinQuality:         minQuality,
+			MaxQuality:         maxQuality,
+			ContentAware:       contentAware,
+			MaxWidth:           maxWidth,
+			MaxHeight:          maxHeight,
+			MaxMegapixels:      maxMegapixels,
+			Grayscale:          grayscale,
+			DetectGrayscale:    detectGrayscale,
+			GrayscaleTolerance: grayscaleTolerance,
+			AutoLevels:         autoLevels,
+			LevelsClip:         levelsClip,
+			Gamma:              gamma,
+			GrayLevels:         grayLevels,
+			Dither:             dither,
+			AutoCrop:           autoCrop,
+			AutoCropThreshold:  autoCropThreshold,
+			AutoCropMargin:     autoCropMargin,
+			SplitSpreads:       splitSpreads,
+			ReadingDirection:   readingDirection,
+			KeepSpreads:        keepSpreads,
+			FlattenAnimations:  flattenAnimations,
+			KeepICC:            keepICC,
+			KeepSmaller:        keepSmaller,
+			MinSavingsPercent:  minSavings,
+		},
+		Override:        override,
+		KeepFilenames:   keepFilenames,
+		RemoveFolder:    removeFolders,
+		LegacyPageOrder: legacyPageOrder,
+		Webtoon:         webtoon,
+		PageFilter:      pageFilter,
+		Cover:           cover,
+		Timeout:         timeout,
+		MaxSize:         maxSize,
+	}, folders)
 	defer queue.Stop()
 
 	debouncer := newEventDebouncer(debounceDelay, queue.Enqueue)
 	defer debouncer.Stop()
 
+	// The watched folder itself is never converted as a folder of images,
+	// since that would turn it into a CBZ outside of it.
+	trigger := func(p string) {
+		if filepath.Clean(p) != filepath.Clean(path) {
+			debouncer.Trigger(p)
+		}
+	}
+
 	// Note: existing archives already present under path when the watch
 	// starts are left untouched unless --backfill is set. Watch mode only
 	// reacts to filesystem events going forward by default; use the
@@ -118,7 +344,7 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 	if err := addRecursiveWatch(watcher, path); err != nil {
 		return fmt.Errorf("failed to watch path %s: %w", path, err)
 	}
-	maybeBackfillExistingArchives(backfill, path, debouncer.Trigger)
+	maybeBackfillExistingArchives(backfill, path, includeArchives, folders, trigger)
 
 	for {
 		select {
@@ -137,7 +363,7 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 					// The newly discovered directory may already contain
 					// archives (e.g. a folder moved/copied in); back-fill them
 					// since no further fsnotify event will target them.
-					backfillExistingArchives(event.Name, debouncer.Trigger)
+					backfillExistingArchives(event.Name, includeArchives, folders, trigger)
 					continue
 				}
 			}
@@ -146,11 +372,20 @@ func WatchCommand(_ *cobra.Command, args []string) error {
 				continue
 			}
 
-			if !isComicArchive(event.Name) {
+			// An image written into a folder of images makes the folder a
+			// chapter to convert once it stops changing.
+			if folders && cbz.IsImageFile(event.Name) {
+				if dir := filepath.Dir(event.Name); cbz.IsImageFolder(dir) {
+					trigger(dir)
+				}
 				continue
 			}
 
-			debouncer.Trigger(event.Name)
+			if !isComicArchive(event.Name, includeArchives) {
+				continue
+			}
+
+			trigger(event.Name)
 		case err, ok := <-watcher.Errors:
 			if !ok {
 				return nil
@@ -188,17 +423,22 @@ func addRecursiveWatch(watcher *fsnotify.Watcher, rootPath string) error {
 // exist on disk and hands them to process. This covers the case where a
 // directory (potentially already containing archives) is created/moved into
 // the watched tree: only the directory itself generates an fsnotify event,
-// so the files inside it would otherwise never be picked up.
-func backfillExistingArchives(rootPath string, process func(path string)) {
+// so the files inside it would otherwise never be picked up. When folders is
+// true, folders of images are handed to process as well.
+func backfillExistingArchives(rootPath string, includeArchives bool, folders bool, process func(path string)) {
 	err := filepath.WalkDir(rootPath, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			log.Warn().Err(err).Str("path", path).Msg("Skipping path while scanning for existing archives")
 			return nil
 		}
 		if entry.IsDir() {
+			if folders && cbz.IsImageFolder(path) {
+				process(path)
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if !isComicArchive(path) {
+		if !isComicArchive(path, includeArchives) {
 			return nil
 		}
 		process(path)
@@ -213,20 +453,21 @@ func backfillExistingArchives(rootPath string, process func(path string)) {
 // rootPath only when enabled is true. It exists as its own function (rather
 // than inlining the `if` check at the call site) so the gating decision used
 // by WatchCommand can be exercised directly in tests.
-func maybeBackfillExistingArchives(enabled bool, rootPath string, process func(path string)) {
+func maybeBackfillExistingArchives(enabled bool, rootPath string, includeArchives bool, folders bool, process func(path string)) {
 	if !enabled {
 		return
 	}
-	backfillExistingArchives(rootPath, process)
+	backfillExistingArchives(rootPath, includeArchives, folders, process)
 }
 
 func shouldProcessWatchEvent(event fsnotify.Event) bool {
 	return event.Has(fsnotify.Create) || event.Has(fsnotify.Write) || event.Has(fsnotify.Rename)
 }
 
-func isComicArchive(path string) bool {
-	filename := strings.ToLower(path)
-	return strings.HasSuffix(filename, ".cbz") || strings.HasSuffix(filename, ".cbr")
+// isComicArchive reports whether path is an archive watch mode optimizes,
+// see cbz.IsChapterArchive.
+func isComicArchive(path string, includeArchives bool) bool {
+	return cbz.IsChapterArchive(path, includeArchives)
 }
 
 // eventDebouncer coalesces bursts of fsnotify events targeting the same path
@@ -318,9 +559,11 @@ type optimizeQueue struct {
 	stopped  bool
 	options  *utils2.OptimizeOptions
 	optimize func(options *utils2.OptimizeOptions) error
+	// folders lets folders of images through, see cbz.IsImageFolder.
+	folders bool
 }
 
-func newOptimizeQueue(workerCount int, options *utils2.OptimizeOptions) *optimizeQueue {
+func newOptimizeQueue(workerCount int, options *utils2.OptimizeOptions, folders bool) *optimizeQueue {
 	if workerCount < 1 {
 		workerCount = 1
 	}
@@ -328,6 +571,7 @@ func newOptimizeQueue(workerCount int, options *utils2.OptimizeOptions) *optimiz
 		jobs:     make(chan string, 64),
 		options:  options,
 		optimize: utils2.Optimize,
+		folders:  folders,
 	}
 	q.wg.Add(workerCount)
 	for i := 0; i < workerCount; i++ {
@@ -348,14 +592,15 @@ func (q *optimizeQueue) worker() {
 // it), and Write can fire while a file is still being written elsewhere. In
 // override mode, Optimize may overwrite/delete the source file, so skipping
 // paths that no longer exist (or that are no longer regular files) avoids
-// noisy failures.
+// noisy failures. Directories are only processed as folders of images, when
+// the queue accepts them.
 func (q *optimizeQueue) process(path string) {
 	info, err := os.Stat(path)
 	if err != nil {
 		log.Debug().Err(err).Str("file", path).Msg("Skipping watch event: path no longer accessible")
 		return
 	}
-	if info.IsDir() {
+	if info.IsDir() && !(q.folders && cbz.IsImageFolder(path)) {
 		return
 	}
 
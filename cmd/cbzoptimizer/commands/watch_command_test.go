@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/belphemur/CBZOptimizer/v2/internal/cbz"
 	utils2 "github.com/belphemur/CBZOptimizer/v2/internal/utils"
 	"github.com/fsnotify/fsnotify"
 	"github.com/stretchr/testify/assert"
@@ -17,20 +18,27 @@ import (
 
 func TestIsComicArchive(t *testing.T) {
 	testCases := []struct {
-		name     string
-		path     string
-		expected bool
+		name            string
+		path            string
+		includeArchives bool
+		expected        bool
 	}{
-		{"cbz lowercase", "/a/b/chapter.cbz", true},
-		{"cbr lowercase", "/a/b/chapter.cbr", true},
-		{"cbz uppercase", "/a/b/chapter.CBZ", true},
-		{"other extension", "/a/b/chapter.zip", false},
-		{"no extension", "/a/b/chapter", false},
+		{"cbz lowercase", "/a/b/chapter.cbz", false, true},
+		{"cbr lowercase", "/a/b/chapter.cbr", false, true},
+		{"cbz uppercase", "/a/b/chapter.CBZ", false, true},
+		{"cb7", "/a/b/chapter.cb7", false, true},
+		{"cbt", "/a/b/chapter.CBT", false, true},
+		{"zip without include-archives", "/a/b/chapter.zip", false, false},
+		{"zip with include-archives", "/a/b/chapter.zip", true, true},
+		{"rar with include-archives", "/a/b/chapter.rar", true, true},
+		{"7z with include-archives", "/a/b/chapter.7z", true, true},
+		{"other extension", "/a/b/chapter.tar", true, false},
+		{"no extension", "/a/b/chapter", true, false},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			assert.Equal(t, tc.expected, isComicArchive(tc.path))
+			assert.Equal(t, tc.expected, isComicArchive(tc.path, tc.includeArchives))
 		})
 	}
 }
@@ -93,7 +101,7 @@ func TestBackfillExistingArchivesFindsPreExistingArchives(t *testing.T) {
 
 	var mu sync.Mutex
 	var found []string
-	backfillExistingArchives(root, func(path string) {
+	backfillExistingArchives(root, false, false, func(path string) {
 		mu.Lock()
 		defer mu.Unlock()
 		found = append(found, path)
@@ -140,7 +148,7 @@ func TestEventDebouncerHandlesMultiplePaths(t *testing.T) {
 }
 
 func TestOptimizeQueueSkipsMissingPath(t *testing.T) {
-	q := newOptimizeQueue(1, &utils2.OptimizeOptions{})
+	q := newOptimizeQueue(1, &utils2.OptimizeOptions{}, false)
 	defer q.Stop()
 	var calls int32
 	done := make(chan struct{}, 1)
@@ -195,10 +203,69 @@ func TestMaybeBackfillExistingArchivesOnlyInvokedWhenRequested(t *testing.T) {
 		}
 		// This is the exact same gating call WatchCommand makes based on the
 		// --backfill flag value.
-		maybeBackfillExistingArchives(enabled, root, process)
+		maybeBackfillExistingArchives(enabled, root, false, false, process)
 		return found
 	}
 
 	assert.Empty(t, runBackfill(false), "no pre-existing archive should be processed when backfill is disabled")
 	assert.Len(t, runBackfill(true), 1, "pre-existing archives should be processed when backfill is enabled")
 }
+
+func TestBackfillExistingArchivesFindsImageFolders(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "chapter1.cbz"), []byte("data"), 0o644))
+
+	chapter2 := filepath.Join(root, "series", "chapter2")
+	assert.NoError(t, os.MkdirAll(chapter2, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(chapter2, "001.jpg"), []byte("data"), 0o644))
+
+	notes := filepath.Join(root, "notes")
+	assert.NoError(t, os.MkdirAll(notes, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(notes, "cover.jpg"), []byte("data"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(notes, "notes.txt"), []byte("data"), 0o644))
+
+	backfill := func(folders bool) []string {
+		var found []string
+		backfillExistingArchives(root, false, folders, func(path string) {
+			found = append(found, path)
+		})
+		return found
+	}
+
+	assert.ElementsMatch(t, []string{filepath.Join(root, "chapter1.cbz")}, backfill(false))
+	assert.ElementsMatch(t, []string{filepath.Join(root, "chapter1.cbz"), chapter2}, backfill(true))
+}
+
+func TestOptimizeQueueConvertsImageFolders(t *testing.T) {
+	writeFolder := func(t *testing.T) string {
+		t.Helper()
+		folder := filepath.Join(t.TempDir(), "chapter1")
+		require.NoError(t, os.MkdirAll(folder, 0o755))
+		for _, name := range []string{"001.jpg", "002.jpg"} {
+			require.NoError(t, os.WriteFile(filepath.Join(folder, name), []byte("data"), 0o644))
+		}
+		return folder
+	}
+
+	t.Run("folders enabled", func(t *testing.T) {
+		folder := writeFolder(t)
+		q := newOptimizeQueue(1, &utils2.OptimizeOptions{ChapterConverter: &MockConverter{}}, true)
+		q.Enqueue(folder)
+		q.Stop()
+
+		chapter, err := cbz.LoadChapter(folder + ".cbz")
+		require.NoError(t, err)
+		defer func() { _ = chapter.Cleanup() }()
+		assert.Len(t, chapter.Pages, 2)
+		assert.DirExists(t, folder)
+	})
+
+	t.Run("folders disabled", func(t *testing.T) {
+		folder := writeFolder(t)
+		q := newOptimizeQueue(1, &utils2.OptimizeOptions{ChapterConverter: &MockConverter{}}, false)
+		q.Enqueue(folder)
+		q.Stop()
+
+		assert.NoFileExists(t, folder+".cbz")
+	})
+}
@@ -158,6 +158,14 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) (err error
 	// Set zip comment for converted chapters
 	if chapter.IsConverted {
 		comment := fmt.Sprintf("%s\nThis chapter has been converted by CBZOptimizer.", chapter.ConvertedTime)
+		// The converted time must stay on the first line, which is all
+		// IsAlreadyConverted reads.
+		if len(chapter.RemovedPages) > 0 {
+			comment += fmt.Sprintf("\nRemoved %d pages:", len(chapter.RemovedPages))
+			for _, page := range chapter.RemovedPages {
+				comment += "\n- " + page.String()
+			}
+		}
 		err = zipWriter.SetComment(comment)
 		if err != nil {
 			return fmt.Errorf("failed to write comment: %w", err)
@@ -167,3 +175,35 @@ func WriteChapterToCBZ(chapter *manga.Chapter, outputFilePath string) (err error
 	log.Debug().Str("output_path", outputFilePath).Msg("CBZ file creation completed")
 	return nil
 }
+
+// VerifyCBZ checks that the CBZ at filePath was written completely: it must
+// open as a zip, hold at least one page, and every entry must read back with
+// a matching checksum.
+func VerifyCBZ(filePath string) (err error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open .cbz: %w", err)
+	}
+	defer errs.Capture(&err, r.Close, "failed to close .cbz")
+
+	pages := 0
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s in .cbz: %w", f.Name, err)
+		}
+		// The zip reader checks the entry's CRC-32 once it is read to the end.
+		_, err = io.Copy(io.Discard, rc)
+		_ = rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s in .cbz: %w", f.Name, err)
+		}
+		if IsImageFile(f.Name) {
+			pages++
+		}
+	}
+	if pages == 0 {
+		return fmt.Errorf("no pages in .cbz")
+	}
+	return nil
+}
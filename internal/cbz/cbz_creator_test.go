@@ -2,6 +2,7 @@ package cbz
 
 import (
 	"archive/zip"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -56,6 +57,28 @@ func TestWriteChapterToCBZ(t *testing.T) {
 			expectedFiles:   []string{"0000.jpg", "ComicInfo.xml"},
 			expectedComment: fmt.Sprintf("%s\nThis chapter has been converted by CBZOptimizer.", currentTime),
 		},
+		{
+			name: "Converted with removed pages",
+			chapter: func(t *testing.T, dir string) *manga.Chapter {
+				return &manga.Chapter{
+					Pages: []*manga.PageFile{
+						{
+							Index:     1,
+							Extension: ".jpg",
+							FilePath:  createTempPage(t, dir, "image data", ".jpg"),
+						},
+					},
+					IsConverted:   true,
+					ConvertedTime: currentTime,
+					RemovedPages: []manga.RemovedPage{
+						{Index: 0, Reason: "blank"},
+						{Index: 2, Name: "credits.png", Reason: "matches credits.jpg"},
+					},
+				}
+			},
+			expectedFiles:   []string{"0001.jpg"},
+			expectedComment: fmt.Sprintf("%s\nThis chapter has been converted by CBZOptimizer.\nRemoved 2 pages:\n- page 0: blank\n- page 2 (credits.png): matches credits.jpg", currentTime),
+		},
 		{
 			name: "Single page, no ComicInfo",
 			chapter: func(t *testing.T, dir string) *manga.Chapter {
@@ -274,3 +297,50 @@ func TestWriteAndReadRoundTrip(t *testing.T) {
 		t.Errorf("ComicInfoXml mismatch: %s", loaded.ComicInfoXml)
 	}
 }
+
+func TestVerifyCBZ(t *testing.T) {
+	pageDir := t.TempDir()
+	pagePath := filepath.Join(pageDir, "0000.jpg")
+	if err := os.WriteFile(pagePath, []byte("image data 0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.cbz")
+	chapter := &manga.Chapter{Pages: []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: pagePath}}}
+	if err := WriteChapterToCBZ(chapter, valid); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCBZ(valid); err != nil {
+		t.Errorf("Expected a valid CBZ, got %v", err)
+	}
+
+	// The page is stored uncompressed, so changing its bytes breaks its CRC.
+	data, err := os.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := filepath.Join(dir, "corrupted.cbz")
+	if err := os.WriteFile(corrupted, bytes.Replace(data, []byte("image data 0"), []byte("image data 1"), 1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCBZ(corrupted); err == nil {
+		t.Error("Expected an error for a corrupted page")
+	}
+
+	truncated := filepath.Join(dir, "truncated.cbz")
+	if err := os.WriteFile(truncated, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCBZ(truncated); err == nil {
+		t.Error("Expected an error for a truncated CBZ")
+	}
+
+	empty := filepath.Join(dir, "empty.cbz")
+	if err := WriteChapterToCBZ(&manga.Chapter{ComicInfoXml: "<ComicInfo/>"}, empty); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCBZ(empty); err == nil {
+		t.Error("Expected an error for a CBZ without pages")
+	}
+}
@@ -26,11 +26,74 @@ var supportedImageExtensions = map[string]bool{
 	".png":  true,
 	".gif":  true,
 	".webp": true,
+	".avif": true,
+	".jxl":  true,
 	".bmp":  true,
 	".tiff": true,
 	".tif":  true,
 }
 
+// comicArchiveExtensions contains the extensions of the comic book archives
+// processed as chapters: zip, RAR, 7z and tar.
+var comicArchiveExtensions = map[string]bool{
+	".cbz": true,
+	".cbr": true,
+	".cb7": true,
+	".cbt": true,
+}
+
+// plainArchiveExtensions contains the extensions of generic archives that are
+// processed as chapters only on request, since they may hold anything.
+var plainArchiveExtensions = map[string]bool{
+	".zip": true,
+	".rar": true,
+	".7z":  true,
+}
+
+// IsChapterArchive reports whether filePath names an archive to process as a
+// chapter: a comic book archive (.cbz, .cbr, .cb7 or .cbt), or when
+// includePlain is true also a plain .zip, .rar or .7z archive.
+func IsChapterArchive(filePath string, includePlain bool) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return comicArchiveExtensions[ext] || (includePlain && plainArchiveExtensions[ext])
+}
+
+// IsImageFile reports whether filePath names an image that can be a page.
+func IsImageFile(filePath string) bool {
+	return supportedImageExtensions[strings.ToLower(filepath.Ext(filePath))]
+}
+
+// IsImageFolder reports whether dir is a loose chapter: a folder without
+// subfolders that holds at least one image and, besides junk files and a
+// ComicInfo.xml, nothing else.
+func IsImageFolder(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	images := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir():
+			return false
+		case IsImageFile(name):
+			images++
+		case isJunkFile(name), strings.EqualFold(name, "comicinfo.xml"):
+		default:
+			return false
+		}
+	}
+	return images > 0
+}
+
+// isZipArchive reports whether filePath names a zip archive, whose comment
+// can be read directly.
+func isZipArchive(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == ".cbz" || ext == ".zip"
+}
+
 // parseConvertedComment checks if a zip comment's first line is a parseable date,
 // indicating the archive was already converted. Returns true and the parsed time if so.
 func parseConvertedComment(comment string) bool {
@@ -67,9 +130,7 @@ func parseConvertedCommentTime(comment string) (time.Time, bool) {
 func IsAlreadyConverted(ctx context.Context, filePath string) (converted bool, err error) {
 	log.Debug().Str("file_path", filePath).Msg("Checking if already converted")
 
-	pathLower := strings.ToLower(filepath.Ext(filePath))
-
-	if pathLower == ".cbz" {
+	if isZipArchive(filePath) {
 		r, err := zip.OpenReader(filePath)
 		if err != nil {
 			return false, fmt.Errorf("failed to open CBZ for conversion check: %w", err)
@@ -104,8 +165,9 @@ func IsAlreadyConverted(ctx context.Context, filePath string) (converted bool, e
 		}
 	}
 
-	// For CBR files, we need to use the archives library to check
-	if pathLower == ".cbr" {
+	// For the other archives (RAR, 7z, tar), we need to use the archives
+	// library to check
+	if !isZipArchive(filePath) && IsChapterArchive(filePath, true) {
 		fsys, err := archives.FileSystem(ctx, filePath, nil)
 		if err != nil {
 			return false, fmt.Errorf("failed to open archive: %w", err)
@@ -139,7 +201,8 @@ func IsAlreadyConverted(ctx context.Context, filePath string) (converted bool, e
 	return false, nil
 }
 
-// ExtractChapter extracts an archive (CBZ/CBR) to a temp directory on disk.
+// ExtractChapter extracts an archive (CBZ/CBR/CB7/CBT), or copies a folder of
+// images (see IsImageFolder), to a temp directory on disk.
 // Pages are streamed directly to files — no image data is held in memory.
 // Returns a Chapter with PageFile entries pointing to extracted files.
 //
@@ -148,7 +211,13 @@ func IsAlreadyConverted(ctx context.Context, filePath string) (converted bool, e
 // name to preserve the original page identity in the output CBZ (with the
 // extension swapped for format conversion). When false, OriginalName stays
 // empty and the sequential %04d naming convention is used instead.
-func ExtractChapter(ctx context.Context, filePath string, keepFilenames bool) (*manga.Chapter, error) {
+//
+// Pages are numbered in natural order of their paths in the archive (see
+// comparePagePaths), so page2.jpg comes before page10.jpg, or in the order
+// the chapter's ComicInfo.xml lists them when it lists every page. When
+// legacyOrder is true they are numbered in the order the archive is walked
+// instead, as before natural ordering was introduced.
+func ExtractChapter(ctx context.Context, filePath string, keepFilenames, legacyOrder bool) (*manga.Chapter, error) {
 	log.Debug().Str("file_path", filePath).Msg("Extracting chapter to disk")
 
 	// Create temp directory for extraction
@@ -185,8 +254,7 @@ func ExtractChapter(ctx context.Context, filePath string, keepFilenames bool) (*
 	}
 
 	// For CBZ files, read metadata from zip comment
-	pathLower := strings.ToLower(filepath.Ext(filePath))
-	if pathLower == ".cbz" {
+	if isZipArchive(filePath) {
 		r, err := zip.OpenReader(filePath)
 		if err == nil {
 			if t, ok := parseConvertedCommentTime(r.Comment); ok {
@@ -197,13 +265,16 @@ func ExtractChapter(ctx context.Context, filePath string, keepFilenames bool) (*
 		}
 	}
 
-	// Extract files using the archives library (supports both CBZ and CBR)
+	// Extract files using the archives library (supports zip, RAR, 7z, tar and folders)
 	fsys, err := archives.FileSystem(ctx, filePath, nil)
 	if err != nil {
 		_ = os.RemoveAll(tempDir)
 		return nil, fmt.Errorf("failed to open archive: %w", err)
 	}
 
+	// Image entries are collected first and extracted once they are sorted
+	// in reading order.
+	var imagePaths []string
 	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
@@ -268,32 +339,26 @@ func ExtractChapter(ctx context.Context, filePath string, keepFilenames bool) (*
 			return nil
 		}
 
-		// Extract image file to disk
-		file, err := fsys.Open(path)
-		if err != nil {
-			return fmt.Errorf("failed to open file %s: %w", path, err)
-		}
-		defer func() { _ = file.Close() }()
-
-		// Create output file with sequential naming
-		pageIndex := uint16(len(chapter.Pages))
-		outputName := fmt.Sprintf("%04d%s", pageIndex, ext)
-		outputPath := filepath.Join(inputDir, outputName)
+		imagePaths = append(imagePaths, path)
+		return nil
+	})
+	if err == nil && !legacyOrder {
+		chapter.ComicInfoXml = sortPagePaths(imagePaths, chapter.ComicInfoXml)
+	}
 
-		outFile, err := os.Create(outputPath)
-		if err != nil {
-			return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+	for i := 0; err == nil && i < len(imagePaths); i++ {
+		// Check for context cancellation during extraction
+		if err = ctx.Err(); err != nil {
+			break
 		}
 
-		_, err = io.Copy(outFile, file)
-		closeErr := outFile.Close()
-		if err != nil {
-			_ = os.Remove(outputPath)
-			return fmt.Errorf("failed to write file %s: %w", outputPath, err)
-		}
-		if closeErr != nil {
-			_ = os.Remove(outputPath)
-			return fmt.Errorf("failed to close file %s: %w", outputPath, closeErr)
+		// Extract image file to disk with sequential naming
+		path := imagePaths[i]
+		pageIndex := uint16(len(chapter.Pages))
+		ext := strings.ToLower(filepath.Ext(path))
+		outputPath := filepath.Join(inputDir, fmt.Sprintf("%04d%s", pageIndex, ext))
+		if err = extractFile(fsys, path, outputPath); err != nil {
+			break
 		}
 
 		page := &manga.PageFile{
@@ -311,9 +376,7 @@ func ExtractChapter(ctx context.Context, filePath string, keepFilenames bool) (*
 			Str("archive_file", path).
 			Uint16("page_index", pageIndex).
 			Msg("Page extracted to disk")
-
-		return nil
-	})
+	}
 
 	if err != nil {
 		_ = os.RemoveAll(tempDir)
@@ -329,6 +392,33 @@ func ExtractChapter(ctx context.Context, filePath string, keepFilenames bool) (*
 	return chapter, nil
 }
 
+// extractFile copies the archive entry at path to a new file at outputPath,
+// removing it again when the copy fails.
+func extractFile(fsys fs.FS, path, outputPath string) error {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+	}
+
+	_, err = io.Copy(outFile, file)
+	closeErr := outFile.Close()
+	if err != nil {
+		_ = os.Remove(outputPath)
+		return fmt.Errorf("failed to write file %s: %w", outputPath, err)
+	}
+	if closeErr != nil {
+		_ = os.Remove(outputPath)
+		return fmt.Errorf("failed to close file %s: %w", outputPath, closeErr)
+	}
+	return nil
+}
+
 // isJunkFile returns true for known OS/tool metadata files that should not be
 // treated as pages (e.g., __MACOSX/, Thumbs.db, .DS_Store).
 func isJunkFile(path string) bool {
@@ -410,10 +500,10 @@ func allocateUniqueBaseName(baseName string, pageIndex uint16, usedStems map[str
 	}
 }
 
-// LoadChapter extracts the chapter from a CBZ/CBR file to disk.
-// It delegates to ExtractChapter with keepFilenames=false and always
-// extracts all pages. Use IsAlreadyConverted for a fast conversion status
+// LoadChapter extracts the chapter from a CBZ/CBR/CB7/CBT file to disk.
+// It delegates to ExtractChapter with keepFilenames=false and
+// legacyOrder=false and always extracts all pages. Use IsAlreadyConverted for a fast conversion status
 // check without extraction.
 func LoadChapter(filePath string) (*manga.Chapter, error) {
-	return ExtractChapter(context.Background(), filePath, false)
+	return ExtractChapter(context.Background(), filePath, false, false)
 }
@@ -1,6 +1,7 @@
 package cbz
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"context"
 	"fmt"
@@ -159,12 +160,12 @@ func TestIsAlreadyConverted_CBZWithNonDateComment(t *testing.T) {
 }
 
 func TestExtractChapter_NonexistentFile(t *testing.T) {
-	_, err := ExtractChapter(context.Background(), "/nonexistent/file.cbz", false)
+	_, err := ExtractChapter(context.Background(), "/nonexistent/file.cbz", false, false)
 	require.Error(t, err)
 }
 
 func TestExtractChapter_PageExtensions(t *testing.T) {
-	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", false)
+	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", false, false)
 	require.NoError(t, err)
 	defer func() { _ = chapter.Cleanup() }()
 
@@ -177,7 +178,7 @@ func TestExtractChapter_PageExtensions(t *testing.T) {
 
 func TestExtractChapter_PagesHaveSequentialIndices(t *testing.T) {
 	t.Run("default sequential naming", func(t *testing.T) {
-		chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", false)
+		chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", false, false)
 		require.NoError(t, err)
 		defer func() { _ = chapter.Cleanup() }()
 
@@ -188,7 +189,7 @@ func TestExtractChapter_PagesHaveSequentialIndices(t *testing.T) {
 	})
 
 	t.Run("keep-filenames records OriginalName", func(t *testing.T) {
-		chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", true)
+		chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", true, false)
 		require.NoError(t, err)
 		defer func() { _ = chapter.Cleanup() }()
 
@@ -233,7 +234,7 @@ func TestExtractChapter_KeepFilenames_DeduplicatesCollidingNames(t *testing.T) {
 	cbzPath := writeCollisionCBZ(t, tmpDir)
 
 	t.Run("keep-filenames resolves colliding base names", func(t *testing.T) {
-		chapter, err := ExtractChapter(context.Background(), cbzPath, true)
+		chapter, err := ExtractChapter(context.Background(), cbzPath, true, false)
 		require.NoError(t, err)
 		defer func() { _ = chapter.Cleanup() }()
 
@@ -271,7 +272,7 @@ func TestExtractChapter_KeepFilenames_DeduplicatesCollidingNames(t *testing.T) {
 		// Same collision-prone archive, but with keep-filenames off: the
 		// dedup logic must not run, so OriginalName stays empty for every
 		// page. This is the historical default and must not regress.
-		chapter, err := ExtractChapter(context.Background(), cbzPath, false)
+		chapter, err := ExtractChapter(context.Background(), cbzPath, false, false)
 		require.NoError(t, err)
 		defer func() { _ = chapter.Cleanup() }()
 
@@ -312,7 +313,7 @@ func TestExtractChapter_KeepFilenames_NormalizesWindowsSeparators(t *testing.T)
 	tmpDir := t.TempDir()
 	cbzPath := writeBackslashCBZ(t, tmpDir)
 
-	chapter, err := ExtractChapter(context.Background(), cbzPath, true)
+	chapter, err := ExtractChapter(context.Background(), cbzPath, true, false)
 	require.NoError(t, err)
 	defer func() { _ = chapter.Cleanup() }()
 
@@ -371,7 +372,7 @@ func TestExtractChapter_KeepFilenames_DeduplicatesSameStemDifferentExtensions(t
 	tmpDir := t.TempDir()
 	cbzPath := writeSameStemDifferentExtCBZ(t, tmpDir)
 
-	chapter, err := ExtractChapter(context.Background(), cbzPath, true)
+	chapter, err := ExtractChapter(context.Background(), cbzPath, true, false)
 	require.NoError(t, err)
 	defer func() { _ = chapter.Cleanup() }()
 
@@ -429,7 +430,7 @@ func TestExtractChapter_KeepFilenames_DeduplicatesSameStemDifferentExtensions(t
 }
 
 func TestExtractChapter_Cleanup(t *testing.T) {
-	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", false)
+	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 128.cbz", false, false)
 	require.NoError(t, err)
 
 	tempDir := chapter.TempDir
@@ -444,7 +445,7 @@ func TestExtractChapter_Cleanup(t *testing.T) {
 }
 
 func TestExtractChapter_CBR(t *testing.T) {
-	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 1.cbr", false)
+	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 1.cbr", false, false)
 	require.NoError(t, err)
 	defer func() { _ = chapter.Cleanup() }()
 
@@ -457,7 +458,7 @@ func TestExtractChapter_CBR(t *testing.T) {
 }
 
 func TestExtractChapter_ConvertedStatus(t *testing.T) {
-	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 10_converted.cbz", false)
+	chapter, err := ExtractChapter(context.Background(), "../../testdata/Chapter 10_converted.cbz", false, false)
 	require.NoError(t, err)
 	defer func() { _ = chapter.Cleanup() }()
 
@@ -601,7 +602,7 @@ func TestExtractChapter_WithConvertedTxt(t *testing.T) {
 	_ = w.Close()
 	_ = f.Close()
 
-	chapter, err := ExtractChapter(context.Background(), cbzPath, false)
+	chapter, err := ExtractChapter(context.Background(), cbzPath, false, false)
 	require.NoError(t, err)
 	defer func() { _ = chapter.Cleanup() }()
 
@@ -669,3 +670,153 @@ func TestWriteChapterToCBZ_InvalidOutputPath(t *testing.T) {
 	err := WriteChapterToCBZ(chapter, "/nonexistent/dir/output.cbz")
 	require.Error(t, err)
 }
+
+func TestExtractChapter_PageOrder(t *testing.T) {
+	tmpDir := t.TempDir()
+	cbzPath := filepath.Join(tmpDir, "order.cbz")
+	f, err := os.Create(cbzPath)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for _, entry := range []string{"page1.jpg", "page10.jpg", "Page2.jpg", "page11.jpg"} {
+		fw, err := w.Create(entry)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(entry))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	pageContents := func(chapter *manga.Chapter) []string {
+		var contents []string
+		for i, page := range chapter.Pages {
+			assert.Equal(t, uint16(i), page.Index)
+			data, err := os.ReadFile(page.FilePath)
+			require.NoError(t, err)
+			contents = append(contents, string(data))
+		}
+		return contents
+	}
+
+	t.Run("natural order", func(t *testing.T) {
+		chapter, err := ExtractChapter(context.Background(), cbzPath, false, false)
+		require.NoError(t, err)
+		defer func() { _ = chapter.Cleanup() }()
+		assert.Equal(t, []string{"page1.jpg", "Page2.jpg", "page10.jpg", "page11.jpg"}, pageContents(chapter))
+	})
+
+	t.Run("legacy order", func(t *testing.T) {
+		chapter, err := ExtractChapter(context.Background(), cbzPath, false, true)
+		require.NoError(t, err)
+		defer func() { _ = chapter.Cleanup() }()
+		assert.Equal(t, []string{"Page2.jpg", "page1.jpg", "page10.jpg", "page11.jpg"}, pageContents(chapter))
+	})
+}
+
+func TestIsChapterArchive(t *testing.T) {
+	testCases := []struct {
+		path         string
+		includePlain bool
+		expected     bool
+	}{
+		{"chapter.cbz", false, true},
+		{"chapter.CBR", false, true},
+		{"chapter.cb7", false, true},
+		{"chapter.cbt", false, true},
+		{"chapter.zip", false, false},
+		{"chapter.zip", true, true},
+		{"chapter.RAR", true, true},
+		{"chapter.7z", true, true},
+		{"chapter.tar", true, false},
+		{"chapter", true, false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, IsChapterArchive(tc.path, tc.includePlain), "%s (include plain: %v)", tc.path, tc.includePlain)
+	}
+}
+
+func TestExtractChapter_CBT(t *testing.T) {
+	tmpDir := t.TempDir()
+	cbtPath := filepath.Join(tmpDir, "chapter.cbt")
+	f, err := os.Create(cbtPath)
+	require.NoError(t, err)
+	w := tar.NewWriter(f)
+	for _, entry := range []struct{ name, content string }{
+		{"page2.jpg", "second page"},
+		{"page1.png", "first page"},
+		{"ComicInfo.xml", "<ComicInfo><Series>Test</Series></ComicInfo>"},
+		{"notes.txt", "not a page"},
+	} {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content))}))
+		_, err = w.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	converted, err := IsAlreadyConverted(context.Background(), cbtPath)
+	require.NoError(t, err)
+	assert.False(t, converted)
+
+	chapter, err := ExtractChapter(context.Background(), cbtPath, false, false)
+	require.NoError(t, err)
+	defer func() { _ = chapter.Cleanup() }()
+
+	require.Len(t, chapter.Pages, 2)
+	assert.Equal(t, ".png", chapter.Pages[0].Extension)
+	assert.Equal(t, ".jpg", chapter.Pages[1].Extension)
+	assert.Contains(t, chapter.ComicInfoXml, "<Series>Test</Series>")
+}
+
+func TestIsImageFolder(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    []string
+		subdir   bool
+		expected bool
+	}{
+		{name: "images only", files: []string{"1.jpg", "2.PNG"}, expected: true},
+		{name: "images with metadata and junk", files: []string{"1.jpg", "ComicInfo.xml", "Thumbs.db", ".DS_Store"}, expected: true},
+		{name: "other file", files: []string{"1.jpg", "notes.txt"}, expected: false},
+		{name: "subfolder", files: []string{"1.jpg"}, subdir: true, expected: false},
+		{name: "no image", files: []string{"ComicInfo.xml"}, expected: false},
+		{name: "empty", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tc.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644))
+			}
+			if tc.subdir {
+				require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+			}
+			assert.Equal(t, tc.expected, IsImageFolder(dir))
+		})
+	}
+
+	assert.False(t, IsImageFolder(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestExtractChapter_Folder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Chapter 1")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	for _, name := range []string{"page10.jpg", "page2.jpg", "page1.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ComicInfo.xml"), []byte("<ComicInfo><Series>Test</Series></ComicInfo>"), 0644))
+
+	chapter, err := ExtractChapter(context.Background(), dir, false, false)
+	require.NoError(t, err)
+	defer func() { _ = chapter.Cleanup() }()
+
+	require.Len(t, chapter.Pages, 3)
+	for i, name := range []string{"page1.jpg", "page2.jpg", "page10.jpg"} {
+		data, err := os.ReadFile(chapter.Pages[i].FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, name, string(data))
+	}
+	assert.Contains(t, chapter.ComicInfoXml, "<Series>Test</Series>")
+	assert.FileExists(t, filepath.Join(dir, "page1.jpg"), "the folder must be left untouched")
+}
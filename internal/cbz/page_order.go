@@ -0,0 +1,152 @@
+package cbz
+
+import (
+	"cmp"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+)
+
+// sortPagePaths orders the archive paths of a chapter's pages in reading
+// order and returns the chapter's ComicInfo.xml to keep with them.
+//
+// The paths are sorted naturally (see comparePagePaths), which is the order
+// the Image indices of the ComicInfo.xml Pages list refer to. When that
+// list covers every page exactly once but not in index order, the pages are
+// read in the order it lists them instead, and its Image indices are
+// renumbered to the pages' new positions so that they keep pointing at the
+// same pages.
+func sortPagePaths(paths []string, comicInfoXml string) string {
+	slices.SortStableFunc(paths, comparePagePaths)
+
+	order := (&manga.Chapter{ComicInfoXml: comicInfoXml}).ComicInfoPageOrder()
+	if !isPermutation(order, len(paths)) || slices.IsSorted(order) {
+		return comicInfoXml
+	}
+	// Only rewrite the indices when each one parsed is found again.
+	if len(pageImageAttr.FindAllStringIndex(comicInfoXml, -1)) != len(order) {
+		return comicInfoXml
+	}
+	sorted := slices.Clone(paths)
+	for i, image := range order {
+		paths[i] = sorted[image]
+	}
+	return renumberComicInfoPages(comicInfoXml)
+}
+
+// isPermutation reports whether order lists each of 0..n-1 exactly once.
+func isPermutation(order []int, n int) bool {
+	if n == 0 || len(order) != n {
+		return false
+	}
+	seen := make([]bool, n)
+	for _, image := range order {
+		if image < 0 || image >= n || seen[image] {
+			return false
+		}
+		seen[image] = true
+	}
+	return true
+}
+
+// pageImageAttr matches the Image attribute of a ComicInfo.xml Page element.
+var pageImageAttr = regexp.MustCompile(`(<Page\b[^>]*?\bImage\s*=\s*["'])\s*\d+\s*(["'])`)
+
+// renumberComicInfoPages numbers the Image attributes of the Page elements
+// of comicInfoXml 0, 1, 2, ... in the order they are listed, leaving the
+// rest of the document untouched.
+func renumberComicInfoPages(comicInfoXml string) string {
+	position := 0
+	return pageImageAttr.ReplaceAllStringFunc(comicInfoXml, func(attr string) string {
+		match := pageImageAttr.FindStringSubmatch(attr)
+		attr = match[1] + strconv.Itoa(position) + match[2]
+		position++
+		return attr
+	})
+}
+
+// comparePagePaths orders archive paths naturally: directory by directory,
+// a directory's own files before those of its subdirectories, and within a
+// name runs of digits by their numeric value and the rest case-insensitively,
+// so that page2.jpg comes before Page10.jpg. Stems are compared before
+// extensions. Paths that are still equal fall back to a byte comparison so
+// the order is total.
+func comparePagePaths(a, b string) int {
+	aDir, aName := splitArchivePath(a)
+	bDir, bName := splitArchivePath(b)
+	for i := range min(len(aDir), len(bDir)) {
+		if c := compareNatural(aDir[i], bDir[i]); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(aDir), len(bDir)); c != 0 {
+		return c
+	}
+	aExt, bExt := filepath.Ext(aName), filepath.Ext(bName)
+	if c := compareNatural(strings.TrimSuffix(aName, aExt), strings.TrimSuffix(bName, bExt)); c != 0 {
+		return c
+	}
+	if c := compareNatural(aExt, bExt); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// splitArchivePath splits an archive path into its directories and its base
+// name, treating backslashes as separators as archiveBaseName does.
+func splitArchivePath(path string) ([]string, string) {
+	segments := strings.Split(strings.ReplaceAll(path, "\\", "/"), "/")
+	return segments[:len(segments)-1], segments[len(segments)-1]
+}
+
+// compareNatural compares a and b case-insensitively, with runs of digits
+// compared by value. Equal values with more leading zeros sort first.
+func compareNatural(a, b string) int {
+	zeros := 0
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			aRun, bRun := digitRun(a), digitRun(b)
+			a, b = a[len(aRun):], b[len(bRun):]
+			aValue, bValue := strings.TrimLeft(aRun, "0"), strings.TrimLeft(bRun, "0")
+			if c := cmp.Compare(len(aValue), len(bValue)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(aValue, bValue); c != 0 {
+				return c
+			}
+			if zeros == 0 {
+				zeros = cmp.Compare(len(bRun), len(aRun))
+			}
+			continue
+		}
+		aRune, aSize := utf8.DecodeRuneInString(a)
+		bRune, bSize := utf8.DecodeRuneInString(b)
+		a, b = a[aSize:], b[bSize:]
+		if c := cmp.Compare(unicode.ToLower(aRune), unicode.ToLower(bRune)); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(len(a), len(b)); c != 0 {
+		return c
+	}
+	return zeros
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitRun returns the run of digits s starts with.
+func digitRun(s string) string {
+	end := 0
+	for end < len(s) && isDigit(s[end]) {
+		end++
+	}
+	return s[:end]
+}
@@ -0,0 +1,104 @@
+package cbz
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparePagePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		paths    []string
+		expected []string
+	}{
+		{
+			name:     "numbers by value",
+			paths:    []string{"page10.jpg", "page2.jpg", "page1.jpg", "page11.jpg"},
+			expected: []string{"page1.jpg", "page2.jpg", "page10.jpg", "page11.jpg"},
+		},
+		{
+			name:     "case-insensitive",
+			paths:    []string{"b.jpg", "Page2.jpg", "page10.jpg", "A.jpg"},
+			expected: []string{"A.jpg", "b.jpg", "Page2.jpg", "page10.jpg"},
+		},
+		{
+			name:     "leading zeros",
+			paths:    []string{"p010.png", "p9.png", "p0010.png", "p1.png"},
+			expected: []string{"p1.png", "p9.png", "p0010.png", "p010.png"},
+		},
+		{
+			name:     "stem before extension",
+			paths:    []string{"page-1.jpg", "page.png", "page.jpg"},
+			expected: []string{"page.jpg", "page.png", "page-1.jpg"},
+		},
+		{
+			name:     "directories",
+			paths:    []string{"ch10/1.jpg", "ch2/10.jpg", "ch2/2.jpg", "cover.jpg", "ch2/extra/1.jpg"},
+			expected: []string{"cover.jpg", "ch2/2.jpg", "ch2/10.jpg", "ch2/extra/1.jpg", "ch10/1.jpg"},
+		},
+		{
+			name:     "backslash separators",
+			paths:    []string{`ch2\10.jpg`, "ch10/1.jpg", `ch2\9.jpg`},
+			expected: []string{`ch2\9.jpg`, `ch2\10.jpg`, "ch10/1.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := slices.Clone(tt.paths)
+			slices.SortFunc(paths, comparePagePaths)
+			assert.Equal(t, tt.expected, paths)
+		})
+	}
+}
+
+func TestSortPagePaths(t *testing.T) {
+	paths := []string{"p3.jpg", "p1.jpg", "p2.jpg"}
+
+	tests := []struct {
+		name             string
+		comicInfoXml     string
+		expectedPaths    []string
+		expectedComicXml string
+	}{
+		{
+			name:          "no ComicInfo",
+			expectedPaths: []string{"p1.jpg", "p2.jpg", "p3.jpg"},
+		},
+		{
+			name:             "listed in index order",
+			comicInfoXml:     `<ComicInfo><Pages><Page Image="0"/><Page Image="1"/><Page Image="2"/></Pages></ComicInfo>`,
+			expectedPaths:    []string{"p1.jpg", "p2.jpg", "p3.jpg"},
+			expectedComicXml: `<ComicInfo><Pages><Page Image="0"/><Page Image="1"/><Page Image="2"/></Pages></ComicInfo>`,
+		},
+		{
+			name:             "listed out of order",
+			comicInfoXml:     `<ComicInfo><Pages><Page Image="2" Type="FrontCover"/><Page Type="Story" Image='0'/><Page Image="1"/></Pages></ComicInfo>`,
+			expectedPaths:    []string{"p3.jpg", "p1.jpg", "p2.jpg"},
+			expectedComicXml: `<ComicInfo><Pages><Page Image="0" Type="FrontCover"/><Page Type="Story" Image='1'/><Page Image="2"/></Pages></ComicInfo>`,
+		},
+		{
+			name:             "not every page listed",
+			comicInfoXml:     `<ComicInfo><Pages><Page Image="2"/><Page Image="0"/></Pages></ComicInfo>`,
+			expectedPaths:    []string{"p1.jpg", "p2.jpg", "p3.jpg"},
+			expectedComicXml: `<ComicInfo><Pages><Page Image="2"/><Page Image="0"/></Pages></ComicInfo>`,
+		},
+		{
+			name:             "page listed twice",
+			comicInfoXml:     `<ComicInfo><Pages><Page Image="2"/><Page Image="0"/><Page Image="2"/></Pages></ComicInfo>`,
+			expectedPaths:    []string{"p1.jpg", "p2.jpg", "p3.jpg"},
+			expectedComicXml: `<ComicInfo><Pages><Page Image="2"/><Page Image="0"/><Page Image="2"/></Pages></ComicInfo>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := slices.Clone(paths)
+			comicInfoXml := sortPagePaths(sorted, tt.comicInfoXml)
+			assert.Equal(t, tt.expectedPaths, sorted)
+			assert.Equal(t, tt.expectedComicXml, comicInfoXml)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package imaging
+
+import "image"
+
+// IsBlank reports whether img is a blank page of any shade: apart from a
+// speck of dust and scan noise, every pixel is within gutterTolerance of
+// the page's mean luma.
+func IsBlank(img image.Image) bool {
+	gray := Luma(img)
+	bounds := gray.Bounds()
+	if bounds.Empty() {
+		return true
+	}
+
+	sum := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(bounds.Min.X, y) : gray.PixOffset(bounds.Max.X-1, y)+1] {
+			sum += int(v)
+		}
+	}
+	mean := sum / (bounds.Dx() * bounds.Dy())
+
+	maxNoise := int(float64(bounds.Dx()*bounds.Dy()) * borderNoiseRatio)
+	noise := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for _, v := range gray.Pix[gray.PixOffset(bounds.Min.X, y) : gray.PixOffset(bounds.Max.X-1, y)+1] {
+			if d := int(v) - mean; d > gutterTolerance || d < -gutterTolerance {
+				noise++
+				if noise > maxNoise {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
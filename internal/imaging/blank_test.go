@@ -0,0 +1,40 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBlank(t *testing.T) {
+	// A white page with light scan noise and a few specks of dust.
+	scanned := image.NewGray(image.Rect(10, 10, 210, 310))
+	for y := 10; y < 310; y++ {
+		for x := 10; x < 210; x++ {
+			scanned.SetGray(x, y, color.Gray{Y: uint8(235 + (x*7+y*3)%12)})
+		}
+	}
+	for i := range 50 {
+		scanned.SetGray(10+i, 100, color.Gray{Y: 0})
+	}
+	assert.True(t, IsBlank(scanned))
+
+	black := image.NewGray(image.Rect(0, 0, 100, 100))
+	assert.True(t, IsBlank(black), "blank pages may be any shade")
+
+	// A line of text is enough to keep the page.
+	text := image.NewGray(image.Rect(0, 0, 200, 300))
+	for y := range 300 {
+		for x := range 200 {
+			text.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	for x := 20; x < 180; x++ {
+		for y := 140; y < 150; y++ {
+			text.SetGray(x, y, color.Gray{Y: 0})
+		}
+	}
+	assert.False(t, IsBlank(text))
+}
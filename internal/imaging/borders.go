@@ -0,0 +1,113 @@
+package imaging
+
+import "image"
+
+const (
+	// borderNoiseRatio is the share of pixels of a border row or column
+	// allowed to stray from the border color, so dust and scan noise do not
+	// stop the trimming.
+	borderNoiseRatio = 0.005
+	// minContentRatio is the smallest share of the page width and height
+	// the content may cover. Pages whose content is smaller than that are
+	// left alone: they are more likely an intentionally sparse page (a
+	// single speech bubble, a chapter title) than one with huge margins.
+	minContentRatio = 0.5
+)
+
+type borderKind int
+
+const (
+	notBorder borderKind = iota
+	whiteBorder
+	blackBorder
+)
+
+// TrimBorders detects the uniform white or black borders of img and returns
+// the rectangle of the content inside them, grown by margin pixels on each
+// side so the content is never cropped flush. Each side is measured
+// independently, so uneven scans are handled. A pixel belongs to a border
+// when its luma is within threshold of pure white or pure black.
+//
+// The second result is false when there is nothing to crop, when the whole
+// page is blank, or when the content would cover less than half the page.
+func TrimBorders(img image.Image, threshold uint8, margin int) (image.Rectangle, bool) {
+	gray := Luma(img)
+	bounds := gray.Bounds()
+	if bounds.Empty() {
+		return bounds, false
+	}
+
+	classify := func(values func(i int) uint8, n int) borderKind {
+		white, black := 0, 0
+		for i := 0; i < n; i++ {
+			v := values(i)
+			if v >= 255-threshold {
+				white++
+			} else if v <= threshold {
+				black++
+			}
+		}
+		required := n - int(float64(n)*borderNoiseRatio)
+		switch {
+		case white >= required:
+			return whiteBorder
+		case black >= required:
+			return blackBorder
+		}
+		return notBorder
+	}
+	row := func(y, minX, maxX int) borderKind {
+		line := gray.Pix[gray.PixOffset(minX, y) : gray.PixOffset(maxX-1, y)+1]
+		return classify(func(i int) uint8 { return line[i] }, len(line))
+	}
+	column := func(x, minY, maxY int) borderKind {
+		return classify(func(i int) uint8 { return gray.Pix[gray.PixOffset(x, minY+i)] }, maxY-minY)
+	}
+
+	// trim advances from start in direction step while lines share the
+	// kind of the first one and returns the first content line.
+	trim := func(start, end, step int, kindAt func(i int) borderKind) int {
+		kind := kindAt(start)
+		if kind == notBorder {
+			return start
+		}
+		i := start
+		for i != end && kindAt(i) == kind {
+			i += step
+		}
+		return i
+	}
+
+	// Sides are trimmed in turns, each within what the others left, until
+	// nothing changes: a black strip along one edge makes every row mixed,
+	// but once it is cut the white rows above the content are uniform.
+	rect := bounds
+	for {
+		top := trim(rect.Min.Y, rect.Max.Y, 1, func(y int) borderKind { return row(y, rect.Min.X, rect.Max.X) })
+		if top == rect.Max.Y {
+			return bounds, false
+		}
+		bottom := trim(rect.Max.Y-1, top-1, -1, func(y int) borderKind { return row(y, rect.Min.X, rect.Max.X) }) + 1
+		left := trim(rect.Min.X, rect.Max.X, 1, func(x int) borderKind { return column(x, top, bottom) })
+		if left == rect.Max.X {
+			return bounds, false
+		}
+		right := trim(rect.Max.X-1, left-1, -1, func(x int) borderKind { return column(x, top, bottom) }) + 1
+
+		trimmed := image.Rect(left, top, right, bottom)
+		if trimmed == rect {
+			break
+		}
+		rect = trimmed
+	}
+
+	content := image.Rect(rect.Min.X-margin, rect.Min.Y-margin, rect.Max.X+margin, rect.Max.Y+margin).Intersect(bounds)
+	if content == bounds {
+		return bounds, false
+	}
+	if float64(content.Dx()) < float64(bounds.Dx())*minContentRatio ||
+		float64(content.Dy()) < float64(bounds.Dy())*minContentRatio {
+		return bounds, false
+	}
+	return content, true
+}
@@ -0,0 +1,58 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// framedPage returns a width x height page filled with border, with a
+// mid-gray content block at content.
+func framedPage(width, height int, border color.Color, content image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(border), image.Point{}, draw.Src)
+	draw.Draw(img, content, image.NewUniform(color.RGBA{R: 120, G: 120, B: 120, A: 255}), image.Point{}, draw.Src)
+	return img
+}
+
+func TestTrimBorders(t *testing.T) {
+	offWhite := color.RGBA{R: 240, G: 238, B: 235, A: 255}
+
+	noisy := framedPage(200, 300, color.White, image.Rect(20, 30, 180, 280))
+	noisy.Set(100, 5, color.Black) // a speck of dust in the top margin
+
+	unevenMixed := framedPage(200, 300, color.White, image.Rect(10, 40, 170, 290))
+	draw.Draw(unevenMixed, image.Rect(0, 0, 10, 300), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	tests := []struct {
+		name     string
+		img      image.Image
+		margin   int
+		expected image.Rectangle
+		ok       bool
+	}{
+		{name: "white borders", img: framedPage(200, 300, color.White, image.Rect(20, 30, 180, 280)), expected: image.Rect(20, 30, 180, 280), ok: true},
+		{name: "black borders", img: framedPage(200, 300, color.Black, image.Rect(20, 30, 180, 280)), expected: image.Rect(20, 30, 180, 280), ok: true},
+		{name: "off-white scan", img: framedPage(200, 300, offWhite, image.Rect(20, 30, 180, 280)), expected: image.Rect(20, 30, 180, 280), ok: true},
+		{name: "safety margin", img: framedPage(200, 300, color.White, image.Rect(20, 30, 180, 280)), margin: 8, expected: image.Rect(12, 22, 188, 288), ok: true},
+		{name: "margin clamped to page", img: framedPage(200, 300, color.White, image.Rect(4, 30, 180, 280)), margin: 8, expected: image.Rect(0, 22, 188, 288), ok: true},
+		{name: "dust in the margin", img: noisy, expected: image.Rect(20, 30, 180, 280), ok: true},
+		{name: "uneven black and white sides", img: unevenMixed, expected: image.Rect(10, 40, 170, 290), ok: true},
+		{name: "no border", img: framedPage(200, 300, color.White, image.Rect(0, 0, 200, 300)), ok: false},
+		{name: "blank page", img: framedPage(200, 300, color.White, image.Rectangle{}), ok: false},
+		{name: "sparse page", img: framedPage(200, 300, color.White, image.Rect(80, 120, 120, 160)), ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rect, ok := TrimBorders(tt.img, 24, tt.margin)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, rect)
+			}
+		})
+	}
+}
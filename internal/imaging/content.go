@@ -0,0 +1,127 @@
+package imaging
+
+import "image"
+
+// Content is the kind of artwork a page holds, as far as picking encoder
+// settings goes.
+type Content int
+
+const (
+	// ContentDrawing is line art, screentone and flat colors: most manga
+	// and comic pages.
+	ContentDrawing Content = iota
+	// ContentText is mostly lettering on a light background: credits,
+	// afterwords, novel inserts.
+	ContentText
+	// ContentPhoto is continuous-tone color: painted covers, photographs.
+	ContentPhoto
+)
+
+// String returns the lowercase name of the content kind.
+func (c Content) String() string {
+	switch c {
+	case ContentText:
+		return "text"
+	case ContentPhoto:
+		return "photo"
+	}
+	return "drawing"
+}
+
+const (
+	// contentSamples is the number of samples taken along the longest side
+	// of a page when classifying it.
+	contentSamples = 800
+	// flatGradient and edgeGradient split the luma gradient of a sample
+	// (the sum of its horizontal and vertical differences) into flat areas,
+	// soft shading and sharp edges.
+	flatGradient = 6
+	edgeGradient = 64
+	// lightLuma and darkLuma are the bounds of the midtones.
+	lightLuma = 208
+	darkLuma  = 48
+)
+
+// ContentStats are the measures ClassifyContent decides on. Ratios are
+// shares of the sampled pixels (0-1).
+type ContentStats struct {
+	// EdgeRatio is the share of pixels on a sharp luma edge.
+	EdgeRatio float64
+	// SoftRatio is the share of pixels in soft shading: neither flat nor on
+	// an edge.
+	SoftRatio float64
+	// LightRatio is the share of pixels near white.
+	LightRatio float64
+	// MidtoneRatio is the share of pixels neither near white nor near black.
+	MidtoneRatio float64
+	// Colorfulness is the mean spread between the highest and lowest of a
+	// pixel's R, G and B values (0-255), 0 for grayscale images.
+	Colorfulness float64
+}
+
+// ClassifyContent tells text, drawings and photos apart from the luma
+// gradients and colors of a sample grid over img:
+//   - photos are colorful and mostly soft shading, which flat-colored
+//     artwork is not;
+//   - text is a light page with hardly any midtones and some sharp edges;
+//   - anything else is a drawing.
+func ClassifyContent(img image.Image) (Content, ContentStats) {
+	gray := Luma(img)
+	bounds := gray.Bounds()
+	var stats ContentStats
+	if bounds.Dx() < 2 || bounds.Dy() < 2 {
+		return ContentDrawing, stats
+	}
+
+	step := max(1, max(bounds.Dx(), bounds.Dy())/contentSamples)
+	_, isGray := img.(*image.Gray)
+	samples, edges, soft, light, midtones := 0, 0, 0, 0, 0
+	colorfulness := 0
+	for y := bounds.Min.Y; y+step < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x+step < bounds.Max.X; x += step {
+			v := int(gray.Pix[gray.PixOffset(x, y)])
+			dx := v - int(gray.Pix[gray.PixOffset(x+step, y)])
+			dy := v - int(gray.Pix[gray.PixOffset(x, y+step)])
+			switch gradient := abs(dx) + abs(dy); {
+			case gradient > edgeGradient:
+				edges++
+			case gradient > flatGradient:
+				soft++
+			}
+			switch {
+			case v >= lightLuma:
+				light++
+			case v > darkLuma:
+				midtones++
+			}
+			if !isGray {
+				r, g, b, _ := img.At(x, y).RGBA()
+				colorfulness += int(max(r, g, b)>>8) - int(min(r, g, b)>>8)
+			}
+			samples++
+		}
+	}
+
+	n := float64(samples)
+	stats = ContentStats{
+		EdgeRatio:    float64(edges) / n,
+		SoftRatio:    float64(soft) / n,
+		LightRatio:   float64(light) / n,
+		MidtoneRatio: float64(midtones) / n,
+		Colorfulness: float64(colorfulness) / n,
+	}
+	switch {
+	case stats.Colorfulness >= 24 && stats.SoftRatio >= 0.35:
+		return ContentPhoto, stats
+	case stats.LightRatio >= 0.8 && stats.MidtoneRatio < 0.1 && stats.EdgeRatio >= 0.01:
+		return ContentText, stats
+	}
+	return ContentDrawing, stats
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
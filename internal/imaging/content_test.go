@@ -0,0 +1,88 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// textPage draws lines of small glyphs on a white page.
+func textPage(width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for line := 40; line+12 < height-40; line += 24 {
+		for x := 40; x+6 < width-40; x += 10 {
+			for y := line; y < line+12; y++ {
+				img.SetGray(x+(y%3), y, color.Gray{})
+				img.SetGray(x+3, y, color.Gray{})
+			}
+		}
+	}
+	return img
+}
+
+// drawingPage draws flat-colored panels with black outlines.
+func drawingPage(width, height int) *image.RGBA {
+	fills := []color.RGBA{{230, 80, 60, 255}, {70, 140, 220, 255}, {250, 220, 90, 255}, {120, 200, 120, 255}}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			c := fills[(x/(width/2))+2*(y/(height/2))%4]
+			if x%(width/2) < 4 || y%(height/2) < 4 {
+				c = color.RGBA{A: 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// photoPage draws smooth color gradients with film grain.
+func photoPage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	seed := uint32(1)
+	for y := range height {
+		for x := range width {
+			seed = seed*1664525 + 1013904223
+			grain := int(seed>>24)%25 - 12
+			channel := func(v int) uint8 { return uint8(min(max(v+grain, 0), 255)) }
+			img.SetRGBA(x, y, color.RGBA{
+				R: channel(40 + 180*x/width),
+				G: channel(200 - 150*y/height),
+				B: channel(60 + 120*(x+y)/(width+height)),
+				A: 255,
+			})
+		}
+	}
+	return img
+}
+
+func TestClassifyContent(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want Content
+	}{
+		{"text", textPage(600, 900), ContentText},
+		{"drawing", drawingPage(600, 900), ContentDrawing},
+		{"photo", photoPage(600, 900), ContentPhoto},
+		{"photo in grayscale", Luma(photoPage(600, 900)), ContentDrawing},
+		{"too small", image.NewGray(image.Rect(0, 0, 1, 1)), ContentDrawing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, stats := ClassifyContent(tt.img)
+			assert.Equal(t, tt.want, content, "stats: %+v", stats)
+		})
+	}
+}
+
+func TestContent_String(t *testing.T) {
+	assert.Equal(t, "drawing", ContentDrawing.String())
+	assert.Equal(t, "text", ContentText.String())
+	assert.Equal(t, "photo", ContentPhoto.String())
+}
@@ -0,0 +1,60 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// grayOutlierRatio is the share of pixels allowed beyond the tolerance, so
+// a few stray colored pixels (JPEG ringing around screentone, scanner
+// specks) do not make a black-and-white page count as color.
+const grayOutlierRatio = 0.001
+
+// IsNearGrayscale reports whether img is effectively grayscale: apart from a
+// few outliers, the spread between the highest and lowest of each pixel's
+// R, G and B values is at most tolerance (0-255). Images stored as
+// grayscale always are; color pages are rejected as soon as enough colored
+// pixels have been seen.
+func IsNearGrayscale(img image.Image, tolerance uint8) bool {
+	var rgb func(x, y int) (uint8, uint8, uint8)
+	switch src := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	case *image.YCbCr:
+		rgb = func(x, y int) (uint8, uint8, uint8) {
+			c := src.COffset(x, y)
+			return color.YCbCrToRGB(src.Y[src.YOffset(x, y)], src.Cb[c], src.Cr[c])
+		}
+	case *image.RGBA:
+		rgb = func(x, y int) (uint8, uint8, uint8) {
+			i := src.PixOffset(x, y)
+			return src.Pix[i], src.Pix[i+1], src.Pix[i+2]
+		}
+	case *image.NRGBA:
+		rgb = func(x, y int) (uint8, uint8, uint8) {
+			i := src.PixOffset(x, y)
+			return src.Pix[i], src.Pix[i+1], src.Pix[i+2]
+		}
+	default:
+		rgb = func(x, y int) (uint8, uint8, uint8) {
+			r, g, b, _ := img.At(x, y).RGBA()
+			return uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)
+		}
+	}
+
+	bounds := img.Bounds()
+	maxOutliers := int(float64(bounds.Dx()*bounds.Dy()) * grayOutlierRatio)
+	outliers := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b := rgb(x, y)
+			if max(r, g, b)-min(r, g, b) > tolerance {
+				outliers++
+				if outliers > maxOutliers {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNearGrayscale(t *testing.T) {
+	grayRGBA := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 100; x++ {
+				v := uint8((x + y) * 255 / 198)
+				img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+			}
+		}
+		return img
+	}
+
+	tinted := grayRGBA()
+	for i := 0; i < len(tinted.Pix); i += 4 {
+		tinted.Pix[i] = min(255, tinted.Pix[i]+6)
+	}
+
+	speck := grayRGBA()
+	speck.Set(50, 50, color.RGBA{R: 255, A: 255})
+
+	colorInsert := grayRGBA()
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			colorInsert.Set(x, y, color.RGBA{R: 200, G: 40, B: 40, A: 255})
+		}
+	}
+
+	tests := []struct {
+		name      string
+		img       image.Image
+		tolerance uint8
+		expected  bool
+	}{
+		{name: "stored as gray", img: image.NewGray(image.Rect(0, 0, 10, 10)), expected: true},
+		{name: "gray stored as RGBA", img: grayRGBA(), expected: true},
+		{name: "slight tint within tolerance", img: tinted, tolerance: 8, expected: true},
+		{name: "slight tint beyond tolerance", img: tinted, tolerance: 4, expected: false},
+		{name: "single colored speck", img: speck, tolerance: 8, expected: true},
+		{name: "color insert", img: colorInsert, tolerance: 32, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsNearGrayscale(tt.img, tt.tolerance))
+		})
+	}
+}
+
+func TestIsNearGrayscale_JPEG(t *testing.T) {
+	// JPEG stores RGB pages as YCbCr; a gray page survives the round trip
+	// with chroma close to neutral, a color one does not.
+	roundTrip := func(img image.Image) image.Image {
+		var buf bytes.Buffer
+		require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}))
+		decoded, err := jpeg.Decode(&buf)
+		require.NoError(t, err)
+		return decoded
+	}
+
+	gray := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	colored := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(x * 4)
+			gray.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+			colored.Set(x, y, color.RGBA{R: v, G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+
+	decodedGray := roundTrip(gray)
+	require.IsType(t, &image.YCbCr{}, decodedGray)
+	assert.True(t, IsNearGrayscale(decodedGray, 16))
+	assert.False(t, IsNearGrayscale(roundTrip(colored), 16))
+}
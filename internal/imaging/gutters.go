@@ -0,0 +1,84 @@
+package imaging
+
+import "image"
+
+const (
+	// gutterSearchRatio is the share of the slice height searched above each
+	// fixed cut for a gutter to cut at instead.
+	gutterSearchRatio = 0.25
+	// gutterTolerance is how far (0-255) the pixels of a gutter row may
+	// stray from the row's mean luma.
+	gutterTolerance = 24
+)
+
+// FixedSliceRows returns the cut rows that split the rows minY to maxY into
+// slices of sliceHeight, the last one taking the remainder. The result
+// starts with minY and ends with maxY.
+func FixedSliceRows(minY, maxY, sliceHeight int) []int {
+	cuts := []int{minY}
+	for y := minY + sliceHeight; y < maxY; y += sliceHeight {
+		cuts = append(cuts, y)
+	}
+	return append(cuts, maxY)
+}
+
+// SliceRows returns the cut rows that split the tall img into slices of at
+// most sliceHeight, choosing cuts in the gutters between panels so speech
+// bubbles and artwork are not sliced through. The result starts with the
+// top of img and ends with its bottom.
+//
+// Each cut is searched within a quarter of sliceHeight above the fixed cut:
+// a cut already inside a gutter is kept, otherwise the nearest gutter is cut
+// through its middle. Where there is no gutter in reach, the fixed cut is
+// used.
+func SliceRows(img image.Image, sliceHeight int) []int {
+	gray := Luma(img)
+	bounds := gray.Bounds()
+	if sliceHeight <= 0 || bounds.Dy() <= sliceHeight {
+		return []int{bounds.Min.Y, bounds.Max.Y}
+	}
+
+	maxNoise := int(float64(bounds.Dx()) * borderNoiseRatio)
+	isGutter := func(y int) bool {
+		line := gray.Pix[gray.PixOffset(bounds.Min.X, y) : gray.PixOffset(bounds.Max.X-1, y)+1]
+		sum := 0
+		for _, v := range line {
+			sum += int(v)
+		}
+		mean := sum / len(line)
+		noise := 0
+		for _, v := range line {
+			if d := int(v) - mean; d > gutterTolerance || d < -gutterTolerance {
+				noise++
+				if noise > maxNoise {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	window := int(float64(sliceHeight) * gutterSearchRatio)
+	cuts := []int{bounds.Min.Y}
+	for start := bounds.Min.Y; bounds.Max.Y-start > sliceHeight; {
+		target := start + sliceHeight
+		lowest := max(target-window, start+1)
+		cut := target
+		if !isGutter(target-1) || !isGutter(target) {
+			for y := target - 1; y >= lowest; y-- {
+				if !isGutter(y) {
+					continue
+				}
+				top := y
+				for top > lowest && isGutter(top-1) {
+					top--
+				}
+				cut = (top + y + 1) / 2
+				break
+			}
+		}
+		cuts = append(cuts, cut)
+		start = cut
+	}
+	return append(cuts, bounds.Max.Y)
+}
@@ -0,0 +1,56 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stripPage returns a width x height strip of busy artwork with white
+// gutters at the given row ranges.
+func stripPage(width, height int, gutters ...[2]int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*13) % 200)})
+		}
+	}
+	for _, gutter := range gutters {
+		for y := gutter[0]; y < gutter[1]; y++ {
+			for x := 0; x < width; x++ {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestFixedSliceRows(t *testing.T) {
+	assert.Equal(t, []int{0, 100, 200, 250}, FixedSliceRows(0, 250, 100))
+	assert.Equal(t, []int{10, 110, 210}, FixedSliceRows(10, 210, 100))
+	assert.Equal(t, []int{0, 80}, FixedSliceRows(0, 80, 100))
+}
+
+func TestSliceRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		img      image.Image
+		expected []int
+	}{
+		{name: "short page", img: stripPage(50, 80), expected: []int{0, 80}},
+		{name: "no gutter", img: stripPage(50, 250), expected: []int{0, 100, 200, 250}},
+		{name: "gutter before the cut", img: stripPage(50, 250, [2]int{80, 90}), expected: []int{0, 85, 185, 250}},
+		{name: "cut already in a gutter", img: stripPage(50, 250, [2]int{95, 110}), expected: []int{0, 100, 200, 250}},
+		{name: "gutter out of reach", img: stripPage(50, 250, [2]int{40, 50}), expected: []int{0, 100, 200, 250}},
+		{name: "blank page", img: image.NewGray(image.Rect(0, 0, 50, 250)), expected: []int{0, 100, 200, 250}},
+		{name: "gutter partly out of reach", img: stripPage(50, 250, [2]int{80, 90}).SubImage(image.Rect(0, 10, 50, 250)), expected: []int{10, 87, 187, 250}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SliceRows(tt.img, 100))
+		})
+	}
+}
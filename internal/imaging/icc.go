@@ -0,0 +1,248 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// ErrUnsupportedProfile is returned by ParseICC for profiles that are not
+// RGB matrix/TRC profiles, such as CMYK or LUT-based ones.
+var ErrUnsupportedProfile = errors.New("unsupported icc profile")
+
+// iccProfileTolerance is how far a profile's colorants and curves may stray
+// from sRGB for it to be treated as sRGB.
+const iccProfileTolerance = 0.003
+
+// srgbToPCS holds the sRGB primaries adapted to the D50 white of the ICC
+// profile connection space, one column per channel.
+var srgbToPCS = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// ColorProfile is an RGB matrix/TRC ICC profile, the kind Adobe RGB, Display
+// P3 and the sRGB profiles themselves are, reduced to what it takes to
+// convert pixels to sRGB.
+type ColorProfile struct {
+	// toPCS maps linear RGB to D50 XYZ, one column per channel.
+	toPCS [3][3]float64
+	// curves linearizes each 8-bit channel value.
+	curves [3][256]float64
+}
+
+// ParseICC parses an ICC profile. Only RGB matrix/TRC profiles are
+// supported; others return ErrUnsupportedProfile.
+func ParseICC(data []byte) (*ColorProfile, error) {
+	if len(data) < 132 {
+		return nil, errors.New("icc profile too short")
+	}
+	if string(data[16:20]) != "RGB " || string(data[20:24]) != "XYZ " {
+		return nil, ErrUnsupportedProfile
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:132]))
+	for i := range count {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			return nil, errors.New("icc tag table truncated")
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, errors.New("icc tag out of bounds")
+		}
+		tags[string(data[entry:entry+4])] = data[offset : offset+size]
+	}
+
+	profile := &ColorProfile{}
+	for channel, name := range []string{"r", "g", "b"} {
+		xyz, ok := tags[name+"XYZ"]
+		if !ok || len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return nil, ErrUnsupportedProfile
+		}
+		for row := range 3 {
+			profile.toPCS[row][channel] = s15Fixed16(xyz[8+row*4:])
+		}
+
+		trc, ok := tags[name+"TRC"]
+		if !ok {
+			return nil, ErrUnsupportedProfile
+		}
+		curve, err := parseCurve(trc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %sTRC: %w", name, err)
+		}
+		for v := range 256 {
+			profile.curves[channel][v] = curve(float64(v) / 255)
+		}
+	}
+	return profile, nil
+}
+
+// parseCurve parses a curv or para tone curve into the function it describes
+// over [0, 1].
+func parseCurve(tag []byte) (func(float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("curve too short")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if 12+count*2 > len(tag) {
+			return nil, errors.New("curve truncated")
+		}
+		switch count {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		}
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+i*2:])) / 65535
+		}
+		return func(x float64) float64 {
+			pos := x * float64(count-1)
+			i := min(int(pos), count-2)
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+
+	case "para":
+		paramCounts := []int{1, 3, 4, 5, 7}
+		kind := int(binary.BigEndian.Uint16(tag[8:]))
+		if kind >= len(paramCounts) || 12+paramCounts[kind]*4 > len(tag) {
+			return nil, errors.New("unsupported parametric curve")
+		}
+		// g, a, b, c, d, e, f as named by the ICC specification.
+		p := []float64{0, 1, 0, 0, 0, 0, 0}
+		for i := range paramCounts[kind] {
+			p[i] = s15Fixed16(tag[12+i*4:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch kind {
+		case 1, 2:
+			// The linear segment is replaced by the constant c (0 for type 1).
+			d, e, f = -b/a, c, c
+			c = 0
+		case 3:
+			e, f = 0, 0
+		}
+		if kind == 0 {
+			return func(x float64) float64 { return math.Pow(x, g) }, nil
+		}
+		return func(x float64) float64 {
+			if x >= d {
+				return math.Pow(max(a*x+b, 0), g) + e
+			}
+			return c*x + f
+		}, nil
+	}
+	return nil, ErrUnsupportedProfile
+}
+
+// s15Fixed16 reads an ICC signed 15.16 fixed-point number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// IsSRGB reports whether the profile describes sRGB, within rounding, so
+// pixels tagged with it need no conversion.
+func (p *ColorProfile) IsSRGB() bool {
+	for row := range 3 {
+		for col := range 3 {
+			if math.Abs(p.toPCS[row][col]-srgbToPCS[row][col]) > iccProfileTolerance {
+				return false
+			}
+		}
+	}
+	for _, curve := range p.curves {
+		for v, linear := range curve {
+			if math.Abs(linear-srgbToLinear(float64(v)/255)) > iccProfileTolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ToSRGB returns img, whose pixels are in the profile's color space,
+// converted to sRGB. Colors outside the sRGB gamut are clipped.
+func (p *ColorProfile) ToSRGB(img image.Image) *image.NRGBA {
+	bounds := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+
+	toSRGB := multiply3(invert3(srgbToPCS), p.toPCS)
+	var encode [4096]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(linearToSRGB(float64(i)/4095) * 255))
+	}
+
+	for i := 0; i < len(dst.Pix); i += 4 {
+		px := dst.Pix[i : i+3 : i+3]
+		linear := [3]float64{p.curves[0][px[0]], p.curves[1][px[1]], p.curves[2][px[2]]}
+		for c := range 3 {
+			v := toSRGB[c][0]*linear[0] + toSRGB[c][1]*linear[1] + toSRGB[c][2]*linear[2]
+			px[c] = encode[int(math.Round(min(max(v, 0), 1)*4095))]
+		}
+	}
+	return dst
+}
+
+// srgbToLinear is the sRGB transfer function, from encoded to linear light.
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB is the inverse of srgbToLinear.
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func multiply3(a, b [3][3]float64) [3][3]float64 {
+	var m [3][3]float64
+	for row := range 3 {
+		for col := range 3 {
+			for k := range 3 {
+				m[row][col] += a[row][k] * b[k][col]
+			}
+		}
+	}
+	return m
+}
+
+func invert3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	return [3][3]float64{
+		{
+			(m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det,
+			(m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det,
+			(m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det,
+		},
+		{
+			(m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det,
+			(m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det,
+			(m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det,
+		},
+		{
+			(m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det,
+			(m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det,
+			(m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det,
+		},
+	}
+}
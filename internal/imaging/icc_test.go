@@ -0,0 +1,61 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseICC(t *testing.T) {
+	adobe, err := ParseICC(iccFixture(adobeRGBToPCS, gammaCurve(563.0/256)))
+	require.NoError(t, err)
+	assert.False(t, adobe.IsSRGB())
+	assert.InDelta(t, 0.2196, adobe.curves[1][128], 0.001, "gamma 2.2 at mid gray")
+
+	srgb, err := ParseICC(iccFixture(srgbToPCS, srgbCurve()))
+	require.NoError(t, err)
+	assert.True(t, srgb.IsSRGB())
+
+	// sRGB colorants with a plain gamma curve are not sRGB.
+	gamma, err := ParseICC(iccFixture(srgbToPCS, gammaCurve(1.8)))
+	require.NoError(t, err)
+	assert.False(t, gamma.IsSRGB())
+
+	cmyk := iccFixture(adobeRGBToPCS, gammaCurve(2.2))
+	copy(cmyk[16:], "CMYK")
+	_, err = ParseICC(cmyk)
+	assert.ErrorIs(t, err, ErrUnsupportedProfile)
+
+	_, err = ParseICC([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestColorProfile_ToSRGB(t *testing.T) {
+	profile, err := ParseICC(iccFixture(adobeRGBToPCS, gammaCurve(563.0/256)))
+	require.NoError(t, err)
+
+	img := image.NewNRGBA(image.Rect(5, 5, 9, 6))
+	img.SetNRGBA(5, 5, color.NRGBA{255, 255, 255, 255})
+	img.SetNRGBA(6, 5, color.NRGBA{128, 128, 128, 255})
+	img.SetNRGBA(7, 5, color.NRGBA{0, 128, 0, 200})
+	img.SetNRGBA(8, 5, color.NRGBA{0, 255, 0, 255})
+
+	converted := profile.ToSRGB(img)
+	assert.Equal(t, image.Rect(0, 0, 4, 1), converted.Bounds())
+	// Neutrals stay neutral: both spaces share the D65 white point.
+	assert.Equal(t, color.NRGBA{255, 255, 255, 255}, converted.NRGBAAt(0, 0))
+	gray := converted.NRGBAAt(1, 0)
+	assert.InDelta(t, 128, int(gray.R), 2)
+	assert.Equal(t, gray.R, gray.G)
+	assert.Equal(t, gray.R, gray.B)
+	// Adobe RGB greens are more saturated than sRGB's, so mid green maps to
+	// a brighter sRGB green. Alpha is left untouched.
+	green := converted.NRGBAAt(2, 0)
+	assert.Greater(t, green.G, uint8(128))
+	assert.Equal(t, uint8(200), green.A)
+	// Pure Adobe RGB green lies outside sRGB and is clipped to its edge.
+	assert.Equal(t, color.NRGBA{0, 255, 0, 255}, converted.NRGBAAt(3, 0))
+}
@@ -0,0 +1,272 @@
+// Package imaging holds the Go-side image helpers shared by the converters
+// for the cases their external encoders cannot handle on their own (input
+// formats they cannot read, regions they cannot crop). Everything here
+// decodes the page into memory, so converters only reach for it off the
+// file-to-file happy path.
+package imaging
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	_ "golang.org/x/image/bmp"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Dimensions reads only the image header to determine dimensions.
+// This is much cheaper than a full Decode — only a few bytes are read.
+func Dimensions(filePath string) (width, height int, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return config.Width, config.Height, nil
+}
+
+// maxPaletteColors is the most distinct colors an image may use and still
+// fit an 8-bit palette.
+const maxPaletteColors = 256
+
+// IsPaletteLike reports whether the image at filePath is stored with a
+// palette, or uses few enough distinct colors that it could be. Such pages
+// are typically flat line art where lossless compression beats lossy.
+func IsPaletteLike(filePath string) (bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := config.ColorModel.(color.Palette); ok {
+		return true, nil
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return false, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return false, err
+	}
+	return CountColors(img, maxPaletteColors) <= maxPaletteColors, nil
+}
+
+// CountColors returns the number of distinct colors in img. Counting stops
+// as soon as more than limit colors have been seen, in which case limit+1 is
+// returned, so photographic pages are rejected after a few rows.
+func CountColors(img image.Image, limit int) int {
+	seen := make(map[uint64]struct{}, limit+1)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			seen[uint64(r)<<48|uint64(g)<<32|uint64(b)<<16|uint64(a)] = struct{}{}
+			if len(seen) > limit {
+				return limit + 1
+			}
+		}
+	}
+	return len(seen)
+}
+
+// Decode fully decodes the image stored at filePath.
+func Decode(filePath string) (image.Image, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// IsStoredGray reports whether the image at filePath is stored as
+// grayscale, reading only its header. Files that cannot be read are not.
+func IsStoredGray(filePath string) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return false
+	}
+	return config.ColorModel == color.GrayModel || config.ColorModel == color.Gray16Model
+}
+
+// IsAnimatedGIF reports whether the file at filePath is a GIF with more than
+// one frame. Only the block structure is walked, up to the second image
+// descriptor, so no frame is decoded. Files that are not GIFs or cannot be
+// read are not.
+func IsAnimatedGIF(filePath string) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	r := bufio.NewReader(f)
+
+	// Header and logical screen descriptor, whose packed field tells about
+	// the global color table that follows.
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return false
+	}
+	if version := string(header[:6]); version != "GIF87a" && version != "GIF89a" {
+		return false
+	}
+	if err := skipColorTable(r, header[10]); err != nil {
+		return false
+	}
+
+	frames := 0
+	for {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		switch introducer {
+		case 0x2C: // Image descriptor
+			if frames++; frames > 1 {
+				return true
+			}
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return false
+			}
+			if err := skipColorTable(r, descriptor[8]); err != nil {
+				return false
+			}
+			// LZW minimum code size, then the image data.
+			if _, err := r.ReadByte(); err != nil {
+				return false
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return false
+			}
+		case 0x21: // Extension: its label, then its data.
+			if _, err := r.ReadByte(); err != nil {
+				return false
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return false
+			}
+		default: // Trailer, or not a block at all.
+			return false
+		}
+	}
+}
+
+// skipColorTable skips the color table announced by the packed field of a
+// GIF logical screen or image descriptor, if any.
+func skipColorTable(r *bufio.Reader, packed byte) error {
+	if packed&0x80 == 0 {
+		return nil
+	}
+	_, err := r.Discard(3 << ((packed & 0x07) + 1))
+	return err
+}
+
+// skipSubBlocks skips GIF data sub-blocks up to their zero-length terminator.
+func skipSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil || size == 0 {
+			return err
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// Crop returns the rect portion of img, sharing pixels with img when its
+// concrete type supports it and copying otherwise.
+func Crop(img image.Image, rect image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// SpreadHalves cuts the bounds of a double-page spread down the middle and
+// returns both halves in reading order: the right half first when
+// rightToLeft is set. An odd middle column goes to the right half.
+func SpreadHalves(bounds image.Rectangle, rightToLeft bool) []image.Rectangle {
+	middle := bounds.Min.X + bounds.Dx()/2
+	left := image.Rect(bounds.Min.X, bounds.Min.Y, middle, bounds.Max.Y)
+	right := image.Rect(middle, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)
+	if rightToLeft {
+		return []image.Rectangle{right, left}
+	}
+	return []image.Rectangle{left, right}
+}
+
+// Resize scales img to width x height with a Catmull-Rom filter, the
+// sharpest of x/image/draw's scalers, which keeps line art and text crisp
+// when downscaling. Grayscale images stay grayscale.
+func Resize(img image.Image, width, height int) image.Image {
+	rect := image.Rect(0, 0, width, height)
+	var dst draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		dst = image.NewGray(rect)
+	} else {
+		dst = image.NewRGBA(rect)
+	}
+	xdraw.CatmullRom.Scale(dst, rect, img, img.Bounds(), xdraw.Src, nil)
+	return dst
+}
+
+// WritePNG stages img as a PNG file for an external encoder to read.
+// Speed matters more than size here: the file only lives until the encoder
+// has consumed it. On failure the partial file is removed.
+func WritePNG(img image.Image, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create intermediate png: %w", err)
+	}
+
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	err = encoder.Encode(f, img)
+	closeErr := f.Close()
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to encode intermediate png: %w", err)
+	}
+	if closeErr != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to close intermediate png: %w", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDimensions(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name          string
+		width, height int
+	}{
+		{"small image", 100, 200},
+		{"wide image", 1920, 1080},
+		{"tall image", 800, 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".jpg")
+			f, err := os.Create(path)
+			require.NoError(t, err)
+			require.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, tt.width, tt.height)), nil))
+			require.NoError(t, f.Close())
+
+			w, h, err := Dimensions(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.width, w)
+			assert.Equal(t, tt.height, h)
+		})
+	}
+}
+
+func TestDimensions_NonexistentFile(t *testing.T) {
+	_, _, err := Dimensions("/nonexistent/file.jpg")
+	assert.Error(t, err)
+}
+
+func TestDimensions_InvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invalid.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("not an image"), 0644))
+
+	_, _, err := Dimensions(path)
+	assert.Error(t, err)
+
+	_, err = Decode(path)
+	assert.Error(t, err)
+}
+
+func TestCrop(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 30))
+	img.SetGray(5, 15, color.Gray{Y: 200})
+
+	part := Crop(img, image.Rect(0, 10, 10, 20))
+	assert.Equal(t, 10, part.Bounds().Dx())
+	assert.Equal(t, 10, part.Bounds().Dy())
+	r, _, _, _ := part.At(5, 15).RGBA()
+	assert.Equal(t, uint32(200)<<8|200, r)
+}
+
+func TestWritePNG_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.png")
+
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	img.SetGray(1, 2, color.Gray{Y: 77})
+	require.NoError(t, WritePNG(img, path))
+
+	decoded, err := Decode(path)
+	require.NoError(t, err)
+	assert.Equal(t, img.Bounds(), decoded.Bounds())
+	r, _, _, _ := decoded.At(1, 2).RGBA()
+	assert.Equal(t, uint32(77)<<8|77, r)
+}
+
+func TestWritePNG_InvalidPath(t *testing.T) {
+	err := WritePNG(image.NewGray(image.Rect(0, 0, 1, 1)), filepath.Join(t.TempDir(), "missing", "page.png"))
+	assert.Error(t, err)
+}
+
+func writeTestPNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+}
+
+func TestIsPaletteLike(t *testing.T) {
+	dir := t.TempDir()
+
+	paletted := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.Black, color.White})
+	palettedPath := filepath.Join(dir, "paletted.png")
+	writeTestPNG(t, palettedPath, paletted)
+
+	// RGBA storage, but only two colors actually used.
+	flat := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		flat.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	flatPath := filepath.Join(dir, "flat.png")
+	writeTestPNG(t, flatPath, flat)
+
+	noisy := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			noisy.Set(x, y, color.RGBA{R: uint8(x * 8), G: uint8(y * 8), B: uint8(x ^ y), A: 255})
+		}
+	}
+	noisyPath := filepath.Join(dir, "noisy.png")
+	writeTestPNG(t, noisyPath, noisy)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected bool
+	}{
+		{"paletted png", palettedPath, true},
+		{"few colors rgba png", flatPath, true},
+		{"many colors", noisyPath, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsPaletteLike(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCountColors_StopsAtLimit(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		img.SetGray(x, 0, color.Gray{Y: uint8(x)})
+	}
+	assert.Equal(t, 256, CountColors(img, 300))
+	assert.Equal(t, 11, CountColors(img, 10))
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 40, 80))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.RGBA{R: 200, G: 100, B: 50, A: 255}), image.Point{}, draw.Src)
+
+	resized := Resize(src, 10, 20)
+	assert.Equal(t, image.Rect(0, 0, 10, 20), resized.Bounds())
+	r, g, b, _ := resized.At(5, 10).RGBA()
+	assert.Equal(t, []uint32{200, 100, 50}, []uint32{r >> 8, g >> 8, b >> 8})
+
+	gray := Resize(image.NewGray(image.Rect(0, 0, 40, 80)), 10, 20)
+	assert.IsType(t, &image.Gray{}, gray, "grayscale pages should stay grayscale")
+
+	// Sub-images with a non-zero origin are scaled from their own bounds.
+	sub := Crop(src, image.Rect(10, 20, 30, 60))
+	assert.Equal(t, image.Rect(0, 0, 5, 10), Resize(sub, 5, 10).Bounds())
+}
+
+func TestSpreadHalves(t *testing.T) {
+	bounds := image.Rect(10, 20, 211, 120)
+	left := image.Rect(10, 20, 110, 120)
+	right := image.Rect(110, 20, 211, 120)
+
+	assert.Equal(t, []image.Rectangle{left, right}, SpreadHalves(bounds, false))
+	assert.Equal(t, []image.Rectangle{right, left}, SpreadHalves(bounds, true))
+}
+
+func TestIsStoredGray(t *testing.T) {
+	dir := t.TempDir()
+	writeJPEG := func(name string, img image.Image) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, jpeg.Encode(f, img, nil))
+		require.NoError(t, f.Close())
+		return path
+	}
+
+	assert.True(t, IsStoredGray(writeJPEG("gray.jpg", image.NewGray(image.Rect(0, 0, 8, 8)))))
+	assert.False(t, IsStoredGray(writeJPEG("color.jpg", image.NewRGBA(image.Rect(0, 0, 8, 8)))))
+	assert.False(t, IsStoredGray(filepath.Join(dir, "missing.jpg")))
+}
+
+func TestIsAnimatedGIF(t *testing.T) {
+	dir := t.TempDir()
+	palette := color.Palette{color.Black, color.White}
+	writeGIF := func(name string, frames int, globalPalette bool) string {
+		path := filepath.Join(dir, name)
+		animation := &gif.GIF{}
+		if globalPalette {
+			// A global color table and a looping application extension.
+			animation.Config = image.Config{ColorModel: palette, Width: 8, Height: 8}
+			animation.LoopCount = 0
+		}
+		for i := 0; i < frames; i++ {
+			frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+			frame.SetColorIndex(i%8, 0, 1)
+			animation.Image = append(animation.Image, frame)
+			animation.Delay = append(animation.Delay, 10)
+		}
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, gif.EncodeAll(f, animation))
+		require.NoError(t, f.Close())
+		return path
+	}
+
+	assert.True(t, IsAnimatedGIF(writeGIF("animated.gif", 3, false)))
+	assert.True(t, IsAnimatedGIF(writeGIF("global.gif", 2, true)))
+	assert.False(t, IsAnimatedGIF(writeGIF("still.gif", 1, false)))
+	assert.False(t, IsAnimatedGIF(writeGIF("still-global.gif", 1, true)))
+
+	// Cut short within the first frame, the second one is never reached.
+	data, err := os.ReadFile(filepath.Join(dir, "animated.gif"))
+	require.NoError(t, err)
+	truncatedPath := filepath.Join(dir, "truncated.gif")
+	require.NoError(t, os.WriteFile(truncatedPath, data[:30], 0644))
+	assert.False(t, IsAnimatedGIF(truncatedPath))
+
+	pngPath := filepath.Join(dir, "page.png")
+	f, err := os.Create(pngPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 8))))
+	require.NoError(t, f.Close())
+	assert.False(t, IsAnimatedGIF(pngPath))
+	assert.False(t, IsAnimatedGIF(filepath.Join(dir, "missing.gif")))
+}
@@ -0,0 +1,109 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// minLevelsRange is the narrowest luma range AutoLevels stretches: pages
+// spanning fewer levels are blank or nearly so, and stretching them would
+// only amplify paper texture and noise.
+const minLevelsRange = 16
+
+// Levels maps every 8-bit channel value to its adjusted value.
+type Levels [256]uint8
+
+// IsIdentity reports whether the levels leave every value unchanged.
+func (l *Levels) IsIdentity() bool {
+	for v, out := range l {
+		if int(out) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// AutoLevels returns the levels stretching the luma range of img to the full
+// 0-255 range, then applying gamma. The black and white points are the luma
+// values below and above which clip percent (0-50) of the pixels fall, so a
+// few specks of dust or a stray scanner highlight do not hold the stretch
+// back. Gamma above 1 lightens the midtones and below 1 darkens them; 1 or 0
+// leaves them alone. autoLevels false only applies the gamma.
+func AutoLevels(img image.Image, autoLevels bool, clip float64, gamma float64) *Levels {
+	black, white := 0, 255
+	if autoLevels {
+		black, white = clipPoints(Luma(img), clip)
+		if white-black < minLevelsRange {
+			black, white = 0, 255
+		}
+	}
+	if gamma <= 0 {
+		gamma = 1
+	}
+
+	var levels Levels
+	for v := range levels {
+		x := float64(v-black) / float64(white-black)
+		x = min(max(x, 0), 1)
+		levels[v] = uint8(math.Round(math.Pow(x, 1/gamma) * 255))
+	}
+	return &levels
+}
+
+// clipPoints returns the luma values below and above which clip percent of
+// the pixels of gray fall.
+func clipPoints(gray *image.Gray, clip float64) (int, int) {
+	var histogram [256]int
+	bounds := gray.Bounds()
+	for y := 0; y < bounds.Dy(); y++ {
+		row := gray.Pix[y*gray.Stride : y*gray.Stride+bounds.Dx()]
+		for _, v := range row {
+			histogram[v]++
+		}
+	}
+
+	limit := int(float64(bounds.Dx()*bounds.Dy()) * clip / 100)
+	black, seen := 0, 0
+	for black < 255 {
+		if seen += histogram[black]; seen > limit {
+			break
+		}
+		black++
+	}
+	white, seen := 255, 0
+	for white > 0 {
+		if seen += histogram[white]; seen > limit {
+			break
+		}
+		white--
+	}
+	return black, white
+}
+
+// Apply returns img with the levels applied to each of its R, G and B
+// channels, or to its single channel for grayscale images. Applying the same
+// curve to every channel keeps neutral grays neutral.
+func (l *Levels) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	if src, ok := img.(*image.Gray); ok {
+		dst := image.NewGray(bounds)
+		for y := 0; y < bounds.Dy(); y++ {
+			srcRow := src.Pix[y*src.Stride:]
+			dstRow := dst.Pix[y*dst.Stride:]
+			for x := 0; x < bounds.Dx(); x++ {
+				dstRow[x] = l[srcRow[x]]
+			}
+		}
+		return dst
+	}
+
+	dst := image.NewNRGBA(bounds)
+	draw.Draw(dst, bounds, img, bounds.Min, draw.Src)
+	for i := 0; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = l[dst.Pix[i]]
+		dst.Pix[i+1] = l[dst.Pix[i+1]]
+		dst.Pix[i+2] = l[dst.Pix[i+2]]
+	}
+	return dst
+}
@@ -0,0 +1,107 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fadedScan returns a gray-on-gray gradient spanning luma 60-190, with a few
+// pure black and pure white specks.
+func fadedScan() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 131, 100))
+	for y := range 100 {
+		for x := range 131 {
+			img.Pix[y*img.Stride+x] = uint8(60 + x)
+		}
+	}
+	img.Pix[0] = 0
+	img.Pix[1] = 255
+	return img
+}
+
+func TestAutoLevels(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        image.Image
+		autoLevels bool
+		clip       float64
+		gamma      float64
+		check      func(t *testing.T, levels *Levels)
+	}{
+		{
+			name:       "stretches past the clipped specks",
+			img:        fadedScan(),
+			autoLevels: true,
+			clip:       0.5,
+			gamma:      1,
+			check: func(t *testing.T, levels *Levels) {
+				assert.Equal(t, uint8(0), levels[60])
+				assert.Equal(t, uint8(255), levels[190])
+				assert.InDelta(t, 128, int(levels[125]), 2)
+			},
+		},
+		{
+			name:       "specks hold the stretch back without clipping",
+			img:        fadedScan(),
+			autoLevels: true,
+			clip:       0,
+			gamma:      1,
+			check: func(t *testing.T, levels *Levels) {
+				assert.True(t, levels.IsIdentity())
+			},
+		},
+		{
+			name:       "blank page is left alone",
+			img:        uniformGray(50, 50, 240),
+			autoLevels: true,
+			clip:       0.5,
+			gamma:      1,
+			check: func(t *testing.T, levels *Levels) {
+				assert.True(t, levels.IsIdentity())
+			},
+		},
+		{
+			name:  "gamma only",
+			img:   fadedScan(),
+			gamma: 2,
+			check: func(t *testing.T, levels *Levels) {
+				assert.Equal(t, uint8(0), levels[0])
+				assert.Equal(t, uint8(255), levels[255])
+				assert.Greater(t, levels[64], uint8(64), "gamma above 1 lightens the midtones")
+			},
+		},
+		{
+			name:  "no adjustment",
+			img:   fadedScan(),
+			gamma: 0,
+			check: func(t *testing.T, levels *Levels) {
+				assert.True(t, levels.IsIdentity())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, AutoLevels(tt.img, tt.autoLevels, tt.clip, tt.gamma))
+		})
+	}
+}
+
+func TestLevels_Apply(t *testing.T) {
+	var invert Levels
+	for v := range invert {
+		invert[v] = uint8(255 - v)
+	}
+
+	gray := invert.Apply(uniformGray(4, 4, 10))
+	assert.Equal(t, color.Gray{Y: 245}, gray.(*image.Gray).GrayAt(3, 3))
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	rgba.SetRGBA(1, 1, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	out := invert.Apply(rgba)
+	assert.Equal(t, color.NRGBA{R: 245, G: 235, B: 225, A: 255}, out.(*image.NRGBA).NRGBAAt(1, 1))
+	assert.Equal(t, color.RGBA{R: 10, G: 20, B: 30, A: 255}, rgba.RGBAAt(1, 1), "the source is left untouched")
+}
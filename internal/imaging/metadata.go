@@ -0,0 +1,301 @@
+package imaging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"sort"
+)
+
+// Metadata is what a page file says about how it is meant to be displayed.
+type Metadata struct {
+	// Orientation is the EXIF orientation (1-8), 1 when the file has none.
+	Orientation int
+	// ICC is the embedded ICC profile, nil when the file has none.
+	ICC []byte
+}
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader    = []byte("Exif\x00\x00")
+	iccHeader     = []byte("ICC_PROFILE\x00")
+)
+
+// ReadMetadata reads the EXIF orientation and ICC profile of the JPEG or PNG
+// at filePath, stopping before the image data. Other formats are reported
+// as having neither.
+func ReadMetadata(filePath string) (Metadata, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := bufio.NewReader(f)
+	signature, err := r.Peek(len(pngSignature))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Metadata{}, err
+	}
+	switch {
+	case bytes.HasPrefix(signature, jpegSignature):
+		return readJPEGMetadata(r)
+	case bytes.HasPrefix(signature, pngSignature):
+		return readPNGMetadata(r)
+	}
+	return Metadata{Orientation: 1}, nil
+}
+
+// readJPEGMetadata walks the JPEG segments up to the start of scan, reading
+// the orientation from the APP1 EXIF segment and reassembling the ICC
+// profile from its APP2 chunks.
+func readJPEGMetadata(r *bufio.Reader) (Metadata, error) {
+	md := Metadata{Orientation: 1}
+	if _, err := r.Discard(len(jpegSignature)); err != nil {
+		return md, err
+	}
+
+	iccChunks := map[byte][]byte{}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return md, fmt.Errorf("failed to read jpeg marker: %w", err)
+		}
+		if b != 0xFF {
+			return md, errors.New("invalid jpeg marker")
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return md, fmt.Errorf("failed to read jpeg marker: %w", err)
+		}
+		// Markers without a segment.
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		// Start of scan or end of image: the metadata is all behind us.
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		var length uint16
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return md, fmt.Errorf("failed to read jpeg segment: %w", err)
+		}
+		if length < 2 {
+			return md, errors.New("invalid jpeg segment length")
+		}
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return md, fmt.Errorf("failed to read jpeg segment: %w", err)
+		}
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, exifHeader):
+			md.Orientation = exifOrientation(segment[len(exifHeader):])
+		case marker == 0xE2 && bytes.HasPrefix(segment, iccHeader) && len(segment) > len(iccHeader)+2:
+			// Each chunk carries its sequence number (from 1) and the chunk count.
+			iccChunks[segment[len(iccHeader)]] = segment[len(iccHeader)+2:]
+		}
+	}
+
+	if len(iccChunks) > 0 {
+		sequence := make([]int, 0, len(iccChunks))
+		for seq := range iccChunks {
+			sequence = append(sequence, int(seq))
+		}
+		sort.Ints(sequence)
+		for _, seq := range sequence {
+			md.ICC = append(md.ICC, iccChunks[byte(seq)]...)
+		}
+	}
+	return md, nil
+}
+
+// readPNGMetadata walks the PNG chunks up to the image data, reading the
+// ICC profile from iCCP and the orientation from eXIf.
+func readPNGMetadata(r *bufio.Reader) (Metadata, error) {
+	md := Metadata{Orientation: 1}
+	if _, err := r.Discard(len(pngSignature)); err != nil {
+		return md, err
+	}
+
+	for {
+		var header struct {
+			Length uint32
+			Type   [4]byte
+		}
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return md, fmt.Errorf("failed to read png chunk: %w", err)
+		}
+		kind := string(header.Type[:])
+		if kind == "IDAT" || kind == "IEND" {
+			return md, nil
+		}
+		if kind != "iCCP" && kind != "eXIf" {
+			if _, err := r.Discard(int(header.Length) + 4); err != nil {
+				return md, fmt.Errorf("failed to read png chunk: %w", err)
+			}
+			continue
+		}
+
+		data := make([]byte, header.Length+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return md, fmt.Errorf("failed to read png chunk: %w", err)
+		}
+		data = data[:header.Length]
+		if kind == "eXIf" {
+			md.Orientation = exifOrientation(data)
+			continue
+		}
+
+		// Profile name, NUL, compression method, then the zlib stream.
+		nul := bytes.IndexByte(data, 0)
+		if nul < 0 || nul+2 > len(data) {
+			return md, errors.New("invalid png iccp chunk")
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data[nul+2:]))
+		if err != nil {
+			return md, fmt.Errorf("failed to read png icc profile: %w", err)
+		}
+		md.ICC, err = io.ReadAll(zr)
+		_ = zr.Close()
+		if err != nil {
+			return md, fmt.Errorf("failed to read png icc profile: %w", err)
+		}
+	}
+}
+
+// exifOrientation reads the orientation tag from the first IFD of the TIFF
+// structure EXIF data is stored as, returning 1 when it is missing or
+// invalid.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := range entries {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// Tag 0x0112, a SHORT stored in the first bytes of the value field.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// WritePNGWithProfile is WritePNG embedding the ICC profile in an iCCP chunk
+// so encoders reading the PNG keep the colors of the page it was decoded
+// from. A nil profile writes a plain PNG.
+func WritePNGWithProfile(img image.Image, path string, profile []byte) error {
+	if profile == nil {
+		return WritePNG(img, path)
+	}
+
+	var encoded bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&encoded, img); err != nil {
+		return fmt.Errorf("failed to encode intermediate png: %w", err)
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write(profile)
+	_ = zw.Close()
+	iccp := append([]byte("ICC Profile\x00\x00"), compressed.Bytes()...)
+
+	// The iCCP chunk must come before the image data: right after IHDR,
+	// which is always the first chunk (length, type, 13 bytes, CRC).
+	ihdrEnd := len(pngSignature) + 8 + 13 + 4
+	out := bytes.NewBuffer(make([]byte, 0, encoded.Len()+len(iccp)+12))
+	out.Write(encoded.Bytes()[:ihdrEnd])
+	writePNGChunk(out, "iCCP", iccp)
+	out.Write(encoded.Bytes()[ihdrEnd:])
+
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write intermediate png: %w", err)
+	}
+	return nil
+}
+
+// writePNGChunk appends a PNG chunk of kind with data to w.
+func writePNGChunk(w *bytes.Buffer, kind string, data []byte) {
+	_ = binary.Write(w, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	_, _ = crc.Write([]byte(kind))
+	_, _ = crc.Write(data)
+	w.WriteString(kind)
+	w.Write(data)
+	_ = binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// Normalize returns the page at filePath as it is meant to be displayed:
+// turned upright according to its EXIF orientation and, unless keepICC is
+// set, converted from its embedded ICC profile to sRGB. Encoders drop both
+// pieces of metadata, so they must be applied to the pixels beforehand.
+//
+// The returned profile is the one to embed with the normalized image: the
+// original one when keepICC is set, none otherwise. The image is nil when
+// the page needs no normalization — no orientation, and no profile or one
+// that is already sRGB, kept, or unsupported — so encoders can keep reading
+// the file itself.
+func Normalize(filePath string, keepICC bool) (image.Image, []byte, error) {
+	md, err := ReadMetadata(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var profile *ColorProfile
+	if md.ICC != nil && !keepICC {
+		if profile, err = ParseICC(md.ICC); err != nil || profile.IsSRGB() {
+			profile = nil
+		}
+	}
+	if md.Orientation <= 1 && profile == nil {
+		return nil, nil, nil
+	}
+
+	img, err := Decode(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if profile != nil {
+		img = profile.ToSRGB(img)
+	}
+	img = Orient(img, md.Orientation)
+	if keepICC {
+		return img, md.ICC, nil
+	}
+	return img, nil, nil
+}
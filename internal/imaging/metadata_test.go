@@ -0,0 +1,253 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adobeRGBToPCS holds the Adobe RGB (1998) primaries adapted to D50.
+var adobeRGBToPCS = [3][3]float64{
+	{0.6097559, 0.2052401, 0.1492240},
+	{0.3111242, 0.6256560, 0.0632197},
+	{0.0194811, 0.0608902, 0.7448387},
+}
+
+// gammaCurve is a curv tag holding a single gamma value.
+func gammaCurve(gamma float64) []byte {
+	tag := []byte("curv\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint32(tag, 1)
+	return binary.BigEndian.AppendUint16(tag, uint16(gamma*256+0.5))
+}
+
+// srgbCurve is a para tag holding the sRGB transfer function.
+func srgbCurve() []byte {
+	tag := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, p := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		tag = binary.BigEndian.AppendUint32(tag, uint32(int32(p*65536+0.5)))
+	}
+	return tag
+}
+
+// iccFixture builds an RGB matrix/TRC ICC profile with the given colorants
+// and one tone curve shared by the three channels.
+func iccFixture(toPCS [3][3]float64, curve []byte) []byte {
+	header := make([]byte, 128)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+
+	names := []string{"rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"}
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(names)))
+	offset := 128 + 4 + len(names)*12
+	var data []byte
+	for channel := range 3 {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for row := range 3 {
+			xyz = binary.BigEndian.AppendUint32(xyz, uint32(int32(toPCS[row][channel]*65536+0.5)))
+		}
+		table = append(table, names[channel]...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(xyz)))
+		data = append(data, xyz...)
+	}
+	curveOffset := offset + len(data)
+	data = append(data, curve...)
+	for _, name := range names[3:] {
+		table = append(table, name...)
+		table = binary.BigEndian.AppendUint32(table, uint32(curveOffset))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(curve)))
+	}
+
+	profile := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+// exifFixture builds the payload of an APP1 EXIF segment holding only an
+// orientation tag, in the given byte order.
+func exifFixture(order binary.AppendByteOrder, orientation int) []byte {
+	tiff := []byte("II")
+	if order == binary.BigEndian {
+		tiff = []byte("MM")
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, uint16(orientation))
+	tiff = order.AppendUint16(tiff, 0)
+	tiff = order.AppendUint32(tiff, 0)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+// writeJPEGFixture writes img as a JPEG at path, with an EXIF orientation
+// when orientation is set and an ICC profile, split over several APP2
+// segments, when profile is set.
+func writeJPEGFixture(t *testing.T, path string, img image.Image, orientation int, profile []byte) {
+	t.Helper()
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}))
+
+	segment := func(marker byte, payload []byte) []byte {
+		s := []byte{0xFF, marker}
+		s = binary.BigEndian.AppendUint16(s, uint16(len(payload)+2))
+		return append(s, payload...)
+	}
+	out := []byte{0xFF, 0xD8}
+	if orientation > 0 {
+		out = append(out, segment(0xE1, exifFixture(binary.BigEndian, orientation))...)
+	}
+	const chunkSize = 200
+	chunks := (len(profile) + chunkSize - 1) / chunkSize
+	for i := range chunks {
+		chunk := profile[i*chunkSize : min((i+1)*chunkSize, len(profile))]
+		payload := append([]byte("ICC_PROFILE\x00"), byte(i+1), byte(chunks))
+		out = append(out, segment(0xE2, append(payload, chunk...))...)
+	}
+	out = append(out, encoded.Bytes()[2:]...)
+	require.NoError(t, os.WriteFile(path, out, 0644))
+}
+
+func TestReadMetadata(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	profile := iccFixture(adobeRGBToPCS, gammaCurve(563.0/256))
+
+	t.Run("jpeg", func(t *testing.T) {
+		path := filepath.Join(dir, "page.jpg")
+		writeJPEGFixture(t, path, img, 6, profile)
+
+		md, err := ReadMetadata(path)
+		require.NoError(t, err)
+		assert.Equal(t, 6, md.Orientation)
+		assert.Equal(t, profile, md.ICC)
+	})
+
+	t.Run("jpeg without metadata", func(t *testing.T) {
+		path := filepath.Join(dir, "plain.jpg")
+		writeJPEGFixture(t, path, img, 0, nil)
+
+		md, err := ReadMetadata(path)
+		require.NoError(t, err)
+		assert.Equal(t, Metadata{Orientation: 1}, md)
+	})
+
+	t.Run("png", func(t *testing.T) {
+		path := filepath.Join(dir, "page.png")
+		require.NoError(t, WritePNGWithProfile(img, path, profile))
+
+		md, err := ReadMetadata(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1, md.Orientation)
+		assert.Equal(t, profile, md.ICC)
+
+		decoded, err := Decode(path)
+		require.NoError(t, err, "the iCCP chunk must keep the PNG valid")
+		assert.Equal(t, img.Bounds(), decoded.Bounds())
+	})
+
+	t.Run("other format", func(t *testing.T) {
+		path := filepath.Join(dir, "page.gif")
+		require.NoError(t, os.WriteFile(path, []byte("GIF89a"), 0644))
+
+		md, err := ReadMetadata(path)
+		require.NoError(t, err)
+		assert.Equal(t, Metadata{Orientation: 1}, md)
+	})
+}
+
+func TestExifOrientation(t *testing.T) {
+	exif := len("Exif\x00\x00")
+	assert.Equal(t, 8, exifOrientation(exifFixture(binary.LittleEndian, 8)[exif:]))
+	assert.Equal(t, 3, exifOrientation(exifFixture(binary.BigEndian, 3)[exif:]))
+	assert.Equal(t, 1, exifOrientation(exifFixture(binary.BigEndian, 9)[exif:]), "out of range")
+	assert.Equal(t, 1, exifOrientation([]byte("XX\x00\x2a")), "truncated")
+}
+
+func TestNormalize(t *testing.T) {
+	dir := t.TempDir()
+	// A tall page with a red top half, stored turned a quarter
+	// counter-clockwise as a phone would, so orientation 6 shows it upright.
+	stored := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := range 20 {
+		for x := range 40 {
+			c := color.RGBA{B: 255, A: 255}
+			if x < 20 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			stored.SetRGBA(x, y, c)
+		}
+	}
+	adobe := iccFixture(adobeRGBToPCS, gammaCurve(563.0/256))
+	srgb := iccFixture(srgbToPCS, srgbCurve())
+
+	t.Run("orientation", func(t *testing.T) {
+		path := filepath.Join(dir, "rotated.jpg")
+		writeJPEGFixture(t, path, stored, 6, nil)
+
+		img, profile, err := Normalize(path, false)
+		require.NoError(t, err)
+		require.NotNil(t, img)
+		assert.Nil(t, profile)
+		assert.Equal(t, image.Rect(0, 0, 20, 40), img.Bounds())
+		r, _, b, _ := img.At(10, 5).RGBA()
+		assert.Greater(t, r, b, "the red half should be on top")
+	})
+
+	t.Run("adobe rgb", func(t *testing.T) {
+		path := filepath.Join(dir, "adobe.jpg")
+		writeJPEGFixture(t, path, stored, 0, adobe)
+
+		img, profile, err := Normalize(path, false)
+		require.NoError(t, err)
+		require.NotNil(t, img)
+		assert.Nil(t, profile)
+		assert.Equal(t, stored.Bounds(), img.Bounds())
+	})
+
+	t.Run("adobe rgb kept", func(t *testing.T) {
+		path := filepath.Join(dir, "adobe.jpg")
+		img, profile, err := Normalize(path, true)
+		require.NoError(t, err)
+		assert.Nil(t, img, "nothing to do when the profile is kept and the page is upright")
+		assert.Nil(t, profile)
+	})
+
+	t.Run("rotated adobe rgb kept", func(t *testing.T) {
+		path := filepath.Join(dir, "rotated-adobe.jpg")
+		writeJPEGFixture(t, path, stored, 8, adobe)
+
+		img, profile, err := Normalize(path, true)
+		require.NoError(t, err)
+		require.NotNil(t, img)
+		assert.Equal(t, adobe, profile)
+		assert.Equal(t, image.Rect(0, 0, 20, 40), img.Bounds())
+	})
+
+	t.Run("srgb", func(t *testing.T) {
+		path := filepath.Join(dir, "srgb.jpg")
+		writeJPEGFixture(t, path, stored, 1, srgb)
+
+		img, profile, err := Normalize(path, false)
+		require.NoError(t, err)
+		assert.Nil(t, img)
+		assert.Nil(t, profile)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, _, err := Normalize(filepath.Join(dir, "missing.jpg"), false)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,53 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Orient returns img turned upright according to its EXIF orientation (1-8):
+// mirrored, rotated by a multiple of 90°, or both. Orientation 1 and values
+// out of range return img unchanged.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// source maps a pixel of the upright image back to the stored one.
+	var source func(x, y int) (int, int)
+	dstW, dstH := w, h
+	switch orientation {
+	case 2: // mirrored horizontally
+		source = func(x, y int) (int, int) { return w - 1 - x, y }
+	case 3: // rotated 180°
+		source = func(x, y int) (int, int) { return w - 1 - x, h - 1 - y }
+	case 4: // mirrored vertically
+		source = func(x, y int) (int, int) { return x, h - 1 - y }
+	case 5: // transposed
+		source = func(x, y int) (int, int) { return y, x }
+	case 6: // needs a 90° clockwise turn
+		source = func(x, y int) (int, int) { return y, h - 1 - x }
+	case 7: // transversed
+		source = func(x, y int) (int, int) { return w - 1 - y, h - 1 - x }
+	case 8: // needs a 90° counter-clockwise turn
+		source = func(x, y int) (int, int) { return w - 1 - y, x }
+	}
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := range dstH {
+		row := dst.Pix[y*dst.Stride:]
+		for x := range dstW {
+			sx, sy := source(x, y)
+			copy(row[x*4:x*4+4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,46 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image with a distinct gray level per pixel:
+	//   1 2 3
+	//   4 5 6
+	stored := image.NewGray(image.Rect(10, 10, 13, 12))
+	for i := range 6 {
+		stored.SetGray(10+i%3, 10+i/3, color.Gray{Y: uint8(i + 1)})
+	}
+
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{2, [][]uint8{{3, 2, 1}, {6, 5, 4}}},
+		{3, [][]uint8{{6, 5, 4}, {3, 2, 1}}},
+		{4, [][]uint8{{4, 5, 6}, {1, 2, 3}}},
+		{5, [][]uint8{{1, 4}, {2, 5}, {3, 6}}},
+		{6, [][]uint8{{4, 1}, {5, 2}, {6, 3}}},
+		{7, [][]uint8{{6, 3}, {5, 2}, {4, 1}}},
+		{8, [][]uint8{{3, 6}, {2, 5}, {1, 4}}},
+	}
+	for _, tt := range tests {
+		img := Orient(stored, tt.orientation)
+		got := make([][]uint8, img.Bounds().Dy())
+		for y := range got {
+			for x := range img.Bounds().Dx() {
+				r, _, _, _ := img.At(x, y).RGBA()
+				got[y] = append(got[y], uint8(r>>8))
+			}
+		}
+		assert.Equal(t, tt.want, got, "orientation %d", tt.orientation)
+	}
+
+	assert.Same(t, stored, Orient(stored, 1))
+	assert.Same(t, stored, Orient(stored, 9))
+}
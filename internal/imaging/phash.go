@@ -0,0 +1,57 @@
+package imaging
+
+import (
+	"image"
+	"math/bits"
+)
+
+// Hash is a 64-bit perceptual hash of an image, as computed by
+// PerceptualHash. Images that look alike have hashes a small Distance apart.
+type Hash uint64
+
+// PerceptualHash computes the difference hash of img: the image is averaged
+// down to 9x8 gray cells and each bit records whether a cell is brighter
+// than its right neighbor. It survives rescaling, recompression and small
+// level changes, so re-encoded copies of a page hash the same or nearly so.
+func PerceptualHash(img image.Image) Hash {
+	gray := Luma(img)
+	bounds := gray.Bounds()
+	if bounds.Empty() {
+		return 0
+	}
+
+	const cols, rows = 9, 8
+	var cells [rows][cols]float64
+	for row := range rows {
+		y0 := bounds.Min.Y + row*bounds.Dy()/rows
+		y1 := max(bounds.Min.Y+(row+1)*bounds.Dy()/rows, y0+1)
+		for col := range cols {
+			x0 := bounds.Min.X + col*bounds.Dx()/cols
+			x1 := max(bounds.Min.X+(col+1)*bounds.Dx()/cols, x0+1)
+			sum := 0
+			for y := y0; y < y1; y++ {
+				for _, v := range gray.Pix[gray.PixOffset(x0, y) : gray.PixOffset(x1-1, y)+1] {
+					sum += int(v)
+				}
+			}
+			cells[row][col] = float64(sum) / float64((x1-x0)*(y1-y0))
+		}
+	}
+
+	var h Hash
+	for row := range rows {
+		for col := range cols - 1 {
+			h <<= 1
+			if cells[row][col] > cells[row][col+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// Distance returns the number of bits h and other differ in, from 0 for
+// images that look the same to 64.
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
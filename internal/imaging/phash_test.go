@@ -0,0 +1,46 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// creditsPage draws bands of varying shade, standing in for a credits page.
+func creditsPage(width, height, bands int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			v := uint8((x*bands/width*37 + y*bands/height*91) % 256)
+			img.Set(x, y, color.RGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHash(t *testing.T) {
+	credits := creditsPage(720, 1024, 7)
+
+	// The same page released at another size and recompressed.
+	var recompressed bytes.Buffer
+	require.NoError(t, jpeg.Encode(&recompressed, Resize(credits, 360, 512), &jpeg.Options{Quality: 60}))
+	released, err := jpeg.Decode(&recompressed)
+	require.NoError(t, err)
+
+	hash := PerceptualHash(credits)
+	assert.LessOrEqual(t, hash.Distance(PerceptualHash(released)), 4)
+	assert.Greater(t, hash.Distance(PerceptualHash(creditsPage(720, 1024, 11))), 10)
+	assert.Equal(t, Hash(0), PerceptualHash(image.NewGray(image.Rect(0, 0, 50, 80))), "uniform images have no gradient")
+	assert.Equal(t, Hash(0), PerceptualHash(image.NewGray(image.Rect(0, 0, 0, 0))))
+}
+
+func TestHash_Distance(t *testing.T) {
+	assert.Equal(t, 0, Hash(0xF0).Distance(0xF0))
+	assert.Equal(t, 2, Hash(0b1010).Distance(0b0110))
+	assert.Equal(t, 64, Hash(0).Distance(^Hash(0)))
+}
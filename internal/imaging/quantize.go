@@ -0,0 +1,104 @@
+package imaging
+
+import "image"
+
+// bayer8 is the 8x8 Bayer threshold matrix, with values 0-63.
+var bayer8 = [8][8]int{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// grayLevels maps a luma value to the nearest of levels evenly spaced gray
+// levels, 0 and 255 included.
+type grayLevels struct {
+	levels int
+}
+
+// nearest returns the level closest to v, which may be out of the 0-255
+// range once an error or threshold is added.
+func (g grayLevels) nearest(v int) uint8 {
+	steps := g.levels - 1
+	level := (clamp(v, 0, 255)*steps + 127) / 255
+	return uint8((level*255 + steps/2) / steps)
+}
+
+// Quantize returns the luma of img reduced to levels evenly spaced gray
+// levels (2-256), each pixel rounded to the nearest one.
+func Quantize(img image.Image, levels int) *image.Gray {
+	src := Luma(img)
+	g := grayLevels{levels: levels}
+	bounds := src.Bounds()
+	dst := image.NewGray(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		srcRow := src.Pix[y*src.Stride:]
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < bounds.Dx(); x++ {
+			dstRow[x] = g.nearest(int(srcRow[x]))
+		}
+	}
+	return dst
+}
+
+// DitherFloydSteinberg is Quantize diffusing the rounding error of each pixel
+// to the next pixel of its row and to three pixels of the row below (7/16,
+// 3/16, 5/16 and 1/16), so gradients keep their average tone.
+func DitherFloydSteinberg(img image.Image, levels int) *image.Gray {
+	src := Luma(img)
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	g := grayLevels{levels: levels}
+	dst := image.NewGray(bounds)
+
+	// Errors are kept in 1/16ths, with a spare column on each side so the
+	// edges need no special case.
+	current := make([]int, width+2)
+	next := make([]int, width+2)
+	for y := 0; y < bounds.Dy(); y++ {
+		srcRow := src.Pix[y*src.Stride:]
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			v := int(srcRow[x]) + current[x+1]/16
+			q := g.nearest(v)
+			dstRow[x] = q
+			e := v - int(q)
+			current[x+2] += e * 7
+			next[x] += e * 3
+			next[x+1] += e * 5
+			next[x+2] += e
+		}
+		current, next = next, current
+		clear(next)
+	}
+	return dst
+}
+
+// DitherOrdered is Quantize offsetting each pixel by up to half a level
+// step, following the 8x8 Bayer matrix, before rounding it. Unlike error
+// diffusion, the pattern only depends on the pixel's position and tone.
+func DitherOrdered(img image.Image, levels int) *image.Gray {
+	src := Luma(img)
+	bounds := src.Bounds()
+	g := grayLevels{levels: levels}
+	dst := image.NewGray(bounds)
+	step := 255 / (levels - 1)
+	for y := 0; y < bounds.Dy(); y++ {
+		srcRow := src.Pix[y*src.Stride:]
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < bounds.Dx(); x++ {
+			// Thresholds span (-step/2, step/2), centered on 0.
+			offset := ((2*bayer8[y%8][x%8]+1)*step - 64*step) / 128
+			dstRow[x] = g.nearest(int(srcRow[x]) + offset)
+		}
+	}
+	return dst
+}
+
+func clamp(v, low, high int) int {
+	return min(max(v, low), high)
+}
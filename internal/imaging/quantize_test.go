@@ -0,0 +1,96 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// uniformGray returns a width x height image filled with v.
+func uniformGray(width, height int, v uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+// meanGray returns the average value of img.
+func meanGray(img *image.Gray) float64 {
+	total := 0
+	for _, v := range img.Pix {
+		total += int(v)
+	}
+	return float64(total) / float64(len(img.Pix))
+}
+
+func TestQuantize(t *testing.T) {
+	gradient := image.NewGray(image.Rect(0, 0, 256, 1))
+	for x := range 256 {
+		gradient.Pix[x] = uint8(x)
+	}
+
+	tests := []struct {
+		name     string
+		quantize func(image.Image, int) *image.Gray
+	}{
+		{name: "nearest", quantize: Quantize},
+		{name: "floyd-steinberg", quantize: DitherFloydSteinberg},
+		{name: "ordered", quantize: DitherOrdered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := tt.quantize(gradient, 16)
+			assert.Equal(t, gradient.Bounds(), out.Bounds())
+			for x, v := range out.Pix {
+				assert.Zero(t, v%17, "pixel %d is %d, not one of the 16 levels", x, v)
+			}
+			assert.Equal(t, uint8(0), out.Pix[0], "black stays black")
+			assert.Equal(t, uint8(255), out.Pix[255], "white stays white")
+			assert.Equal(t, uint8(1), gradient.Pix[1], "the source is left untouched")
+		})
+	}
+}
+
+func TestDither_KeepsTone(t *testing.T) {
+	// Mid-gray halfway between two of 4 levels (85 and 170): plain rounding
+	// darkens or lightens the whole area, dithering mixes both levels.
+	src := uniformGray(64, 64, 128)
+
+	assert.InDelta(t, 128, meanGray(DitherFloydSteinberg(src, 4)), 2)
+	assert.InDelta(t, 128, meanGray(DitherOrdered(src, 4)), 2)
+	assert.InDelta(t, 128, meanGray(Quantize(src, 4)), 43)
+
+	// Two tones only: dithering must still produce something in between.
+	twoTone := DitherFloydSteinberg(src, 2)
+	assert.InDelta(t, 128, meanGray(twoTone), 3)
+	assert.Equal(t, 2, CountColors(twoTone, 256))
+}
+
+func TestDitherOrdered_Tiles(t *testing.T) {
+	out := DitherOrdered(uniformGray(32, 32, 100), 4)
+	for y := range 24 {
+		for x := range 24 {
+			assert.Equal(t, out.GrayAt(x, y), out.GrayAt(x+8, y+8), "the pattern repeats every 8 pixels")
+		}
+	}
+}
+
+func TestQuantize_SubImage(t *testing.T) {
+	src := uniformGray(16, 16, 200)
+	for x := range 8 {
+		for y := range 16 {
+			src.SetGray(x, y, color.Gray{Y: 40})
+		}
+	}
+	// The right half only: its rows are not contiguous in src.Pix.
+	right := src.SubImage(image.Rect(8, 0, 16, 16))
+
+	for _, out := range []*image.Gray{Quantize(right, 2), DitherFloydSteinberg(right, 2), DitherOrdered(right, 2)} {
+		assert.Equal(t, right.Bounds(), out.Bounds())
+		assert.InDelta(t, 200, meanGray(out), 56, "the dark left half must not leak in")
+	}
+}
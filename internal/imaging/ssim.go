@@ -0,0 +1,130 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+
+	"golang.org/x/image/webp"
+)
+
+const (
+	// ssimWindow is the side of the square, non-overlapping windows SSIM is
+	// averaged over. 8x8 is the usual cheap alternative to the 11x11
+	// Gaussian window of the original paper and ranks encodes the same way.
+	ssimWindow = 8
+	// ssimC1 and ssimC2 stabilize the division for flat windows, using the
+	// standard K1=0.01 and K2=0.03 for 8-bit samples.
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// Luma returns the BT.601 luma plane of img, which is what SSIM compares.
+func Luma(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	switch src := img.(type) {
+	case *image.Gray:
+		return src
+	case *image.YCbCr:
+		// Go's YCbCr is full-range JFIF, so Y already is the BT.601 luma.
+		gray := image.NewGray(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			row := gray.Pix[gray.PixOffset(bounds.Min.X, y):]
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				row[x-bounds.Min.X] = src.Y[src.YOffset(x, y)]
+			}
+		}
+		return gray
+	}
+	gray := image.NewGray(bounds)
+	draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	return gray
+}
+
+// DecodeWebPLuma decodes a WebP file into its luma plane. Lossy WebP stores
+// BT.601 limited-range YUV, which golang.org/x/image/webp hands back as an
+// image.YCbCr without expanding it, so Y is rescaled from [16, 235] here:
+// compared as-is, every lossy page would look ~14% flatter than its source.
+func DecodeWebPLuma(filePath string) (*image.Gray, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	img, err := webp.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+
+	src, ok := img.(*image.YCbCr)
+	if !ok {
+		return Luma(img), nil
+	}
+	bounds := src.Bounds()
+	gray := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := gray.Pix[gray.PixOffset(bounds.Min.X, y):]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := (int(src.Y[src.YOffset(x, y)]) - 16) * 255
+			row[x-bounds.Min.X] = clampByte((v + 219/2) / 219)
+		}
+	}
+	return gray, nil
+}
+
+// SSIM returns the mean structural similarity of two luma planes of the same
+// size: 1 for identical images, lower as they diverge.
+func SSIM(a, b *image.Gray) (float64, error) {
+	size := a.Bounds().Size()
+	if size != b.Bounds().Size() {
+		return 0, fmt.Errorf("cannot compare %dx%d and %dx%d images", size.X, size.Y, b.Bounds().Dx(), b.Bounds().Dy())
+	}
+	if size.X == 0 || size.Y == 0 {
+		return 0, fmt.Errorf("cannot compare empty images")
+	}
+
+	aMin, bMin := a.Bounds().Min, b.Bounds().Min
+	var total float64
+	var windows int
+	for y0 := 0; y0 < size.Y; y0 += ssimWindow {
+		for x0 := 0; x0 < size.X; x0 += ssimWindow {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			n := 0
+			for y := y0; y < y0+ssimWindow && y < size.Y; y++ {
+				rowA := a.Pix[a.PixOffset(aMin.X, aMin.Y+y):]
+				rowB := b.Pix[b.PixOffset(bMin.X, bMin.Y+y):]
+				for x := x0; x < x0+ssimWindow && x < size.X; x++ {
+					va, vb := float64(rowA[x]), float64(rowB[x])
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+					n++
+				}
+			}
+			count := float64(n)
+			meanA, meanB := sumA/count, sumB/count
+			varA := sumAA/count - meanA*meanA
+			varB := sumBB/count - meanB*meanB
+			covariance := sumAB/count - meanA*meanB
+
+			total += ((2*meanA*meanB + ssimC1) * (2*covariance + ssimC2)) /
+				((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+			windows++
+		}
+	}
+	return total / float64(windows), nil
+}
+
+func clampByte(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,95 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gradientGray returns a diagonal gradient, which has enough structure in
+// every window for SSIM to react to distortions.
+func gradientGray(width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8((x*3 + y*2) % 256)})
+		}
+	}
+	return img
+}
+
+func TestSSIM(t *testing.T) {
+	reference := gradientGray(64, 48)
+
+	identical, err := SSIM(reference, gradientGray(64, 48))
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, identical, 1e-9)
+
+	rng := rand.New(rand.NewSource(1))
+	noisy := func(amplitude int) *image.Gray {
+		img := gradientGray(64, 48)
+		for i := range img.Pix {
+			img.Pix[i] = clampByte(int(img.Pix[i]) + rng.Intn(2*amplitude+1) - amplitude)
+		}
+		return img
+	}
+
+	light, err := SSIM(reference, noisy(4))
+	require.NoError(t, err)
+	heavy, err := SSIM(reference, noisy(40))
+	require.NoError(t, err)
+
+	assert.Less(t, light, 1.0)
+	assert.Less(t, heavy, light, "more noise should score lower")
+}
+
+func TestSSIM_PartialWindowsAndOffsetBounds(t *testing.T) {
+	// 13x11 leaves partial windows on both edges; the sub-image has a
+	// non-zero origin.
+	full := gradientGray(40, 40)
+	part := full.SubImage(image.Rect(5, 7, 18, 18)).(*image.Gray)
+	copied := image.NewGray(image.Rect(0, 0, 13, 11))
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 13; x++ {
+			copied.SetGray(x, y, full.GrayAt(x+5, y+7))
+		}
+	}
+
+	score, err := SSIM(part, copied)
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, score, 1e-9)
+}
+
+func TestSSIM_SizeMismatch(t *testing.T) {
+	_, err := SSIM(gradientGray(10, 10), gradientGray(10, 11))
+	assert.Error(t, err)
+
+	_, err = SSIM(image.NewGray(image.Rect(0, 0, 0, 0)), image.NewGray(image.Rect(0, 0, 0, 0)))
+	assert.Error(t, err)
+}
+
+func TestLuma(t *testing.T) {
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 10)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = 128, 128
+	}
+	luma := Luma(ycbcr)
+	assert.Equal(t, ycbcr.Y, luma.Pix)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	rgba.Set(0, 0, color.White)
+	rgba.Set(1, 0, color.RGBA{R: 255, A: 255})
+	luma = Luma(rgba)
+	assert.Equal(t, uint8(255), luma.GrayAt(0, 0).Y)
+	assert.Equal(t, uint8(76), luma.GrayAt(1, 0).Y, "BT.601 luma of pure red")
+
+	gray := image.NewGray(image.Rect(0, 0, 1, 1))
+	assert.Same(t, gray, Luma(gray))
+}
@@ -1,8 +1,11 @@
 package manga
 
 import (
+	"encoding/xml"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,17 +21,115 @@ type Chapter struct {
 	IsConverted bool
 	// ConvertedTime is when the chapter was converted.
 	ConvertedTime time.Time
+	// KeptOriginalPages counts the pages the converter left in their source
+	// format because converting them did not save enough space.
+	KeptOriginalPages int
+	// GrayscalePages counts the pages the converter encoded as grayscale.
+	GrayscalePages int
+	// RemovedPages lists the pages dropped from the chapter before
+	// conversion, recorded in the output archive's comment.
+	RemovedPages []RemovedPage
 	// TempDir is the root temp directory for this chapter's extracted/converted files.
 	// Cleanup removes this entire directory.
 	TempDir string
 }
 
+// RemovedPage records a page dropped from a chapter before conversion.
+type RemovedPage struct {
+	// Index is the page's index in the source chapter.
+	Index uint16
+	// Name is the page's original filename, empty when it is unknown.
+	Name string
+	// Reason says why the page was dropped, e.g. "blank".
+	Reason string
+}
+
+// String describes the removed page on one line, for logs and the archive
+// comment.
+func (page RemovedPage) String() string {
+	if page.Name != "" {
+		return fmt.Sprintf("page %d (%s): %s", page.Index, page.Name, page.Reason)
+	}
+	return fmt.Sprintf("page %d: %s", page.Index, page.Reason)
+}
+
 // SetConverted marks the chapter as converted with the current timestamp.
 func (chapter *Chapter) SetConverted() {
 	chapter.IsConverted = true
 	chapter.ConvertedTime = time.Now()
 }
 
+// IsRightToLeft reports whether the chapter's ComicInfo.xml marks it as manga
+// read right to left: its Manga field is "YesAndRightToLeft", or "Yes" which
+// readers commonly treat the same way. A missing or unparsable ComicInfo.xml
+// means left to right.
+func (chapter *Chapter) IsRightToLeft() bool {
+	if chapter.ComicInfoXml == "" {
+		return false
+	}
+	var comicInfo struct {
+		Manga string `xml:"Manga"`
+	}
+	if err := xml.Unmarshal([]byte(chapter.ComicInfoXml), &comicInfo); err != nil {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(comicInfo.Manga)) {
+	case "yes", "yesandrighttoleft":
+		return true
+	}
+	return false
+}
+
+// CoverIndex returns the index of the chapter's cover page: the page its
+// ComicInfo.xml lists with Type="FrontCover", or the first page when there
+// is none or the ComicInfo.xml cannot be parsed.
+func (chapter *Chapter) CoverIndex() uint16 {
+	if chapter.ComicInfoXml == "" {
+		return 0
+	}
+	var comicInfo struct {
+		Pages []struct {
+			Image uint16 `xml:"Image,attr"`
+			Type  string `xml:"Type,attr"`
+		} `xml:"Pages>Page"`
+	}
+	if err := xml.Unmarshal([]byte(chapter.ComicInfoXml), &comicInfo); err != nil {
+		return 0
+	}
+	for _, page := range comicInfo.Pages {
+		if strings.EqualFold(page.Type, "FrontCover") {
+			return page.Image
+		}
+	}
+	return 0
+}
+
+// ComicInfoPageOrder returns the Image index of each page its ComicInfo.xml
+// lists, in the order they are listed, or nil when there is no such list,
+// the ComicInfo.xml cannot be parsed or a page has no valid Image index.
+func (chapter *Chapter) ComicInfoPageOrder() []int {
+	if chapter.ComicInfoXml == "" {
+		return nil
+	}
+	var comicInfo struct {
+		Pages []struct {
+			Image string `xml:"Image,attr"`
+		} `xml:"Pages>Page"`
+	}
+	if err := xml.Unmarshal([]byte(chapter.ComicInfoXml), &comicInfo); err != nil {
+		return nil
+	}
+	var order []int
+	for _, page := range comicInfo.Pages {
+		image, err := strconv.Atoi(strings.TrimSpace(page.Image))
+		if err != nil {
+			return nil
+		}
+		order = append(order, image)
+	}
+	return order
+}
+
 // Cleanup removes the chapter's temp directory and all extracted/converted files.
 func (chapter *Chapter) Cleanup() error {
 	if chapter.TempDir == "" {
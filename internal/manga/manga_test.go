@@ -3,6 +3,7 @@ package manga
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 )
@@ -100,3 +101,74 @@ func TestPageFile_Struct(t *testing.T) {
 		t.Errorf("Expected SplitPartIndex 2, got %d", page.SplitPartIndex)
 	}
 }
+
+func TestChapter_IsRightToLeft(t *testing.T) {
+	tests := []struct {
+		name         string
+		comicInfoXml string
+		expected     bool
+	}{
+		{name: "no ComicInfo", comicInfoXml: "", expected: false},
+		{name: "right to left", comicInfoXml: `<?xml version="1.0"?><ComicInfo><Manga>YesAndRightToLeft</Manga></ComicInfo>`, expected: true},
+		{name: "manga", comicInfoXml: `<ComicInfo><Title>Vol 1</Title><Manga>Yes</Manga></ComicInfo>`, expected: true},
+		{name: "not manga", comicInfoXml: `<ComicInfo><Manga>No</Manga></ComicInfo>`, expected: false},
+		{name: "unknown", comicInfoXml: `<ComicInfo><Manga>Unknown</Manga></ComicInfo>`, expected: false},
+		{name: "no Manga field", comicInfoXml: `<ComicInfo><Title>Vol 1</Title></ComicInfo>`, expected: false},
+		{name: "invalid xml", comicInfoXml: `<ComicInfo><Manga>Yes`, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := &Chapter{ComicInfoXml: tt.comicInfoXml}
+			if got := chapter.IsRightToLeft(); got != tt.expected {
+				t.Errorf("IsRightToLeft() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChapter_CoverIndex(t *testing.T) {
+	tests := []struct {
+		name         string
+		comicInfoXml string
+		expected     uint16
+	}{
+		{name: "no ComicInfo", comicInfoXml: "", expected: 0},
+		{name: "front cover", comicInfoXml: `<ComicInfo><Pages><Page Image="0" Type="Story"/><Page Image="2" Type="FrontCover"/><Page Image="3" Type="FrontCover"/></Pages></ComicInfo>`, expected: 2},
+		{name: "no front cover", comicInfoXml: `<ComicInfo><Pages><Page Image="0" Type="Story"/><Page Image="1" Type="BackCover"/></Pages></ComicInfo>`, expected: 0},
+		{name: "no Pages field", comicInfoXml: `<ComicInfo><Title>Vol 1</Title></ComicInfo>`, expected: 0},
+		{name: "invalid xml", comicInfoXml: `<ComicInfo><Pages><Page Image="4" Type="FrontCover"/>`, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := &Chapter{ComicInfoXml: tt.comicInfoXml}
+			if got := chapter.CoverIndex(); got != tt.expected {
+				t.Errorf("CoverIndex() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestChapter_ComicInfoPageOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		comicInfoXml string
+		expected     []int
+	}{
+		{name: "no ComicInfo", comicInfoXml: "", expected: nil},
+		{name: "listed order", comicInfoXml: `<ComicInfo><Pages><Page Image="2"/><Page Image="0" Type="FrontCover"/><Page Image="1"/></Pages></ComicInfo>`, expected: []int{2, 0, 1}},
+		{name: "no Pages field", comicInfoXml: `<ComicInfo><Title>Vol 1</Title></ComicInfo>`, expected: nil},
+		{name: "missing Image", comicInfoXml: `<ComicInfo><Pages><Page Image="1"/><Page Type="Story"/></Pages></ComicInfo>`, expected: nil},
+		{name: "invalid xml", comicInfoXml: `<ComicInfo><Pages><Page Image="4"/>`, expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := &Chapter{ComicInfoXml: tt.comicInfoXml}
+			if got := chapter.ComicInfoPageOrder(); !slices.Equal(got, tt.expected) {
+				t.Errorf("ComicInfoPageOrder() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
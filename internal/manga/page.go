@@ -13,6 +13,14 @@ type PageFile struct {
 	IsSplitted bool
 	// SplitPartIndex is the part index when the page was split.
 	SplitPartIndex uint16
+	// IsGrayscale indicates whether the converter encoded this page as
+	// grayscale.
+	IsGrayscale bool
+	// IsModified indicates whether the converter changed the pixels of this
+	// page on purpose: normalized, enhanced, cropped, resized, converted to
+	// grayscale or quantized. Its source is then no equivalent to fall back
+	// to when the conversion did not save space.
+	IsModified bool
 	// OriginalName is the base filename (e.g. "page01.png") of the page as
 	// it appeared in the source archive, recorded when the --keep-filenames
 	// flag is enabled. Empty when the flag is off or the source name is
@@ -0,0 +1,161 @@
+// Package pagefilter drops pages that are not worth keeping from chapters
+// before they are converted: blank separator pages, and the credit and
+// recruitment pages scanlation groups repeat in every chapter.
+package pagefilter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultMaxDistance is the largest perceptual hash distance, out of 64
+// bits, at which a page still matches a reference image.
+const DefaultMaxDistance = 10
+
+// Filter drops blank pages and pages that look like one of its reference
+// images. It is built once and shared by every chapter processed.
+type Filter struct {
+	removeBlank bool
+	references  []reference
+	maxDistance int
+}
+
+// reference is a page to remove wherever it shows up.
+type reference struct {
+	name string
+	hash imaging.Hash
+}
+
+// New returns a Filter removing blank pages when removeBlank is set, and
+// pages within maxDistance of the perceptual hash of any image in
+// referencePaths. A reference path may be an image file or a directory,
+// whose images are all used; files in it that cannot be decoded are
+// skipped, while an image file given directly must decode. Returns nil when
+// there is nothing to remove.
+func New(removeBlank bool, referencePaths []string, maxDistance int) (*Filter, error) {
+	filter := &Filter{removeBlank: removeBlank, maxDistance: maxDistance}
+	for _, path := range referencePaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference image: %w", err)
+		}
+		if !info.IsDir() {
+			if err := filter.addReference(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference directory: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if err := filter.addReference(filepath.Join(path, entry.Name())); err != nil {
+				log.Warn().Str("path", filepath.Join(path, entry.Name())).Err(err).Msg("Skipping reference file")
+			}
+		}
+	}
+
+	if !filter.removeBlank && len(filter.references) == 0 {
+		return nil, nil
+	}
+	log.Debug().
+		Bool("remove_blank", filter.removeBlank).
+		Int("references", len(filter.references)).
+		Int("max_distance", filter.maxDistance).
+		Msg("Page filter ready")
+	return filter, nil
+}
+
+// addReference hashes the image at path as a reference.
+func (filter *Filter) addReference(path string) error {
+	img, err := imaging.Decode(path)
+	if err != nil {
+		return fmt.Errorf("failed to decode reference image %s: %w", path, err)
+	}
+	filter.references = append(filter.references, reference{
+		name: filepath.Base(path),
+		hash: imaging.PerceptualHash(img),
+	})
+	return nil
+}
+
+// Apply removes the unwanted pages from chapter.Pages, logging each one and
+// recording it in chapter.RemovedPages. The remaining pages keep their
+// index. Pages Go cannot decode are kept. Apply never removes every page: a
+// chapter left empty would be pointless to write.
+func (filter *Filter) Apply(ctx context.Context, chapter *manga.Chapter) error {
+	kept := make([]*manga.PageFile, 0, len(chapter.Pages))
+	var removed []manga.RemovedPage
+	for _, page := range chapter.Pages {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		reason, err := filter.removalReason(page)
+		if err != nil {
+			log.Debug().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode page, keeping it")
+		}
+		if reason == "" {
+			kept = append(kept, page)
+			continue
+		}
+		removed = append(removed, manga.RemovedPage{Index: page.Index, Name: page.OriginalName, Reason: reason})
+	}
+
+	if len(kept) == 0 {
+		log.Warn().
+			Str("chapter", chapter.FilePath).
+			Int("pages", len(chapter.Pages)).
+			Msg("Every page would be removed, keeping them all")
+		return nil
+	}
+	for _, page := range removed {
+		log.Info().
+			Str("chapter", chapter.FilePath).
+			Uint16("page_index", page.Index).
+			Str("page", page.Name).
+			Str("reason", page.Reason).
+			Msg("Removed page")
+	}
+	chapter.Pages = kept
+	chapter.RemovedPages = append(chapter.RemovedPages, removed...)
+	return nil
+}
+
+// removalReason returns why page should be removed, or "" to keep it.
+func (filter *Filter) removalReason(page *manga.PageFile) (string, error) {
+	img, err := imaging.Decode(page.FilePath)
+	if err != nil {
+		return "", err
+	}
+	if filter.removeBlank && imaging.IsBlank(img) {
+		return "blank", nil
+	}
+	if len(filter.references) == 0 {
+		return "", nil
+	}
+
+	hash := imaging.PerceptualHash(img)
+	for _, ref := range filter.references {
+		if distance := hash.Distance(ref.hash); distance <= filter.maxDistance {
+			return fmt.Sprintf("matches %s (distance %d)", ref.name, distance), nil
+		}
+	}
+	return "", nil
+}
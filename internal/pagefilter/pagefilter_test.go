@@ -0,0 +1,140 @@
+package pagefilter
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// artwork draws a page whose layout depends on variant.
+func artwork(width, height, variant int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			v := uint8((x*variant/width*53 + y*variant/height*97) % 256)
+			img.Set(x, y, color.RGBA{R: v, G: 255 - v, B: v / 3, A: 255})
+		}
+	}
+	return img
+}
+
+func blankPage(width, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 250
+	}
+	return img
+}
+
+func writeImage(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	if filepath.Ext(path) == ".jpg" {
+		require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 80}))
+	} else {
+		require.NoError(t, png.Encode(f, img))
+	}
+	require.NoError(t, f.Close())
+}
+
+func writePage(t *testing.T, dir string, index int, img image.Image) *manga.PageFile {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%04d.png", index))
+	writeImage(t, path, img)
+	return &manga.PageFile{Index: uint16(index), Extension: ".png", FilePath: path}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	refs := filepath.Join(dir, "refs")
+	require.NoError(t, os.Mkdir(refs, 0755))
+	writeImage(t, filepath.Join(refs, "credits.jpg"), artwork(300, 400, 5))
+	writeImage(t, filepath.Join(refs, "recruitment.png"), artwork(300, 400, 9))
+	require.NoError(t, os.WriteFile(filepath.Join(refs, "notes.txt"), []byte("not an image"), 0644))
+
+	filter, err := New(false, nil, DefaultMaxDistance)
+	require.NoError(t, err)
+	assert.Nil(t, filter, "nothing to remove")
+
+	filter, err = New(false, []string{refs}, DefaultMaxDistance)
+	require.NoError(t, err)
+	require.NotNil(t, filter)
+	assert.Len(t, filter.references, 2, "files that are not images are skipped in directories")
+
+	_, err = New(false, []string{filepath.Join(refs, "notes.txt")}, DefaultMaxDistance)
+	assert.Error(t, err, "a reference file given directly must be an image")
+
+	_, err = New(true, []string{filepath.Join(dir, "missing")}, DefaultMaxDistance)
+	assert.Error(t, err)
+}
+
+func TestFilter_Apply(t *testing.T) {
+	dir := t.TempDir()
+	// The reference is the group's credits page as released with an earlier
+	// chapter: another size and compression than the copy in this one.
+	referencePath := filepath.Join(dir, "credits.jpg")
+	writeImage(t, referencePath, artwork(600, 800, 5))
+
+	pages := []*manga.PageFile{
+		writePage(t, dir, 0, artwork(300, 400, 13)),
+		writePage(t, dir, 1, blankPage(300, 400)),
+		writePage(t, dir, 2, artwork(300, 400, 17)),
+		writePage(t, dir, 3, artwork(300, 400, 5)),
+	}
+	pages[3].OriginalName = "zz_credits.png"
+	undecodable := filepath.Join(dir, "0004.png")
+	require.NoError(t, os.WriteFile(undecodable, []byte("not an image"), 0644))
+	pages = append(pages, &manga.PageFile{Index: 4, Extension: ".png", FilePath: undecodable})
+
+	chapter := &manga.Chapter{FilePath: filepath.Join(dir, "chapter.cbz"), Pages: pages}
+	filter, err := New(true, []string{referencePath}, DefaultMaxDistance)
+	require.NoError(t, err)
+	require.NoError(t, filter.Apply(context.Background(), chapter))
+
+	var kept []uint16
+	for _, page := range chapter.Pages {
+		kept = append(kept, page.Index)
+	}
+	assert.Equal(t, []uint16{0, 2, 4}, kept, "indexes are left as they were")
+	require.Len(t, chapter.RemovedPages, 2)
+	assert.Equal(t, manga.RemovedPage{Index: 1, Reason: "blank"}, chapter.RemovedPages[0])
+	assert.Equal(t, uint16(3), chapter.RemovedPages[1].Index)
+	assert.Equal(t, "zz_credits.png", chapter.RemovedPages[1].Name)
+	assert.Contains(t, chapter.RemovedPages[1].Reason, "matches credits.jpg")
+}
+
+func TestFilter_Apply_KeepsChapterThatWouldBeEmpty(t *testing.T) {
+	dir := t.TempDir()
+	chapter := &manga.Chapter{Pages: []*manga.PageFile{
+		writePage(t, dir, 0, blankPage(100, 100)),
+		writePage(t, dir, 1, blankPage(100, 100)),
+	}}
+
+	filter, err := New(true, nil, DefaultMaxDistance)
+	require.NoError(t, err)
+	require.NoError(t, filter.Apply(context.Background(), chapter))
+	assert.Len(t, chapter.Pages, 2)
+	assert.Empty(t, chapter.RemovedPages)
+}
+
+func TestFilter_Apply_Cancelled(t *testing.T) {
+	dir := t.TempDir()
+	chapter := &manga.Chapter{Pages: []*manga.PageFile{writePage(t, dir, 0, blankPage(10, 10))}}
+
+	filter, err := New(true, nil, DefaultMaxDistance)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, filter.Apply(ctx, chapter), context.Canceled)
+}
@@ -1,6 +1,12 @@
 package utils
 
-import "os"
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
 
 // IsValidFolder checks if the provided path is a valid directory
 func IsValidFolder(path string) bool {
@@ -10,3 +16,54 @@ func IsValidFolder(path string) bool {
 	}
 	return info.IsDir()
 }
+
+// sizeUnits maps the suffixes accepted by ParseSize to their multiplier.
+// KB/MB/GB are decimal, KiB/MiB/GiB binary.
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longer suffixes first so "MiB" is not read as "B".
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"K", 1000},
+	{"M", 1000 * 1000},
+	{"G", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseSize parses a human-readable size such as "500KB", "20MB" or
+// "1.5GiB" into bytes. A bare number is a count of bytes and an empty string
+// is 0.
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, multiplier := value, int64(1)
+	upper := strings.ToUpper(value)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			number = strings.TrimSpace(value[:len(value)-len(unit.suffix)])
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil || parsed < 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, the first value that does
+	// not fit.
+	bytes := parsed * float64(multiplier)
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return int64(bytes), nil
+}
@@ -57,3 +57,48 @@ func TestIsValidFolder(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    int64
+		expectError bool
+	}{
+		{value: "", expected: 0},
+		{value: "1024", expected: 1024},
+		{value: "500B", expected: 500},
+		{value: "500KB", expected: 500_000},
+		{value: "20MB", expected: 20_000_000},
+		{value: "20mb", expected: 20_000_000},
+		{value: "20 MB", expected: 20_000_000},
+		{value: "20M", expected: 20_000_000},
+		{value: "1.5GB", expected: 1_500_000_000},
+		{value: "64KiB", expected: 64 << 10},
+		{value: "20MiB", expected: 20 << 20},
+		{value: "1GiB", expected: 1 << 30},
+		{value: "MB", expectError: true},
+		{value: "-5MB", expectError: true},
+		{value: "twenty", expectError: true},
+		{value: "NaN", expectError: true},
+		{value: "nanMB", expectError: true},
+		{value: "inf", expectError: true},
+		{value: "+Inf", expectError: true},
+		{value: "1e30", expectError: true},
+		{value: "9223372036854775807", expectError: true},
+		{value: "10000000000GB", expectError: true},
+		{value: "8EB", expectError: true},
+		{value: "1e3KB", expected: 1_000_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSize(tt.value)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -6,30 +6,103 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/belphemur/CBZOptimizer/v2/internal/cbz"
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/internal/pagefilter"
+	"github.com/belphemur/CBZOptimizer/v2/internal/webtoon"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter"
 	errors2 "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/rs/zerolog/log"
 )
 
 type OptimizeOptions struct {
 	ChapterConverter converter.Converter
 	Path             string
-	Quality          uint8
-	Override         bool
-	Split            bool
+	// Conversion holds the per-page encoding settings (quality, split, WebP
+	// mode, ...) passed through to the converter.
+	Conversion options.Conversion
+	Override   bool
 	// KeepFilenames preserves the original base filename of each page inside
 	// the output CBZ (with the extension swapped for format conversion)
 	// instead of the historical %04d sequential naming. Off by default so
 	// existing behavior is unchanged.
 	KeepFilenames bool
-	Timeout       time.Duration
+	// RemoveFolder deletes a folder of images given as Path once its CBZ has
+	// been written and verified, so the CBZ replaces it.
+	RemoveFolder bool
+	// LegacyPageOrder numbers the pages in the order they are stored in the
+	// archive, as before pages were sorted by natural filename order.
+	LegacyPageOrder bool
+	// Webtoon stitches the pages of the chapter into one strip and cuts it
+	// again into pages of Conversion.SliceHeight before converting them.
+	Webtoon bool
+	// PageFilter, when set, drops blank and unwanted pages from the chapter
+	// before it is converted.
+	PageFilter *pagefilter.Filter
+	// Cover, when set, converts the chapter's cover page with its own
+	// settings instead of those of the rest of the chapter.
+	Cover   *CoverOptions
+	Timeout time.Duration
+	// MaxSize is the largest output CBZ allowed, in bytes. When the chapter
+	// converted with Conversion does not fit, it is converted again at lower
+	// qualities until it does, then downscaled at the lowest one. 0 means no
+	// limit.
+	MaxSize int64
 }
 
-// Optimize optimizes a CBZ/CBR file using the specified converter.
+// CoverOptions overrides the conversion settings for the cover page of a
+// chapter, see manga.Chapter.CoverIndex: library UIs show it as the
+// thumbnail, so it is worth more bytes than the other pages.
+type CoverOptions struct {
+	// Converter encodes the cover, nil to use the chapter's converter.
+	Converter converter.Converter
+	// Quality of the cover (1-100), 0 to use the chapter's quality. It is
+	// fixed: neither TargetSSIM nor the MaxSize budget change it.
+	Quality uint8
+	// NoDownscale exempts the cover from the resize limits.
+	NoDownscale bool
+}
+
+// conversion returns the settings the cover is converted with, given those
+// of the rest of the chapter.
+func (cover *CoverOptions) conversion(conversion options.Conversion) options.Conversion {
+	if cover.Quality > 0 {
+		conversion.Quality = cover.Quality
+		conversion.TargetSSIM = 0
+	}
+	if cover.NoDownscale {
+		conversion.MaxWidth, conversion.MaxHeight, conversion.MaxMegapixels = 0, 0, 0
+	}
+	return conversion
+}
+
+// minBudgetQuality is the lowest quality tried when shrinking a chapter to
+// fit OptimizeOptions.MaxSize; below it pages are no longer worth reading.
+const minBudgetQuality uint8 = 10
+
+// budgetScaleStep is the factor the page size limits are lowered by, step
+// after step, when a chapter does not fit OptimizeOptions.MaxSize even at
+// minBudgetQuality: lossless pages and JPEG XL transcodes do not shrink with
+// the quality. minBudgetScale is the smallest scale tried.
+const (
+	budgetScaleStep = 0.75
+	minBudgetScale  = 0.25
+)
+
+// ErrSizeBudgetUnreachable is returned when a chapter does not fit
+// OptimizeOptions.MaxSize even at minBudgetQuality and downscaled to
+// minBudgetScale.
+var ErrSizeBudgetUnreachable = errors.New("size budget unreachable")
+
+// Optimize optimizes a CBZ/CBR/CB7/CBT file, or a folder of images (see
+// cbz.IsImageFolder) written to a CBZ of the same name next to it, using
+// the specified converter.
 // The new pipeline is disk-first:
 // 1. Fast check if already converted (no extraction)
 // 2. Extract archive to temp directory on disk
@@ -40,16 +113,40 @@ func Optimize(options *OptimizeOptions) error {
 	log.Info().Str("file", options.Path).Msg("Processing file")
 	log.Debug().
 		Str("file", options.Path).
-		Uint8("quality", options.Quality).
+		Uint8("quality", options.Conversion.Quality).
 		Bool("override", options.Override).
-		Bool("split", options.Split).
+		Bool("split", options.Conversion.Split).
+		Str("webp_mode", options.Conversion.WebPMode.String()).
+		Bool("keep_smaller", options.Conversion.KeepSmaller).
+		Uint8("min_savings", options.Conversion.MinSavingsPercent).
 		Bool("keep_filenames", options.KeepFilenames).
+		Bool("legacy_page_order", options.LegacyPageOrder).
+		Bool("remove_folder", options.RemoveFolder).
+		Bool("webtoon", options.Webtoon).
+		Bool("page_filter", options.PageFilter != nil).
+		Int64("max_size", options.MaxSize).
 		Msg("Optimization parameters")
 
-	// Step 1: Fast conversion check before extracting (new requirement)
-	alreadyConverted, err := cbz.IsAlreadyConverted(context.Background(), options.Path)
-	if err != nil {
-		log.Debug().Str("file", options.Path).Err(err).Msg("Conversion check failed, proceeding with extraction")
+	isFolder := false
+	if info, err := os.Stat(options.Path); err == nil && info.IsDir() {
+		if !cbz.IsImageFolder(options.Path) {
+			return fmt.Errorf("%s is not a folder of images", options.Path)
+		}
+		isFolder = true
+	}
+
+	// Step 1: Fast conversion check before extracting (new requirement). A
+	// folder counts as converted once its CBZ exists.
+	var alreadyConverted bool
+	var err error
+	if isFolder {
+		_, statErr := os.Stat(folderOutputPath(options.Path))
+		alreadyConverted = statErr == nil && !options.Override
+	} else {
+		alreadyConverted, err = cbz.IsAlreadyConverted(context.Background(), options.Path)
+		if err != nil {
+			log.Debug().Str("file", options.Path).Err(err).Msg("Conversion check failed, proceeding with extraction")
+		}
 	}
 	if alreadyConverted {
 		log.Info().Str("file", options.Path).Msg("Chapter already converted")
@@ -70,7 +167,7 @@ func Optimize(options *OptimizeOptions) error {
 		extractCtx = context.Background()
 	}
 
-	chapter, err := cbz.ExtractChapter(extractCtx, options.Path, options.KeepFilenames)
+	chapter, err := cbz.ExtractChapter(extractCtx, options.Path, options.KeepFilenames, options.LegacyPageOrder)
 	if err != nil {
 		log.Error().Str("file", options.Path).Err(err).Msg("Failed to extract chapter")
 		return fmt.Errorf("failed to extract chapter: %w", err)
@@ -92,8 +189,178 @@ func Optimize(options *OptimizeOptions) error {
 		Int("pages", len(chapter.Pages)).
 		Msg("Chapter extracted successfully")
 
+	// Pages are filtered as extracted, so references match the pages as
+	// they were released rather than webtoon slices.
+	if options.PageFilter != nil {
+		if err := options.PageFilter.Apply(extractCtx, chapter); err != nil {
+			log.Error().Str("file", options.Path).Err(err).Msg("Failed to filter pages")
+			return fmt.Errorf("failed to filter pages: %w", err)
+		}
+	}
+
+	// Webtoon fragments are resliced before converting, so the size
+	// budget below converts the resliced pages again too.
+	if options.Webtoon {
+		pageCount := len(chapter.Pages)
+		if err := webtoon.Reslice(extractCtx, chapter, options.Conversion.SliceHeight); err != nil {
+			log.Error().Str("file", options.Path).Err(err).Msg("Failed to reslice webtoon strip")
+			return fmt.Errorf("failed to reslice webtoon strip: %w", err)
+		}
+		log.Info().Str("file", options.Path).Int("pages", pageCount).Int("resliced_pages", len(chapter.Pages)).Msg("Resliced webtoon strip")
+	}
+
+	// Keep the extracted pages around: fitting a size budget may need to
+	// convert them again at a lower quality.
+	sourcePages := slices.Clone(chapter.Pages)
+
 	// Step 3: Convert pages file-to-file
-	convertedChapter, err := options.ChapterConverter.ConvertChapter(extractCtx, chapter, options.Quality, options.Split, func(msg string, current uint32, total uint32) {
+	convertedChapter, err := convertChapter(extractCtx, options, chapter, options.Conversion)
+	if err != nil {
+		return err
+	}
+
+	convertedChapter.SetConverted()
+
+	// Step 4: Determine output path
+	outputPath := options.Path
+	originalPath := options.Path
+	isArchiveOverride := false
+
+	ext := ""
+	if cbz.IsChapterArchive(options.Path, true) {
+		ext = filepath.Ext(options.Path)
+	}
+	if isFolder {
+		outputPath = folderOutputPath(options.Path)
+	} else if options.Override {
+		// Archives other than CBZ (CBR, CB7, CBT, ...) are replaced by a
+		// CBZ of the same name.
+		if ext != "" && !strings.EqualFold(ext, ".cbz") {
+			outputPath = strings.TrimSuffix(options.Path, ext) + ".cbz"
+			isArchiveOverride = true
+		}
+	} else {
+		outputPath = strings.TrimSuffix(options.Path, ext) + "_converted.cbz"
+	}
+
+	// Step 5: Write converted chapter to CBZ (streaming from disk)
+	log.Debug().Str("output_path", outputPath).Msg("Writing converted chapter to CBZ file")
+	if options.MaxSize > 0 {
+		quality, err := writeWithinBudget(extractCtx, options, chapter, sourcePages, convertedChapter, outputPath)
+		if err != nil {
+			log.Error().Str("output_path", outputPath).Int64("max_size", options.MaxSize).Err(err).Msg("Failed to fit converted chapter in size budget")
+			return err
+		}
+		log.Info().Str("output", outputPath).Uint8("quality", quality).Int64("max_size", options.MaxSize).Msg("Converted file fits size budget")
+	} else {
+		err = cbz.WriteChapterToCBZ(convertedChapter, outputPath)
+		if err != nil {
+			log.Error().Str("output_path", outputPath).Err(err).Msg("Failed to write converted chapter")
+			return fmt.Errorf("failed to write converted chapter: %w", err)
+		}
+	}
+
+	// If overriding an archive that is not a CBZ, delete the original
+	if isArchiveOverride {
+		err = os.Remove(originalPath)
+		if err != nil {
+			log.Warn().Str("file", originalPath).Err(err).Msg("Failed to delete original archive")
+		} else {
+			log.Info().Str("file", originalPath).Msg("Deleted original archive")
+		}
+	}
+
+	// If asked to, replace the folder by its CBZ once the CBZ reads back
+	if isFolder && options.RemoveFolder {
+		if err := cbz.VerifyCBZ(outputPath); err != nil {
+			log.Error().Str("output_path", outputPath).Err(err).Msg("Written CBZ failed verification, keeping the folder")
+			return fmt.Errorf("failed to verify converted chapter: %w", err)
+		}
+		if err := os.RemoveAll(originalPath); err != nil {
+			log.Warn().Str("file", originalPath).Err(err).Msg("Failed to delete original folder")
+		} else {
+			log.Info().Str("file", originalPath).Msg("Deleted original folder")
+		}
+	}
+
+	log.Info().Str("output", outputPath).Msg("Converted file written")
+	return nil
+}
+
+// folderOutputPath returns the path of the CBZ a folder of images is
+// written to: next to the folder, with its name.
+func folderOutputPath(folder string) string {
+	return filepath.Clean(folder) + ".cbz"
+}
+
+// convertChapter runs the chapter converter with conversion, treating
+// ignored pages as non-fatal, and marks the result as converted. With
+// options.Cover, the cover page is taken out of the chapter and converted
+// on its own with the cover settings, then put back in its place.
+func convertChapter(ctx context.Context, options *OptimizeOptions, chapter *manga.Chapter, conversion options.Conversion) (*manga.Chapter, error) {
+	var cover *manga.Chapter
+	if options.Cover != nil {
+		cover = takeCover(chapter)
+	}
+
+	// Converters fail on a chapter without pages, which is all that is left
+	// of a one-page chapter once its cover is taken out.
+	var convertedChapter *manga.Chapter
+	if cover != nil && len(chapter.Pages) == 0 {
+		empty := *chapter
+		convertedChapter = &empty
+	} else {
+		var err error
+		convertedChapter, err = runConverter(ctx, options.ChapterConverter, chapter, conversion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cover != nil {
+		coverConverter := options.Cover.Converter
+		if coverConverter == nil {
+			coverConverter = options.ChapterConverter
+		}
+		coverConversion := options.Cover.conversion(conversion)
+		log.Debug().
+			Str("file", chapter.FilePath).
+			Uint16("cover_index", cover.Pages[0].Index).
+			Str("cover_format", coverConverter.Format().String()).
+			Uint8("cover_quality", coverConversion.Quality).
+			Bool("cover_no_downscale", options.Cover.NoDownscale).
+			Msg("Converting cover page")
+		convertedCover, err := runConverter(ctx, coverConverter, cover, coverConversion)
+		if err != nil {
+			return nil, err
+		}
+		convertedChapter.Pages = insertCover(convertedChapter.Pages, convertedCover.Pages)
+		convertedChapter.KeptOriginalPages += convertedCover.KeptOriginalPages
+		convertedChapter.GrayscalePages += convertedCover.GrayscalePages
+	}
+
+	if convertedChapter.KeptOriginalPages > 0 {
+		log.Info().
+			Str("file", chapter.FilePath).
+			Int("kept_original_pages", convertedChapter.KeptOriginalPages).
+			Msg("Kept pages in their original format, conversion did not save enough space")
+	}
+
+	if convertedChapter.GrayscalePages > 0 {
+		log.Info().
+			Str("file", chapter.FilePath).
+			Int("grayscale_pages", convertedChapter.GrayscalePages).
+			Msg("Encoded pages as grayscale")
+	}
+
+	convertedChapter.SetConverted()
+	return convertedChapter, nil
+}
+
+// runConverter runs chapterConverter on chapter with conversion, treating
+// ignored pages as non-fatal.
+func runConverter(ctx context.Context, chapterConverter converter.Converter, chapter *manga.Chapter, conversion options.Conversion) (*manga.Chapter, error) {
+	convertedChapter, err := chapterConverter.ConvertChapter(ctx, chapter, conversion, func(msg string, current uint32, total uint32) {
 		if current%10 == 0 || current == total {
 			log.Info().Str("file", chapter.FilePath).Uint32("current", current).Uint32("total", total).Msg("Converting")
 		} else {
@@ -106,61 +373,225 @@ func Optimize(options *OptimizeOptions) error {
 			log.Debug().Str("file", chapter.FilePath).Err(err).Msg("Page conversion error (non-fatal)")
 		} else {
 			log.Error().Str("file", chapter.FilePath).Err(err).Msg("Chapter conversion failed")
-			return fmt.Errorf("failed to convert chapter: %w", err)
+			return nil, fmt.Errorf("failed to convert chapter: %w", err)
 		}
 	}
 	if convertedChapter == nil {
 		log.Error().Str("file", chapter.FilePath).Msg("Conversion returned nil chapter")
-		return fmt.Errorf("failed to convert chapter")
+		return nil, fmt.Errorf("failed to convert chapter")
 	}
 
 	log.Debug().
 		Str("file", chapter.FilePath).
+		Uint8("quality", conversion.Quality).
 		Int("converted_pages", len(convertedChapter.Pages)).
 		Msg("Chapter conversion completed")
+	return convertedChapter, nil
+}
 
-	convertedChapter.SetConverted()
+// takeCover removes the cover page from chapter.Pages and returns it as a
+// chapter of its own, sharing the chapter's metadata and temp directory.
+// The cover is the page at chapter.CoverIndex, or the first page when that
+// one was removed. Returns nil for a chapter without pages.
+func takeCover(chapter *manga.Chapter) *manga.Chapter {
+	if len(chapter.Pages) == 0 {
+		return nil
+	}
+	coverIndex := chapter.CoverIndex()
+	position := slices.IndexFunc(chapter.Pages, func(page *manga.PageFile) bool { return page.Index == coverIndex })
+	if position < 0 {
+		position = 0
+	}
+	cover := chapter.Pages[position]
+	chapter.Pages = slices.Delete(slices.Clone(chapter.Pages), position, position+1)
+	return &manga.Chapter{
+		FilePath:     chapter.FilePath,
+		Pages:        []*manga.PageFile{cover},
+		ComicInfoXml: chapter.ComicInfoXml,
+		TempDir:      chapter.TempDir,
+	}
+}
 
-	// Step 4: Determine output path
-	outputPath := options.Path
-	originalPath := options.Path
-	isCbrOverride := false
+// insertCover puts the converted cover pages back among the other converted
+// pages, before the first page that came after the cover.
+func insertCover(pages []*manga.PageFile, cover []*manga.PageFile) []*manga.PageFile {
+	if len(cover) == 0 {
+		return pages
+	}
+	position := slices.IndexFunc(pages, func(page *manga.PageFile) bool { return page.Index > cover[0].Index })
+	if position < 0 {
+		position = len(pages)
+	}
+	return slices.Insert(pages, position, cover...)
+}
+
+// writeWithinBudget writes convertedChapter to outputPath if it fits
+// options.MaxSize. Otherwise the source pages are converted again, binary
+// searching the highest quality between minBudgetQuality and the requested
+// one whose archive fits. When none does, the pages are also downscaled at
+// the lowest quality, see writeDownscaled. Every attempt is written next to
+// outputPath first, so an unreachable budget leaves outputPath (the original
+// file when overriding) untouched. Returns the quality of the written
+// archive.
+func writeWithinBudget(ctx context.Context, options *OptimizeOptions, chapter *manga.Chapter, sourcePages []*manga.PageFile, convertedChapter *manga.Chapter, outputPath string) (uint8, error) {
+	attemptPath := outputPath + ".attempt"
+	bestPath := outputPath + ".best"
+	defer func() {
+		_ = os.Remove(attemptPath)
+		_ = os.Remove(bestPath)
+	}()
 
-	if options.Override {
-		pathLower := strings.ToLower(options.Path)
-		if strings.HasSuffix(pathLower, ".cbr") {
-			outputPath = strings.TrimSuffix(options.Path, filepath.Ext(options.Path)) + ".cbz"
-			isCbrOverride = true
+	requested := options.Conversion.Quality
+	size, err := writeSizedCBZ(convertedChapter, attemptPath)
+	if err != nil {
+		return 0, err
+	}
+	if size <= options.MaxSize {
+		return requested, os.Rename(attemptPath, outputPath)
+	}
+	log.Info().
+		Str("file", chapter.FilePath).
+		Uint8("quality", requested).
+		Int64("size", size).
+		Int64("max_size", options.MaxSize).
+		Msg("Converted chapter exceeds size budget, lowering quality")
+
+	smallest := size
+	var best uint8
+	found := false
+	low, high := int(minBudgetQuality), int(requested)-1
+	for low <= high {
+		quality := uint8(low + (high-low)/2)
+
+		chapter.Pages = slices.Clone(sourcePages)
+		attempt, err := convertChapter(ctx, options, chapter, budgetConversion(options.Conversion, quality))
+		if err != nil {
+			return 0, err
 		}
-	} else {
-		pathLower := strings.ToLower(options.Path)
-		if strings.HasSuffix(pathLower, ".cbz") {
-			outputPath = strings.TrimSuffix(options.Path, ".cbz") + "_converted.cbz"
-		} else if strings.HasSuffix(pathLower, ".cbr") {
-			outputPath = strings.TrimSuffix(options.Path, ".cbr") + "_converted.cbz"
+		size, err := writeSizedCBZ(attempt, attemptPath)
+		if err != nil {
+			return 0, err
+		}
+		smallest = min(smallest, size)
+
+		log.Debug().
+			Str("file", chapter.FilePath).
+			Uint8("quality", quality).
+			Int64("size", size).
+			Int64("max_size", options.MaxSize).
+			Msg("Size budget attempt")
+
+		if size <= options.MaxSize {
+			if err := os.Rename(attemptPath, bestPath); err != nil {
+				return 0, err
+			}
+			best, found = quality, true
+			low = int(quality) + 1
 		} else {
-			outputPath = options.Path + "_converted.cbz"
+			high = int(quality) - 1
 		}
 	}
 
-	// Step 5: Write converted chapter to CBZ (streaming from disk)
-	log.Debug().Str("output_path", outputPath).Msg("Writing converted chapter to CBZ file")
-	err = cbz.WriteChapterToCBZ(convertedChapter, outputPath)
+	if found {
+		return best, os.Rename(bestPath, outputPath)
+	}
+
+	floor := min(requested, minBudgetQuality)
+	fits, downscaledSize, err := writeDownscaled(ctx, options, chapter, sourcePages, floor, attemptPath)
 	if err != nil {
-		log.Error().Str("output_path", outputPath).Err(err).Msg("Failed to write converted chapter")
-		return fmt.Errorf("failed to write converted chapter: %w", err)
+		return 0, err
+	}
+	if !fits {
+		return 0, fmt.Errorf("%w: %s is %d bytes at quality %d and downscaled to %d%%, budget is %d bytes",
+			ErrSizeBudgetUnreachable, chapter.FilePath, min(smallest, downscaledSize), floor, int(minBudgetScale*100), options.MaxSize)
 	}
+	return floor, os.Rename(attemptPath, outputPath)
+}
 
-	// If overriding a CBR file, delete the original
-	if isCbrOverride {
-		err = os.Remove(originalPath)
+// writeDownscaled converts the source pages again at quality with resize
+// limits lowered by budgetScaleStep at each attempt, relative to the largest
+// page of the chapter, until its archive written to attemptPath fits
+// options.MaxSize or the scale drops below minBudgetScale. It reports
+// whether one fit, and the smallest size reached otherwise.
+func writeDownscaled(ctx context.Context, options *OptimizeOptions, chapter *manga.Chapter, sourcePages []*manga.PageFile, quality uint8, attemptPath string) (bool, int64, error) {
+	width, height := largestPage(sourcePages, options.Conversion)
+	if width == 0 {
+		return false, 0, nil
+	}
+
+	var smallest int64
+	for scale := budgetScaleStep; scale >= minBudgetScale; scale *= budgetScaleStep {
+		conversion := budgetConversion(options.Conversion, quality)
+		conversion.MaxWidth = max(1, int(float64(width)*scale))
+		conversion.MaxHeight = max(1, int(float64(height)*scale))
+
+		chapter.Pages = slices.Clone(sourcePages)
+		attempt, err := convertChapter(ctx, options, chapter, conversion)
 		if err != nil {
-			log.Warn().Str("file", originalPath).Err(err).Msg("Failed to delete original CBR file")
-		} else {
-			log.Info().Str("file", originalPath).Msg("Deleted original CBR file")
+			return false, 0, err
+		}
+		size, err := writeSizedCBZ(attempt, attemptPath)
+		if err != nil {
+			return false, 0, err
+		}
+
+		log.Debug().
+			Str("file", chapter.FilePath).
+			Uint8("quality", quality).
+			Int("max_width", conversion.MaxWidth).
+			Int("max_height", conversion.MaxHeight).
+			Int64("size", size).
+			Int64("max_size", options.MaxSize).
+			Msg("Size budget downscale attempt")
+
+		if size <= options.MaxSize {
+			log.Info().
+				Str("file", chapter.FilePath).
+				Int("max_width", conversion.MaxWidth).
+				Int("max_height", conversion.MaxHeight).
+				Msg("Converted chapter fits size budget once downscaled")
+			return true, size, nil
+		}
+		if smallest == 0 || size < smallest {
+			smallest = size
 		}
 	}
+	return false, smallest, nil
+}
 
-	log.Info().Str("output", outputPath).Msg("Converted file written")
-	return nil
+// largestPage returns the largest width and height of pages once fitted to
+// the resize limits of conversion, or zeros when no page header can be read.
+func largestPage(pages []*manga.PageFile, conversion options.Conversion) (int, int) {
+	var width, height int
+	for _, page := range pages {
+		pageWidth, pageHeight, err := imaging.Dimensions(page.FilePath)
+		if err != nil {
+			continue
+		}
+		pageWidth, pageHeight, _ = conversion.FitSize(pageWidth, pageHeight)
+		width, height = max(width, pageWidth), max(height, pageHeight)
+	}
+	return width, height
+}
+
+// budgetConversion lowers conversion to quality. With a target SSIM the
+// search range is capped instead, since Quality is not used for lossy pages.
+func budgetConversion(conversion options.Conversion, quality uint8) options.Conversion {
+	conversion.Quality = quality
+	if conversion.TargetSSIM > 0 {
+		conversion.MaxQuality = min(conversion.MaxQuality, quality)
+		conversion.MinQuality = min(conversion.MinQuality, quality)
+	}
+	return conversion
+}
+
+func writeSizedCBZ(chapter *manga.Chapter, path string) (int64, error) {
+	if err := cbz.WriteChapterToCBZ(chapter, path); err != nil {
+		return 0, fmt.Errorf("failed to write converted chapter: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/belphemur/CBZOptimizer/v2/internal/utils/errs"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 )
 
 func TestOptimizeIntegration(t *testing.T) {
@@ -135,9 +136,8 @@ func TestOptimizeIntegration(t *testing.T) {
 			options := &OptimizeOptions{
 				ChapterConverter: converterInstance,
 				Path:             testFile,
-				Quality:          85,
+				Conversion:       options.Conversion{Quality: 85},
 				Override:         tt.override,
-				Split:            false,
 				Timeout:          0,
 			}
 
@@ -272,9 +272,8 @@ func TestOptimizeIntegration_AlreadyConverted(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: converterInstance,
 		Path:             convertedFile,
-		Quality:          85,
+		Conversion:       options.Conversion{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          30 * time.Second,
 	}
 
@@ -310,9 +309,8 @@ func TestOptimizeIntegration_InvalidFile(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: converterInstance,
 		Path:             "/nonexistent/file.cbz",
-		Quality:          85,
+		Conversion:       options.Conversion{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          30 * time.Second,
 	}
 
@@ -384,9 +382,8 @@ func TestOptimizeIntegration_Timeout(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: converterInstance,
 		Path:             cbzFile,
-		Quality:          85,
+		Conversion:       options.Conversion{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          1 * time.Nanosecond, // Extremely short timeout to force timeout
 	}
 
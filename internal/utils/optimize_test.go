@@ -1,8 +1,14 @@
 package utils
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"context"
+	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,8 +17,10 @@ import (
 
 	"github.com/belphemur/CBZOptimizer/v2/internal/cbz"
 	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/internal/pagefilter"
 	"github.com/belphemur/CBZOptimizer/v2/internal/utils/errs"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 )
 
 // MockConverter for testing
@@ -20,7 +28,7 @@ type MockConverter struct {
 	shouldFail bool
 }
 
-func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+func (m *MockConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
 	if m.shouldFail {
 		return nil, &MockError{message: "mock conversion error"}
 	}
@@ -212,9 +220,8 @@ func TestOptimize(t *testing.T) {
 			options := &OptimizeOptions{
 				ChapterConverter: &MockConverter{shouldFail: tt.mockFail},
 				Path:             testFile,
-				Quality:          85,
+				Conversion:       options.Conversion{Quality: 85},
 				Override:         tt.override,
-				Split:            false,
 				Timeout:          0,
 			}
 
@@ -326,9 +333,8 @@ func TestOptimize_AlreadyConverted(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: &MockConverter{},
 		Path:             convertedFile,
-		Quality:          85,
+		Conversion:       options.Conversion{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          0,
 	}
 
@@ -348,9 +354,8 @@ func TestOptimize_InvalidFile(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: &MockConverter{},
 		Path:             "/nonexistent/file.cbz",
-		Quality:          85,
+		Conversion:       options.Conversion{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          0,
 	}
 
@@ -406,9 +411,8 @@ func TestOptimize_Timeout(t *testing.T) {
 	options := &OptimizeOptions{
 		ChapterConverter: &MockConverter{},
 		Path:             cbzFile,
-		Quality:          85,
+		Conversion:       options.Conversion{Quality: 85},
 		Override:         false,
-		Split:            false,
 		Timeout:          500 * time.Microsecond, // 500 microseconds - should timeout during page processing
 	}
 
@@ -422,3 +426,628 @@ func TestOptimize_Timeout(t *testing.T) {
 		t.Errorf("Expected timeout error message, got: %v", err)
 	}
 }
+
+// qualitySizedConverter writes every page as a file whose size grows with the
+// quality, so size budgets can be tested without a real encoder.
+type qualitySizedConverter struct {
+	qualities []uint8
+}
+
+func (c *qualitySizedConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	if len(chapter.Pages) == 0 {
+		// Like the real converters.
+		return nil, errors.New("no pages were converted")
+	}
+	c.qualities = append(c.qualities, opts.Quality)
+	outputDir := filepath.Join(chapter.TempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+
+	converted := make([]*manga.PageFile, 0, len(chapter.Pages))
+	for _, page := range chapter.Pages {
+		outputPath := filepath.Join(outputDir, fmt.Sprintf("%04d.webp", page.Index))
+		if err := os.WriteFile(outputPath, make([]byte, int(opts.Quality)*1000), 0644); err != nil {
+			return nil, err
+		}
+		converted = append(converted, &manga.PageFile{Index: page.Index, Extension: ".webp", FilePath: outputPath})
+	}
+	chapter.Pages = converted
+	return chapter, nil
+}
+
+func (c *qualitySizedConverter) Format() constant.ConversionFormat {
+	return constant.WebP
+}
+
+func (c *qualitySizedConverter) PrepareConverter() error {
+	return nil
+}
+
+// pixelSizedConverter writes every 8x8 test page as a file whose size grows
+// with its fitted pixel count but not with the quality, like lossless pages.
+type pixelSizedConverter struct {
+	widths []int
+}
+
+func (c *pixelSizedConverter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	width, height, _ := opts.FitSize(8, 8)
+	c.widths = append(c.widths, width)
+	outputDir := filepath.Join(chapter.TempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, err
+	}
+
+	converted := make([]*manga.PageFile, 0, len(chapter.Pages))
+	for _, page := range chapter.Pages {
+		outputPath := filepath.Join(outputDir, fmt.Sprintf("%04d.webp", page.Index))
+		if err := os.WriteFile(outputPath, make([]byte, width*height*1000), 0644); err != nil {
+			return nil, err
+		}
+		converted = append(converted, &manga.PageFile{Index: page.Index, Extension: ".webp", FilePath: outputPath})
+	}
+	chapter.Pages = converted
+	return chapter, nil
+}
+
+func (c *pixelSizedConverter) Format() constant.ConversionFormat {
+	return constant.WebP
+}
+
+func (c *pixelSizedConverter) PrepareConverter() error {
+	return nil
+}
+
+// writeTestCBZ creates a CBZ with the given number of small pages.
+func writeTestCBZ(t *testing.T, path string, pages int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(f)
+	for i := 0; i < pages; i++ {
+		w, err := zipWriter.Create(fmt.Sprintf("%04d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(w, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptimize_MaxSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxSize         int64
+		expectError     bool
+		expectQualities []uint8
+	}{
+		{
+			name:            "fits at requested quality",
+			maxSize:         1_000_000,
+			expectQualities: []uint8{85},
+		},
+		{
+			// 3 pages of quality*1000 bytes plus zip overhead: 50 fits, 51 does not.
+			name:    "lowers quality until it fits",
+			maxSize: 151_000,
+			// 85 misses, then binary search over [10, 84].
+			expectQualities: []uint8{85, 47, 66, 56, 51, 49, 50},
+		},
+		{
+			name:        "unreachable budget",
+			maxSize:     1_000,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputPath := filepath.Join(dir, "chapter.cbz")
+			writeTestCBZ(t, inputPath, 3)
+			outputPath := filepath.Join(dir, "chapter_converted.cbz")
+
+			conv := &qualitySizedConverter{}
+			err := Optimize(&OptimizeOptions{
+				ChapterConverter: conv,
+				Path:             inputPath,
+				Conversion:       options.Conversion{Quality: 85},
+				MaxSize:          tt.maxSize,
+			})
+
+			if tt.expectError {
+				if !errors.Is(err, ErrSizeBudgetUnreachable) {
+					t.Fatalf("Expected ErrSizeBudgetUnreachable, got %v", err)
+				}
+				if _, statErr := os.Stat(outputPath); !os.IsNotExist(statErr) {
+					t.Error("No output should be written when the budget is unreachable")
+				}
+				if conv.qualities[len(conv.qualities)-1] != minBudgetQuality {
+					t.Errorf("Expected the last attempt at quality %d, got %v", minBudgetQuality, conv.qualities)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			info, err := os.Stat(outputPath)
+			if err != nil {
+				t.Fatalf("Expected output file: %v", err)
+			}
+			if info.Size() > tt.maxSize {
+				t.Errorf("Output is %d bytes, budget is %d", info.Size(), tt.maxSize)
+			}
+			if fmt.Sprint(conv.qualities) != fmt.Sprint(tt.expectQualities) {
+				t.Errorf("Expected qualities %v, got %v", tt.expectQualities, conv.qualities)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), ".attempt") || strings.HasSuffix(entry.Name(), ".best") {
+					t.Errorf("Temporary file left behind: %s", entry.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestBudgetConversion(t *testing.T) {
+	fixed := budgetConversion(options.Conversion{Quality: 85, MinQuality: 50, MaxQuality: 95}, 40)
+	if fixed.Quality != 40 || fixed.MaxQuality != 95 || fixed.MinQuality != 50 {
+		t.Errorf("Unexpected conversion without target SSIM: %+v", fixed)
+	}
+
+	target := budgetConversion(options.Conversion{Quality: 85, TargetSSIM: 0.98, MinQuality: 50, MaxQuality: 95}, 40)
+	if target.Quality != 40 || target.MaxQuality != 40 || target.MinQuality != 40 {
+		t.Errorf("Expected the search range capped at 40, got %+v", target)
+	}
+}
+
+func TestOptimize_Webtoon(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "chapter.cbz")
+	// 3 pages of 8 rows make a 24-row strip: two 12-row pages.
+	writeTestCBZ(t, inputPath, 3)
+
+	err := Optimize(&OptimizeOptions{
+		ChapterConverter: &qualitySizedConverter{},
+		Path:             inputPath,
+		Conversion:       options.Conversion{Quality: 10, SliceHeight: 12},
+		Webtoon:          true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reader, err := zip.OpenReader(filepath.Join(dir, "chapter_converted.cbz"))
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	pages := 0
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, ".webp") {
+			pages++
+		}
+	}
+	if pages != 2 {
+		t.Errorf("Expected 2 resliced pages, got %d", pages)
+	}
+}
+
+func TestOptimize_PageFilter(t *testing.T) {
+	dir := t.TempDir()
+	pattern := func(step int) image.Image {
+		img := image.NewGray(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				img.SetGray(x, y, color.Gray{Y: uint8((x*step + y*step*3) % 256)})
+			}
+		}
+		return img
+	}
+	credits := pattern(11)
+	pages := []image.Image{image.NewGray(image.Rect(0, 0, 64, 64)), pattern(3), credits}
+
+	inputPath := filepath.Join(dir, "chapter.cbz")
+	f, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(f)
+	for i, page := range pages {
+		w, err := zipWriter.Create(fmt.Sprintf("%04d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(w, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	referencePath := filepath.Join(dir, "credits.png")
+	f, err = os.Create(referencePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, credits); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := pagefilter.New(true, []string{referencePath}, pagefilter.DefaultMaxDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter: &qualitySizedConverter{},
+		Path:             inputPath,
+		Conversion:       options.Conversion{Quality: 10},
+		PageFilter:       filter,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reader, err := zip.OpenReader(filepath.Join(dir, "chapter_converted.cbz"))
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	if fmt.Sprint(names) != "[0001.webp]" {
+		t.Errorf("Expected only the content page, got %v", names)
+	}
+	for _, expected := range []string{"Removed 2 pages:", "- page 0: blank", "- page 2: matches credits.png"} {
+		if !strings.Contains(reader.Comment, expected) {
+			t.Errorf("Expected comment to contain %q, got %q", expected, reader.Comment)
+		}
+	}
+}
+
+func TestOptimize_Cover(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "chapter.cbz")
+	f, err := os.Create(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipWriter := zip.NewWriter(f)
+	for i := 0; i < 3; i++ {
+		w, err := zipWriter.Create(fmt.Sprintf("%04d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(w, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first page is a credits page, the cover comes second.
+	w, err := zipWriter.Create("ComicInfo.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(`<ComicInfo><Pages><Page Image="0"/><Page Image="1" Type="FrontCover"/><Page Image="2"/></Pages></ComicInfo>`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	chapterConverter := &qualitySizedConverter{}
+	coverConverter := &qualitySizedConverter{}
+	err = Optimize(&OptimizeOptions{
+		ChapterConverter: chapterConverter,
+		Path:             inputPath,
+		Conversion:       options.Conversion{Quality: 10},
+		Cover:            &CoverOptions{Converter: coverConverter, Quality: 50},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fmt.Sprint(chapterConverter.qualities) != "[10]" || fmt.Sprint(coverConverter.qualities) != "[50]" {
+		t.Errorf("Expected the chapter at quality 10 and the cover at 50, got %v and %v", chapterConverter.qualities, coverConverter.qualities)
+	}
+
+	reader, err := zip.OpenReader(filepath.Join(dir, "chapter_converted.cbz"))
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	var pages []string
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, ".webp") {
+			pages = append(pages, fmt.Sprintf("%s:%d", file.Name, file.UncompressedSize64))
+		}
+	}
+	if fmt.Sprint(pages) != "[0000.webp:10000 0001.webp:50000 0002.webp:10000]" {
+		t.Errorf("Expected the cover in its place at quality 50, got %v", pages)
+	}
+}
+
+func TestOptimize_CoverOnePageChapter(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "chapter.cbz")
+	writeTestCBZ(t, inputPath, 1)
+
+	chapterConverter := &qualitySizedConverter{}
+	coverConverter := &qualitySizedConverter{}
+	err := Optimize(&OptimizeOptions{
+		ChapterConverter: chapterConverter,
+		Path:             inputPath,
+		Conversion:       options.Conversion{Quality: 10},
+		Cover:            &CoverOptions{Converter: coverConverter, Quality: 50},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(chapterConverter.qualities) != 0 || fmt.Sprint(coverConverter.qualities) != "[50]" {
+		t.Errorf("Expected only the cover converted, at quality 50, got %v and %v", chapterConverter.qualities, coverConverter.qualities)
+	}
+
+	chapter, err := cbz.LoadChapter(filepath.Join(dir, "chapter_converted.cbz"))
+	if err != nil {
+		t.Fatalf("Expected output file: %v", err)
+	}
+	defer func() { _ = chapter.Cleanup() }()
+	if len(chapter.Pages) != 1 {
+		t.Errorf("Expected 1 page, got %d", len(chapter.Pages))
+	}
+}
+
+// writeTestCBT creates a CBT (tar) archive with the given number of small
+// pages.
+func writeTestCBT(t *testing.T, path string, pages int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarWriter := tar.NewWriter(f)
+	for i := 0; i < pages; i++ {
+		var page strings.Builder
+		if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+			t.Fatal(err)
+		}
+		header := &tar.Header{Name: fmt.Sprintf("%04d.png", i), Mode: 0644, Size: int64(page.Len())}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(page.String())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptimize_CBT(t *testing.T) {
+	tests := []struct {
+		name           string
+		override       bool
+		expectedOutput string
+	}{
+		{name: "without override", override: false, expectedOutput: "chapter_converted.cbz"},
+		{name: "with override", override: true, expectedOutput: "chapter.cbz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputPath := filepath.Join(dir, "chapter.cbt")
+			writeTestCBT(t, inputPath, 3)
+
+			err := Optimize(&OptimizeOptions{
+				ChapterConverter: &qualitySizedConverter{},
+				Path:             inputPath,
+				Conversion:       options.Conversion{Quality: 10},
+				Override:         tt.override,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			chapter, err := cbz.LoadChapter(filepath.Join(dir, tt.expectedOutput))
+			if err != nil {
+				t.Fatalf("Expected output file: %v", err)
+			}
+			defer func() { _ = chapter.Cleanup() }()
+			if len(chapter.Pages) != 3 {
+				t.Errorf("Expected 3 pages, got %d", len(chapter.Pages))
+			}
+
+			_, err = os.Stat(inputPath)
+			if tt.override && !os.IsNotExist(err) {
+				t.Error("Expected the original CBT to be deleted")
+			}
+			if !tt.override && err != nil {
+				t.Errorf("Expected the original CBT to be kept: %v", err)
+			}
+		})
+	}
+}
+
+func TestOptimize_Folder(t *testing.T) {
+	writeFolder := func(t *testing.T) string {
+		t.Helper()
+		folder := filepath.Join(t.TempDir(), "Chapter 1")
+		if err := os.Mkdir(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			f, err := os.Create(filepath.Join(folder, fmt.Sprintf("page%d.png", i+1)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 8, 8))); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return folder
+	}
+
+	t.Run("writes a CBZ next to the folder", func(t *testing.T) {
+		folder := writeFolder(t)
+		converter := &qualitySizedConverter{}
+		optimizeOptions := &OptimizeOptions{
+			ChapterConverter: converter,
+			Path:             folder,
+			Conversion:       options.Conversion{Quality: 10},
+		}
+		if err := Optimize(optimizeOptions); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		chapter, err := cbz.LoadChapter(folder + ".cbz")
+		if err != nil {
+			t.Fatalf("Expected output file: %v", err)
+		}
+		defer func() { _ = chapter.Cleanup() }()
+		if len(chapter.Pages) != 3 || !chapter.IsConverted {
+			t.Errorf("Expected 3 converted pages, got %d (converted: %v)", len(chapter.Pages), chapter.IsConverted)
+		}
+		if _, err := os.Stat(folder); err != nil {
+			t.Errorf("Expected the folder to be kept: %v", err)
+		}
+
+		// The CBZ now exists, so the folder is not converted again.
+		if err := Optimize(optimizeOptions); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(converter.qualities) != 1 {
+			t.Errorf("Expected the folder to be converted once, got %d conversions", len(converter.qualities))
+		}
+	})
+
+	t.Run("removes the folder", func(t *testing.T) {
+		folder := writeFolder(t)
+		err := Optimize(&OptimizeOptions{
+			ChapterConverter: &qualitySizedConverter{},
+			Path:             folder,
+			Conversion:       options.Conversion{Quality: 10},
+			RemoveFolder:     true,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := os.Stat(folder + ".cbz"); err != nil {
+			t.Errorf("Expected output file: %v", err)
+		}
+		if _, err := os.Stat(folder); !os.IsNotExist(err) {
+			t.Error("Expected the folder to be deleted")
+		}
+	})
+
+	t.Run("rejects a folder with other files", func(t *testing.T) {
+		folder := writeFolder(t)
+		if err := os.WriteFile(filepath.Join(folder, "notes.txt"), []byte("notes"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := Optimize(&OptimizeOptions{
+			ChapterConverter: &qualitySizedConverter{},
+			Path:             folder,
+			Conversion:       options.Conversion{Quality: 10},
+		})
+		if err == nil {
+			t.Error("Expected an error for a folder that is not only images")
+		}
+	})
+}
+
+func TestOptimize_MaxSizeDownscales(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxSize     int64
+		expectError bool
+		// expectLastWidth is the page width of the last attempt.
+		expectLastWidth int
+	}{
+		{
+			// 3 pages of 8x8x1000 bytes miss at every quality, 6x6 fits.
+			name:            "downscales once the quality floor misses",
+			maxSize:         120_000,
+			expectLastWidth: 6,
+		},
+		{
+			// 8 * 0.75^4 is below a quarter of the page, so 3x3 is the last try.
+			name:            "unreachable budget",
+			maxSize:         1_000,
+			expectError:     true,
+			expectLastWidth: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputPath := filepath.Join(dir, "chapter.cbz")
+			writeTestCBZ(t, inputPath, 3)
+			outputPath := filepath.Join(dir, "chapter_converted.cbz")
+
+			conv := &pixelSizedConverter{}
+			err := Optimize(&OptimizeOptions{
+				ChapterConverter: conv,
+				Path:             inputPath,
+				Conversion:       options.Conversion{Quality: 85},
+				MaxSize:          tt.maxSize,
+			})
+
+			if last := conv.widths[len(conv.widths)-1]; last != tt.expectLastWidth {
+				t.Errorf("Expected the last attempt %d pixels wide, got %v", tt.expectLastWidth, conv.widths)
+			}
+			if tt.expectError {
+				if !errors.Is(err, ErrSizeBudgetUnreachable) {
+					t.Fatalf("Expected ErrSizeBudgetUnreachable, got %v", err)
+				}
+				if _, statErr := os.Stat(outputPath); !os.IsNotExist(statErr) {
+					t.Error("No output should be written when the budget is unreachable")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			info, err := os.Stat(outputPath)
+			if err != nil {
+				t.Fatalf("Expected output file: %v", err)
+			}
+			if info.Size() > tt.maxSize {
+				t.Errorf("Output is %d bytes, budget is %d", info.Size(), tt.maxSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package webpenc
+
+import (
+	"math/bits"
+	"slices"
+)
+
+const (
+	maxCodeLength           = 15
+	maxCodeLengthCodeLength = 7
+	numCodeLengthCodes      = 19
+	repeatPreviousCode      = 16
+	repeatShortZeroCode     = 17
+	repeatLongZeroCode      = 18
+)
+
+// codeLengthOrder is the order the code length code lengths are written in.
+var codeLengthOrder = [numCodeLengthCodes]uint8{
+	17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// huffmanCode is a canonical prefix code, with each symbol's code bit
+// reversed for the least significant bit first bitWriter.
+type huffmanCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (c *huffmanCode) write(w *bitWriter, symbol uint32) {
+	w.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writeHuffmanCode writes a prefix code fitted to histogram and returns it.
+// Codes with at most two symbols below 256 use the compact simple form.
+func writeHuffmanCode(w *bitWriter, histogram []uint32) *huffmanCode {
+	var symbols []uint32
+	for s, count := range histogram {
+		if count > 0 {
+			symbols = append(symbols, uint32(s))
+		}
+	}
+	code := &huffmanCode{
+		lengths: make([]uint8, len(histogram)),
+		codes:   make([]uint32, len(histogram)),
+	}
+
+	switch {
+	case len(symbols) == 0:
+		// A code nothing is written with still has to be valid: a single
+		// symbol 0.
+		w.write(1, 1)
+		w.write(0, 1)
+		w.write(0, 1)
+		w.write(0, 1)
+		return code
+	case len(symbols) <= 2 && symbols[len(symbols)-1] < 256:
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(symbols[0], 1)
+		} else {
+			w.write(1, 1)
+			w.write(symbols[0], 8)
+		}
+		if len(symbols) == 2 {
+			w.write(symbols[1], 8)
+			code.lengths[symbols[0]], code.codes[symbols[0]] = 1, 0
+			code.lengths[symbols[1]], code.codes[symbols[1]] = 1, 1
+		}
+		return code
+	}
+
+	lengths := huffmanLengths(histogram, maxCodeLength)
+	writeCodeLengths(w, lengths)
+	return canonicalCode(lengths)
+}
+
+// writeCodeLengths writes lengths in the normal form: run-length encoded,
+// themselves prefix coded.
+func writeCodeLengths(w *bitWriter, lengths []uint8) {
+	type token struct{ symbol, extra uint8 }
+	var tokens []token
+	histogram := make([]uint32, numCodeLengthCodes)
+	previous := uint8(8)
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+		i += run
+		for run > 0 {
+			var t token
+			switch {
+			case length == 0 && run >= 11:
+				n := min(run, 138)
+				t, run = token{repeatLongZeroCode, uint8(n - 11)}, run-n
+			case length == 0 && run >= 3:
+				n := min(run, 10)
+				t, run = token{repeatShortZeroCode, uint8(n - 3)}, run-n
+			case length != 0 && length == previous && run >= 3:
+				n := min(run, 6)
+				t, run = token{repeatPreviousCode, uint8(n - 3)}, run-n
+			default:
+				t, run = token{length, 0}, run-1
+				if length != 0 {
+					previous = length
+				}
+			}
+			tokens = append(tokens, t)
+			histogram[t.symbol]++
+		}
+	}
+
+	codeLengths := huffmanLengths(histogram, maxCodeLengthCodeLength)
+	n := numCodeLengthCodes
+	for n > 4 && codeLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.write(0, 1) // Not a simple code.
+	w.write(uint32(n-4), 4)
+	for _, symbol := range codeLengthOrder[:n] {
+		w.write(uint32(codeLengths[symbol]), 3)
+	}
+	w.write(0, 1) // Every symbol has a length, no max_symbol.
+
+	code := canonicalCode(codeLengths)
+	for _, t := range tokens {
+		code.write(w, uint32(t.symbol))
+		switch t.symbol {
+		case repeatPreviousCode:
+			w.write(uint32(t.extra), 2)
+		case repeatShortZeroCode:
+			w.write(uint32(t.extra), 3)
+		case repeatLongZeroCode:
+			w.write(uint32(t.extra), 7)
+		}
+	}
+}
+
+// canonicalCode assigns the codes of lengths as the decoder does: shorter
+// codes first, then by symbol. A lone symbol takes no bits.
+func canonicalCode(lengths []uint8) *huffmanCode {
+	code := &huffmanCode{lengths: slices.Clone(lengths), codes: make([]uint32, len(lengths))}
+	var counts [maxCodeLength + 1]uint32
+	used, last := 0, 0
+	for s, length := range lengths {
+		if length > 0 {
+			counts[length]++
+			used, last = used+1, s
+		}
+	}
+	if used == 1 {
+		code.lengths[last] = 0
+		return code
+	}
+
+	var next [maxCodeLength + 1]uint32
+	c := uint32(0)
+	for length := 1; length <= maxCodeLength; length++ {
+		c = (c + counts[length-1]) << 1
+		next[length] = c
+	}
+	for s, length := range lengths {
+		if length > 0 {
+			code.codes[s] = bits.Reverse32(next[length]) >> (32 - uint(length))
+			next[length]++
+		}
+	}
+	return code
+}
+
+// huffmanLengths returns the code lengths of a Huffman code for histogram,
+// none longer than limit. When the optimal code is too deep, rare symbols
+// are counted as more frequent until it fits.
+func huffmanLengths(histogram []uint32, limit int) []uint8 {
+	lengths := make([]uint8, len(histogram))
+	var symbols []int
+	for s, count := range histogram {
+		if count > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	switch len(symbols) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+	for floor := uint32(1); ; floor *= 2 {
+		if huffmanDepths(histogram, symbols, floor, lengths) <= limit {
+			return lengths
+		}
+	}
+}
+
+// huffmanDepths builds a Huffman tree over symbols, with counts raised to
+// at least floor, stores each symbol's depth in lengths and returns the
+// deepest.
+func huffmanDepths(histogram []uint32, symbols []int, floor uint32, lengths []uint8) int {
+	type node struct {
+		weight uint64
+		// Leaves have no children and the index of their symbol in left.
+		left, right int
+		leaf        bool
+	}
+	nodes := make([]node, 0, 2*len(symbols))
+	for _, s := range symbols {
+		nodes = append(nodes, node{weight: uint64(max(histogram[s], floor)), left: s, leaf: true})
+	}
+	slices.SortStableFunc(nodes, func(a, b node) int {
+		switch {
+		case a.weight < b.weight:
+			return -1
+		case a.weight > b.weight:
+			return 1
+		}
+		return 0
+	})
+
+	// Two queues: the sorted leaves, and the merged nodes, which come out
+	// in increasing weight.
+	nextLeaf, nextMerged := 0, len(symbols)
+	smallest := func() int {
+		if nextLeaf < len(symbols) && (nextMerged >= len(nodes) || nodes[nextLeaf].weight <= nodes[nextMerged].weight) {
+			nextLeaf++
+			return nextLeaf - 1
+		}
+		nextMerged++
+		return nextMerged - 1
+	}
+	for range len(symbols) - 1 {
+		a := smallest()
+		b := smallest()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, left: a, right: b})
+	}
+
+	deepest := 0
+	type entry struct{ node, depth int }
+	stack := []entry{{len(nodes) - 1, 0}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		n := nodes[e.node]
+		if n.leaf {
+			lengths[n.left] = uint8(min(e.depth, 255))
+			deepest = max(deepest, e.depth)
+			continue
+		}
+		stack = append(stack, entry{n.left, e.depth + 1}, entry{n.right, e.depth + 1})
+	}
+	return deepest
+}
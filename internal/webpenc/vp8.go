@@ -0,0 +1,713 @@
+package webpenc
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+)
+
+// The lossy encoder keeps to a subset of VP8: every macroblock is predicted
+// as a whole (16x16 luma, 8x8 chroma) with the mode leaving the smallest
+// error, one quantizer applies to the whole frame and the tokens go in a
+// single partition. It reconstructs each macroblock exactly as the decoder
+// will, so that predictions match on both sides.
+
+const (
+	// The 16x16 and chroma prediction modes, in the decoder's numbering.
+	predDC = 0
+	predTM = 1
+	predVE = 2
+	predHE = 3
+
+	maxLevel = 2047
+
+	// The quantizers round a coefficient up once its fractional part,
+	// out of 256, reaches 256 minus these biases.
+	y1DCBias = 96
+	y1ACBias = 110
+	y2DCBias = 96
+	y2ACBias = 108
+	uvDCBias = 110
+	uvACBias = 115
+)
+
+// quantMatrix quantizes the DC and the AC coefficients of a block.
+type quantMatrix struct {
+	q    [2]int32
+	iq   [2]uint32
+	bias [2]uint32
+}
+
+func newQuantMatrix(dc, ac uint16, dcBias, acBias uint32) quantMatrix {
+	return quantMatrix{
+		q:    [2]int32{int32(dc), int32(ac)},
+		iq:   [2]uint32{(1 << 17) / uint32(dc), (1 << 17) / uint32(ac)},
+		bias: [2]uint32{dcBias << 9, acBias << 9},
+	}
+}
+
+// quantize quantizes coeffs from its first coefficient on, storing the
+// levels in zigzag order and the coefficients the decoder will see in
+// place. It reports whether any level is not 0.
+func (m *quantMatrix) quantize(coeffs *[16]int32, levels *[16]int16, first int) bool {
+	nonZero := false
+	for n := first; n < 16; n++ {
+		j := zigzag[n]
+		k := min(int(j), 1)
+		c := coeffs[j]
+		sign := int32(1)
+		if c < 0 {
+			sign, c = -1, -c
+		}
+		level := int32(min((uint32(c)*m.iq[k]+m.bias[k])>>17, maxLevel))
+		levels[n] = int16(sign * level)
+		coeffs[j] = sign * level * m.q[k]
+		nonZero = nonZero || level != 0
+	}
+	return nonZero
+}
+
+// macroblock is what the bitstream stores of a macroblock.
+type macroblock struct {
+	yMode, uvMode uint8
+	skip          bool
+	// levels are the quantized coefficients in zigzag order: the 16 luma
+	// blocks, the 4 U then the 4 V blocks, then the luma DC (Y2) block.
+	levels [25][16]int16
+}
+
+// lossyEncoder holds the frame being encoded: its source planes, padded to
+// whole macroblocks, the planes the decoder will reconstruct, and the
+// macroblocks.
+type lossyEncoder struct {
+	mbw, mbh         int
+	q                int
+	y1, y2, uv       quantMatrix
+	yStride, cStride int
+	srcY, srcU, srcV []uint8
+	recY, recU, recV []uint8
+	mbs              []macroblock
+}
+
+// encodeLossy returns the VP8 bitstream of img at quality (0-100).
+func encodeLossy(img *image.NRGBA, quality int) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	e := &lossyEncoder{
+		mbw: (width + 15) >> 4,
+		mbh: (height + 15) >> 4,
+		q:   quantizerIndex(quality),
+	}
+	e.y1 = newQuantMatrix(dequantTableDC[e.q], dequantTableAC[e.q], y1DCBias, y1ACBias)
+	e.y2 = newQuantMatrix(dequantTableDC[e.q]*2, max(dequantTableAC[e.q]*155/100, 8), y2DCBias, y2ACBias)
+	e.uv = newQuantMatrix(dequantTableDC[min(e.q, 117)], dequantTableAC[e.q], uvDCBias, uvACBias)
+	e.toYUV(img)
+
+	e.mbs = make([]macroblock, e.mbw*e.mbh)
+	for mby := range e.mbh {
+		for mbx := range e.mbw {
+			e.encodeMacroblock(mbx, mby)
+		}
+	}
+	return e.writeFrame(width, height)
+}
+
+// quantizerIndex maps a quality to a quantizer index (0-127) the way cwebp
+// does before its per-segment adjustments.
+func quantizerIndex(quality int) int {
+	c := float64(quality) / 100
+	linear := 2*c - 1
+	if c < 0.75 {
+		linear = c * 2 / 3
+	}
+	return min(max(int(127*(1-math.Cbrt(linear))), 0), 127)
+}
+
+// toYUV converts img to limited range YUV 4:2:0 planes, replicating the
+// last column and row into the macroblock padding.
+func (e *lossyEncoder) toYUV(img *image.NRGBA) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	e.yStride, e.cStride = e.mbw*16, e.mbw*8
+	e.srcY = make([]uint8, e.yStride*e.mbh*16)
+	e.srcU = make([]uint8, e.cStride*e.mbh*8)
+	e.srcV = make([]uint8, e.cStride*e.mbh*8)
+	e.recY = make([]uint8, len(e.srcY))
+	e.recU = make([]uint8, len(e.srcU))
+	e.recV = make([]uint8, len(e.srcV))
+
+	rgb := func(x, y int) (int, int, int) {
+		p := img.Pix[min(y, height-1)*img.Stride+4*min(x, width-1):]
+		return int(p[0]), int(p[1]), int(p[2])
+	}
+	for y := range e.mbh * 16 {
+		for x := range e.mbw * 16 {
+			r, g, b := rgb(x, y)
+			e.srcY[y*e.yStride+x] = rgbToY(r, g, b)
+		}
+	}
+	for y := range e.mbh * 8 {
+		for x := range e.mbw * 8 {
+			var r, g, b int
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb := rgb(2*x+d[0], 2*y+d[1])
+				r, g, b = r+pr, g+pg, b+pb
+			}
+			e.srcU[y*e.cStride+x] = clipUV(-9719*r - 19081*g + 28800*b)
+			e.srcV[y*e.cStride+x] = clipUV(28800*r - 24116*g - 4684*b)
+		}
+	}
+}
+
+// rgbToY returns the limited range luma of an RGB color.
+func rgbToY(r, g, b int) uint8 {
+	return uint8((16839*r + 33059*g + 6420*b + 16<<16 + 1<<15) >> 16)
+}
+
+// clipUV scales a chroma sum over 4 pixels and clips it to a byte.
+func clipUV(v int) uint8 {
+	return clampByte((v + 1<<17 + 128<<18) >> 18)
+}
+
+// encodeMacroblock picks the predictions of a macroblock, quantizes its
+// residuals and reconstructs it.
+func (e *lossyEncoder) encodeMacroblock(mbx, mby int) {
+	mb := &e.mbs[mby*e.mbw+mbx]
+	var pred [256]uint8
+
+	mb.yMode = e.bestMode(e.srcY, e.recY, e.yStride, 16, mbx, mby)
+	e.predict(mb.yMode, e.recY, e.yStride, 16, mbx, mby, pred[:])
+	var coeffs [16][16]int32
+	var dc [16]int32
+	for b := range 16 {
+		x, y := mbx*16+b%4*4, mby*16+b/4*4
+		forwardDCT(e.srcY[y*e.yStride+x:], pred[b/4*64+b%4*4:], e.yStride, 16, &coeffs[b])
+		dc[b] = coeffs[b][0]
+	}
+	var y2 [16]int32
+	forwardWHT(&dc, &y2)
+	nonZero := e.y2.quantize(&y2, &mb.levels[24], 0)
+	dc = inverseWHT(&y2)
+	for b := range 16 {
+		nonZero = e.y1.quantize(&coeffs[b], &mb.levels[b], 1) || nonZero
+		coeffs[b][0] = dc[b]
+		x, y := mbx*16+b%4*4, mby*16+b/4*4
+		inverseDCT(&coeffs[b], pred[b/4*64+b%4*4:], 16, e.recY[y*e.yStride+x:], e.yStride)
+	}
+
+	// Both chroma planes share a prediction mode.
+	mb.uvMode = predDC
+	best := math.MaxInt
+	for _, mode := range [4]uint8{predDC, predTM, predVE, predHE} {
+		cost := 0
+		for _, p := range [2][2][]uint8{{e.srcU, e.recU}, {e.srcV, e.recV}} {
+			e.predict(mode, p[1], e.cStride, 8, mbx, mby, pred[:64])
+			cost += sse(p[0][mby*8*e.cStride+mbx*8:], e.cStride, pred[:64], 8)
+		}
+		if cost < best {
+			mb.uvMode, best = mode, cost
+		}
+	}
+	for i, p := range [2][2][]uint8{{e.srcU, e.recU}, {e.srcV, e.recV}} {
+		e.predict(mb.uvMode, p[1], e.cStride, 8, mbx, mby, pred[:64])
+		for b := range 4 {
+			x, y := mbx*8+b%2*4, mby*8+b/2*4
+			var c [16]int32
+			forwardDCT(p[0][y*e.cStride+x:], pred[b/2*32+b%2*4:], e.cStride, 8, &c)
+			nonZero = e.uv.quantize(&c, &mb.levels[16+4*i+b], 0) || nonZero
+			inverseDCT(&c, pred[b/2*32+b%2*4:], 8, p[1][y*e.cStride+x:], e.cStride)
+		}
+	}
+	mb.skip = !nonZero
+}
+
+// bestMode returns the prediction mode of a size x size block closest to
+// the source.
+func (e *lossyEncoder) bestMode(src, rec []uint8, stride, size, mbx, mby int) uint8 {
+	var pred [256]uint8
+	mode, best := uint8(predDC), math.MaxInt
+	for _, m := range [4]uint8{predDC, predTM, predVE, predHE} {
+		e.predict(m, rec, stride, size, mbx, mby, pred[:size*size])
+		if cost := sse(src[mby*size*stride+mbx*size:], stride, pred[:size*size], size); cost < best {
+			mode, best = m, cost
+		}
+	}
+	return mode
+}
+
+// predict fills out with the prediction of the size x size block of
+// macroblock (mbx, mby) in a reconstructed plane. Outside the frame, the
+// decoder takes the row above as 127 and the column to the left as 129.
+func (e *lossyEncoder) predict(mode uint8, rec []uint8, stride, size, mbx, mby int, out []uint8) {
+	var top, left [16]uint8
+	topLeft := uint8(0x7f)
+	origin := mby*size*stride + mbx*size
+	for i := range size {
+		top[i], left[i] = 0x7f, 0x81
+		if mby > 0 {
+			top[i] = rec[origin-stride+i]
+		}
+		if mbx > 0 {
+			left[i] = rec[origin+i*stride-1]
+		}
+	}
+	if mby > 0 {
+		topLeft = 0x81
+		if mbx > 0 {
+			topLeft = rec[origin-stride-1]
+		}
+	}
+
+	switch mode {
+	case predDC:
+		var sum int
+		var shift uint
+		switch {
+		case mbx > 0 && mby > 0:
+			for i := range size {
+				sum += int(top[i]) + int(left[i])
+			}
+			shift = 1
+		case mby > 0:
+			for i := range size {
+				sum += int(top[i])
+			}
+		case mbx > 0:
+			for i := range size {
+				sum += int(left[i])
+			}
+		default:
+			sum = 0x80 * size
+		}
+		n := size << shift
+		avg := uint8((sum + n/2) / n)
+		for i := range size * size {
+			out[i] = avg
+		}
+	case predTM:
+		for y := range size {
+			for x := range size {
+				out[y*size+x] = clampByte(int(left[y]) + int(top[x]) - int(topLeft))
+			}
+		}
+	case predVE:
+		for y := range size {
+			copy(out[y*size:(y+1)*size], top[:size])
+		}
+	case predHE:
+		for y := range size {
+			for x := range size {
+				out[y*size+x] = left[y]
+			}
+		}
+	}
+}
+
+// sse is the sum of the squared differences between a block of src and
+// pred.
+func sse(src []uint8, stride int, pred []uint8, size int) int {
+	sum := 0
+	for y := range size {
+		for x := range size {
+			d := int(src[y*stride+x]) - int(pred[y*size+x])
+			sum += d * d
+		}
+	}
+	return sum
+}
+
+// forwardDCT transforms the difference between a 4x4 block of src and
+// pred, with the integer approximation libwebp uses.
+func forwardDCT(src, pred []uint8, srcStride, predStride int, out *[16]int32) {
+	var tmp [16]int32
+	for i := range 4 {
+		s, p := src[i*srcStride:], pred[i*predStride:]
+		d0 := int32(s[0]) - int32(p[0])
+		d1 := int32(s[1]) - int32(p[1])
+		d2 := int32(s[2]) - int32(p[2])
+		d3 := int32(s[3]) - int32(p[3])
+		a0, a1, a2, a3 := d0+d3, d1+d2, d1-d2, d0-d3
+		tmp[0+i*4] = (a0 + a1) * 8
+		tmp[1+i*4] = (a2*2217 + a3*5352 + 1812) >> 9
+		tmp[2+i*4] = (a0 - a1) * 8
+		tmp[3+i*4] = (a3*2217 - a2*5352 + 937) >> 9
+	}
+	for i := range 4 {
+		a0 := tmp[0+i] + tmp[12+i]
+		a1 := tmp[4+i] + tmp[8+i]
+		a2 := tmp[4+i] - tmp[8+i]
+		a3 := tmp[0+i] - tmp[12+i]
+		out[0+i] = (a0 + a1 + 7) >> 4
+		out[4+i] = (a2*2217 + a3*5352 + 12000) >> 16
+		if a3 != 0 {
+			out[4+i]++
+		}
+		out[8+i] = (a0 - a1 + 7) >> 4
+		out[12+i] = (a3*2217 - a2*5352 + 51000) >> 16
+	}
+}
+
+// forwardWHT transforms the DC coefficients of the 16 luma blocks, in
+// raster order.
+func forwardWHT(in, out *[16]int32) {
+	var tmp [16]int32
+	for i := range 4 {
+		a0 := in[4*i+0] + in[4*i+2]
+		a1 := in[4*i+1] + in[4*i+3]
+		a2 := in[4*i+1] - in[4*i+3]
+		a3 := in[4*i+0] - in[4*i+2]
+		tmp[0+i*4] = a0 + a1
+		tmp[1+i*4] = a3 + a2
+		tmp[2+i*4] = a3 - a2
+		tmp[3+i*4] = a0 - a1
+	}
+	for i := range 4 {
+		a0 := tmp[0+i] + tmp[8+i]
+		a1 := tmp[4+i] + tmp[12+i]
+		a2 := tmp[4+i] - tmp[12+i]
+		a3 := tmp[0+i] - tmp[8+i]
+		out[0+i] = (a0 + a1) >> 1
+		out[4+i] = (a3 + a2) >> 1
+		out[8+i] = (a3 - a2) >> 1
+		out[12+i] = (a0 - a1) >> 1
+	}
+}
+
+// inverseWHT is the decoder's inverse of forwardWHT.
+func inverseWHT(in *[16]int32) [16]int32 {
+	var m, out [16]int32
+	for i := range 4 {
+		a0 := in[0+i] + in[12+i]
+		a1 := in[4+i] + in[8+i]
+		a2 := in[4+i] - in[8+i]
+		a3 := in[0+i] - in[12+i]
+		m[0+i] = a0 + a1
+		m[8+i] = a0 - a1
+		m[4+i] = a3 + a2
+		m[12+i] = a3 - a2
+	}
+	for i := range 4 {
+		dc := m[0+i*4] + 3
+		a0 := dc + m[3+i*4]
+		a1 := m[1+i*4] + m[2+i*4]
+		a2 := m[1+i*4] - m[2+i*4]
+		a3 := dc - m[3+i*4]
+		out[4*i+0] = (a0 + a1) >> 3
+		out[4*i+1] = (a3 + a2) >> 3
+		out[4*i+2] = (a0 - a1) >> 3
+		out[4*i+3] = (a3 - a2) >> 3
+	}
+	return out
+}
+
+// inverseDCT adds the decoder's inverse transform of coeffs to a 4x4 block
+// of pred, writing the result to dst.
+func inverseDCT(coeffs *[16]int32, pred []uint8, predStride int, dst []uint8, dstStride int) {
+	const (
+		c1 = 85627 // 65536 * cos(pi/8) * sqrt(2).
+		c2 = 35468 // 65536 * sin(pi/8) * sqrt(2).
+	)
+	var m [4][4]int32
+	for i := range 4 {
+		a := coeffs[i] + coeffs[8+i]
+		b := coeffs[i] - coeffs[8+i]
+		c := (coeffs[4+i]*c2)>>16 - (coeffs[12+i]*c1)>>16
+		d := (coeffs[4+i]*c1)>>16 + (coeffs[12+i]*c2)>>16
+		m[i][0] = a + d
+		m[i][1] = b + c
+		m[i][2] = b - c
+		m[i][3] = a - d
+	}
+	for j := range 4 {
+		dc := m[0][j] + 4
+		a := dc + m[2][j]
+		b := dc - m[2][j]
+		c := (m[1][j]*c2)>>16 - (m[3][j]*c1)>>16
+		d := (m[1][j]*c1)>>16 + (m[3][j]*c2)>>16
+		p, out := pred[j*predStride:], dst[j*dstStride:]
+		out[0] = clampByte(int(p[0]) + int((a+d)>>3))
+		out[1] = clampByte(int(p[1]) + int((b+c)>>3))
+		out[2] = clampByte(int(p[2]) + int((b-c)>>3))
+		out[3] = clampByte(int(p[3]) + int((a-d)>>3))
+	}
+}
+
+// writeFrame writes the frame header, the first partition with the
+// probabilities and prediction modes, then the token partition.
+func (e *lossyEncoder) writeFrame(width, height int) []byte {
+	var stats tokenStats
+	e.writeTokens(&tokenWriter{probs: &defaultTokenProb, stats: &stats})
+	probs, updated := updatedTokenProbs(&stats)
+
+	tokens := newBoolEncoder()
+	e.writeTokens(&tokenWriter{enc: tokens, probs: &probs, stats: &stats})
+
+	header := newBoolEncoder()
+	header.putLiteral(0, 1) // Color space.
+	header.putLiteral(0, 1) // Clamping type.
+	header.putLiteral(0, 1) // Segmentation.
+	header.putLiteral(0, 1) // Normal loop filter.
+	header.putLiteral(uint32(min(int(dequantTableAC[e.q])*2/3, 63)), 6)
+	header.putLiteral(0, 3) // Sharpness.
+	header.putLiteral(0, 1) // Loop filter deltas.
+	header.putLiteral(0, 2) // A single token partition.
+	header.putLiteral(uint32(e.q), 7)
+	for range 5 {
+		header.putLiteral(0, 1) // Quantizer deltas.
+	}
+	header.putLiteral(0, 1) // Refresh entropy probabilities.
+	for i := range probs {
+		for j := range probs[i] {
+			for k := range probs[i][j] {
+				for l := range probs[i][j][k] {
+					update := updated[i][j][k][l]
+					header.putBit(update, tokenProbUpdateProb[i][j][k][l])
+					if update {
+						header.putLiteral(uint32(probs[i][j][k][l]), 8)
+					}
+				}
+			}
+		}
+	}
+
+	skipped := 0
+	for i := range e.mbs {
+		if e.mbs[i].skip {
+			skipped++
+		}
+	}
+	skipProb := uint8(0)
+	if skipped > 0 {
+		skipProb = uint8(min(max(256*(len(e.mbs)-skipped)/len(e.mbs), 1), 255))
+		header.putLiteral(1, 1)
+		header.putLiteral(uint32(skipProb), 8)
+	} else {
+		header.putLiteral(0, 1)
+	}
+	for i := range e.mbs {
+		mb := &e.mbs[i]
+		if skipped > 0 {
+			header.putBit(mb.skip, skipProb)
+		}
+		header.putBit(true, 145) // 16x16 luma prediction.
+		switch mb.yMode {
+		case predDC:
+			header.putBit(false, 156)
+			header.putBit(false, 163)
+		case predVE:
+			header.putBit(false, 156)
+			header.putBit(true, 163)
+		case predHE:
+			header.putBit(true, 156)
+			header.putBit(false, 128)
+		case predTM:
+			header.putBit(true, 156)
+			header.putBit(true, 128)
+		}
+		header.putBit(mb.uvMode != predDC, 142)
+		if mb.uvMode != predDC {
+			header.putBit(mb.uvMode != predVE, 114)
+			if mb.uvMode != predVE {
+				header.putBit(mb.uvMode == predTM, 183)
+			}
+		}
+	}
+
+	first, second := header.bytes(), tokens.bytes()
+	frame := make([]byte, 10, 10+len(first)+len(second))
+	tag := uint32(1<<4 | len(first)<<5) // A key frame, shown.
+	frame[0], frame[1], frame[2] = byte(tag), byte(tag>>8), byte(tag>>16)
+	frame[3], frame[4], frame[5] = 0x9d, 0x01, 0x2a
+	binary.LittleEndian.PutUint16(frame[6:], uint16(width))
+	binary.LittleEndian.PutUint16(frame[8:], uint16(height))
+	frame = append(frame, first...)
+	return append(frame, second...)
+}
+
+// tokenStats counts, for each token probability, the 0 and 1 bits coded
+// with it.
+type tokenStats [nPlane][nBand][nContext][nProb][2]uint32
+
+// updatedTokenProbs returns the token probabilities fitted to stats, for
+// those where the saving outweighs the cost of sending the update.
+func updatedTokenProbs(stats *tokenStats) (probs [nPlane][nBand][nContext][nProb]uint8, updated [nPlane][nBand][nContext][nProb]bool) {
+	probs = defaultTokenProb
+	for i := range probs {
+		for j := range probs[i] {
+			for k := range probs[i][j] {
+				for l := range probs[i][j][k] {
+					zeros, ones := stats[i][j][k][l][0], stats[i][j][k][l][1]
+					if zeros+ones == 0 {
+						continue
+					}
+					fitted := uint8(min(max((256*uint64(zeros)+uint64(zeros+ones)/2)/uint64(zeros+ones), 1), 255))
+					updateProb := tokenProbUpdateProb[i][j][k][l]
+					keep := bitCost(zeros, ones, probs[i][j][k][l]) + bitCost(1, 0, updateProb)
+					update := bitCost(zeros, ones, fitted) + bitCost(0, 1, updateProb) + 8
+					if update < keep {
+						probs[i][j][k][l] = fitted
+						updated[i][j][k][l] = true
+					}
+				}
+			}
+		}
+	}
+	return probs, updated
+}
+
+// bitCost is the number of bits coding zeros and ones takes at prob.
+func bitCost(zeros, ones uint32, prob uint8) float64 {
+	p := float64(prob) / 256
+	return -float64(zeros)*math.Log2(p) - float64(ones)*math.Log2(1-p)
+}
+
+// nzContext records which blocks along a macroblock edge had non-zero
+// coefficients, the context of the neighboring blocks' tokens.
+type nzContext struct {
+	y2 uint8
+	y  [4]uint8
+	uv [4]uint8
+}
+
+// writeTokens codes the coefficients of every macroblock that is not
+// skipped.
+func (e *lossyEncoder) writeTokens(t *tokenWriter) {
+	up := make([]nzContext, e.mbw)
+	for mby := range e.mbh {
+		var left nzContext
+		for mbx := range e.mbw {
+			mb := &e.mbs[mby*e.mbw+mbx]
+			above := &up[mbx]
+			if mb.skip {
+				left, *above = nzContext{}, nzContext{}
+				continue
+			}
+			nz := t.block(planeY2, left.y2+above.y2, &mb.levels[24], 0)
+			left.y2, above.y2 = nz, nz
+			for y := range 4 {
+				nz := left.y[y]
+				for x := range 4 {
+					nz = t.block(planeY1WithY2, nz+above.y[x], &mb.levels[y*4+x], 1)
+					above.y[x] = nz
+				}
+				left.y[y] = nz
+			}
+			for c := 0; c < 4; c += 2 {
+				for y := range 2 {
+					nz := left.uv[c+y]
+					for x := range 2 {
+						nz = t.block(planeUV, nz+above.uv[c+x], &mb.levels[16+2*c+y*2+x], 0)
+						above.uv[c+x] = nz
+					}
+					left.uv[c+y] = nz
+				}
+			}
+		}
+	}
+}
+
+// tokenWriter codes blocks of coefficients, or only counts the bits they
+// take with each probability when it has no encoder.
+type tokenWriter struct {
+	enc   *boolEncoder
+	probs *[nPlane][nBand][nContext][nProb]uint8
+	stats *tokenStats
+}
+
+// block codes the levels of a block from its first coefficient on, and
+// returns 1 when any of them is not zero.
+func (t *tokenWriter) block(plane int, context uint8, levels *[16]int16, first int) uint8 {
+	last := -1
+	for n := first; n < 16; n++ {
+		if levels[n] != 0 {
+			last = n
+		}
+	}
+	p, s := &t.probs[plane][bands[first]][context], &t.stats[plane][bands[first]][context]
+	put := func(bit bool, k int) {
+		if bit {
+			s[k][1]++
+		} else {
+			s[k][0]++
+		}
+		if t.enc != nil {
+			t.enc.putBit(bit, p[k])
+		}
+	}
+	putFixed := func(bit bool, prob uint8) {
+		if t.enc != nil {
+			t.enc.putBit(bit, prob)
+		}
+	}
+
+	put(last >= 0, 0)
+	if last < 0 {
+		return 0
+	}
+	for n := first; n <= last; n++ {
+		v := int(levels[n])
+		if v == 0 {
+			put(false, 1)
+			p, s = &t.probs[plane][bands[n+1]][0], &t.stats[plane][bands[n+1]][0]
+			continue
+		}
+		put(true, 1)
+		negative := v < 0
+		if negative {
+			v = -v
+		}
+		next := 2
+		switch {
+		case v == 1:
+			put(false, 2)
+			next = 1
+		case v <= 4:
+			put(true, 2)
+			put(false, 3)
+			put(v != 2, 4)
+			if v != 2 {
+				put(v == 4, 5)
+			}
+		case v <= 10:
+			put(true, 2)
+			put(true, 3)
+			put(false, 6)
+			if v <= 6 {
+				put(false, 7)
+				putFixed(v == 6, 159)
+			} else {
+				put(true, 7)
+				putFixed((v-7)&2 != 0, 165)
+				putFixed((v-7)&1 != 0, 145)
+			}
+		default:
+			put(true, 2)
+			put(true, 3)
+			put(true, 6)
+			cat := 3
+			switch {
+			case v < 19:
+				cat = 0
+			case v < 35:
+				cat = 1
+			case v < 67:
+				cat = 2
+			}
+			put(cat >= 2, 8)
+			put(cat&1 == 1, 9+cat>>1)
+			extra := v - (3 + 8<<cat)
+			tab := cat3456[cat][:]
+			nBits := 0
+			for tab[nBits] != 0 {
+				nBits++
+			}
+			for i := range nBits {
+				putFixed(extra>>(nBits-1-i)&1 == 1, tab[i])
+			}
+		}
+		putFixed(negative, 128)
+		p, s = &t.probs[plane][bands[n+1]][next], &t.stats[plane][bands[n+1]][next]
+		if n < 15 {
+			put(n < last, 0)
+		}
+	}
+	return 1
+}
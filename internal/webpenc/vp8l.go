@@ -0,0 +1,587 @@
+package webpenc
+
+import (
+	"image"
+	"math/bits"
+	"slices"
+)
+
+// VP8L constants, from the WebP lossless bitstream specification.
+const (
+	vp8lSignature = 0x2f
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+	transformColorIndexing = 3
+
+	numLiteralCodes  = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	// numPlaneCodes is the number of short distance codes standing for a
+	// pixel nearby in the rows above; longer distances are offset by it.
+	numPlaneCodes = 120
+
+	maxCopyLength = 4096
+	// maxCopyDistance keeps offset distances within the distance codes.
+	maxCopyDistance = 1<<20 - numPlaneCodes
+
+	// predictorBits is the log2 of the side of the tiles sharing a
+	// predictor.
+	predictorBits        = 4
+	numPredictors        = 14
+	colorCacheBits       = 10
+	colorCacheMultiplier = 0x1e35a7bd
+
+	// The LZ77 search hashes pairs of pixels and follows at most
+	// maxMatchChain earlier occurrences of the pair.
+	hashBits      = 16
+	maxMatchChain = 16
+	minCopyLength = 3
+)
+
+// distanceMapTable lists the (dy, 8-dx) neighbors of the plane codes, in
+// code order.
+var distanceMapTable = [numPlaneCodes]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// bitWriter packs values least significant bit first, as VP8L reads them.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nBits uint
+}
+
+// write appends the low n bits of v, n being at most 32.
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= (uint64(v) & (1<<n - 1)) << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nBits -= 8
+	}
+}
+
+// bytes flushes the pending bits and returns the bitstream.
+func (w *bitWriter) bytes() []byte {
+	if w.nBits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nBits = 0, 0
+	}
+	return w.buf
+}
+
+// encodeLossless returns the VP8L bitstream of img. Images with few colors
+// are stored as palette indexes, the others as the residuals of spatial
+// prediction; with up to 256 colors both are tried and the smaller kept.
+func encodeLossless(img *image.NRGBA, alpha bool) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	argb := make([]uint32, width*height)
+	for y := range height {
+		row := img.Pix[y*img.Stride:]
+		for x := range width {
+			p := row[4*x : 4*x+4]
+			argb[y*width+x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+		}
+	}
+
+	var best []byte
+	if palette := collectPalette(argb, 256); palette != nil {
+		w := newVP8LWriter(width, height, alpha)
+		writePaletted(w, argb, width, height, palette)
+		best = w.bytes()
+		if len(palette) <= 16 {
+			return best
+		}
+	}
+	w := newVP8LWriter(width, height, alpha)
+	writePredicted(w, argb, width, height)
+	if predicted := w.bytes(); best == nil || len(predicted) < len(best) {
+		best = predicted
+	}
+	return best
+}
+
+// newVP8LWriter starts a VP8L bitstream with its header.
+func newVP8LWriter(width, height int, alpha bool) *bitWriter {
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if alpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3) // Version.
+	return w
+}
+
+// collectPalette returns the distinct colors of argb, or nil when there are
+// more than limit.
+func collectPalette(argb []uint32, limit int) []uint32 {
+	seen := make(map[uint32]struct{}, limit+1)
+	last := ^argb[0]
+	for _, c := range argb {
+		if c == last {
+			continue
+		}
+		last = c
+		seen[c] = struct{}{}
+		if len(seen) > limit {
+			return nil
+		}
+	}
+	palette := make([]uint32, 0, len(seen))
+	for c := range seen {
+		palette = append(palette, c)
+	}
+	slices.Sort(palette)
+	return palette
+}
+
+// writePaletted writes argb through the color indexing transform: the
+// palette, then the index of each pixel's color, packed several to a pixel
+// when there are 16 colors or fewer.
+func writePaletted(w *bitWriter, argb []uint32, width, height int, palette []uint32) {
+	w.write(1, 1)
+	w.write(transformColorIndexing, 2)
+	w.write(uint32(len(palette)-1), 8)
+	// The palette is stored as the difference of each color to the one
+	// before.
+	deltas := make([]uint32, len(palette))
+	index := make(map[uint32]uint32, len(palette))
+	previous := uint32(0)
+	for i, c := range palette {
+		deltas[i] = subPixels(c, previous)
+		previous = c
+		index[c] = uint32(i)
+	}
+	writeImageData(w, deltas, len(palette), 1, false)
+
+	var xBits uint
+	switch {
+	case len(palette) <= 2:
+		xBits = 3
+	case len(palette) <= 4:
+		xBits = 2
+	case len(palette) <= 16:
+		xBits = 1
+	}
+	packedWidth := (width + 1<<xBits - 1) >> xBits
+	bitsPerIndex := uint(8 >> xBits)
+	packed := make([]uint32, packedWidth*height)
+	last, lastIndex := ^argb[0], uint32(0)
+	for y := range height {
+		for x := range width {
+			c := argb[y*width+x]
+			if c != last {
+				last, lastIndex = c, index[c]
+			}
+			packed[y*packedWidth+x>>xBits] |= lastIndex << (bitsPerIndex * uint(x&(1<<xBits-1)))
+		}
+	}
+	for i, v := range packed {
+		packed[i] = 0xff000000 | v<<8
+	}
+
+	w.write(0, 1)
+	writeImageData(w, packed, packedWidth, height, true)
+}
+
+// writePredicted writes argb through the subtract green and predictor
+// transforms: each pixel is stored as its difference to a prediction from
+// its neighbors, with the predictor picked for each tile of the image.
+func writePredicted(w *bitWriter, argb []uint32, width, height int) {
+	w.write(1, 1)
+	w.write(transformSubtractGreen, 2)
+	subtracted := make([]uint32, len(argb))
+	for i, c := range argb {
+		green := (c >> 8) & 0xff
+		subtracted[i] = c&0xff00ff00 | ((c>>16)-green)&0xff<<16 | (c-green)&0xff
+	}
+
+	tilesWide := (width + 1<<predictorBits - 1) >> predictorBits
+	tilesHigh := (height + 1<<predictorBits - 1) >> predictorBits
+	modes := choosePredictors(subtracted, width, height, tilesWide, tilesHigh)
+	w.write(1, 1)
+	w.write(transformPredictor, 2)
+	w.write(predictorBits-2, 3)
+	tiles := make([]uint32, len(modes))
+	for i, mode := range modes {
+		tiles[i] = 0xff000000 | uint32(mode)<<8
+	}
+	writeImageData(w, tiles, tilesWide, tilesHigh, false)
+
+	residuals := make([]uint32, len(subtracted))
+	// The first pixel is predicted as opaque black, the rest of the first
+	// row from the left and the first column from above, whatever the
+	// tile's predictor.
+	residuals[0] = subPixels(subtracted[0], 0xff000000)
+	for x := 1; x < width; x++ {
+		residuals[x] = subPixels(subtracted[x], subtracted[x-1])
+	}
+	for y := 1; y < height; y++ {
+		row := y * width
+		residuals[row] = subPixels(subtracted[row], subtracted[row-width])
+		tileRow := (y >> predictorBits) * tilesWide
+		for x := 1; x < width; x++ {
+			mode := modes[tileRow+x>>predictorBits]
+			residuals[row+x] = subPixels(subtracted[row+x], predict(mode, subtracted, row+x, width))
+		}
+	}
+
+	w.write(0, 1)
+	writeImageData(w, residuals, width, height, true)
+}
+
+// choosePredictors picks for each tile the predictor leaving the smallest
+// residuals.
+func choosePredictors(argb []uint32, width, height, tilesWide, tilesHigh int) []uint8 {
+	modes := make([]uint8, tilesWide*tilesHigh)
+	for ty := range tilesHigh {
+		for tx := range tilesWide {
+			var costs [numPredictors]int
+			for y := max(ty<<predictorBits, 1); y < min((ty+1)<<predictorBits, height); y++ {
+				for x := max(tx<<predictorBits, 1); x < min((tx+1)<<predictorBits, width); x++ {
+					i := y*width + x
+					for mode := range uint8(numPredictors) {
+						costs[mode] += residualCost(subPixels(argb[i], predict(mode, argb, i, width)))
+					}
+				}
+			}
+			best := 0
+			for mode, cost := range costs {
+				if cost < costs[best] {
+					best = mode
+				}
+			}
+			modes[ty*tilesWide+tx] = uint8(best)
+		}
+	}
+	return modes
+}
+
+// residualCost is the sum of the magnitudes of the channels of a residual.
+func residualCost(residual uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(int8(residual >> shift))
+		if v < 0 {
+			v = -v
+		}
+		cost += v
+	}
+	return cost
+}
+
+// predict returns the prediction of argb[i] by predictor mode, from its
+// left (L), top (T), top-left (TL) and top-right (TR) neighbors. Like the
+// decoder, the top-right neighbor of the last pixel of a row is the first
+// pixel of the row itself.
+func predict(mode uint8, argb []uint32, i, width int) uint32 {
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return argb[i-1]
+	case 2:
+		return argb[i-width]
+	case 3:
+		return argb[i-width+1]
+	case 4:
+		return argb[i-width-1]
+	case 5:
+		return average2(average2(argb[i-1], argb[i-width+1]), argb[i-width])
+	case 6:
+		return average2(argb[i-1], argb[i-width-1])
+	case 7:
+		return average2(argb[i-1], argb[i-width])
+	case 8:
+		return average2(argb[i-width-1], argb[i-width])
+	case 9:
+		return average2(argb[i-width], argb[i-width+1])
+	case 10:
+		return average2(average2(argb[i-1], argb[i-width-1]), average2(argb[i-width], argb[i-width+1]))
+	case 11:
+		return selectPredictor(argb[i-1], argb[i-width], argb[i-width-1])
+	case 12:
+		return clampAddSubtractFull(argb[i-1], argb[i-width], argb[i-width-1])
+	}
+	return clampAddSubtractHalf(average2(argb[i-1], argb[i-width]), argb[i-width-1])
+}
+
+// average2 averages a and b channel by channel, rounding down.
+func average2(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + a&b
+}
+
+// selectPredictor picks whichever of left and top is closer to the
+// gradient estimate left + top - topLeft.
+func selectPredictor(left, top, topLeft uint32) uint32 {
+	leftScore := channelDistance(topLeft, top)
+	topScore := channelDistance(topLeft, left)
+	if leftScore < topScore {
+		return left
+	}
+	return top
+}
+
+func channelDistance(a, b uint32) int {
+	distance := 0
+	for shift := 0; shift < 32; shift += 8 {
+		d := int(a>>shift&0xff) - int(b>>shift&0xff)
+		if d < 0 {
+			d = -d
+		}
+		distance += d
+	}
+	return distance
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xff) + int(b>>shift&0xff) - int(c>>shift&0xff)
+		out |= uint32(clampByte(v)) << shift
+	}
+	return out
+}
+
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		va, vb := int(a>>shift&0xff), int(b>>shift&0xff)
+		out |= uint32(clampByte(va+(va-vb)/2)) << shift
+	}
+	return out
+}
+
+func clampByte(v int) uint8 {
+	return uint8(min(max(v, 0), 255))
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + a&0xff00ff00 - b&0xff00ff00
+	redBlue := 0xff00ff00 + a&0x00ff00ff - b&0x00ff00ff
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// Kinds of pixelToken.
+const (
+	tokenLiteral = iota
+	tokenCacheHit
+	tokenCopy
+)
+
+// pixelToken is a literal pixel, a color cache hit or a backward copy.
+type pixelToken struct {
+	kind uint8
+	// value is the literal ARGB, the cache index or the copy length.
+	value uint32
+	// distance is the distance code of a copy.
+	distance uint32
+}
+
+// writeImageData writes the entropy-coded argb image: its color cache
+// setup, its five prefix codes, then its pixels. Only the main image, as
+// opposed to the transform data, uses the color cache and has the bit
+// telling it shares a single set of prefix codes.
+func writeImageData(w *bitWriter, argb []uint32, width, height int, mainImage bool) {
+	cacheBits := 0
+	if mainImage {
+		cacheBits = colorCacheBits
+	}
+	tokens := backwardReferences(argb, width, cacheBits)
+
+	if cacheBits > 0 {
+		w.write(1, 1)
+		w.write(uint32(cacheBits), 4)
+	} else {
+		w.write(0, 1)
+	}
+	if mainImage {
+		w.write(0, 1)
+	}
+
+	green := make([]uint32, numLiteralCodes+numLengthCodes+1<<cacheBits*min(cacheBits, 1))
+	red := make([]uint32, numLiteralCodes)
+	blue := make([]uint32, numLiteralCodes)
+	alpha := make([]uint32, numLiteralCodes)
+	distance := make([]uint32, numDistanceCodes)
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenLiteral:
+			green[t.value>>8&0xff]++
+			red[t.value>>16&0xff]++
+			blue[t.value&0xff]++
+			alpha[t.value>>24]++
+		case tokenCacheHit:
+			green[numLiteralCodes+numLengthCodes+t.value]++
+		case tokenCopy:
+			symbol, _, _ := prefixEncode(t.value)
+			green[numLiteralCodes+symbol]++
+			symbol, _, _ = prefixEncode(t.distance)
+			distance[symbol]++
+		}
+	}
+	greenCode := writeHuffmanCode(w, green)
+	redCode := writeHuffmanCode(w, red)
+	blueCode := writeHuffmanCode(w, blue)
+	alphaCode := writeHuffmanCode(w, alpha)
+	distanceCode := writeHuffmanCode(w, distance)
+
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenLiteral:
+			greenCode.write(w, t.value>>8&0xff)
+			redCode.write(w, t.value>>16&0xff)
+			blueCode.write(w, t.value&0xff)
+			alphaCode.write(w, t.value>>24)
+		case tokenCacheHit:
+			greenCode.write(w, numLiteralCodes+numLengthCodes+t.value)
+		case tokenCopy:
+			symbol, extraBits, extra := prefixEncode(t.value)
+			greenCode.write(w, numLiteralCodes+symbol)
+			w.write(extra, extraBits)
+			symbol, extraBits, extra = prefixEncode(t.distance)
+			distanceCode.write(w, symbol)
+			w.write(extra, extraBits)
+		}
+	}
+}
+
+// prefixEncode splits a copy length or distance code into its prefix
+// symbol and the extra bits following it.
+func prefixEncode(v uint32) (symbol uint32, extraBits uint, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	highBit := uint32(bits.Len32(d)) - 1
+	secondBit := d >> (highBit - 1) & 1
+	extraBits = uint(highBit - 1)
+	return 2*highBit + secondBit, extraBits, d & (1<<extraBits - 1)
+}
+
+// backwardReferences turns argb into tokens: greedy LZ77 copies found by
+// hashing pixel pairs, and literals, looked up in a color cache of
+// cacheBits (none when 0) first.
+func backwardReferences(argb []uint32, width, cacheBits int) []pixelToken {
+	n := len(argb)
+	tokens := make([]pixelToken, 0, n/2)
+	planeCodes := planeCodesFor(width)
+
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*0x9e3779b1 ^ argb[i+1]*0x85ebca77) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	var cache []uint32
+	cacheShift := uint(32 - cacheBits)
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+
+	for i := 0; i < n; {
+		length, distance := 0, 0
+		if i+1 < n {
+			limit := min(maxCopyLength, n-i)
+			matchLength := func(j int) int {
+				k := 0
+				for k < limit && argb[j+k] == argb[i+k] {
+					k++
+				}
+				return k
+			}
+			// The pixel to the left and the one above are the likeliest
+			// matches and have the cheapest distance codes.
+			for _, d := range [2]int{1, width} {
+				if d <= i {
+					if l := matchLength(i - d); l > length {
+						length, distance = l, d
+					}
+				}
+			}
+			for j, tries := int(head[hash(i)]), 0; j >= 0 && tries < maxMatchChain && length < limit; j, tries = int(chain[j]), tries+1 {
+				if i-j > maxCopyDistance {
+					break
+				}
+				if l := matchLength(j); l > length {
+					length, distance = l, i-j
+				}
+			}
+		}
+
+		if length >= minCopyLength {
+			code, ok := planeCodes[distance]
+			if !ok {
+				code = uint32(distance + numPlaneCodes)
+			}
+			tokens = append(tokens, pixelToken{kind: tokenCopy, value: uint32(length), distance: code})
+			for k := i; k < i+length; k++ {
+				insert(k)
+				if cache != nil {
+					cache[argb[k]*colorCacheMultiplier>>cacheShift] = argb[k]
+				}
+			}
+			i += length
+			continue
+		}
+
+		c := argb[i]
+		if cache != nil {
+			key := c * colorCacheMultiplier >> cacheShift
+			if cache[key] == c {
+				tokens = append(tokens, pixelToken{kind: tokenCacheHit, value: key})
+			} else {
+				tokens = append(tokens, pixelToken{kind: tokenLiteral, value: c})
+				cache[key] = c
+			}
+		} else {
+			tokens = append(tokens, pixelToken{kind: tokenLiteral, value: c})
+		}
+		insert(i)
+		i++
+	}
+	return tokens
+}
+
+// planeCodesFor maps the distances the plane codes stand for in an image
+// width pixels wide to the smallest code for each.
+func planeCodesFor(width int) map[int]uint32 {
+	codes := make(map[int]uint32, numPlaneCodes)
+	for code := numPlaneCodes; code >= 1; code-- {
+		entry := int(distanceMapTable[code-1])
+		distance := (entry>>4)*width + 8 - entry&0xf
+		if distance < 1 {
+			distance = 1
+		}
+		codes[distance] = uint32(code)
+	}
+	return codes
+}
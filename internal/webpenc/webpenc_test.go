@@ -0,0 +1,181 @@
+package webpenc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+// page draws a width x height test page: a smooth color gradient behind
+// black line art.
+func page(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			c := color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: uint8((x + y) % 256), A: 255}
+			if (x/7+y/5)%9 == 0 || x%31 == 3 {
+				c = color.NRGBA{A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// paletted draws a width x height page using only the given colors.
+func paletted(width, height int, colors ...color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, colors[(x/3*7+y/2*3+x*y/11)%len(colors)])
+		}
+	}
+	return img
+}
+
+func encode(t *testing.T, img image.Image, o *Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, Encode(&buf, img, o))
+	return buf.Bytes()
+}
+
+func TestEncode_Lossless(t *testing.T) {
+	gray := func(v uint8) color.NRGBA { return color.NRGBA{R: v, G: v, B: v, A: 255} }
+	var many []color.NRGBA
+	for i := range 200 {
+		many = append(many, color.NRGBA{R: uint8(i), G: uint8(i * 7), B: uint8(i * 13), A: 255})
+	}
+	translucent := page(40, 30)
+	for i := 3; i < len(translucent.Pix); i += 4 * 7 {
+		translucent.Pix[i] = uint8(i % 256)
+	}
+
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"single pixel", page(1, 1)},
+		{"two colors", paletted(33, 17, gray(0), gray(255))},
+		{"sixteen grays", paletted(61, 40, func() []color.NRGBA {
+			var grays []color.NRGBA
+			for i := range 16 {
+				grays = append(grays, gray(uint8(i*17)))
+			}
+			return grays
+		}()...)},
+		{"two hundred colors", paletted(50, 50, many...)},
+		{"true color", page(123, 77)},
+		{"transparency", translucent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encode(t, tt.img, &Options{Lossless: true})
+			decoded, err := webp.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Equal(t, tt.img.Bounds(), decoded.Bounds())
+			for y := range tt.img.Rect.Dy() {
+				for x := range tt.img.Rect.Dx() {
+					want := tt.img.NRGBAAt(x, y)
+					got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+					if want.A == 0 {
+						want, got = color.NRGBA{}, color.NRGBA{A: got.A}
+					}
+					require.Equal(t, want, got, "pixel (%d, %d)", x, y)
+				}
+			}
+		})
+	}
+}
+
+func TestEncode_LosslessSmallerForFewerColors(t *testing.T) {
+	twoColors := encode(t, paletted(300, 400, color.NRGBA{A: 255}, color.NRGBA{R: 255, G: 255, B: 255, A: 255}), &Options{Lossless: true})
+	trueColor := encode(t, page(300, 400), &Options{Lossless: true})
+	assert.Less(t, len(twoColors), len(trueColor))
+	assert.Less(t, len(twoColors), 300*400/8, "two colors take less than a bit per pixel")
+}
+
+// lumaPSNR is the peak signal to noise ratio of the luma of a decoded lossy
+// image against the source's.
+func lumaPSNR(t *testing.T, src *image.NRGBA, decoded image.Image) float64 {
+	t.Helper()
+	ycbcr, ok := decoded.(*image.YCbCr)
+	require.True(t, ok, "lossy WebP decodes to YCbCr")
+	var sum float64
+	for y := range src.Rect.Dy() {
+		for x := range src.Rect.Dx() {
+			c := src.NRGBAAt(x, y)
+			d := float64(rgbToY(int(c.R), int(c.G), int(c.B))) - float64(ycbcr.Y[ycbcr.YOffset(x, y)])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(src.Rect.Dx()*src.Rect.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func TestEncode_Lossy(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     *image.NRGBA
+		quality int
+		minPSNR float64
+	}{
+		{"page at quality 90", page(200, 300), 90, 42},
+		{"page at quality 75", page(200, 300), 75, 38},
+		{"page at quality 20", page(200, 300), 20, 30},
+		{"odd size", page(37, 23), 75, 36},
+		{"single pixel", page(1, 1), 75, 30},
+		{"grayscale", paletted(90, 70, color.NRGBA{R: 20, G: 20, B: 20, A: 255}, color.NRGBA{R: 230, G: 230, B: 230, A: 255}), 75, 34},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encode(t, tt.img, &Options{Quality: tt.quality})
+			decoded, err := webp.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			require.Equal(t, tt.img.Bounds(), decoded.Bounds())
+			assert.GreaterOrEqual(t, lumaPSNR(t, tt.img, decoded), tt.minPSNR)
+		})
+	}
+}
+
+func TestEncode_LossyQuality(t *testing.T) {
+	img := page(320, 480)
+	previous := 0
+	for _, quality := range []int{10, 40, 75, 95} {
+		size := len(encode(t, img, &Options{Quality: quality}))
+		assert.Greater(t, size, previous, "quality %d", quality)
+		previous = size
+	}
+}
+
+func TestEncode_ICC(t *testing.T) {
+	icc := []byte("an ICC profile of odd length")
+	for _, lossless := range []bool{false, true} {
+		data := encode(t, page(40, 30), &Options{Lossless: lossless, Quality: 75, ICC: icc})
+		assert.Equal(t, "VP8X", string(data[12:16]))
+		assert.Contains(t, string(data), "ICCP"+"\x1c\x00\x00\x00"+string(icc))
+		config, err := webp.DecodeConfig(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 40, config.Width)
+		assert.Equal(t, 30, config.Height)
+		_, err = webp.Decode(bytes.NewReader(data))
+		assert.NoError(t, err)
+	}
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Error(t, Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 10, MaxDimension+1)), nil))
+	assert.Error(t, Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 0, 10)), nil))
+	assert.Error(t, Encode(&buf, page(10, 10), &Options{Quality: 101}))
+	assert.Zero(t, buf.Len())
+}
@@ -0,0 +1,146 @@
+// Package webtoon turns the arbitrary-height fragments webtoon chapters are
+// distributed as back into a strip of pages of uniform height.
+package webtoon
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/rs/zerolog/log"
+)
+
+// Reslice stitches the consecutive pages of chapter that share the same
+// width into one strip and cuts it again into pages of sliceHeight, at the
+// gutters between panels where possible. A change of width starts a new
+// strip; pages Go cannot decode are kept as they are, between strips. A
+// sliceHeight of 0 uses options.DefaultSliceHeight.
+//
+// The strip is only virtual: no more than one slice and the page being
+// added are held in memory. The new pages are written as PNG to a webtoon
+// directory in chapter.TempDir and replace chapter.Pages, indexed in reading
+// order. Their original names no longer apply, so they are dropped.
+func Reslice(ctx context.Context, chapter *manga.Chapter, sliceHeight int) error {
+	if sliceHeight <= 0 {
+		sliceHeight = options.DefaultSliceHeight
+	}
+	outputDir := filepath.Join(chapter.TempDir, "webtoon")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create webtoon directory: %w", err)
+	}
+
+	s := &strip{outputDir: outputDir, sliceHeight: sliceHeight}
+	for _, page := range chapter.Pages {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		img, err := imaging.Decode(page.FilePath)
+		if err != nil {
+			log.Debug().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode page, keeping it out of the webtoon strip")
+			if err := s.flush(); err != nil {
+				return err
+			}
+			s.pages = append(s.pages, page)
+			continue
+		}
+		if s.buffer != nil && s.buffer.Bounds().Dx() != img.Bounds().Dx() {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+		if err := s.add(img); err != nil {
+			return err
+		}
+	}
+	if err := s.flush(); err != nil {
+		return err
+	}
+
+	for i, page := range s.pages {
+		page.Index = uint16(i)
+		page.OriginalName = ""
+	}
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("pages", len(chapter.Pages)).
+		Int("resliced_pages", len(s.pages)).
+		Int("slice_height", sliceHeight).
+		Msg("Webtoon strip resliced")
+	chapter.Pages = s.pages
+	return nil
+}
+
+// strip accumulates the rows of same-width pages and writes them out one
+// slice at a time.
+type strip struct {
+	outputDir   string
+	sliceHeight int
+	// buffer holds the rows not written yet, nil when there are none.
+	buffer *image.RGBA
+	pages  []*manga.PageFile
+}
+
+// add appends img below the buffered rows and writes every slice that can
+// be cut from them. A slice is only cut once rows past it are buffered, so
+// the gutter search sees the whole slice.
+func (s *strip) add(img image.Image) error {
+	bounds := img.Bounds()
+	rows := image.Rect(0, 0, bounds.Dx(), 0)
+	if s.buffer != nil {
+		rows = s.buffer.Bounds()
+	}
+	grown := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), rows.Dy()+bounds.Dy()))
+	if s.buffer != nil {
+		draw.Draw(grown, image.Rect(0, 0, rows.Dx(), rows.Dy()), s.buffer, rows.Min, draw.Src)
+	}
+	draw.Draw(grown, image.Rect(0, rows.Dy(), bounds.Dx(), grown.Bounds().Dy()), img, bounds.Min, draw.Src)
+	s.buffer = grown
+
+	for s.buffer.Bounds().Dy() > s.sliceHeight {
+		rows := s.buffer.Bounds()
+		window := s.buffer.SubImage(image.Rect(rows.Min.X, rows.Min.Y, rows.Max.X, rows.Min.Y+s.sliceHeight+1))
+		cut := imaging.SliceRows(window, s.sliceHeight)[1]
+		if err := s.write(s.buffer.SubImage(image.Rect(rows.Min.X, rows.Min.Y, rows.Max.X, cut))); err != nil {
+			return err
+		}
+		s.buffer = s.buffer.SubImage(image.Rect(rows.Min.X, cut, rows.Max.X, rows.Max.Y)).(*image.RGBA)
+	}
+	return nil
+}
+
+// flush writes the buffered rows as the last, shorter page of the strip.
+func (s *strip) flush() error {
+	if s.buffer == nil {
+		return nil
+	}
+	defer func() { s.buffer = nil }()
+	if s.buffer.Bounds().Empty() {
+		return nil
+	}
+	return s.write(s.buffer)
+}
+
+// write stores img as the next page.
+func (s *strip) write(img image.Image) error {
+	path := filepath.Join(s.outputDir, fmt.Sprintf("%04d.png", len(s.pages)))
+	if err := imaging.WritePNG(img, path); err != nil {
+		return fmt.Errorf("failed to write webtoon page %d: %w", len(s.pages), err)
+	}
+	s.pages = append(s.pages, &manga.PageFile{
+		Extension: ".png",
+		FilePath:  path,
+	})
+	return nil
+}
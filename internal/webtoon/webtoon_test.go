@@ -0,0 +1,136 @@
+package webtoon
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFragment writes a width x height fragment of busy artwork, shaded by
+// shade so the order of the rows can be checked after reslicing.
+func writeFragment(t *testing.T, dir string, index int, width, height int, shade uint8) *manga.PageFile {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: shade + uint8((x*7+y*13)%32)})
+		}
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%04d.png", index))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+	return &manga.PageFile{Index: uint16(index), Extension: ".png", FilePath: path, OriginalName: fmt.Sprintf("frag%d.png", index)}
+}
+
+func pageSize(t *testing.T, page *manga.PageFile) (int, int) {
+	t.Helper()
+	f, err := os.Open(page.FilePath)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	config, _, err := image.DecodeConfig(f)
+	require.NoError(t, err)
+	return config.Width, config.Height
+}
+
+func TestReslice(t *testing.T) {
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		TempDir: dir,
+		Pages: []*manga.PageFile{
+			writeFragment(t, dir, 0, 100, 250, 0),
+			writeFragment(t, dir, 1, 100, 250, 100),
+			writeFragment(t, dir, 2, 100, 250, 200),
+		},
+	}
+
+	require.NoError(t, Reslice(context.Background(), chapter, 300))
+
+	require.Len(t, chapter.Pages, 3)
+	for i, expectedHeight := range []int{300, 300, 150} {
+		page := chapter.Pages[i]
+		assert.Equal(t, uint16(i), page.Index)
+		assert.Equal(t, ".png", page.Extension)
+		assert.Empty(t, page.OriginalName)
+		width, height := pageSize(t, page)
+		assert.Equal(t, 100, width)
+		assert.Equal(t, expectedHeight, height)
+	}
+
+	// The first resliced page ends with the first rows of the second
+	// fragment.
+	f, err := os.Open(chapter.Pages[0].FilePath)
+	require.NoError(t, err)
+	img, err := png.Decode(f)
+	_ = f.Close()
+	require.NoError(t, err)
+	r, _, _, _ := img.At(0, 240).RGBA()
+	assert.Less(t, r>>8, uint32(100))
+	r, _, _, _ = img.At(0, 260).RGBA()
+	assert.GreaterOrEqual(t, r>>8, uint32(100))
+}
+
+func TestReslice_WidthChangeStartsNewStrip(t *testing.T) {
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		TempDir: dir,
+		Pages: []*manga.PageFile{
+			writeFragment(t, dir, 0, 100, 200, 0),
+			writeFragment(t, dir, 1, 80, 200, 0),
+			writeFragment(t, dir, 2, 80, 200, 0),
+		},
+	}
+
+	require.NoError(t, Reslice(context.Background(), chapter, 300))
+
+	require.Len(t, chapter.Pages, 3)
+	expected := [][2]int{{100, 200}, {80, 300}, {80, 100}}
+	for i, page := range chapter.Pages {
+		width, height := pageSize(t, page)
+		assert.Equal(t, expected[i], [2]int{width, height}, "page %d", i)
+	}
+}
+
+func TestReslice_UndecodablePageIsKept(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "0001.jpg")
+	require.NoError(t, os.WriteFile(broken, []byte("not an image"), 0644))
+	chapter := &manga.Chapter{
+		TempDir: dir,
+		Pages: []*manga.PageFile{
+			writeFragment(t, dir, 0, 100, 200, 0),
+			{Index: 1, Extension: ".jpg", FilePath: broken},
+			writeFragment(t, dir, 2, 100, 200, 0),
+		},
+	}
+
+	require.NoError(t, Reslice(context.Background(), chapter, 300))
+
+	require.Len(t, chapter.Pages, 3)
+	assert.Equal(t, broken, chapter.Pages[1].FilePath)
+	for i, page := range chapter.Pages {
+		assert.Equal(t, uint16(i), page.Index)
+	}
+}
+
+func TestReslice_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		TempDir: dir,
+		Pages:   []*manga.PageFile{writeFragment(t, dir, 0, 100, 200, 0)},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, Reslice(ctx, chapter, 300), context.Canceled)
+}
@@ -0,0 +1,264 @@
+package avif
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/pagefile"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/runner"
+	"github.com/rs/zerolog/log"
+)
+
+// avifMaxHeight is the tallest page we hand to avifenc. AV1 itself allows
+// bigger frames, but the decoders shipped in readers commonly refuse images
+// past 16K pixels, so pages above this are treated like webpMaxHeight: kept
+// as-is, or split when splitting is enabled.
+const avifMaxHeight = 16384
+
+// nativeInputExtensions are the formats avifenc can read directly.
+var nativeInputExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+}
+
+type Converter struct {
+	cropHeight int
+	isPrepared bool
+	// pages converts the pages of chapters, running at most one avifenc
+	// process per CPU core across all of them.
+	pages *runner.Pool
+}
+
+func (converter *Converter) Format() constant.ConversionFormat {
+	return constant.AVIF
+}
+
+// sliceHeight returns the height of the parts of a split page: the one set
+// in opts, or the converter's default.
+func (converter *Converter) sliceHeight(opts options.Conversion) int {
+	if opts.SliceHeight > 0 {
+		return opts.SliceHeight
+	}
+	return converter.cropHeight
+}
+
+func New() *Converter {
+	converter := &Converter{
+		cropHeight: options.DefaultSliceHeight,
+		isPrepared: false,
+	}
+	converter.pages = runner.New(constant.AVIF, converter.convertPage)
+	return converter
+}
+
+func (converter *Converter) PrepareConverter() error {
+	if converter.isPrepared {
+		return nil
+	}
+	err := PrepareEncoder()
+	if err != nil {
+		return err
+	}
+	converter.isPrepared = true
+	return nil
+}
+
+// ConvertChapter converts all pages in a chapter to AVIF using avifenc.
+// JPEG and PNG pages are encoded file-to-file; other formats and split parts
+// are decoded in Go and staged as PNG first since avifenc cannot read them.
+// The WebP-specific settings in opts are ignored.
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("pages", len(chapter.Pages)).
+		Uint8("quality", opts.Quality).
+		Bool("split", opts.Split).
+		Msg("Starting avif chapter conversion")
+
+	err := converter.PrepareConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	return converter.pages.ConvertChapter(ctx, chapter, opts, progress)
+}
+
+// convertPage converts page for the chapter runner, normalized first when
+// it needs to be, see pagefile.Normalize.
+func (converter *Converter) convertPage(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+	source, cleanup := pagefile.Normalize(page, outputDir, ".avif", opts)
+	defer cleanup()
+	pages, err := converter.convertPageFile(ctx, source, outputDir, opts)
+	// A page kept in its source format keeps its original file, and the
+	// others were changed by the normalization when there was one.
+	for i := range pages {
+		if pages[i] == source {
+			pages[i] = page
+		} else if source != page {
+			pages[i].IsModified = true
+		}
+	}
+	return pages, err
+}
+
+// convertPageFile converts a single page file to AVIF format.
+// Returns the converted page(s) — multiple if splitting was needed.
+//
+// avifenc happily encodes frames far taller than readers can decode, so
+// unlike the WebP converter the dimensions are checked up front (header
+// only) instead of waiting for the encoder to fail. avifenc cannot resize
+// either: pages over the resize limits are downscaled in Go and the height
+// limit applies to the downscaled page. Cropped borders and grayscale pages
+// are handled in Go too, the latter encoded without chroma. Pages quantized
+// to a few gray levels are dithered once cropped and resized, see
+// encodePage.
+func (converter *Converter) convertPageFile(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("input", page.FilePath).
+		Msg("Converting page file")
+
+	ext := strings.ToLower(page.Extension)
+	if ext == ".avif" {
+		log.Debug().Uint16("page_index", page.Index).Msg("Page already AVIF, skipping")
+		return []*manga.PageFile{page}, nil
+	}
+
+	width, height, err := imaging.Dimensions(page.FilePath)
+	if err != nil {
+		log.Info().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Cannot decode image, keeping original")
+		return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+			fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
+	}
+
+	// Quantized pages are gray by definition.
+	grayscale := opts.Grayscale || opts.Quantizes()
+	var decoded image.Image
+	if opts.DetectGrayscale && !grayscale {
+		decoded, grayscale = pagefile.DetectGrayscale(page, opts.GrayscaleTolerance)
+	}
+	var region *image.Rectangle
+	if opts.AutoCrop {
+		if decoded, region = pagefile.DetectBorders(decoded, page, opts); region != nil {
+			width, height = region.Dx(), region.Dy()
+		}
+	}
+
+	if opts.IsSpread(width, height) {
+		img, err := decodePage(decoded, page.FilePath, region, false, 0, 0, grayscale)
+		if err != nil {
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
+		}
+		pages, err := pagefile.SplitSpread(ctx, page, outputDir, ".avif", img, opts, func(part image.Image, outputPath string) error {
+			return encodePage(part, outputPath, opts)
+		})
+		for _, part := range pages {
+			part.IsGrayscale = grayscale
+		}
+		return pages, err
+	}
+
+	fitWidth, fitHeight, resize := opts.FitSize(width, height)
+
+	if fitHeight > avifMaxHeight || opts.SplitsHeight(fitHeight) {
+		if !opts.Split {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Int("height", fitHeight).
+				Msg("Page too tall for AVIF, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d is too tall [max: %dpx] to be converted to avif format", page.Index, avifMaxHeight))
+		}
+		img, err := decodePage(decoded, page.FilePath, region, resize, fitWidth, fitHeight, grayscale)
+		if err != nil {
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
+		}
+		pages, err := pagefile.SplitRows(ctx, page, outputDir, ".avif", img, converter.sliceHeight(opts), opts, func(part image.Image, outputPath string) error {
+			return encodePage(part, outputPath, opts)
+		})
+		for _, part := range pages {
+			part.IsGrayscale = grayscale
+		}
+		return pages, err
+	}
+
+	outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".avif"))
+	if nativeInputExtensions[ext] && region == nil && !resize && !grayscale {
+		err = EncodeFile(page.FilePath, outputPath, uint(opts.Quality))
+	} else {
+		var img image.Image
+		img, err = decodePage(decoded, page.FilePath, region, resize, fitWidth, fitHeight, grayscale)
+		if err == nil {
+			err = encodePage(img, outputPath, opts)
+		}
+	}
+
+	if err != nil {
+		log.Warn().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Conversion failed, keeping original")
+		return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+			fmt.Sprintf("page %d: conversion failed (%s)", page.Index, err.Error()))
+	}
+
+	// Preserve OriginalName so --keep-filenames carries through to the
+	// final zip entry name.
+	return []*manga.PageFile{{
+		Index:        page.Index,
+		Extension:    ".avif",
+		FilePath:     outputPath,
+		OriginalName: page.OriginalName,
+		IsGrayscale:  grayscale,
+		IsModified:   region != nil || resize || opts.Quantizes() || pagefile.Grayscaled(page, grayscale),
+	}}, nil
+}
+
+// encodePage encodes the decoded, cropped and resized img to outputPath at
+// opts.Quality. Pages to quantize are dithered to opts.GrayLevels gray
+// levels first and also encoded losslessly, see pagefile.EncodeSmaller.
+func encodePage(img image.Image, outputPath string, opts options.Conversion) error {
+	if !opts.Quantizes() {
+		return EncodeImage(img, outputPath, uint(opts.Quality))
+	}
+	return pagefile.EncodeSmaller(pagefile.Quantize(img, opts), outputPath, func(img image.Image, outputPath string) error {
+		return EncodeImage(img, outputPath, uint(opts.Quality))
+	}, EncodeImageLossless)
+}
+
+// decodePage decodes a page in Go, unless decoded already holds it, crops it
+// to region when set, converts it to grayscale when grayscale is set and
+// downscales it to width x height when resize is set.
+func decodePage(decoded image.Image, filePath string, region *image.Rectangle, resize bool, width, height int, grayscale bool) (image.Image, error) {
+	img := decoded
+	if img == nil {
+		var err error
+		if img, err = imaging.Decode(filePath); err != nil {
+			return nil, err
+		}
+	}
+	if region != nil {
+		img = imaging.Crop(img, *region)
+	}
+	if grayscale {
+		img = imaging.Luma(img)
+	}
+	if resize {
+		img = imaging.Resize(img, width, height)
+	}
+	return img, nil
+}
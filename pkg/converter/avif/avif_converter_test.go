@@ -0,0 +1,319 @@
+package avif
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireEncoder skips the test when avifenc is not installed: unlike cwebp
+// it is not provisioned by encoder-setup.
+func requireEncoder(t *testing.T) *Converter {
+	t.Helper()
+	converter := New()
+	if err := converter.PrepareConverter(); err != nil {
+		t.Skipf("avifenc not available: %v", err)
+	}
+	return converter
+}
+
+func createTestImageFile(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	err = jpeg.Encode(f, img, nil)
+	require.NoError(t, err)
+	_ = f.Close()
+}
+
+func createTestChapter(t *testing.T, pages []struct{ w, h int }) (*manga.Chapter, string) {
+	t.Helper()
+	dir := t.TempDir()
+	inputDir := filepath.Join(dir, "input")
+	require.NoError(t, os.MkdirAll(inputDir, 0755))
+
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+	}
+
+	for i, p := range pages {
+		pagePath := filepath.Join(inputDir, fmt.Sprintf("%04d.jpg", i))
+		createTestImageFile(t, pagePath, p.w, p.h)
+		chapter.Pages = append(chapter.Pages, &manga.PageFile{
+			Index:     uint16(i),
+			Extension: ".jpg",
+			FilePath:  pagePath,
+		})
+	}
+
+	return chapter, dir
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		expectMajor int
+		expectVer   string
+		expectError bool
+	}{
+		{
+			name:        "libavif 1.x",
+			output:      "Version: 1.0.4 (dav1d [dec]:1.4.1, aom [enc/dec]:3.8.2)\nlibyuv : available (1875)\n",
+			expectMajor: 1,
+			expectVer:   "1.0.4",
+		},
+		{
+			name:        "libavif 0.x",
+			output:      "Version: 0.11.1 (aom [enc/dec]:3.6.0)\n",
+			expectMajor: 0,
+			expectVer:   "0.11.1",
+		},
+		{
+			name:        "garbage",
+			output:      "avifenc: unknown option",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			major, version, err := parseVersion(tt.output)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectMajor, major)
+			assert.Equal(t, tt.expectVer, version)
+		})
+	}
+}
+
+func TestConverter_Format(t *testing.T) {
+	assert.Equal(t, constant.AVIF, New().Format())
+}
+
+func TestConverter_ConvertChapter(t *testing.T) {
+	converter := requireEncoder(t)
+
+	chapter, dir := createTestChapter(t, []struct{ w, h int }{{400, 600}, {400, 600}})
+	progress := func(message string, current uint32, total uint32) {}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60}, progress)
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	for i, page := range convertedChapter.Pages {
+		assert.Equal(t, uint16(i), page.Index)
+		assert.Equal(t, ".avif", page.Extension)
+		assert.Equal(t, filepath.Join(dir, "output"), filepath.Dir(page.FilePath))
+		assert.FileExists(t, page.FilePath)
+	}
+}
+
+func TestConverter_ConvertChapter_NonNativeInput(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	gifPath := filepath.Join(dir, "0000.gif")
+	f, err := os.Create(gifPath)
+	require.NoError(t, err)
+	require.NoError(t, gif.Encode(f, image.NewPaletted(image.Rect(0, 0, 50, 80), color.Palette{color.Black, color.White}), nil))
+	require.NoError(t, f.Close())
+
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".gif", FilePath: gifPath}},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+	assert.Equal(t, ".avif", convertedChapter.Pages[0].Extension)
+
+	// The staged PNG must not outlive the conversion.
+	assert.NoFileExists(t, convertedChapter.Pages[0].FilePath+".png")
+}
+
+func TestConverter_SplitAndConvert(t *testing.T) {
+	converter := requireEncoder(t)
+
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{100, avifMaxHeight + 500}})
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60, Split: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.NotNil(t, convertedChapter)
+
+	// (16384 + 500) / 2000 rounded up
+	assert.Len(t, convertedChapter.Pages, 9)
+	for i, page := range convertedChapter.Pages {
+		assert.True(t, page.IsSplitted)
+		assert.Equal(t, uint16(i), page.SplitPartIndex)
+		assert.Equal(t, uint16(0), page.Index)
+		assert.Equal(t, ".avif", page.Extension)
+		assert.FileExists(t, page.FilePath)
+	}
+}
+
+func TestConverter_OversizedImageNoSplit(t *testing.T) {
+	converter := requireEncoder(t)
+
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{100, avifMaxHeight + 500}})
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60}, func(string, uint32, uint32) {})
+	assert.Error(t, err, "Should return error for oversized page without split")
+	if convertedChapter != nil {
+		for _, page := range convertedChapter.Pages {
+			assert.Equal(t, ".jpg", page.Extension, "Page should keep original extension")
+		}
+	}
+}
+
+func TestConverter_ResizeBeforeSplit(t *testing.T) {
+	converter := requireEncoder(t)
+
+	// Halving the width brings the page under avifMaxHeight, so it is
+	// converted whole instead of being split.
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{100, avifMaxHeight + 500}})
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60, Split: true, MaxWidth: 50}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+	assert.False(t, convertedChapter.Pages[0].IsSplitted)
+	assert.Equal(t, ".avif", convertedChapter.Pages[0].Extension)
+	assert.NoFileExists(t, convertedChapter.Pages[0].FilePath+".png")
+}
+
+func TestDecodePage_Grayscale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.jpg")
+	createTestImageFile(t, path, 40, 60)
+
+	img, err := decodePage(nil, path, nil, false, 0, 0, true)
+	require.NoError(t, err)
+	assert.IsType(t, &image.Gray{}, img)
+
+	img, err = decodePage(nil, path, nil, true, 20, 30, true)
+	require.NoError(t, err)
+	assert.IsType(t, &image.Gray{}, img, "resizing should keep the page grayscale")
+	assert.Equal(t, image.Pt(20, 30), img.Bounds().Size())
+
+	img, err = decodePage(nil, path, nil, false, 0, 0, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, color.GrayModel, img.ColorModel())
+}
+
+func TestConverter_ConvertChapter_Grayscale(t *testing.T) {
+	converter := requireEncoder(t)
+
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{100, 150}, {100, avifMaxHeight + 500}})
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60, Split: true, Grayscale: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+	for _, page := range convertedChapter.Pages {
+		assert.Equal(t, ".avif", page.Extension)
+		assert.NoFileExists(t, page.FilePath+".png")
+	}
+}
+
+func TestConverter_ConvertChapter_DetectGrayscale(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	gray := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	colored := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(x * 4)
+			gray.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+			colored.Set(x, y, color.RGBA{R: v, G: 255 - v, B: 64, A: 255})
+		}
+	}
+	chapter := &manga.Chapter{FilePath: filepath.Join(dir, "test.cbz"), TempDir: dir}
+	for i, img := range []image.Image{gray, colored} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d.jpg", i))
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 90}))
+		_ = f.Close()
+		chapter.Pages = append(chapter.Pages, &manga.PageFile{Index: uint16(i), Extension: ".jpg", FilePath: path})
+	}
+
+	opts := options.Conversion{Quality: 60, DetectGrayscale: true, GrayscaleTolerance: options.DefaultGrayscaleTolerance}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+	assert.True(t, convertedChapter.Pages[0].IsGrayscale)
+	assert.False(t, convertedChapter.Pages[1].IsGrayscale)
+	assert.Equal(t, 1, convertedChapter.GrayscalePages)
+}
+
+func TestDecodePage_Crop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "page.jpg")
+	createTestImageFile(t, path, 40, 60)
+
+	region := image.Rect(5, 10, 35, 50)
+	img, err := decodePage(nil, path, &region, true, 15, 20, false)
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(15, 20), img.Bounds().Size(), "the page is resized after cropping")
+
+	img, err = decodePage(nil, path, &region, false, 0, 0, true)
+	require.NoError(t, err)
+	assert.Equal(t, region, img.Bounds())
+	assert.IsType(t, &image.Gray{}, img)
+}
+
+func TestConverter_ConvertChapter_SplitSpreads(t *testing.T) {
+	converter := requireEncoder(t)
+
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{800, 600}, {400, 600}})
+
+	opts := options.Conversion{Quality: 60, SplitSpreads: true, KeepSpreads: true}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+
+	// The spread becomes itself and its two halves; the portrait page is
+	// left whole.
+	require.Len(t, convertedChapter.Pages, 4)
+	for i, page := range convertedChapter.Pages[:3] {
+		assert.Equal(t, uint16(0), page.Index)
+		assert.True(t, page.IsSplitted)
+		assert.Equal(t, uint16(i), page.SplitPartIndex)
+		assert.FileExists(t, page.FilePath)
+	}
+	assert.Equal(t, uint16(1), convertedChapter.Pages[3].Index)
+	assert.False(t, convertedChapter.Pages[3].IsSplitted)
+}
+
+func TestConverter_SplitHeight(t *testing.T) {
+	converter := requireEncoder(t)
+
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{100, 5000}, {100, 2500}})
+
+	opts := options.Conversion{Quality: 60, Split: true, SplitHeight: 3000, SliceHeight: 1000, SliceOverlap: 50}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+
+	// Only the page above the split height is cut, into 5 slices.
+	require.Len(t, convertedChapter.Pages, 6)
+	for _, page := range convertedChapter.Pages[:5] {
+		assert.Equal(t, uint16(0), page.Index)
+		assert.True(t, page.IsSplitted)
+	}
+	assert.False(t, convertedChapter.Pages[5].IsSplitted)
+}
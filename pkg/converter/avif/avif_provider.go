@@ -0,0 +1,121 @@
+package avif
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+)
+
+// encoderBinary is the libavif command-line encoder. Unlike cwebp there is no
+// Go wrapper that provisions it, so it must be installed on the host (e.g.
+// libavif-bin on Debian/Ubuntu, libavif-apps on Alpine).
+const encoderBinary = "avifenc"
+
+// minEncoderMajor is the first libavif release whose avifenc understands the
+// unified -q quality flag used below.
+const minEncoderMajor = 1
+
+var versionPattern = regexp.MustCompile(`Version:\s*(\d+)\.(\d+)\.(\d+)`)
+
+var prepareMutex sync.Mutex
+
+func PrepareEncoder() error {
+	prepareMutex.Lock()
+	defer prepareMutex.Unlock()
+
+	path, err := exec.LookPath(encoderBinary)
+	if err != nil {
+		return fmt.Errorf("%s not found, install libavif to convert to avif: %w", encoderBinary, err)
+	}
+
+	output, err := exec.Command(path, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to query %s version: %w", encoderBinary, err)
+	}
+
+	major, version, err := parseVersion(string(output))
+	if err != nil {
+		return err
+	}
+
+	if major < minEncoderMajor {
+		return fmt.Errorf("unexpected avifenc version: got %s, want %d.0.0 or newer", version, minEncoderMajor)
+	}
+
+	return nil
+}
+
+// parseVersion extracts the libavif version from `avifenc --version` output.
+func parseVersion(output string) (major int, version string, err error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return 0, "", fmt.Errorf("cannot parse avifenc version from %q", strings.TrimSpace(output))
+	}
+	major, err = strconv.Atoi(match[1])
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid avifenc major version %q: %w", match[1], err)
+	}
+	return major, strings.Join(match[1:], "."), nil
+}
+
+// EncodeFile converts a JPEG or PNG file directly to AVIF using avifenc.
+// Like webp.EncodeFile, no image data is loaded into Go memory. avifenc only
+// reads JPEG, PNG and Y4M, so other inputs must go through EncodeImage.
+//
+// avifenc is limited to a single worker thread: the converter already runs
+// one encoder per CPU core and letting each of them spawn more threads would
+// just oversubscribe the machine.
+func EncodeFile(inputPath string, outputPath string, quality uint) error {
+	return run("-q", strconv.FormatUint(uint64(quality), 10), inputPath, outputPath)
+}
+
+// EncodeImage writes an already decoded image to a temporary PNG next to
+// outputPath and encodes that with avifenc. It is used for inputs avifenc
+// cannot read itself (GIF, BMP, TIFF, WebP) and for split parts, since
+// avifenc has no equivalent of cwebp's -crop. Grayscale images are encoded
+// as YUV 4:0:0, leaving out the chroma planes entirely.
+func EncodeImage(img image.Image, outputPath string, quality uint) error {
+	return encodeImage(img, outputPath, "-q", strconv.FormatUint(uint64(quality), 10))
+}
+
+// EncodeImageLossless is EncodeImage encoding losslessly instead of at a
+// given quality.
+func EncodeImageLossless(img image.Image, outputPath string) error {
+	return encodeImage(img, outputPath, "--lossless")
+}
+
+// encodeImage stages img as a PNG and encodes it with avifenc and the given
+// quality arguments, see EncodeImage.
+func encodeImage(img image.Image, outputPath string, args ...string) error {
+	intermediatePath := outputPath + ".png"
+	if err := imaging.WritePNG(img, intermediatePath); err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(intermediatePath) }()
+
+	if _, ok := img.(*image.Gray); ok {
+		args = append([]string{"--yuv", "400"}, args...)
+	}
+	return run(append(args, intermediatePath, outputPath)...)
+}
+
+// run invokes avifenc single-threaded with the given arguments.
+func run(args ...string) error {
+	cmd := exec.Command(encoderBinary, append([]string{"--jobs", "1"}, args...)...)
+
+	var stderr bytes.Buffer
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", encoderBinary, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package constant
+
+import "github.com/thediveo/enumflag/v2"
+
+// Dither selects how pages quantized to a few gray levels spread the
+// rounding error.
+type Dither enumflag.Flag
+
+const (
+	// DitherFloydSteinberg diffuses the error of each pixel to its
+	// neighbors: the smoothest gradients, but patterns vary from page to page.
+	DitherFloydSteinberg Dither = iota
+	// DitherOrdered compares pixels to a fixed 8x8 Bayer matrix: a regular
+	// pattern that compresses better and does not shimmer when pages turn.
+	DitherOrdered
+	// DitherNone rounds each pixel to the nearest level.
+	DitherNone
+)
+
+var DitherValue = map[Dither][]string{
+	DitherFloydSteinberg: {"floyd-steinberg", "fs"},
+	DitherOrdered:        {"ordered", "bayer"},
+	DitherNone:           {"none"},
+}
+
+var DitherHelpText = enumflag.Help[Dither]{
+	DitherFloydSteinberg: "Diffuse the rounding error to neighboring pixels",
+	DitherOrdered:        "Use a fixed 8x8 Bayer pattern",
+	DitherNone:           "Round each pixel to the nearest level",
+}
+
+var DefaultDither = DitherFloydSteinberg
+
+func (d Dither) String() string {
+	return DitherValue[d][0]
+}
+
+func FindDither(dither string) Dither {
+	for d, names := range DitherValue {
+		for _, name := range names {
+			if name == dither {
+				return d
+			}
+		}
+	}
+	return DefaultDither
+}
@@ -0,0 +1,34 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDither(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Dither
+	}{
+		{"floyd-steinberg", DitherFloydSteinberg},
+		{"fs", DitherFloydSteinberg},
+		{"ordered", DitherOrdered},
+		{"bayer", DitherOrdered},
+		{"none", DitherNone},
+		{"unknown", DefaultDither},
+		{"", DefaultDither},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FindDither(tt.input))
+		})
+	}
+}
+
+func TestDither_String(t *testing.T) {
+	for dither, names := range DitherValue {
+		assert.Equal(t, names[0], dither.String())
+	}
+}
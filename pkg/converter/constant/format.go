@@ -6,14 +6,20 @@ type ConversionFormat enumflag.Flag
 
 const (
 	WebP ConversionFormat = iota
+	AVIF
+	JXL
 )
 
 var CommandValue = map[ConversionFormat][]string{
 	WebP: {"webp"},
+	AVIF: {"avif"},
+	JXL:  {"jxl", "jpegxl"},
 }
 
 var HelpText = enumflag.Help[ConversionFormat]{
 	WebP: "WebP Image Format",
+	AVIF: "AVIF Image Format (requires avifenc from libavif)",
+	JXL:  "JPEG XL Image Format, JPEG pages are recompressed losslessly (requires cjxl from libjxl)",
 }
 
 var DefaultConversion = WebP
@@ -0,0 +1,47 @@
+package constant
+
+import "github.com/thediveo/enumflag/v2"
+
+// ReadingDirection selects the order in which the halves of a split
+// double-page spread are stored.
+type ReadingDirection enumflag.Flag
+
+const (
+	// ReadingDirectionAuto reads the direction from the chapter's ComicInfo
+	// Manga field, falling back to left-to-right.
+	ReadingDirectionAuto ReadingDirection = iota
+	// ReadingDirectionLTR stores the left half of a spread first.
+	ReadingDirectionLTR
+	// ReadingDirectionRTL stores the right half of a spread first, as manga
+	// is read.
+	ReadingDirectionRTL
+)
+
+var ReadingDirectionValue = map[ReadingDirection][]string{
+	ReadingDirectionAuto: {"auto"},
+	ReadingDirectionLTR:  {"ltr", "left-to-right"},
+	ReadingDirectionRTL:  {"rtl", "right-to-left"},
+}
+
+var ReadingDirectionHelpText = enumflag.Help[ReadingDirection]{
+	ReadingDirectionAuto: "Use the ComicInfo Manga field, left-to-right when absent",
+	ReadingDirectionLTR:  "Left half of a spread first",
+	ReadingDirectionRTL:  "Right half of a spread first",
+}
+
+var DefaultReadingDirection = ReadingDirectionAuto
+
+func (d ReadingDirection) String() string {
+	return ReadingDirectionValue[d][0]
+}
+
+func FindReadingDirection(direction string) ReadingDirection {
+	for readingDirection, names := range ReadingDirectionValue {
+		for _, name := range names {
+			if name == direction {
+				return readingDirection
+			}
+		}
+	}
+	return DefaultReadingDirection
+}
@@ -0,0 +1,34 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindReadingDirection(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ReadingDirection
+	}{
+		{"auto", ReadingDirectionAuto},
+		{"ltr", ReadingDirectionLTR},
+		{"left-to-right", ReadingDirectionLTR},
+		{"rtl", ReadingDirectionRTL},
+		{"right-to-left", ReadingDirectionRTL},
+		{"unknown", DefaultReadingDirection},
+		{"", DefaultReadingDirection},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FindReadingDirection(tt.input))
+		})
+	}
+}
+
+func TestReadingDirection_String(t *testing.T) {
+	for direction, names := range ReadingDirectionValue {
+		assert.Equal(t, names[0], direction.String())
+	}
+}
@@ -0,0 +1,46 @@
+package constant
+
+import "github.com/thediveo/enumflag/v2"
+
+// WebPEncoder selects the program the WebP converter encodes pages with.
+type WebPEncoder enumflag.Flag
+
+const (
+	// WebPEncoderAuto uses cwebp, falling back to the built-in encoder when
+	// cwebp cannot be provisioned.
+	WebPEncoderAuto WebPEncoder = iota
+	// WebPEncoderCWebP uses cwebp and fails when it is not available.
+	WebPEncoderCWebP
+	// WebPEncoderNative uses the built-in pure-Go encoder: no external
+	// binary, but larger files and slower encoding than cwebp.
+	WebPEncoderNative
+)
+
+var WebPEncoderValue = map[WebPEncoder][]string{
+	WebPEncoderAuto:   {"auto"},
+	WebPEncoderCWebP:  {"cwebp"},
+	WebPEncoderNative: {"native", "go"},
+}
+
+var WebPEncoderHelpText = enumflag.Help[WebPEncoder]{
+	WebPEncoderAuto:   "cwebp, or the built-in encoder when cwebp cannot be provisioned",
+	WebPEncoderCWebP:  "cwebp only, failing when it is not available",
+	WebPEncoderNative: "The built-in pure-Go encoder, no external binary needed",
+}
+
+var DefaultWebPEncoder = WebPEncoderAuto
+
+func (e WebPEncoder) String() string {
+	return WebPEncoderValue[e][0]
+}
+
+func FindWebPEncoder(encoder string) WebPEncoder {
+	for e, names := range WebPEncoderValue {
+		for _, name := range names {
+			if name == encoder {
+				return e
+			}
+		}
+	}
+	return DefaultWebPEncoder
+}
@@ -0,0 +1,33 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindWebPEncoder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected WebPEncoder
+	}{
+		{"auto", WebPEncoderAuto},
+		{"cwebp", WebPEncoderCWebP},
+		{"native", WebPEncoderNative},
+		{"go", WebPEncoderNative},
+		{"unknown", DefaultWebPEncoder},
+		{"", DefaultWebPEncoder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FindWebPEncoder(tt.input))
+		})
+	}
+}
+
+func TestWebPEncoder_String(t *testing.T) {
+	for encoder, names := range WebPEncoderValue {
+		assert.Equal(t, names[0], encoder.String())
+	}
+}
@@ -0,0 +1,50 @@
+package constant
+
+import "github.com/thediveo/enumflag/v2"
+
+// WebPMode selects how the WebP converter compresses pages.
+type WebPMode enumflag.Flag
+
+const (
+	// WebPLossy encodes every page with lossy VP8 (the historical behavior).
+	WebPLossy WebPMode = iota
+	// WebPLossless encodes every page with lossless VP8L.
+	WebPLossless
+	// WebPNearLossless encodes with VP8L after cwebp's near-lossless
+	// preprocessing, trading exactness for size.
+	WebPNearLossless
+	// WebPAuto encodes lossy, and additionally tries lossless for palette-like
+	// PNG pages, keeping whichever output is smaller.
+	WebPAuto
+)
+
+var WebPModeValue = map[WebPMode][]string{
+	WebPLossy:        {"lossy"},
+	WebPLossless:     {"lossless"},
+	WebPNearLossless: {"near-lossless"},
+	WebPAuto:         {"auto"},
+}
+
+var WebPModeHelpText = enumflag.Help[WebPMode]{
+	WebPLossy:        "Lossy VP8 for every page",
+	WebPLossless:     "Lossless VP8L for every page, quality sets the compression effort",
+	WebPNearLossless: "Lossless VP8L with near-lossless preprocessing, see --near-lossless-level",
+	WebPAuto:         "Lossy, but also try lossless for palette-like PNG pages and keep the smaller",
+}
+
+var DefaultWebPMode = WebPLossy
+
+func (m WebPMode) String() string {
+	return WebPModeValue[m][0]
+}
+
+func FindWebPMode(mode string) WebPMode {
+	for webpMode, names := range WebPModeValue {
+		for _, name := range names {
+			if name == mode {
+				return webpMode
+			}
+		}
+	}
+	return DefaultWebPMode
+}
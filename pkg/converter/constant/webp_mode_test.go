@@ -0,0 +1,33 @@
+package constant
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindWebPMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected WebPMode
+	}{
+		{"lossy", WebPLossy},
+		{"lossless", WebPLossless},
+		{"near-lossless", WebPNearLossless},
+		{"auto", WebPAuto},
+		{"unknown", DefaultWebPMode},
+		{"", DefaultWebPMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, FindWebPMode(tt.input))
+		})
+	}
+}
+
+func TestWebPMode_String(t *testing.T) {
+	for mode, names := range WebPModeValue {
+		assert.Equal(t, names[0], mode.String())
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"strings"
 
 	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/avif"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/jxl"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/webp"
 	"github.com/samber/lo"
 )
@@ -18,10 +21,11 @@ type Converter interface {
 	Format() constant.ConversionFormat
 
 	// ConvertChapter converts all pages in a chapter from their source files to
-	// the target format. Pages are processed in parallel (bounded by CPU count).
+	// the target format using the settings in opts. Pages are processed in
+	// parallel (bounded by CPU count).
 	// On success, chapter.Pages is updated with converted PageFile entries.
 	// Returns partial success (non-fatal errors) via errors.PageIgnoredError.
-	ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error)
+	ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error)
 
 	// PrepareConverter ensures the external encoder binary is available.
 	PrepareConverter() error
@@ -29,6 +33,8 @@ type Converter interface {
 
 var converters = map[constant.ConversionFormat]Converter{
 	constant.WebP: webp.New(),
+	constant.AVIF: avif.New(),
+	constant.JXL:  jxl.New(),
 }
 
 // Available returns a list of available converters.
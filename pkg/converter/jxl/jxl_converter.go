@@ -0,0 +1,353 @@
+package jxl
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/pagefile"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/runner"
+	"github.com/rs/zerolog/log"
+)
+
+// jxlMaxHeight is the tallest page encoded whole. JPEG XL itself allows far
+// taller frames, but like AVIF pages past 16K pixels are kept as-is, or
+// split when splitting is enabled, so readers are not handed strips their
+// decoders struggle with and a chapter is paged the same in either format.
+const jxlMaxHeight = 16384
+
+type Converter struct {
+	cropHeight int
+	isPrepared bool
+	// pages converts the pages of chapters, running at most one cjxl
+	// process per CPU core across all of them.
+	pages *runner.Pool
+}
+
+func (converter *Converter) Format() constant.ConversionFormat {
+	return constant.JXL
+}
+
+// sliceHeight returns the height of the parts of a split page: the one set
+// in opts, or the converter's default.
+func (converter *Converter) sliceHeight(opts options.Conversion) int {
+	if opts.SliceHeight > 0 {
+		return opts.SliceHeight
+	}
+	return converter.cropHeight
+}
+
+func New() *Converter {
+	converter := &Converter{
+		cropHeight: options.DefaultSliceHeight,
+		isPrepared: false,
+	}
+	converter.pages = runner.New(constant.JXL, converter.convertPage)
+	return converter
+}
+
+func (converter *Converter) PrepareConverter() error {
+	if converter.isPrepared {
+		return nil
+	}
+	err := PrepareEncoder()
+	if err != nil {
+		return err
+	}
+	converter.isPrepared = true
+	return nil
+}
+
+// ConvertChapter converts all pages in a chapter to JPEG XL using cjxl.
+// JPEG pages are recompressed losslessly (reversible to the original file);
+// PNG and GIF pages are encoded from their pixels at the given quality, with
+// 100 meaning lossless. Other formats are decoded in Go and staged as PNG.
+// Pages taller than jxlMaxHeight, or than opts.SplitHeight, are split like
+// the other formats do. The WebP-specific settings in opts are ignored.
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("pages", len(chapter.Pages)).
+		Uint8("quality", opts.Quality).
+		Bool("split", opts.Split).
+		Msg("Starting jxl chapter conversion")
+
+	err := converter.PrepareConverter()
+	if err != nil {
+		return nil, err
+	}
+
+	return converter.pages.ConvertChapter(ctx, chapter, opts, progress)
+}
+
+// convertPage converts page for the chapter runner, normalized first when
+// it needs to be, see pagefile.Normalize. JPEG pages whose pixels are kept
+// as they are skip normalization and are recompressed losslessly from the
+// original file, see transcodesJPEG: staging them as PNG would lose the
+// reversible transcode.
+func (converter *Converter) convertPage(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+	if grayscale, ok := transcodesJPEG(page, opts); ok {
+		return transcodePage(page, outputDir, grayscale)
+	}
+	source, cleanup := pagefile.Normalize(page, outputDir, ".jxl", opts)
+	defer cleanup()
+	pages, err := converter.convertPageFile(ctx, source, outputDir, opts)
+	// A page kept in its source format keeps its original file, and the
+	// others were changed by the normalization when there was one.
+	for i := range pages {
+		if pages[i] == source {
+			pages[i] = page
+		} else if source != page {
+			pages[i].IsModified = true
+		}
+	}
+	return pages, err
+}
+
+// transcodesJPEG reports whether page is a JPEG to recompress losslessly
+// rather than re-encode from its pixels: nothing in opts changes them and
+// the page needs no resizing, splitting or cropping. It also reports whether
+// the page is grayscale, which a JPEG already stored as such still is once
+// transcoded: it has no chroma to drop.
+func transcodesJPEG(page *manga.PageFile, opts options.Conversion) (bool, bool) {
+	ext := strings.ToLower(page.Extension)
+	if (ext != ".jpg" && ext != ".jpeg") || opts.Enhances() || opts.Quantizes() {
+		return false, false
+	}
+	storedGray := imaging.IsStoredGray(page.FilePath)
+	if opts.Grayscale && !storedGray {
+		return false, false
+	}
+
+	// The limits apply to the page turned upright. cjxl may still read a
+	// page whose header Go cannot, so a failure here skips them.
+	if width, height, err := imaging.Dimensions(page.FilePath); err == nil {
+		if metadata, err := imaging.ReadMetadata(page.FilePath); err == nil && metadata.Orientation >= 5 {
+			width, height = height, width
+		}
+		_, fitHeight, resize := opts.FitSize(width, height)
+		if resize || opts.IsSpread(width, height) || fitHeight > jxlMaxHeight || opts.SplitsHeight(fitHeight) {
+			return false, false
+		}
+	}
+
+	grayscale := opts.Grayscale || (opts.DetectGrayscale && storedGray)
+	var img image.Image
+	if opts.DetectGrayscale && !grayscale {
+		var nearGray bool
+		if img, nearGray = pagefile.DetectGrayscale(page, opts.GrayscaleTolerance); nearGray {
+			return false, false
+		}
+	}
+	if opts.AutoCrop {
+		if _, region := pagefile.DetectBorders(img, page, opts); region != nil {
+			return false, false
+		}
+	}
+	return grayscale, true
+}
+
+// transcodePage recompresses the JPEG page losslessly into outputDir. A
+// page cjxl cannot transcode is kept in its original format and reported
+// through a PageIgnoredError.
+func transcodePage(page *manga.PageFile, outputDir string, grayscale bool) ([]*manga.PageFile, error) {
+	outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".jxl"))
+	if err := TranscodeJPEG(page.FilePath, outputPath); err != nil {
+		_ = os.Remove(outputPath)
+		log.Warn().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Conversion failed, keeping original")
+		return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+			fmt.Sprintf("page %d: conversion failed (%s)", page.Index, err.Error()))
+	}
+
+	return []*manga.PageFile{{
+		Index:        page.Index,
+		Extension:    ".jxl",
+		FilePath:     outputPath,
+		OriginalName: page.OriginalName,
+		IsGrayscale:  grayscale,
+	}}, nil
+}
+
+// convertPageFile converts a single page file to JPEG XL format.
+// A page cjxl cannot encode is kept in its original format and reported
+// through a PageIgnoredError, like the WebP converter does.
+//
+// JPEG pages get here only when their pixels change, see transcodesJPEG.
+// cjxl cannot resize, so pages over the resize limits are downscaled in Go
+// and encoded at opts.Quality. The same goes for pages with borders to crop
+// and for grayscale pages, forced or detected: the gray PNG handed to cjxl
+// is encoded as a single-channel image. Pages quantized to a few gray levels
+// are dithered once cropped and resized, see encodePage. Pages too tall once
+// resized are split in Go, see pagefile.SplitRows.
+func (converter *Converter) convertPageFile(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("input", page.FilePath).
+		Msg("Converting page file")
+
+	ext := strings.ToLower(page.Extension)
+	if ext == ".jxl" {
+		log.Debug().Uint16("page_index", page.Index).Msg("Page already JPEG XL, skipping")
+		return []*manga.PageFile{page}, nil
+	}
+
+	// Quantized pages are gray by definition.
+	grayscale := opts.Grayscale || opts.Quantizes()
+	var img image.Image
+	if opts.DetectGrayscale && !grayscale {
+		img, grayscale = pagefile.DetectGrayscale(page, opts.GrayscaleTolerance)
+	}
+	var region *image.Rectangle
+	if opts.AutoCrop {
+		img, region = pagefile.DetectBorders(img, page, opts)
+	}
+
+	// cjxl may still read a page whose header Go cannot, so a failure here
+	// only skips resizing and splitting.
+	var fitWidth, fitHeight int
+	resize, spread := false, false
+	width, height, dimensionsErr := imaging.Dimensions(page.FilePath)
+	if region != nil {
+		width, height, dimensionsErr = region.Dx(), region.Dy(), nil
+	}
+	if dimensionsErr == nil {
+		fitWidth, fitHeight, resize = opts.FitSize(width, height)
+		spread = opts.IsSpread(width, height)
+	}
+
+	if spread {
+		img, err := decodePage(img, page.FilePath, region, grayscale)
+		if err != nil {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode image, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
+		}
+		pages, err := pagefile.SplitSpread(ctx, page, outputDir, ".jxl", img, opts, func(part image.Image, outputPath string) error {
+			return encodePage(part, outputPath, opts)
+		})
+		for _, part := range pages {
+			part.IsGrayscale = grayscale
+		}
+		return pages, err
+	}
+
+	if dimensionsErr == nil && (fitHeight > jxlMaxHeight || opts.SplitsHeight(fitHeight)) {
+		if !opts.Split {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Int("height", fitHeight).
+				Msg("Page too tall for JPEG XL, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d is too tall [max: %dpx] to be converted to jxl format", page.Index, jxlMaxHeight))
+		}
+		img, err := decodePage(img, page.FilePath, region, grayscale)
+		if err != nil {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode image, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
+		}
+		if resize {
+			img = imaging.Resize(img, fitWidth, fitHeight)
+		}
+		pages, err := pagefile.SplitRows(ctx, page, outputDir, ".jxl", img, converter.sliceHeight(opts), opts, func(part image.Image, outputPath string) error {
+			return encodePage(part, outputPath, opts)
+		})
+		for _, part := range pages {
+			part.IsGrayscale = grayscale
+		}
+		return pages, err
+	}
+
+	outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".jxl"))
+
+	var err error
+	switch {
+	case region == nil && !resize && !grayscale && (ext == ".png" || ext == ".gif"):
+		err = EncodeFile(page.FilePath, outputPath, uint(opts.Quality))
+	default:
+		var decodeErr error
+		if img, decodeErr = decodePage(img, page.FilePath, region, grayscale); decodeErr != nil {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Err(decodeErr).
+				Msg("Cannot decode image, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, decodeErr.Error()))
+		}
+		if resize {
+			img = imaging.Resize(img, fitWidth, fitHeight)
+		}
+		err = encodePage(img, outputPath, opts)
+	}
+
+	if err != nil {
+		_ = os.Remove(outputPath)
+		log.Warn().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Conversion failed, keeping original")
+		return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+			fmt.Sprintf("page %d: conversion failed (%s)", page.Index, err.Error()))
+	}
+
+	// Preserve OriginalName so --keep-filenames carries through to the
+	// final zip entry name.
+	return []*manga.PageFile{{
+		Index:        page.Index,
+		Extension:    ".jxl",
+		FilePath:     outputPath,
+		OriginalName: page.OriginalName,
+		IsGrayscale:  grayscale,
+		IsModified:   region != nil || resize || opts.Quantizes() || pagefile.Grayscaled(page, grayscale),
+	}}, nil
+}
+
+// decodePage returns the page at filePath ready to encode: decoded unless
+// already done, cropped to region and converted to grayscale as requested.
+func decodePage(decoded image.Image, filePath string, region *image.Rectangle, grayscale bool) (image.Image, error) {
+	img := decoded
+	if img == nil {
+		var err error
+		if img, err = imaging.Decode(filePath); err != nil {
+			return nil, err
+		}
+	}
+	if region != nil {
+		img = imaging.Crop(img, *region)
+	}
+	if grayscale {
+		img = imaging.Luma(img)
+	}
+	return img, nil
+}
+
+// encodePage encodes the decoded, cropped and resized img to outputPath at
+// opts.Quality. Pages to quantize are dithered to opts.GrayLevels gray
+// levels first and also encoded losslessly, see pagefile.EncodeSmaller.
+func encodePage(img image.Image, outputPath string, opts options.Conversion) error {
+	if !opts.Quantizes() {
+		return EncodeImage(img, outputPath, uint(opts.Quality))
+	}
+	return pagefile.EncodeSmaller(pagefile.Quantize(img, opts), outputPath, func(img image.Image, outputPath string) error {
+		return EncodeImage(img, outputPath, uint(opts.Quality))
+	}, func(img image.Image, outputPath string) error {
+		return EncodeImage(img, outputPath, 100)
+	})
+}
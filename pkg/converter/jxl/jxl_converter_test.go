@@ -0,0 +1,522 @@
+package jxl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
+)
+
+// requireEncoder skips the test when cjxl is not installed: unlike cwebp it
+// is not provisioned by encoder-setup.
+func requireEncoder(t *testing.T) *Converter {
+	t.Helper()
+	converter := New()
+	if err := converter.PrepareConverter(); err != nil {
+		t.Skipf("cjxl not available: %v", err)
+	}
+	return converter
+}
+
+func gradient(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+	return img
+}
+
+func writePage(t *testing.T, dir string, index int, ext string) *manga.PageFile {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%04d%s", index, ext))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	switch ext {
+	case ".jpg":
+		require.NoError(t, jpeg.Encode(f, gradient(64, 96), &jpeg.Options{Quality: 90}))
+	case ".png":
+		require.NoError(t, png.Encode(f, gradient(64, 96)))
+	case ".bmp":
+		require.NoError(t, bmp.Encode(f, gradient(64, 96)))
+	default:
+		_, err = f.WriteString("not an image")
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+	return &manga.PageFile{Index: uint16(index), Extension: ext, FilePath: path}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		expected    [3]int
+		expectError bool
+	}{
+		{"release", "cjxl v0.10.2 0.10.2 [AVX2,SSE4,SSE2]\n", [3]int{0, 10, 2}, false},
+		{"distro build", "JPEG XL encoder v0.7.0 [AVX2,SSE4,SSSE3,Unknown]\n", [3]int{0, 7, 0}, false},
+		{"garbage", "cjxl: unknown flag", [3]int{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := parseVersion(tt.output)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, version)
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	assert.True(t, versionAtLeast([3]int{0, 7, 0}, [3]int{0, 7, 0}))
+	assert.True(t, versionAtLeast([3]int{0, 10, 2}, [3]int{0, 7, 0}))
+	assert.True(t, versionAtLeast([3]int{1, 0, 0}, [3]int{0, 7, 0}))
+	assert.False(t, versionAtLeast([3]int{0, 6, 9}, [3]int{0, 7, 0}))
+}
+
+func TestConverter_Format(t *testing.T) {
+	assert.Equal(t, constant.JXL, New().Format())
+}
+
+func TestConverter_ConvertChapter(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages: []*manga.PageFile{
+			writePage(t, dir, 0, ".jpg"),
+			writePage(t, dir, 1, ".png"),
+			writePage(t, dir, 2, ".bmp"),
+		},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+
+	for i, page := range convertedChapter.Pages {
+		assert.Equal(t, uint16(i), page.Index)
+		assert.Equal(t, ".jxl", page.Extension)
+		assert.Equal(t, filepath.Join(dir, "output"), filepath.Dir(page.FilePath))
+		assert.FileExists(t, page.FilePath)
+	}
+}
+
+func TestConverter_ConvertChapter_UndecodablePageIsIgnored(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	good := writePage(t, dir, 0, ".jpg")
+	bad := writePage(t, dir, 1, ".tiff")
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{good, bad},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, func(string, uint32, uint32) {})
+	var pageIgnored *converterrors.PageIgnoredError
+	require.ErrorAs(t, err, &pageIgnored)
+	require.NotNil(t, convertedChapter)
+	require.Len(t, convertedChapter.Pages, 2)
+	assert.Equal(t, ".jxl", convertedChapter.Pages[0].Extension)
+	assert.Equal(t, ".tiff", convertedChapter.Pages[1].Extension, "undecodable page should be kept as-is")
+}
+
+// TestTranscodeJPEG_IsReversible checks the point of the JPEG path: djxl must
+// give back the exact bytes that went in.
+func TestTranscodeJPEG_IsReversible(t *testing.T) {
+	requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	dir := t.TempDir()
+	page := writePage(t, dir, 0, ".jpg")
+	jxlPath := filepath.Join(dir, "page.jxl")
+	roundTripPath := filepath.Join(dir, "roundtrip.jpg")
+
+	require.NoError(t, TranscodeJPEG(page.FilePath, jxlPath))
+	require.NoError(t, exec.Command("djxl", jxlPath, roundTripPath).Run())
+
+	original, err := os.ReadFile(page.FilePath)
+	require.NoError(t, err)
+	roundTrip, err := os.ReadFile(roundTripPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(original, roundTrip), "jpeg should be reconstructed bit for bit")
+}
+
+// TestConverter_ConvertChapter_RotatedJPEGIsTranscoded checks that a JPEG
+// tagged with an EXIF orientation is not normalized to PNG first when its
+// pixels are kept: it is still reconstructed bit for bit.
+func TestConverter_ConvertChapter_RotatedJPEGIsTranscoded(t *testing.T) {
+	converter := requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	dir := t.TempDir()
+	upright := writePage(t, dir, 0, ".jpg")
+	// The same page tagged with EXIF orientation 6, a quarter turn clockwise.
+	data, err := os.ReadFile(upright.FilePath)
+	require.NoError(t, err)
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	segment := append([]byte{0xFF, 0xE1, 0x00, byte(len(exif) + 2)}, exif...)
+	rotated := append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+	require.NoError(t, os.WriteFile(upright.FilePath, rotated, 0644))
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{upright},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+	assert.Equal(t, ".jxl", convertedChapter.Pages[0].Extension)
+
+	roundTripPath := filepath.Join(dir, "roundtrip.jpg")
+	require.NoError(t, exec.Command("djxl", convertedChapter.Pages[0].FilePath, roundTripPath).Run())
+	roundTrip, err := os.ReadFile(roundTripPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(rotated, roundTrip), "rotated jpeg should be reconstructed bit for bit")
+}
+
+func TestConverter_ConvertChapter_Resize(t *testing.T) {
+	converter := requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{writePage(t, dir, 0, ".jpg"), writePage(t, dir, 1, ".png")},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, MaxWidth: 32}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	for _, page := range convertedChapter.Pages {
+		decodedPath := page.FilePath + ".png"
+		require.NoError(t, exec.Command("djxl", page.FilePath, decodedPath).Run())
+		f, err := os.Open(decodedPath)
+		require.NoError(t, err)
+		config, err := png.DecodeConfig(f)
+		_ = f.Close()
+		require.NoError(t, err)
+		assert.Equal(t, 32, config.Width)
+		assert.Equal(t, 48, config.Height)
+	}
+}
+
+func TestConverter_ConvertChapter_Grayscale(t *testing.T) {
+	converter := requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{writePage(t, dir, 0, ".jpg"), writePage(t, dir, 1, ".png")},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Grayscale: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	for _, page := range convertedChapter.Pages {
+		decodedPath := page.FilePath + ".png"
+		require.NoError(t, exec.Command("djxl", page.FilePath, decodedPath).Run())
+		f, err := os.Open(decodedPath)
+		require.NoError(t, err)
+		config, err := png.DecodeConfig(f)
+		_ = f.Close()
+		require.NoError(t, err)
+		assert.Contains(t, []color.Model{color.GrayModel, color.Gray16Model}, config.ColorModel)
+	}
+}
+
+// TestConverter_ConvertChapter_GrayscaleStoredGrayJPEG checks that forcing
+// grayscale keeps the lossless transcode of a JPEG that is already gray.
+func TestConverter_ConvertChapter_GrayscaleStoredGrayJPEG(t *testing.T) {
+	converter := requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0000.jpg")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	gray := image.NewGray(image.Rect(0, 0, 64, 96))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+	require.NoError(t, jpeg.Encode(f, gray, &jpeg.Options{Quality: 90}))
+	require.NoError(t, f.Close())
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: path}},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Grayscale: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+
+	roundTripPath := filepath.Join(dir, "roundtrip.jpg")
+	require.NoError(t, exec.Command("djxl", convertedChapter.Pages[0].FilePath, roundTripPath).Run())
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+	roundTrip, err := os.ReadFile(roundTripPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(original, roundTrip), "gray jpeg should still be transcoded losslessly")
+}
+
+func TestConverter_ConvertChapter_DetectGrayscale(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	writeJPEG := func(index int, img image.Image) *manga.PageFile {
+		path := filepath.Join(dir, fmt.Sprintf("%04d.jpg", index))
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 90}))
+		require.NoError(t, f.Close())
+		return &manga.PageFile{Index: uint16(index), Extension: ".jpg", FilePath: path}
+	}
+
+	grayRGB := image.NewRGBA(image.Rect(0, 0, 64, 96))
+	storedGray := image.NewGray(image.Rect(0, 0, 64, 96))
+	for y := 0; y < 96; y++ {
+		for x := 0; x < 64; x++ {
+			grayRGB.Set(x, y, color.Gray{Y: uint8(x + y)})
+			storedGray.SetGray(x, y, color.Gray{Y: uint8(x + y)})
+		}
+	}
+
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{writeJPEG(0, grayRGB), writeJPEG(1, gradient(64, 96)), writeJPEG(2, storedGray)},
+	}
+	storedGrayJPEG, err := os.ReadFile(chapter.Pages[2].FilePath)
+	require.NoError(t, err)
+
+	opts := options.Conversion{Quality: 80, DetectGrayscale: true, GrayscaleTolerance: options.DefaultGrayscaleTolerance}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+	assert.True(t, convertedChapter.Pages[0].IsGrayscale)
+	assert.False(t, convertedChapter.Pages[1].IsGrayscale)
+	assert.True(t, convertedChapter.Pages[2].IsGrayscale)
+	assert.Equal(t, 2, convertedChapter.GrayscalePages)
+
+	// A JPEG already stored as grayscale is still recompressed losslessly.
+	if _, err := exec.LookPath("djxl"); err == nil {
+		restoredPath := filepath.Join(dir, "restored.jpg")
+		require.NoError(t, exec.Command("djxl", convertedChapter.Pages[2].FilePath, restoredPath).Run())
+		restored, err := os.ReadFile(restoredPath)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(storedGrayJPEG, restored))
+	}
+}
+
+func TestConverter_ConvertChapter_AutoCrop(t *testing.T) {
+	converter := requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	dir := t.TempDir()
+	framed := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 200; x++ {
+			if x >= 20 && x < 180 && y >= 30 && y < 270 {
+				framed.Set(x, y, color.Gray{Y: uint8(64 + x%128)})
+			} else {
+				framed.Set(x, y, color.White)
+			}
+		}
+	}
+	path := filepath.Join(dir, "0000.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, framed))
+	require.NoError(t, f.Close())
+
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".png", FilePath: path}},
+	}
+
+	opts := options.Conversion{Quality: 90, AutoCrop: true, AutoCropThreshold: 32, AutoCropMargin: 4}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+
+	decodedPath := convertedChapter.Pages[0].FilePath + ".png"
+	require.NoError(t, exec.Command("djxl", convertedChapter.Pages[0].FilePath, decodedPath).Run())
+	decoded, err := os.Open(decodedPath)
+	require.NoError(t, err)
+	config, err := png.DecodeConfig(decoded)
+	_ = decoded.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 168, config.Width)
+	assert.Equal(t, 248, config.Height)
+}
+
+func TestConverter_ConvertChapter_SplitSpreads(t *testing.T) {
+	converter := requireEncoder(t)
+	if _, err := exec.LookPath("djxl"); err != nil {
+		t.Skip("djxl not available")
+	}
+
+	// A spread whose left half is white and right half black.
+	dir := t.TempDir()
+	spread := image.NewGray(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			spread.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	path := filepath.Join(dir, "0000.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, spread))
+	require.NoError(t, f.Close())
+
+	chapter := &manga.Chapter{
+		FilePath:     filepath.Join(dir, "test.cbz"),
+		TempDir:      dir,
+		ComicInfoXml: `<ComicInfo><Manga>YesAndRightToLeft</Manga></ComicInfo>`,
+		Pages:        []*manga.PageFile{{Index: 0, Extension: ".png", FilePath: path}},
+	}
+
+	opts := options.Conversion{Quality: 90, SplitSpreads: true}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	// Read right to left, the black half comes first.
+	for i, expectedWhite := range []bool{false, true} {
+		page := convertedChapter.Pages[i]
+		assert.Equal(t, uint16(i), page.SplitPartIndex)
+
+		decodedPath := page.FilePath + ".png"
+		require.NoError(t, exec.Command("djxl", page.FilePath, decodedPath).Run())
+		decoded, err := os.Open(decodedPath)
+		require.NoError(t, err)
+		img, err := png.Decode(decoded)
+		_ = decoded.Close()
+		require.NoError(t, err)
+		assert.Equal(t, 100, img.Bounds().Dx())
+		r, _, _, _ := img.At(50, 50).RGBA()
+		assert.Equal(t, expectedWhite, r > 0x8000, "part %d", i)
+	}
+}
+
+// writeTallPage writes a width x height JPEG page to dir.
+func writeTallPage(t *testing.T, dir string, index, width, height int) *manga.PageFile {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%04d.jpg", index))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, image.NewRGBA(image.Rect(0, 0, width, height)), nil))
+	require.NoError(t, f.Close())
+	return &manga.PageFile{Index: uint16(index), Extension: ".jpg", FilePath: path}
+}
+
+func TestConverter_SplitAndConvert(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{writeTallPage(t, dir, 0, 100, jxlMaxHeight+500)},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60, Split: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+
+	// (16384 + 500) / 2000 rounded up
+	require.Len(t, convertedChapter.Pages, 9)
+	for i, page := range convertedChapter.Pages {
+		assert.True(t, page.IsSplitted)
+		assert.Equal(t, uint16(i), page.SplitPartIndex)
+		assert.Equal(t, uint16(0), page.Index)
+		assert.Equal(t, ".jxl", page.Extension)
+		assert.FileExists(t, page.FilePath)
+	}
+}
+
+func TestConverter_OversizedImageNoSplit(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{writeTallPage(t, dir, 0, 100, jxlMaxHeight+500)},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 60}, func(string, uint32, uint32) {})
+	var pageIgnored *converterrors.PageIgnoredError
+	require.ErrorAs(t, err, &pageIgnored)
+	require.NotNil(t, convertedChapter)
+	require.Len(t, convertedChapter.Pages, 1)
+	assert.Equal(t, ".jpg", convertedChapter.Pages[0].Extension, "page should keep its original extension")
+}
+
+func TestConverter_SplitHeight(t *testing.T) {
+	converter := requireEncoder(t)
+
+	dir := t.TempDir()
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{writeTallPage(t, dir, 0, 100, 5000), writeTallPage(t, dir, 1, 100, 2500)},
+	}
+
+	opts := options.Conversion{Quality: 60, Split: true, SplitHeight: 3000, SliceHeight: 1000, SliceOverlap: 50}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+
+	// Only the page above the split height is cut, into 5 slices.
+	require.Len(t, convertedChapter.Pages, 6)
+	for _, page := range convertedChapter.Pages[:5] {
+		assert.Equal(t, uint16(0), page.Index)
+		assert.True(t, page.IsSplitted)
+	}
+	assert.False(t, convertedChapter.Pages[5].IsSplitted)
+}
@@ -0,0 +1,122 @@
+package jxl
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+)
+
+// encoderBinary is the libjxl command-line encoder. It must be installed on
+// the host (libjxl-tools on Debian/Ubuntu and Alpine).
+const encoderBinary = "cjxl"
+
+// minEncoderVersion is the oldest libjxl release whose cjxl flags are relied
+// upon below (-q, --lossless_jpeg, --num_threads).
+var minEncoderVersion = [3]int{0, 7, 0}
+
+var versionPattern = regexp.MustCompile(`v(\d+)\.(\d+)\.(\d+)`)
+
+var prepareMutex sync.Mutex
+
+func PrepareEncoder() error {
+	prepareMutex.Lock()
+	defer prepareMutex.Unlock()
+
+	path, err := exec.LookPath(encoderBinary)
+	if err != nil {
+		return fmt.Errorf("%s not found, install libjxl to convert to jxl: %w", encoderBinary, err)
+	}
+
+	output, err := exec.Command(path, "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to query %s version: %w", encoderBinary, err)
+	}
+
+	version, err := parseVersion(string(output))
+	if err != nil {
+		return err
+	}
+
+	if !versionAtLeast(version, minEncoderVersion) {
+		return fmt.Errorf("unexpected cjxl version: got %d.%d.%d, want %d.%d.%d or newer",
+			version[0], version[1], version[2],
+			minEncoderVersion[0], minEncoderVersion[1], minEncoderVersion[2])
+	}
+
+	return nil
+}
+
+// parseVersion extracts the libjxl version from `cjxl --version` output.
+func parseVersion(output string) ([3]int, error) {
+	var version [3]int
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return version, fmt.Errorf("cannot parse cjxl version from %q", strings.TrimSpace(output))
+	}
+	for i := range version {
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return version, fmt.Errorf("invalid cjxl version component %q: %w", match[i+1], err)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+func versionAtLeast(version, minimum [3]int) bool {
+	for i := range version {
+		if version[i] != minimum[i] {
+			return version[i] > minimum[i]
+		}
+	}
+	return true
+}
+
+// TranscodeJPEG losslessly recompresses a JPEG file into JPEG XL. The JPEG
+// bitstream is stored as-is in the output, so djxl can reconstruct the
+// original file bit for bit; no pixel data is re-encoded, which is why there
+// is no quality parameter.
+func TranscodeJPEG(inputPath string, outputPath string) error {
+	return run("--lossless_jpeg=1", inputPath, outputPath)
+}
+
+// EncodeFile encodes a PNG or GIF file to JPEG XL from its pixels. Quality
+// 100 is mathematically lossless; anything lower is lossy.
+func EncodeFile(inputPath string, outputPath string, quality uint) error {
+	return run("--lossless_jpeg=0", "-q", strconv.FormatUint(uint64(quality), 10), inputPath, outputPath)
+}
+
+// EncodeImage writes an already decoded image to a temporary PNG next to
+// outputPath and encodes that with cjxl. It is used for inputs cjxl cannot
+// read itself (BMP, TIFF, WebP).
+func EncodeImage(img image.Image, outputPath string, quality uint) error {
+	intermediatePath := outputPath + ".png"
+	if err := imaging.WritePNG(img, intermediatePath); err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(intermediatePath) }()
+
+	return EncodeFile(intermediatePath, outputPath, quality)
+}
+
+// run invokes cjxl single-threaded: the converter already runs one encoder
+// per CPU core.
+func run(args ...string) error {
+	cmd := exec.Command(encoderBinary, append([]string{"--num_threads=0"}, args...)...)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", encoderBinary, err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
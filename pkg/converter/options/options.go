@@ -0,0 +1,219 @@
+// Package options holds the per-run settings handed to a converter. It lives
+// apart from pkg/converter so the format implementations can depend on it
+// without importing the registry that imports them.
+package options
+
+import (
+	"math"
+
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+)
+
+// DefaultNearLosslessLevel is cwebp's own default -near_lossless level.
+const DefaultNearLosslessLevel uint8 = 60
+
+// DefaultMinQuality and DefaultMaxQuality bound the quality search done when
+// a TargetSSIM is set.
+const (
+	DefaultMinQuality uint8 = 50
+	DefaultMaxQuality uint8 = 95
+)
+
+// DefaultGrayscaleTolerance is the channel spread, in 8-bit levels, under
+// which DetectGrayscale treats a pixel as gray. It absorbs JPEG chroma noise
+// and the slight tint of scanned paper.
+const DefaultGrayscaleTolerance uint8 = 16
+
+// DefaultAutoCropThreshold and DefaultAutoCropMargin are the AutoCrop
+// defaults: pixels within 32 levels of pure white or black count as border,
+// and 8 pixels of border are kept around the content.
+const (
+	DefaultAutoCropThreshold uint8 = 32
+	DefaultAutoCropMargin    int   = 8
+)
+
+// DefaultLevelsClip is the share of the pixels, in percent, AutoLevels lets
+// clip to pure black and to pure white.
+const DefaultLevelsClip = 0.5
+
+// DefaultSliceHeight is the height, in pixels, of the parts a split page is
+// cut into. MaxSliceHeight is the tallest part, overlap included, every
+// splitting format can store: WebP's 16383 pixel limit.
+const (
+	DefaultSliceHeight = 2000
+	MaxSliceHeight     = 16383
+)
+
+// Conversion configures a single Converter.ConvertChapter call. The zero
+// value (apart from Quality) reproduces the historical behavior, so callers
+// only set what they need.
+type Conversion struct {
+	// Quality of the output (0-100). For lossless WebP it is the compression
+	// effort instead.
+	Quality uint8
+	// Split allows pages too tall for the output format to be cut into
+	// several parts instead of being kept in their original format.
+	Split bool
+	// SplitHeight, when positive, also splits pages taller than this once
+	// resized, even if the output format could store them whole.
+	SplitHeight int
+	// SliceHeight is the height of the parts of a split page. 0 uses the
+	// converter's default, DefaultSliceHeight.
+	SliceHeight int
+	// SliceOverlap is the number of rows each part repeats from the end of
+	// the previous one, so nothing is lost at the seams.
+	SliceOverlap int
+	// WebPMode selects lossy, lossless, near-lossless or automatic WebP
+	// encoding. Other converters ignore it.
+	WebPMode constant.WebPMode
+	// NearLosslessLevel is cwebp's -near_lossless level (0-100, lower means
+	// more preprocessing). Only used with constant.WebPNearLossless.
+	NearLosslessLevel uint8
+	// WebPEncoder selects cwebp or the built-in encoder for WebP pages.
+	// Other converters ignore it.
+	WebPEncoder constant.WebPEncoder
+	// TargetSSIM, when above 0, replaces the fixed Quality of lossy WebP
+	// encodes: each page is encoded at the lowest quality between MinQuality
+	// and MaxQuality whose output reaches this SSIM (0-1) against the source.
+	TargetSSIM float64
+	// MinQuality and MaxQuality bound the search enabled by TargetSSIM.
+	MinQuality uint8
+	MaxQuality uint8
+	// ContentAware classifies each page as text, drawing or photo and
+	// adapts the WebP preset and quality to it. Other converters ignore it.
+	ContentAware bool
+	// MaxWidth, MaxHeight and MaxMegapixels downscale pages, keeping their
+	// aspect ratio, until they fit all the set limits. Pages are never
+	// upscaled. 0 means no limit.
+	MaxWidth      int
+	MaxHeight     int
+	MaxMegapixels float64
+	// Grayscale converts every page to grayscale before encoding, for
+	// monochrome reading devices where color only costs space.
+	Grayscale bool
+	// DetectGrayscale analyzes each page and encodes the near-grayscale ones
+	// as grayscale, leaving color pages untouched. Implied by Grayscale.
+	DetectGrayscale bool
+	// GrayscaleTolerance is the spread between the R, G and B values of a
+	// pixel (0-255) up to which DetectGrayscale still considers it gray.
+	GrayscaleTolerance uint8
+	// AutoLevels stretches the luma range of each page to full black and
+	// white before encoding, for faded scans.
+	AutoLevels bool
+	// LevelsClip is the percentage of pixels (0-50) AutoLevels lets clip at
+	// each end of the range.
+	LevelsClip float64
+	// Gamma, when above 0 and other than 1, is applied to each page before
+	// encoding: above 1 lightens the midtones, below 1 darkens them.
+	Gamma float64
+	// GrayLevels, when between 2 and 255, quantizes every page to that many
+	// evenly spaced gray levels after cropping and resizing, for e-ink
+	// screens that cannot show more. Implies Grayscale.
+	GrayLevels int
+	// Dither spreads the rounding error of GrayLevels quantization.
+	Dither constant.Dither
+	// AutoCrop trims the uniform white or black borders of each page before
+	// encoding (and before any resize or split).
+	AutoCrop bool
+	// AutoCropThreshold is how far (0-255) from pure white or black a pixel
+	// may be and still count as border.
+	AutoCropThreshold uint8
+	// AutoCropMargin is the number of border pixels kept around the content
+	// as a safety margin.
+	AutoCropMargin int
+	// SplitSpreads cuts double-page spreads, pages wider than tall, into
+	// their two halves.
+	SplitSpreads bool
+	// ReadingDirection orders the halves of a split spread. Converters
+	// resolve constant.ReadingDirectionAuto from the chapter's ComicInfo.
+	ReadingDirection constant.ReadingDirection
+	// KeepSpreads stores the whole spread as well, before its halves.
+	KeepSpreads bool
+	// FlattenAnimations encodes only the first frame of animated GIFs, as
+	// cwebp does, instead of converting them to animated WebP.
+	FlattenAnimations bool
+	// KeepICC keeps the ICC profiles embedded in pages instead of converting
+	// the pages to sRGB. EXIF orientation is applied either way.
+	KeepICC bool
+	// KeepSmaller keeps a page in its source format when converting it does
+	// not shrink the file by at least MinSavingsPercent.
+	KeepSmaller bool
+	// MinSavingsPercent is the size reduction (0-100) a conversion must reach
+	// to replace the source page when KeepSmaller is set. With 0, only pages
+	// that grew or stayed the same size are kept.
+	MinSavingsPercent uint8
+}
+
+// KeepOriginal reports whether a page should stay in its source format given
+// the size of the source file and of its conversion.
+func (c Conversion) KeepOriginal(originalSize, convertedSize int64) bool {
+	if !c.KeepSmaller || originalSize <= 0 {
+		return false
+	}
+	saved := originalSize - convertedSize
+	if saved <= 0 {
+		return true
+	}
+	return saved*100 < originalSize*int64(c.MinSavingsPercent)
+}
+
+// SplitsHeight reports whether a page of the given height, as encoded, is
+// split because of SplitHeight rather than the format's own limit.
+func (c Conversion) SplitsHeight(height int) bool {
+	return c.Split && c.SplitHeight > 0 && height > c.SplitHeight
+}
+
+// IsSpread reports whether a width x height page is a double-page spread
+// to split.
+func (c Conversion) IsSpread(width, height int) bool {
+	return c.SplitSpreads && width > height
+}
+
+// Enhances reports whether pages go through AutoLevels or Gamma.
+func (c Conversion) Enhances() bool {
+	return c.AutoLevels || (c.Gamma > 0 && c.Gamma != 1)
+}
+
+// Quantizes reports whether pages are reduced to GrayLevels gray levels.
+func (c Conversion) Quantizes() bool {
+	return c.GrayLevels >= 2 && c.GrayLevels < 256
+}
+
+// Resizes reports whether any of the resize limits is set.
+func (c Conversion) Resizes() bool {
+	return c.MaxWidth > 0 || c.MaxHeight > 0 || c.MaxMegapixels > 0
+}
+
+// FitSize returns the size a width x height page is downscaled to under the
+// resize limits, and false when it already fits.
+func (c Conversion) FitSize(width, height int) (int, int, bool) {
+	if width <= 0 || height <= 0 {
+		return width, height, false
+	}
+
+	scale := 1.0
+	if c.MaxWidth > 0 && width > c.MaxWidth {
+		scale = math.Min(scale, float64(c.MaxWidth)/float64(width))
+	}
+	if c.MaxHeight > 0 && height > c.MaxHeight {
+		scale = math.Min(scale, float64(c.MaxHeight)/float64(height))
+	}
+	if c.MaxMegapixels > 0 {
+		pixels := float64(width) * float64(height)
+		if maxPixels := c.MaxMegapixels * 1_000_000; pixels > maxPixels {
+			scale = math.Min(scale, math.Sqrt(maxPixels/pixels))
+		}
+	}
+	if scale >= 1 {
+		return width, height, false
+	}
+
+	// Round down so the result never exceeds a limit, but keep at least a
+	// pixel on each side.
+	fitWidth := max(1, int(math.Floor(float64(width)*scale)))
+	fitHeight := max(1, int(math.Floor(float64(height)*scale)))
+	if fitWidth == width && fitHeight == height {
+		return width, height, false
+	}
+	return fitWidth, fitHeight, true
+}
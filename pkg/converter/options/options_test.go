@@ -0,0 +1,97 @@
+package options
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversion_KeepOriginal(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Conversion
+		originalSize  int64
+		convertedSize int64
+		expected      bool
+	}{
+		{name: "disabled keeps conversion even if larger", opts: Conversion{}, originalSize: 100, convertedSize: 150, expected: false},
+		{name: "larger conversion", opts: Conversion{KeepSmaller: true}, originalSize: 100, convertedSize: 150, expected: true},
+		{name: "same size", opts: Conversion{KeepSmaller: true}, originalSize: 100, convertedSize: 100, expected: true},
+		{name: "any saving without threshold", opts: Conversion{KeepSmaller: true}, originalSize: 100, convertedSize: 99, expected: false},
+		{name: "below threshold", opts: Conversion{KeepSmaller: true, MinSavingsPercent: 10}, originalSize: 1000, convertedSize: 901, expected: true},
+		{name: "exactly threshold", opts: Conversion{KeepSmaller: true, MinSavingsPercent: 10}, originalSize: 1000, convertedSize: 900, expected: false},
+		{name: "above threshold", opts: Conversion{KeepSmaller: true, MinSavingsPercent: 10}, originalSize: 1000, convertedSize: 500, expected: false},
+		{name: "unknown original size", opts: Conversion{KeepSmaller: true}, originalSize: 0, convertedSize: 10, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.opts.KeepOriginal(tt.originalSize, tt.convertedSize))
+		})
+	}
+}
+
+func TestConversion_FitSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Conversion
+		width, height  int
+		expectedWidth  int
+		expectedHeight int
+		expectResize   bool
+	}{
+		{name: "no limits", opts: Conversion{}, width: 4000, height: 6000, expectedWidth: 4000, expectedHeight: 6000},
+		{name: "already fits", opts: Conversion{MaxWidth: 1600, MaxHeight: 2400}, width: 1200, height: 1800, expectedWidth: 1200, expectedHeight: 1800},
+		{name: "never upscales", opts: Conversion{MaxWidth: 3000}, width: 1000, height: 1500, expectedWidth: 1000, expectedHeight: 1500},
+		{name: "max width", opts: Conversion{MaxWidth: 1000}, width: 4000, height: 6000, expectedWidth: 1000, expectedHeight: 1500, expectResize: true},
+		{name: "max height", opts: Conversion{MaxHeight: 1500}, width: 4000, height: 6000, expectedWidth: 1000, expectedHeight: 1500, expectResize: true},
+		{name: "most restrictive wins", opts: Conversion{MaxWidth: 2000, MaxHeight: 1500}, width: 4000, height: 6000, expectedWidth: 1000, expectedHeight: 1500, expectResize: true},
+		{name: "megapixels", opts: Conversion{MaxMegapixels: 6}, width: 4000, height: 6000, expectedWidth: 2000, expectedHeight: 3000, expectResize: true},
+		{name: "webtoon width", opts: Conversion{MaxWidth: 600}, width: 800, height: 20000, expectedWidth: 600, expectedHeight: 15000, expectResize: true},
+		{name: "rounds down", opts: Conversion{MaxWidth: 333}, width: 1000, height: 1001, expectedWidth: 333, expectedHeight: 333, expectResize: true},
+		{name: "keeps a pixel", opts: Conversion{MaxHeight: 10}, width: 5, height: 1000, expectedWidth: 1, expectedHeight: 10, expectResize: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, resize := tt.opts.FitSize(tt.width, tt.height)
+			assert.Equal(t, tt.expectedWidth, width)
+			assert.Equal(t, tt.expectedHeight, height)
+			assert.Equal(t, tt.expectResize, resize)
+		})
+	}
+}
+
+func TestConversion_Resizes(t *testing.T) {
+	assert.False(t, Conversion{Quality: 85}.Resizes())
+	assert.True(t, Conversion{MaxWidth: 1000}.Resizes())
+	assert.True(t, Conversion{MaxHeight: 1000}.Resizes())
+	assert.True(t, Conversion{MaxMegapixels: 2.5}.Resizes())
+}
+
+func TestConversion_IsSpread(t *testing.T) {
+	assert.False(t, Conversion{}.IsSpread(2000, 1400), "disabled")
+	assert.True(t, Conversion{SplitSpreads: true}.IsSpread(2000, 1400))
+	assert.False(t, Conversion{SplitSpreads: true}.IsSpread(1400, 2000))
+	assert.False(t, Conversion{SplitSpreads: true}.IsSpread(1400, 1400), "square pages are not spreads")
+}
+
+func TestConversion_SplitsHeight(t *testing.T) {
+	assert.False(t, Conversion{Split: true}.SplitsHeight(10000), "no split height set")
+	assert.False(t, Conversion{SplitHeight: 3000}.SplitsHeight(10000), "split disabled")
+	assert.True(t, Conversion{Split: true, SplitHeight: 3000}.SplitsHeight(3001))
+	assert.False(t, Conversion{Split: true, SplitHeight: 3000}.SplitsHeight(3000))
+}
+
+func TestConversion_Quantizes(t *testing.T) {
+	for levels, expected := range map[int]bool{0: false, 1: false, 2: true, 16: true, 255: true, 256: false} {
+		assert.Equal(t, expected, Conversion{GrayLevels: levels}.Quantizes(), "gray levels %d", levels)
+	}
+}
+
+func TestConversion_Enhances(t *testing.T) {
+	assert.False(t, Conversion{}.Enhances())
+	assert.False(t, Conversion{Gamma: 1}.Enhances())
+	assert.True(t, Conversion{Gamma: 1.8}.Enhances())
+	assert.True(t, Conversion{AutoLevels: true, Gamma: 1}.Enhances())
+}
@@ -0,0 +1,329 @@
+// Package pagefile holds the page steps shared by the format converters:
+// staging names, normalization, grayscale and border detection, quantization
+// and the lossless candidate of quantized pages, and the Go-side splitting
+// of decoded pages. It lives apart from pkg/converter so the format
+// implementations can depend on it without importing the registry that
+// imports them.
+package pagefile
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/rs/zerolog/log"
+)
+
+// EncodeFunc encodes the decoded img, a page or one of its parts, to
+// outputPath.
+type EncodeFunc func(img image.Image, outputPath string) error
+
+// IntermediateName returns the on-disk filename used for a page's output
+// with extension ext during conversion. When the page carries an
+// OriginalName (recorded by --keep-filenames), its stem is reused so the
+// temp file lines up with the name the archive writer will pick. Otherwise
+// the historical %04d indexed naming is kept. The splitSuffix argument is
+// appended verbatim after the stem (e.g. "-00", "-01") for split parts and
+// is empty for the happy-path single output, so the indexed form of a part
+// stays as %04d-%02d.
+func IntermediateName(page *manga.PageFile, splitSuffix string, ext string) string {
+	if page.OriginalName != "" {
+		stem := strings.TrimSuffix(page.OriginalName, filepath.Ext(page.OriginalName))
+		return stem + splitSuffix + ext
+	}
+	return fmt.Sprintf("%04d%s%s", page.Index, splitSuffix, ext)
+}
+
+// Normalize stages page as a PNG in outputDir when imaging.Normalize finds
+// it needs turning upright or converting to sRGB, or when opts enhances
+// pages, and returns the page to convert in its place along with a func
+// removing the staged file. ext is the extension of the converter's output:
+// pages already in that format are not enhanced. Pages that need none of
+// it, or whose metadata cannot be read, are returned as is.
+func Normalize(page *manga.PageFile, outputDir string, ext string, opts options.Conversion) (*manga.PageFile, func()) {
+	img, profile, err := imaging.Normalize(page.FilePath, opts.KeepICC)
+	if err != nil {
+		log.Debug().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Cannot normalize page, converting it as is")
+		return page, func() {}
+	}
+	if opts.Enhances() && strings.ToLower(page.Extension) != ext {
+		img = enhance(img, page, opts)
+	}
+	if img == nil {
+		return page, func() {}
+	}
+
+	normalizedPath := filepath.Join(outputDir, IntermediateName(page, "", ext)+".normalized.png")
+	if err := imaging.WritePNGWithProfile(img, normalizedPath, profile); err != nil {
+		log.Debug().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Cannot stage normalized page, converting it as is")
+		return page, func() {}
+	}
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("normalized", normalizedPath).
+		Msg("Page normalized before encoding")
+
+	normalized := *page
+	normalized.FilePath = normalizedPath
+	normalized.Extension = ".png"
+	return &normalized, func() { _ = os.Remove(normalizedPath) }
+}
+
+// enhance applies the auto-levels and gamma of opts to img, the page as
+// normalized so far or nil when it needed no normalization, decoding page
+// in the latter case. It returns nil when there is nothing to stage: the
+// page was not normalized and the levels change nothing, or Go cannot decode
+// it.
+func enhance(img image.Image, page *manga.PageFile, opts options.Conversion) image.Image {
+	decoded := img
+	if decoded == nil {
+		var err error
+		if decoded, err = imaging.Decode(page.FilePath); err != nil {
+			log.Debug().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode page, skipping enhancement")
+			return nil
+		}
+	}
+	levels := imaging.AutoLevels(decoded, opts.AutoLevels, opts.LevelsClip, opts.Gamma)
+	if levels.IsIdentity() {
+		return img
+	}
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Bool("auto_levels", opts.AutoLevels).
+		Float64("gamma", opts.Gamma).
+		Msg("Page enhanced")
+	return levels.Apply(decoded)
+}
+
+// DetectGrayscale decodes page and reports whether it is near-grayscale
+// within tolerance, returning the decoded image for reuse. A page Go cannot
+// decode is reported as color and left to the encoder.
+func DetectGrayscale(page *manga.PageFile, tolerance uint8) (image.Image, bool) {
+	img, err := imaging.Decode(page.FilePath)
+	if err != nil {
+		log.Debug().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Cannot decode image for grayscale detection, treating it as color")
+		return nil, false
+	}
+	grayscale := imaging.IsNearGrayscale(img, tolerance)
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Bool("grayscale", grayscale).
+		Msg("Grayscale detection completed")
+	return img, grayscale
+}
+
+// Grayscaled reports whether encoding page as grayscale, as asked by
+// grayscale, drops colors from it: a page stored as grayscale has none.
+func Grayscaled(page *manga.PageFile, grayscale bool) bool {
+	return grayscale && !imaging.IsStoredGray(page.FilePath)
+}
+
+// DetectBorders returns the content region of page when AutoCrop finds
+// borders to trim, or nil. img is the already decoded page, or nil to decode
+// it here; the decoded image is returned for reuse. A page Go cannot decode
+// is left uncropped.
+func DetectBorders(img image.Image, page *manga.PageFile, opts options.Conversion) (image.Image, *image.Rectangle) {
+	if img == nil {
+		var err error
+		if img, err = imaging.Decode(page.FilePath); err != nil {
+			log.Debug().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode image for border detection, keeping borders")
+			return nil, nil
+		}
+	}
+	content, ok := imaging.TrimBorders(img, opts.AutoCropThreshold, opts.AutoCropMargin)
+	if !ok {
+		return img, nil
+	}
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("bounds", img.Bounds().String()).
+		Str("content", content.String()).
+		Msg("Trimming page borders")
+	return img, &content
+}
+
+// Quantize reduces img to opts.GrayLevels gray levels, dithered as set by
+// opts.Dither.
+func Quantize(img image.Image, opts options.Conversion) *image.Gray {
+	switch opts.Dither {
+	case constant.DitherOrdered:
+		return imaging.DitherOrdered(img, opts.GrayLevels)
+	case constant.DitherNone:
+		return imaging.Quantize(img, opts.GrayLevels)
+	}
+	return imaging.DitherFloydSteinberg(img, opts.GrayLevels)
+}
+
+// EncodeSmaller encodes img to outputPath with encode and, as a candidate,
+// with encodeLossless, keeping whichever file is smaller. It is meant for
+// pages quantized to a few gray levels: lossless often wins on those, and it
+// keeps the dithering intact. A failing lossless attempt is not an error:
+// the lossy output is already in place.
+func EncodeSmaller(img image.Image, outputPath string, encode EncodeFunc, encodeLossless EncodeFunc) error {
+	if err := encode(img, outputPath); err != nil {
+		return err
+	}
+
+	candidatePath := outputPath + ".lossless"
+	defer func() { _ = os.Remove(candidatePath) }()
+	if err := encodeLossless(img, candidatePath); err != nil {
+		log.Debug().Str("output", outputPath).Err(err).Msg("Lossless attempt failed, keeping lossy output")
+		return nil
+	}
+	lossyInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return err
+	}
+	losslessInfo, err := os.Stat(candidatePath)
+	if err != nil {
+		return err
+	}
+	log.Debug().
+		Str("output", outputPath).
+		Int64("lossy_size", lossyInfo.Size()).
+		Int64("lossless_size", losslessInfo.Size()).
+		Msg("Compared lossy and lossless output")
+	if losslessInfo.Size() < lossyInfo.Size() {
+		return os.Rename(candidatePath, outputPath)
+	}
+	return nil
+}
+
+// SplitRows splits a tall, already decoded (and resized) page into parts of
+// at most sliceHeight, cut at panel gutters where possible, and encodes each
+// part with encode to a file with extension ext in outputDir. Every part
+// after the first also repeats the last opts.SliceOverlap rows of the one
+// before.
+func SplitRows(ctx context.Context, page *manga.PageFile, outputDir string, ext string, img image.Image, sliceHeight int, opts options.Conversion, encode EncodeFunc) ([]*manga.PageFile, error) {
+	bounds := img.Bounds()
+
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", bounds.Dx()).
+		Int("height", bounds.Dy()).
+		Int("crop_height", sliceHeight).
+		Int("overlap", opts.SliceOverlap).
+		Msg("Splitting and converting page")
+
+	// Cuts are moved to the gutters between panels when there are some
+	// nearby, so speech bubbles are not sliced through.
+	cuts := imaging.SliceRows(img, sliceHeight)
+
+	var parts []*manga.PageFile
+	for i := 0; i < len(cuts)-1; i++ {
+		select {
+		case <-ctx.Done():
+			return parts, ctx.Err()
+		default:
+		}
+
+		top := cuts[i]
+		if i > 0 {
+			top = max(top-opts.SliceOverlap, bounds.Min.Y)
+		}
+		part := imaging.Crop(img, image.Rect(bounds.Min.X, top, bounds.Max.X, cuts[i+1]))
+
+		outputPath := filepath.Join(outputDir, IntermediateName(page, fmt.Sprintf("-%02d", i), ext))
+		if err := encode(part, outputPath); err != nil {
+			_ = os.Remove(outputPath)
+			log.Error().
+				Uint16("page_index", page.Index).
+				Int("part", i).
+				Err(err).
+				Msg("Failed to convert split part")
+			return nil, fmt.Errorf("failed to convert split part %d of page %d: %w", i, page.Index, err)
+		}
+
+		parts = append(parts, &manga.PageFile{
+			Index:          page.Index,
+			Extension:      ext,
+			FilePath:       outputPath,
+			IsSplitted:     true,
+			SplitPartIndex: uint16(i),
+			OriginalName:   page.OriginalName,
+		})
+	}
+
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("parts", len(parts)).
+		Msg("Split conversion completed")
+
+	return parts, nil
+}
+
+// SplitSpread encodes the halves of the double-page spread img as separate
+// parts with encode, in the reading order of opts, preceded by the whole
+// spread when opts.KeepSpreads is set. Each part is fitted to the resize
+// limits on its own.
+func SplitSpread(ctx context.Context, page *manga.PageFile, outputDir string, ext string, img image.Image, opts options.Conversion, encode EncodeFunc) ([]*manga.PageFile, error) {
+	bounds := img.Bounds()
+	regions := imaging.SpreadHalves(bounds, opts.ReadingDirection == constant.ReadingDirectionRTL)
+	if opts.KeepSpreads {
+		regions = append([]image.Rectangle{bounds}, regions...)
+	}
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", bounds.Dx()).
+		Int("height", bounds.Dy()).
+		Str("reading_direction", opts.ReadingDirection.String()).
+		Int("parts", len(regions)).
+		Msg("Splitting double-page spread")
+
+	var parts []*manga.PageFile
+	for i, region := range regions {
+		select {
+		case <-ctx.Done():
+			return parts, ctx.Err()
+		default:
+		}
+
+		part := imaging.Crop(img, region)
+		if fitWidth, fitHeight, resize := opts.FitSize(region.Dx(), region.Dy()); resize {
+			part = imaging.Resize(part, fitWidth, fitHeight)
+		}
+
+		outputPath := filepath.Join(outputDir, IntermediateName(page, fmt.Sprintf("-%02d", i), ext))
+		if err := encode(part, outputPath); err != nil {
+			_ = os.Remove(outputPath)
+			log.Error().
+				Uint16("page_index", page.Index).
+				Int("part", i).
+				Err(err).
+				Msg("Failed to convert spread part")
+			return nil, fmt.Errorf("failed to convert spread part %d of page %d: %w", i, page.Index, err)
+		}
+
+		parts = append(parts, &manga.PageFile{
+			Index:          page.Index,
+			Extension:      ext,
+			FilePath:       outputPath,
+			IsSplitted:     true,
+			SplitPartIndex: uint16(i),
+			OriginalName:   page.OriginalName,
+		})
+	}
+	return parts, nil
+}
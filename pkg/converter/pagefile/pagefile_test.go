@@ -0,0 +1,280 @@
+package pagefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gradient(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 255})
+		}
+	}
+	return img
+}
+
+func writePage(t *testing.T, dir string, index int, ext string) *manga.PageFile {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("%04d%s", index, ext))
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	switch ext {
+	case ".jpg":
+		require.NoError(t, jpeg.Encode(f, gradient(64, 96), &jpeg.Options{Quality: 90}))
+	case ".png":
+		require.NoError(t, png.Encode(f, gradient(64, 96)))
+	default:
+		_, err = f.WriteString("not an image")
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+	return &manga.PageFile{Index: uint16(index), Extension: ext, FilePath: path}
+}
+
+// writeParts is an EncodeFunc staging each part as a PNG.
+func writeParts(img image.Image, outputPath string) error {
+	return imaging.WritePNG(img, outputPath)
+}
+
+func TestIntermediateName(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        *manga.PageFile
+		splitSuffix string
+		ext         string
+		expected    string
+	}{
+		{"indexed", &manga.PageFile{Index: 3}, "", ".avif", "0003.avif"},
+		{"indexed split", &manga.PageFile{Index: 3}, "-01", ".webp", "0003-01.webp"},
+		{"original name", &manga.PageFile{Index: 3, OriginalName: "cover.png"}, "", ".jxl", "cover.jxl"},
+		{"original name split", &manga.PageFile{Index: 3, OriginalName: "cover.png"}, "-01", ".avif", "cover-01.avif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IntermediateName(tt.page, tt.splitSuffix, tt.ext))
+		})
+	}
+}
+
+// TestIntermediateName_StemsAreUnique pins the contract that IntermediateName
+// must produce a different on-disk filename for two pages whose
+// OriginalNames share a stem via the original archive entry name.
+// ExtractChapter guarantees stem-unique OriginalNames per chapter (so, e.g.,
+// a/page.png and b/page.jpg come out as "page.png" and "page_0001.jpg"), and
+// the converters must reflect that: stripping the extension and appending
+// their own must not collapse two distinct stems onto the same path.
+func TestIntermediateName_StemsAreUnique(t *testing.T) {
+	tests := []struct {
+		name         string
+		originalName string
+		splitSuffix  string
+	}{
+		{name: "bare stem", originalName: "page.png", splitSuffix: ""},
+		{name: "indexed stem (post-fix)", originalName: "page_0001.jpg", splitSuffix: ""},
+		{name: "bare stem + split suffix", originalName: "page.png", splitSuffix: "-00"},
+		{name: "indexed stem + split suffix", originalName: "page_0001.jpg", splitSuffix: "-00"},
+	}
+
+	names := make(map[string]struct{}, len(tests))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &manga.PageFile{Index: 0, OriginalName: tt.originalName}
+			got := IntermediateName(page, tt.splitSuffix, ".webp")
+			_, dup := names[got]
+			assert.False(t, dup, "intermediate name %q collides with an earlier page's", got)
+			names[got] = struct{}{}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	dir := t.TempDir()
+	upright := writePage(t, dir, 0, ".jpg")
+	source, cleanup := Normalize(upright, dir, ".webp", options.Conversion{})
+	cleanup()
+	assert.Same(t, upright, source, "upright pages without a profile are converted as they are")
+
+	// The same page tagged with EXIF orientation 6, a quarter turn clockwise.
+	data, err := os.ReadFile(upright.FilePath)
+	require.NoError(t, err)
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	segment := append([]byte{0xFF, 0xE1, 0x00, byte(len(exif) + 2)}, exif...)
+	rotatedPath := filepath.Join(dir, "0001.jpg")
+	require.NoError(t, os.WriteFile(rotatedPath, append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...), 0644))
+	rotated := &manga.PageFile{Index: 1, Extension: ".jpg", FilePath: rotatedPath, OriginalName: "scan.jpg"}
+
+	source, cleanup = Normalize(rotated, dir, ".webp", options.Conversion{})
+	require.NotSame(t, rotated, source)
+	assert.Equal(t, ".png", source.Extension)
+	assert.Equal(t, filepath.Join(dir, "scan.webp.normalized.png"), source.FilePath)
+	assert.Equal(t, rotated.Index, source.Index)
+	assert.Equal(t, rotated.OriginalName, source.OriginalName)
+
+	width, height, err := imaging.Dimensions(source.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, 96, width)
+	assert.Equal(t, 64, height)
+
+	cleanup()
+	assert.NoFileExists(t, source.FilePath)
+}
+
+func TestNormalize_Enhance(t *testing.T) {
+	dir := t.TempDir()
+	// The gradient page only reaches about a third of the luma range.
+	page := writePage(t, dir, 0, ".png")
+
+	source, cleanup := Normalize(page, dir, ".avif", options.Conversion{Gamma: 1})
+	cleanup()
+	assert.Same(t, page, source, "a gamma of 1 changes nothing")
+
+	source, cleanup = Normalize(page, dir, ".avif", options.Conversion{AutoLevels: true, LevelsClip: options.DefaultLevelsClip})
+	defer cleanup()
+	require.NotSame(t, page, source)
+	assert.Equal(t, ".png", source.Extension)
+	enhanced, err := imaging.Decode(source.FilePath)
+	require.NoError(t, err)
+	r, g, b, _ := enhanced.At(63, 95).RGBA()
+	assert.Greater(t, max(r, g, b)>>8, uint32(250), "the lightest pixel is stretched to white")
+
+	converted := writePage(t, dir, 1, ".avif")
+	source, cleanup = Normalize(converted, dir, ".avif", options.Conversion{AutoLevels: true, Gamma: 2})
+	cleanup()
+	assert.Same(t, converted, source, "pages already in the output format are left alone")
+}
+
+func TestGrayscaled(t *testing.T) {
+	dir := t.TempDir()
+	colorPage := writePage(t, dir, 0, ".png")
+	grayPath := filepath.Join(dir, "0001.png")
+	require.NoError(t, imaging.WritePNG(imaging.Luma(gradient(8, 8)), grayPath))
+	grayPage := &manga.PageFile{Index: 1, Extension: ".png", FilePath: grayPath}
+
+	assert.True(t, Grayscaled(colorPage, true))
+	assert.False(t, Grayscaled(colorPage, false))
+	assert.False(t, Grayscaled(grayPage, true), "a page stored as grayscale has no colors to drop")
+}
+
+func TestEncodeSmaller(t *testing.T) {
+	writeBytes := func(size int) EncodeFunc {
+		return func(_ image.Image, outputPath string) error {
+			return os.WriteFile(outputPath, make([]byte, size), 0644)
+		}
+	}
+	failing := func(image.Image, string) error { return errors.New("boom") }
+
+	tests := []struct {
+		name     string
+		lossy    EncodeFunc
+		lossless EncodeFunc
+		wantSize int64
+		wantErr  bool
+	}{
+		{"lossless smaller", writeBytes(100), writeBytes(40), 40, false},
+		{"lossy smaller", writeBytes(40), writeBytes(100), 40, false},
+		{"lossless fails", writeBytes(100), failing, 100, false},
+		{"lossy fails", failing, writeBytes(40), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "0000.avif")
+			err := EncodeSmaller(gradient(8, 8), outputPath, tt.lossy, tt.lossless)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			info, err := os.Stat(outputPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSize, info.Size())
+			assert.NoFileExists(t, outputPath+".lossless")
+		})
+	}
+}
+
+func TestSplitRows(t *testing.T) {
+	dir := t.TempDir()
+	page := &manga.PageFile{Index: 2, OriginalName: "strip.png"}
+
+	parts, err := SplitRows(context.Background(), page, dir, ".jxl", gradient(32, 250), 100, options.Conversion{SliceOverlap: 10}, writeParts)
+	require.NoError(t, err)
+	require.Len(t, parts, 3)
+
+	heights := 0
+	for i, part := range parts {
+		assert.Equal(t, page.Index, part.Index)
+		assert.Equal(t, ".jxl", part.Extension)
+		assert.Equal(t, filepath.Join(dir, fmt.Sprintf("strip-%02d.jxl", i)), part.FilePath)
+		assert.True(t, part.IsSplitted)
+		assert.Equal(t, uint16(i), part.SplitPartIndex)
+		_, height, err := imaging.Dimensions(part.FilePath)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, height, 100+10)
+		heights += height
+	}
+	assert.Equal(t, 250+2*10, heights, "every part after the first repeats the overlap")
+
+	failing := func(image.Image, string) error { return errors.New("boom") }
+	_, err = SplitRows(context.Background(), page, dir, ".jxl", gradient(32, 250), 100, options.Conversion{}, failing)
+	assert.ErrorContains(t, err, "failed to convert split part 0 of page 2")
+}
+
+func TestSplitSpread(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      options.Conversion
+		wantParts int
+		// firstX is the left edge, in the spread, of the first half.
+		firstX int
+	}{
+		{"left to right", options.Conversion{}, 2, 0},
+		{"right to left", options.Conversion{ReadingDirection: constant.ReadingDirectionRTL}, 2, 100},
+		{"keep spread", options.Conversion{KeepSpreads: true}, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			spread := gradient(200, 120)
+			page := &manga.PageFile{Index: 5}
+
+			parts, err := SplitSpread(context.Background(), page, dir, ".avif", spread, tt.opts, writeParts)
+			require.NoError(t, err)
+			require.Len(t, parts, tt.wantParts)
+
+			first := parts[0]
+			if tt.opts.KeepSpreads {
+				width, _, err := imaging.Dimensions(first.FilePath)
+				require.NoError(t, err)
+				assert.Equal(t, 200, width, "the whole spread comes first")
+				first = parts[1]
+			}
+			half, err := imaging.Decode(first.FilePath)
+			require.NoError(t, err)
+			assert.Equal(t, 100, half.Bounds().Dx())
+			assert.Equal(t, spread.At(tt.firstX, 0), half.At(0, 0))
+			for i, part := range parts {
+				assert.Equal(t, filepath.Join(dir, fmt.Sprintf("0005-%02d.avif", i)), part.FilePath)
+			}
+		})
+	}
+}
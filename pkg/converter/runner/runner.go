@@ -0,0 +1,243 @@
+// Package runner converts the pages of a chapter concurrently for the format
+// converters, which only supply how a single page is encoded. It lives apart
+// from pkg/converter so the format implementations can depend on it without
+// importing the registry that imports them.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/rs/zerolog/log"
+)
+
+// PageFunc converts page into one or more pages written to outputDir. A page
+// left in its source format is returned as is. Errors wrapping a
+// converterrors.PageIgnoredError keep the returned pages and are reported
+// alongside the converted chapter; any other error fails the chapter.
+type PageFunc func(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error)
+
+// Pool runs a PageFunc over the pages of chapters, one goroutine per page.
+type Pool struct {
+	format      constant.ConversionFormat
+	convertPage PageFunc
+	// guard limits concurrent encoder processes across all chapters.
+	guard chan struct{}
+}
+
+// New returns a Pool converting pages to format with convertPage, at most
+// one page per CPU core at a time.
+func New(format constant.ConversionFormat, convertPage PageFunc) *Pool {
+	return &Pool{
+		format:      format,
+		convertPage: convertPage,
+		guard:       make(chan struct{}, runtime.NumCPU()),
+	}
+}
+
+// ConvertChapter converts every page of chapter into its TempDir's output
+// directory and replaces the chapter's pages with the results, ordered by
+// page index and split part. Pages whose conversion did not save enough
+// space are swapped back for their source as opts asks.
+//
+// Cancelling ctx or a page failing outright fails the whole chapter. Pages
+// that were ignored are kept in their source format and their errors are
+// joined into the returned error, along with the converted chapter.
+func (pool *Pool) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+	// Validate TempDir is set to prevent writing to cwd
+	if chapter.TempDir == "" {
+		return nil, fmt.Errorf("chapter TempDir is empty, cannot create output directory")
+	}
+
+	// Create output directory for converted files
+	outputDir := filepath.Join(chapter.TempDir, "output")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Check for early context cancellation
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	// Spreads are split in the chapter's own reading direction unless one
+	// was given.
+	if opts.ReadingDirection == constant.ReadingDirectionAuto && chapter.IsRightToLeft() {
+		opts.ReadingDirection = constant.ReadingDirectionRTL
+	}
+
+	var totalPages atomic.Uint32
+	totalPages.Store(uint32(len(chapter.Pages)))
+
+	type pageResult struct {
+		pages []*manga.PageFile
+		err   error
+	}
+
+	results := make([]pageResult, len(chapter.Pages))
+	var wg sync.WaitGroup
+	var convertedCount atomic.Uint32
+	var keptCount atomic.Uint32
+	var grayscaleCount atomic.Uint32
+
+	for i, page := range chapter.Pages {
+		wg.Add(1)
+
+		go func(idx int, p *manga.PageFile) {
+			defer wg.Done()
+
+			// Check context before acquiring worker slot
+			select {
+			case <-ctx.Done():
+				results[idx] = pageResult{err: ctx.Err()}
+				return
+			case pool.guard <- struct{}{}:
+			}
+			defer func() { <-pool.guard }()
+
+			// Check context after acquiring worker slot
+			select {
+			case <-ctx.Done():
+				results[idx] = pageResult{err: ctx.Err()}
+				return
+			default:
+			}
+
+			pages, err := pool.convertPage(ctx, p, outputDir, opts)
+			if err == nil {
+				var kept bool
+				if pages, kept = keepSmallerPage(p, pages, opts); kept {
+					keptCount.Add(1)
+				}
+				if len(pages) > 0 && pages[0].IsGrayscale {
+					grayscaleCount.Add(1)
+				}
+			}
+			results[idx] = pageResult{pages: pages, err: err}
+
+			current := convertedCount.Add(1)
+			total := totalPages.Load()
+			progress(fmt.Sprintf("Converted %d/%d pages to %s format", current, total, pool.format), current, total)
+		}(i, page)
+	}
+
+	// Wait for completion or context cancellation
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Wait for in-flight goroutines to finish
+		<-done
+		return nil, ctx.Err()
+	}
+
+	// Collect results — separate fatal errors from page-ignored errors
+	var convertedPages []*manga.PageFile
+	var fatalErrors []error
+	var ignoredErrors []error
+
+	for _, result := range results {
+		if result.err != nil {
+			if errors.Is(result.err, context.DeadlineExceeded) || errors.Is(result.err, context.Canceled) {
+				return nil, result.err
+			}
+			var pageIgnored *converterrors.PageIgnoredError
+			if errors.As(result.err, &pageIgnored) {
+				ignoredErrors = append(ignoredErrors, result.err)
+			} else {
+				fatalErrors = append(fatalErrors, result.err)
+			}
+		}
+		if result.pages != nil {
+			convertedPages = append(convertedPages, result.pages...)
+		}
+	}
+
+	// Fatal errors take priority over ignored-page errors
+	if len(fatalErrors) > 0 {
+		return nil, errors.Join(fatalErrors...)
+	}
+
+	if len(convertedPages) == 0 {
+		if len(ignoredErrors) > 0 {
+			return nil, errors.Join(ignoredErrors...)
+		}
+		return nil, fmt.Errorf("no pages were converted")
+	}
+
+	// Sort pages by index and split part
+	sort.Slice(convertedPages, func(i, j int) bool {
+		a, b := convertedPages[i], convertedPages[j]
+		if a.Index == b.Index {
+			return a.SplitPartIndex < b.SplitPartIndex
+		}
+		return a.Index < b.Index
+	})
+
+	chapter.Pages = convertedPages
+	chapter.KeptOriginalPages = int(keptCount.Load())
+	chapter.GrayscalePages = int(grayscaleCount.Load())
+
+	var aggregatedError error
+	if len(ignoredErrors) > 0 {
+		aggregatedError = errors.Join(ignoredErrors...)
+	}
+
+	log.Debug().
+		Str("chapter", chapter.FilePath).
+		Int("converted_pages", len(convertedPages)).
+		Int("kept_original_pages", chapter.KeptOriginalPages).
+		Int("grayscale_pages", chapter.GrayscalePages).
+		Msg("Chapter conversion completed")
+
+	return chapter, aggregatedError
+}
+
+// keepSmallerPage returns the source page instead of its conversion when
+// opts asks to keep pages that did not shrink enough, removing the converted
+// file. Split pages always keep their parts: the source is too tall for the
+// format anyway. So do pages whose pixels the converter changed on purpose,
+// see manga.PageFile.IsModified: falling back would undo the resize, crop,
+// grayscale or quantization asked for.
+func keepSmallerPage(original *manga.PageFile, converted []*manga.PageFile, opts options.Conversion) ([]*manga.PageFile, bool) {
+	if !opts.KeepSmaller || len(converted) != 1 || converted[0] == original || converted[0].IsModified {
+		return converted, false
+	}
+	originalInfo, err := os.Stat(original.FilePath)
+	if err != nil {
+		return converted, false
+	}
+	convertedInfo, err := os.Stat(converted[0].FilePath)
+	if err != nil {
+		return converted, false
+	}
+	if !opts.KeepOriginal(originalInfo.Size(), convertedInfo.Size()) {
+		return converted, false
+	}
+
+	log.Debug().
+		Uint16("page_index", original.Index).
+		Int64("original_size", originalInfo.Size()).
+		Int64("converted_size", convertedInfo.Size()).
+		Msg("Conversion did not save enough space, keeping original")
+	_ = os.Remove(converted[0].FilePath)
+	return []*manga.PageFile{original}, true
+}
@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	converterrors "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestChapter(t *testing.T, pageCount int) *manga.Chapter {
+	t.Helper()
+	dir := t.TempDir()
+	chapter := &manga.Chapter{FilePath: filepath.Join(dir, "test.cbz"), TempDir: dir}
+	for i := range pageCount {
+		path := filepath.Join(dir, fmt.Sprintf("%04d.jpg", i))
+		require.NoError(t, os.WriteFile(path, []byte("page"), 0644))
+		chapter.Pages = append(chapter.Pages, &manga.PageFile{Index: uint16(i), Extension: ".jpg", FilePath: path})
+	}
+	return chapter
+}
+
+// convertTo writes each page to outputDir with the given extension, split in
+// two parts when split is set.
+func convertTo(ext string, split bool) PageFunc {
+	return func(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+		parts := 1
+		if split {
+			parts = 2
+		}
+		var pages []*manga.PageFile
+		for part := range parts {
+			path := filepath.Join(outputDir, fmt.Sprintf("%04d-%02d%s", page.Index, part, ext))
+			if err := os.WriteFile(path, []byte("converted"), 0644); err != nil {
+				return nil, err
+			}
+			pages = append(pages, &manga.PageFile{Index: page.Index, Extension: ext, FilePath: path, IsSplitted: split, SplitPartIndex: uint16(part)})
+		}
+		return pages, nil
+	}
+}
+
+func TestPool_ConvertChapter(t *testing.T) {
+	chapter := newTestChapter(t, 20)
+	pool := New(constant.WebP, convertTo(".webp", true))
+
+	var calls atomic.Uint32
+	convertedChapter, err := pool.ConvertChapter(context.Background(), chapter, options.Conversion{}, func(message string, current uint32, total uint32) {
+		calls.Add(1)
+		assert.Equal(t, uint32(20), total)
+		assert.Contains(t, message, "to webp format")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(20), calls.Load())
+
+	// Pages come back ordered by index, then split part.
+	require.Len(t, convertedChapter.Pages, 40)
+	for i, page := range convertedChapter.Pages {
+		assert.Equal(t, uint16(i/2), page.Index)
+		assert.Equal(t, uint16(i%2), page.SplitPartIndex)
+		assert.Equal(t, filepath.Join(chapter.TempDir, "output"), filepath.Dir(page.FilePath))
+	}
+}
+
+func TestPool_ConvertChapter_Errors(t *testing.T) {
+	failing := func(err error) PageFunc {
+		return func(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+			if page.Index == 1 {
+				return []*manga.PageFile{page}, err
+			}
+			return convertTo(".avif", false)(ctx, page, outputDir, opts)
+		}
+	}
+
+	t.Run("ignored pages are kept", func(t *testing.T) {
+		chapter := newTestChapter(t, 3)
+		convertedChapter, err := New(constant.AVIF, failing(converterrors.NewPageIgnored("page 1 ignored"))).
+			ConvertChapter(context.Background(), chapter, options.Conversion{}, func(string, uint32, uint32) {})
+		var pageIgnored *converterrors.PageIgnoredError
+		require.ErrorAs(t, err, &pageIgnored)
+		require.NotNil(t, convertedChapter)
+		require.Len(t, convertedChapter.Pages, 3)
+		assert.Equal(t, ".jpg", convertedChapter.Pages[1].Extension)
+	})
+
+	t.Run("fatal errors fail the chapter", func(t *testing.T) {
+		chapter := newTestChapter(t, 3)
+		convertedChapter, err := New(constant.AVIF, failing(errors.New("encoder crashed"))).
+			ConvertChapter(context.Background(), chapter, options.Conversion{}, func(string, uint32, uint32) {})
+		assert.ErrorContains(t, err, "encoder crashed")
+		assert.Nil(t, convertedChapter)
+	})
+
+	t.Run("no pages", func(t *testing.T) {
+		chapter := newTestChapter(t, 0)
+		_, err := New(constant.AVIF, convertTo(".avif", false)).
+			ConvertChapter(context.Background(), chapter, options.Conversion{}, func(string, uint32, uint32) {})
+		assert.EqualError(t, err, "no pages were converted")
+	})
+
+	t.Run("missing temp dir", func(t *testing.T) {
+		chapter := newTestChapter(t, 1)
+		chapter.TempDir = ""
+		_, err := New(constant.AVIF, convertTo(".avif", false)).
+			ConvertChapter(context.Background(), chapter, options.Conversion{}, func(string, uint32, uint32) {})
+		assert.Error(t, err)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		chapter := newTestChapter(t, 3)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := New(constant.AVIF, convertTo(".avif", false)).
+			ConvertChapter(ctx, chapter, options.Conversion{}, func(string, uint32, uint32) {})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestPool_ConvertChapter_ResolvesReadingDirection(t *testing.T) {
+	chapter := newTestChapter(t, 1)
+	chapter.ComicInfoXml = `<ComicInfo><Manga>YesAndRightToLeft</Manga></ComicInfo>`
+
+	var direction constant.ReadingDirection
+	pool := New(constant.JXL, func(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+		direction = opts.ReadingDirection
+		return []*manga.PageFile{page}, nil
+	})
+	_, err := pool.ConvertChapter(context.Background(), chapter, options.Conversion{}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	assert.Equal(t, constant.ReadingDirectionRTL, direction)
+}
+
+func TestKeepSmallerPage(t *testing.T) {
+	dir := t.TempDir()
+	writeSized := func(name string, size int) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0644))
+		return path
+	}
+
+	tests := []struct {
+		name          string
+		opts          options.Conversion
+		originalSize  int
+		convertedSize int
+		modified      bool
+		expectKept    bool
+	}{
+		{name: "disabled", opts: options.Conversion{}, originalSize: 100, convertedSize: 200, expectKept: false},
+		{name: "conversion larger", opts: options.Conversion{KeepSmaller: true}, originalSize: 100, convertedSize: 200, expectKept: true},
+		{name: "conversion smaller", opts: options.Conversion{KeepSmaller: true}, originalSize: 200, convertedSize: 100, expectKept: false},
+		{name: "saving below threshold", opts: options.Conversion{KeepSmaller: true, MinSavingsPercent: 20}, originalSize: 100, convertedSize: 90, expectKept: true},
+		{name: "modified page larger", opts: options.Conversion{KeepSmaller: true}, originalSize: 100, convertedSize: 200, modified: true, expectKept: false},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := &manga.PageFile{Index: uint16(i), Extension: ".png", FilePath: writeSized(fmt.Sprintf("%d.png", i), tt.originalSize)}
+			converted := &manga.PageFile{Index: uint16(i), Extension: ".webp", FilePath: writeSized(fmt.Sprintf("%d.webp", i), tt.convertedSize), IsModified: tt.modified}
+
+			pages, kept := keepSmallerPage(original, []*manga.PageFile{converted}, tt.opts)
+			assert.Equal(t, tt.expectKept, kept)
+			require.Len(t, pages, 1)
+
+			_, statErr := os.Stat(converted.FilePath)
+			if tt.expectKept {
+				assert.Same(t, original, pages[0])
+				assert.True(t, os.IsNotExist(statErr), "discarded conversion should be removed")
+			} else {
+				assert.Same(t, converted, pages[0])
+				assert.NoError(t, statErr)
+			}
+		})
+	}
+
+	t.Run("split pages are never replaced", func(t *testing.T) {
+		original := &manga.PageFile{Extension: ".png", FilePath: writeSized("tall.png", 10)}
+		parts := []*manga.PageFile{
+			{Extension: ".webp", FilePath: writeSized("tall-00.webp", 100), IsSplitted: true},
+			{Extension: ".webp", FilePath: writeSized("tall-01.webp", 100), IsSplitted: true, SplitPartIndex: 1},
+		}
+		pages, kept := keepSmallerPage(original, parts, options.Conversion{KeepSmaller: true})
+		assert.False(t, kept)
+		assert.Equal(t, parts, pages)
+	})
+}
@@ -0,0 +1,50 @@
+package webp
+
+import (
+	"image"
+	"os"
+
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
+	"github.com/belphemur/CBZOptimizer/v2/internal/webpenc"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+)
+
+// encodeNative encodes inputPath, or its crop region when set, with the
+// built-in encoder instead of cwebp. Unlike cwebp it decodes the image in
+// Go, then crops and resizes it in the same order cwebp does. Near-lossless
+// encodes losslessly, and the preset, which only tunes cwebp, is ignored.
+// Images over WebP's size limit fail like they do with cwebp, so pages are
+// split the same way with either encoder.
+func encodeNative(inputPath string, outputPath string, encoding Encoding, crop *image.Rectangle) error {
+	img, err := imaging.Decode(inputPath)
+	if err != nil {
+		return err
+	}
+	if crop != nil {
+		img = imaging.Crop(img, crop.Add(img.Bounds().Min))
+	}
+	if encoding.ResizeWidth > 0 && encoding.ResizeHeight > 0 {
+		img = imaging.Resize(img, encoding.ResizeWidth, encoding.ResizeHeight)
+	}
+
+	options := &webpenc.Options{
+		Lossless: encoding.Mode == constant.WebPLossless || encoding.Mode == constant.WebPNearLossless,
+		Quality:  int(min(encoding.Quality, 100)),
+	}
+	if encoding.KeepICC {
+		if metadata, err := imaging.ReadMetadata(inputPath); err == nil {
+			options.ICC = metadata.ICC
+		}
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := webpenc.Encode(f, img, options); err != nil {
+		_ = f.Close()
+		_ = os.Remove(outputPath)
+		return err
+	}
+	return f.Close()
+}
@@ -2,7 +2,6 @@ package webp
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"image"
 	_ "image/gif"
@@ -10,245 +9,289 @@ import (
 	_ "image/png"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sort"
 	"sync"
-	"sync/atomic"
 
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
 	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
 	converterrors "github.com/belphemur/CBZOptimizer/v2/pkg/converter/errors"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/pagefile"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/runner"
 	"github.com/rs/zerolog/log"
 	_ "golang.org/x/image/webp"
 )
 
 const webpMaxHeight = 16383
 
-// intermediatePageName returns the on-disk filename used for a page's WebP
-// intermediate during conversion. When the page carries an OriginalName
-// (recorded by --keep-filenames), its stem is reused so the temp file line
-// up with the name the archive writer will pick. Otherwise the historical
-// %04d indexed naming is kept. The splitSuffix argument is appended verbatim
-// after the stem (e.g. "-00", "-01") for split parts and is empty for the
-// happy-path single output. A leading dash is only added when both the
-// split suffix and the original-name stem are present, so the indexed form
-// stays as %04d-%02d.
-func intermediatePageName(page *manga.PageFile, splitSuffix string) string {
-	if page.OriginalName != "" {
-		stem := strings.TrimSuffix(page.OriginalName, filepath.Ext(page.OriginalName))
-		return stem + splitSuffix + ".webp"
-	}
-	if splitSuffix == "" {
-		return fmt.Sprintf("%04d.webp", page.Index)
-	}
-	return fmt.Sprintf("%04d%s.webp", page.Index, splitSuffix)
-}
-
 type Converter struct {
 	maxHeight  int
 	cropHeight int
 	isPrepared bool
-	// pageWorkerGuard limits concurrent cwebp processes across all chapters.
-	pageWorkerGuard chan struct{}
+	// cwebpErr is why cwebp could not be provisioned, in which case pages
+	// are encoded with the built-in encoder unless cwebp is required.
+	cwebpErr error
+	// pages converts the pages of chapters, running at most one cwebp
+	// process per CPU core across all of them.
+	pages *runner.Pool
 }
 
 func (converter *Converter) Format() constant.ConversionFormat {
 	return constant.WebP
 }
 
+// sliceHeight returns the height of the parts of a split page: the one set
+// in opts, or the converter's default.
+func (converter *Converter) sliceHeight(opts options.Conversion) int {
+	if opts.SliceHeight > 0 {
+		return opts.SliceHeight
+	}
+	return converter.cropHeight
+}
+
 func New() *Converter {
-	return &Converter{
-		maxHeight:       4000,
-		cropHeight:      2000,
-		isPrepared:      false,
-		pageWorkerGuard: make(chan struct{}, runtime.NumCPU()),
+	converter := &Converter{
+		maxHeight:  4000,
+		cropHeight: options.DefaultSliceHeight,
+		isPrepared: false,
 	}
+	converter.pages = runner.New(constant.WebP, converter.convertPage)
+	return converter
 }
 
+// fallbackWarning makes the built-in encoder fallback be logged once per
+// run, however many converters and chapters fall back.
+var fallbackWarning sync.Once
+
+// PrepareConverter provisions cwebp. A host where it cannot be, such as an
+// air-gapped one, is not an error: the failure is kept for ConvertChapter,
+// which then falls back to the built-in encoder. Use RequireCWebP to fail
+// instead.
 func (converter *Converter) PrepareConverter() error {
 	if converter.isPrepared {
 		return nil
 	}
-	err := PrepareEncoder()
-	if err != nil {
-		return err
+	if err := PrepareEncoder(); err != nil {
+		converter.cwebpErr = err
 	}
 	converter.isPrepared = true
 	return nil
 }
 
+// RequireCWebP provisions cwebp like PrepareConverter but returns an error
+// when it cannot be, for runs that must not fall back to the built-in
+// encoder (--webp-encoder cwebp).
+func (converter *Converter) RequireCWebP() error {
+	if err := converter.PrepareConverter(); err != nil {
+		return err
+	}
+	if converter.cwebpErr != nil {
+		return fmt.Errorf("cwebp is not available: %w", converter.cwebpErr)
+	}
+	return nil
+}
+
 // ConvertChapter converts all pages in a chapter using file-to-file cwebp operations.
 // In the happy path, no image data is loaded into Go memory.
 // Splitting is attempted only if direct conversion fails due to dimension limits.
-func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, quality uint8, split bool, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
+func (converter *Converter) ConvertChapter(ctx context.Context, chapter *manga.Chapter, opts options.Conversion, progress func(message string, current uint32, total uint32)) (*manga.Chapter, error) {
 	log.Debug().
 		Str("chapter", chapter.FilePath).
 		Int("pages", len(chapter.Pages)).
-		Uint8("quality", quality).
-		Bool("split", split).
+		Uint8("quality", opts.Quality).
+		Bool("split", opts.Split).
+		Str("webp_mode", opts.WebPMode.String()).
+		Float64("target_ssim", opts.TargetSSIM).
+		Str("webp_encoder", opts.WebPEncoder.String()).
 		Msg("Starting file-to-file chapter conversion")
 
-	err := converter.PrepareConverter()
-	if err != nil {
-		return nil, err
+	// cwebp is only provisioned when it may be used.
+	switch opts.WebPEncoder {
+	case constant.WebPEncoderCWebP:
+		if err := converter.RequireCWebP(); err != nil {
+			return nil, err
+		}
+	case constant.WebPEncoderAuto:
+		if err := converter.PrepareConverter(); err != nil {
+			return nil, err
+		}
+		if converter.cwebpErr != nil {
+			cwebpErr := converter.cwebpErr
+			fallbackWarning.Do(func() {
+				log.Warn().Err(cwebpErr).Msg("cwebp is not available, WebP pages will be encoded with the built-in encoder")
+			})
+			opts.WebPEncoder = constant.WebPEncoderNative
+		}
 	}
 
-	// Validate TempDir is set to prevent writing to cwd
-	if chapter.TempDir == "" {
-		return nil, fmt.Errorf("chapter TempDir is empty, cannot create output directory")
-	}
+	return converter.pages.ConvertChapter(ctx, chapter, opts, progress)
+}
 
-	// Create output directory for converted files
-	outputDir := filepath.Join(chapter.TempDir, "output")
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create output directory: %w", err)
+// convertPage converts page for the chapter runner, normalized first when
+// it needs to be, see pagefile.Normalize. Animated GIFs are not, unless
+// they are to be flattened: staging would keep only their first frame.
+func (converter *Converter) convertPage(ctx context.Context, page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+	animated := !opts.FlattenAnimations && strings.ToLower(page.Extension) == ".gif" && imaging.IsAnimatedGIF(page.FilePath)
+	source, cleanup := page, func() {}
+	if !animated {
+		source, cleanup = pagefile.Normalize(page, outputDir, ".webp", opts)
 	}
-
-	// Check for early context cancellation
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
+	defer cleanup()
+	pages, err := converter.convertPageFile(ctx, source, outputDir, animated, opts)
+	// A page kept in its source format keeps its original file, and the
+	// others were changed by the normalization when there was one.
+	for i := range pages {
+		if pages[i] == source {
+			pages[i] = page
+		} else if source != page {
+			pages[i].IsModified = true
+		}
 	}
+	return pages, err
+}
 
-	guard := converter.pageWorkerGuard
-	var totalPages atomic.Uint32
-	totalPages.Store(uint32(len(chapter.Pages)))
+// convertPageFile converts a single page file to WebP format.
+// Returns the converted page(s) — multiple if splitting was needed.
+// animated tells that page is an animated GIF to keep animated.
+func (converter *Converter) convertPageFile(ctx context.Context, page *manga.PageFile, outputDir string, animated bool, opts options.Conversion) ([]*manga.PageFile, error) {
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("input", page.FilePath).
+		Msg("Converting page file")
 
-	type pageResult struct {
-		pages []*manga.PageFile
-		err   error
+	// If the page is already WebP, just return it as-is. The returned page
+	// keeps any OriginalName set during extraction so the archive writer can
+	// honor --keep-filenames for the final entry name.
+	if strings.ToLower(page.Extension) == ".webp" {
+		log.Debug().Uint16("page_index", page.Index).Msg("Page already WebP, skipping")
+		return []*manga.PageFile{page}, nil
 	}
 
-	results := make([]pageResult, len(chapter.Pages))
-	var wg sync.WaitGroup
-	var convertedCount atomic.Uint32
-
-	for i, page := range chapter.Pages {
-		wg.Add(1)
-
-		go func(idx int, p *manga.PageFile) {
-			defer wg.Done()
-
-			// Check context before acquiring worker slot
-			select {
-			case <-ctx.Done():
-				results[idx] = pageResult{err: ctx.Err()}
-				return
-			case guard <- struct{}{}:
-			}
-			defer func() { <-guard }()
-
-			// Check context after acquiring worker slot
-			select {
-			case <-ctx.Done():
-				results[idx] = pageResult{err: ctx.Err()}
-				return
-			default:
-			}
-
-			pages, err := converter.convertPageFile(ctx, p, outputDir, quality, split)
-			results[idx] = pageResult{pages: pages, err: err}
-
-			current := convertedCount.Add(1)
-			total := totalPages.Load()
-			progress(fmt.Sprintf("Converted %d/%d pages to %s format", current, total, converter.Format()), current, total)
-		}(i, page)
+	// cwebp only reads the first frame of a GIF, so animated ones go
+	// through gif2webp.
+	if animated {
+		return convertAnimation(page, outputDir, opts)
 	}
 
-	// Wait for completion or context cancellation
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-	case <-ctx.Done():
-		// Wait for in-flight goroutines to finish
-		<-done
-		return nil, ctx.Err()
+	// Grayscale pages are staged as a gray PNG that cwebp then reads in
+	// place of the source, so cropping and resizing still happen in cwebp.
+	inputPath := page.FilePath
+	grayscale := opts.Grayscale
+	var decoded image.Image
+	if opts.DetectGrayscale && !grayscale {
+		decoded, grayscale = pagefile.DetectGrayscale(page, opts.GrayscaleTolerance)
 	}
-
-	// Collect results — separate fatal errors from page-ignored errors
-	var convertedPages []*manga.PageFile
-	var fatalErrors []error
-	var ignoredErrors []error
-
-	for _, result := range results {
-		if result.err != nil {
-			if errors.Is(result.err, context.DeadlineExceeded) || errors.Is(result.err, context.Canceled) {
-				return nil, result.err
-			}
-			var pageIgnored *converterrors.PageIgnoredError
-			if errors.As(result.err, &pageIgnored) {
-				ignoredErrors = append(ignoredErrors, result.err)
-			} else {
-				fatalErrors = append(fatalErrors, result.err)
-			}
-		}
-		if result.pages != nil {
-			convertedPages = append(convertedPages, result.pages...)
+	// Only the border detection decodes the page: cwebp does the cropping.
+	var region *image.Rectangle
+	if opts.AutoCrop {
+		decoded, region = pagefile.DetectBorders(decoded, page, opts)
+	}
+	if grayscale && !opts.Quantizes() {
+		grayPath, err := stageGrayscale(decoded, page, outputDir)
+		if err != nil {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode image, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
 		}
+		defer func() { _ = os.Remove(grayPath) }()
+		inputPath = grayPath
 	}
 
-	// Fatal errors take priority over ignored-page errors
-	if len(fatalErrors) > 0 {
-		return nil, errors.Join(fatalErrors...)
+	enc := pageEncoding{
+		Encoding: Encoding{
+			Quality:           uint(opts.Quality),
+			Mode:              opts.WebPMode,
+			NearLosslessLevel: opts.NearLosslessLevel,
+			KeepICC:           opts.KeepICC,
+			Native:            opts.WebPEncoder == constant.WebPEncoderNative,
+		},
+		tryLossless: opts.WebPMode == constant.WebPAuto && isPaletteLikePage(page),
+		targetSSIM:  opts.TargetSSIM,
+		minQuality:  uint(opts.MinQuality),
+		maxQuality:  uint(opts.MaxQuality),
+	}
+	if opts.ContentAware {
+		decoded = classifyPage(decoded, page, region, grayscale, &enc)
 	}
 
-	if len(convertedPages) == 0 {
-		if len(ignoredErrors) > 0 {
-			return nil, errors.Join(ignoredErrors...)
+	// Quantized pages are cropped and resized in Go before being dithered,
+	// as cwebp resizing them afterwards would blur the dithering back into
+	// gray. The few gray levels left usually compress best losslessly.
+	if opts.Quantizes() {
+		quantizedPath, quantized, err := stageQuantized(decoded, page, region, outputDir, opts)
+		if err != nil {
+			log.Info().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode image, keeping original")
+			return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+				fmt.Sprintf("page %d: failed to decode image (%s)", page.Index, err.Error()))
 		}
-		return nil, fmt.Errorf("no pages were converted")
+		defer func() { _ = os.Remove(quantizedPath) }()
+		inputPath, decoded, region, grayscale = quantizedPath, quantized, nil, true
+		enc.tryLossless = enc.Mode == constant.WebPLossy || enc.Mode == constant.WebPAuto
 	}
 
-	// Sort pages by index and split part
-	sort.Slice(convertedPages, func(i, j int) bool {
-		a, b := convertedPages[i], convertedPages[j]
-		if a.Index == b.Index {
-			return a.SplitPartIndex < b.SplitPartIndex
+	// A double-page spread is cut into its halves, each then cropped and
+	// resized by cwebp like a page of its own.
+	if opts.SplitSpreads {
+		bounds, err := pageBounds(inputPath, region)
+		if err == nil && opts.IsSpread(bounds.Dx(), bounds.Dy()) {
+			pages, err := converter.splitSpread(ctx, page, inputPath, outputDir, enc, bounds, opts)
+			for _, part := range pages {
+				part.IsGrayscale = grayscale
+			}
+			return pages, err
 		}
-		return a.Index < b.Index
-	})
-
-	chapter.Pages = convertedPages
-
-	var aggregatedError error
-	if len(ignoredErrors) > 0 {
-		aggregatedError = errors.Join(ignoredErrors...)
 	}
 
-	log.Debug().
-		Str("chapter", chapter.FilePath).
-		Int("converted_pages", len(convertedPages)).
-		Msg("Chapter conversion completed")
-
-	return chapter, aggregatedError
-}
-
-// convertPageFile converts a single page file to WebP format.
-// Returns the converted page(s) — multiple if splitting was needed.
-func (converter *Converter) convertPageFile(ctx context.Context, page *manga.PageFile, outputDir string, quality uint8, split bool) ([]*manga.PageFile, error) {
-	log.Debug().
-		Uint16("page_index", page.Index).
-		Str("input", page.FilePath).
-		Msg("Converting page file")
+	// Resize limits need the page size up front. Reading the header is cheap
+	// and cwebp still does the resize file-to-file. cwebp crops before
+	// resizing, so a cropped page is fitted by its cropped size.
+	if opts.Resizes() {
+		width, height, err := imaging.Dimensions(inputPath)
+		if region != nil {
+			width, height, err = region.Dx(), region.Dy(), nil
+		}
+		if err == nil {
+			if fitWidth, fitHeight, resize := opts.FitSize(width, height); resize {
+				log.Debug().
+					Uint16("page_index", page.Index).
+					Int("width", width).
+					Int("height", height).
+					Int("resize_width", fitWidth).
+					Int("resize_height", fitHeight).
+					Msg("Downscaling page")
+				enc.ResizeWidth, enc.ResizeHeight = fitWidth, fitHeight
+			}
+		}
+	}
 
-	// If the page is already WebP, just return it as-is. The returned page
-	// keeps any OriginalName set during extraction so the archive writer can
-	// honor --keep-filenames for the final entry name.
-	if strings.ToLower(page.Extension) == ".webp" {
-		log.Debug().Uint16("page_index", page.Index).Msg("Page already WebP, skipping")
-		return []*manga.PageFile{page}, nil
+	// Pages above the configured split height are split up front, even when
+	// WebP could store them whole.
+	if opts.Split && opts.SplitHeight > 0 {
+		if bounds, err := pageBounds(inputPath, region); err == nil {
+			outputHeight := bounds.Dy()
+			if enc.ResizeHeight > 0 {
+				outputHeight = enc.ResizeHeight
+			}
+			if opts.SplitsHeight(outputHeight) {
+				pages, err := converter.splitAndConvert(ctx, page, inputPath, decoded, outputDir, enc, bounds, opts)
+				for _, part := range pages {
+					part.IsGrayscale = grayscale
+				}
+				return pages, err
+			}
+		}
 	}
 
 	// Try direct file-to-file conversion first (happy path — no memory allocation)
-	outputPath := filepath.Join(outputDir, intermediatePageName(page, ""))
-	err := EncodeFile(page.FilePath, outputPath, uint(quality))
+	outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".webp"))
+	err := encodeSmallest(inputPath, outputPath, region, enc)
 
 	if err == nil {
 		// Success! No image decoding needed. Preserve OriginalName so
@@ -258,6 +301,8 @@ func (converter *Converter) convertPageFile(ctx context.Context, page *manga.Pag
 			Extension:    ".webp",
 			FilePath:     outputPath,
 			OriginalName: page.OriginalName,
+			IsGrayscale:  grayscale,
+			IsModified:   region != nil || enc.ResizeWidth > 0 || opts.Quantizes() || pagefile.Grayscaled(page, grayscale),
 		}}, nil
 	}
 
@@ -268,7 +313,7 @@ func (converter *Converter) convertPageFile(ctx context.Context, page *manga.Pag
 		Msg("Direct conversion failed, checking dimensions")
 
 	// Read just the image header to get dimensions (no full decode)
-	width, height, decodeErr := getImageDimensions(page.FilePath)
+	width, height, decodeErr := imaging.Dimensions(inputPath)
 	if decodeErr != nil {
 		// Can't even read the image header — keep the original file
 		log.Info().
@@ -285,19 +330,33 @@ func (converter *Converter) convertPageFile(ctx context.Context, page *manga.Pag
 		Int("height", height).
 		Msg("Image dimensions read")
 
+	// The limits apply to the page as encoded, i.e. after any crop and resize.
+	bounds := image.Rect(0, 0, width, height)
+	if region != nil {
+		bounds = *region
+	}
+	outputHeight := bounds.Dy()
+	if enc.ResizeHeight > 0 {
+		outputHeight = enc.ResizeHeight
+	}
+
 	// If height exceeds WebP max and split is not enabled, keep original
-	if height >= webpMaxHeight && !split {
+	if outputHeight >= webpMaxHeight && !opts.Split {
 		log.Info().
 			Uint16("page_index", page.Index).
-			Int("height", height).
+			Int("height", outputHeight).
 			Msg("Page too tall for WebP, keeping original")
 		return []*manga.PageFile{page}, converterrors.NewPageIgnored(
 			fmt.Sprintf("page %d is too tall [max: %dpx] to be converted to webp format", page.Index, webpMaxHeight))
 	}
 
 	// If height exceeds our split threshold and split is enabled, use cwebp -crop
-	if height >= converter.maxHeight && split {
-		return converter.splitAndConvert(ctx, page, outputDir, quality, width, height)
+	if outputHeight >= converter.maxHeight && opts.Split {
+		pages, err := converter.splitAndConvert(ctx, page, inputPath, decoded, outputDir, enc, bounds, opts)
+		for _, part := range pages {
+			part.IsGrayscale = grayscale
+		}
+		return pages, err
 	}
 
 	// Height is within limits but conversion still failed for another reason.
@@ -310,38 +369,76 @@ func (converter *Converter) convertPageFile(ctx context.Context, page *manga.Pag
 		fmt.Sprintf("page %d: conversion failed (%s)", page.Index, err.Error()))
 }
 
-// splitAndConvert splits a tall image into multiple parts using cwebp -crop
-// and converts each part. No Go-side image decode is needed.
-func (converter *Converter) splitAndConvert(ctx context.Context, page *manga.PageFile, outputDir string, quality uint8, width, height int) ([]*manga.PageFile, error) {
+// splitAndConvert splits the bounds region of a tall image into multiple
+// parts using cwebp -crop and converts each part. inputPath is the file
+// actually encoded: page.FilePath, or its grayscale staging copy.
+//
+// Parts are cut from the page as it will be encoded: when the page is also
+// resized, each part's region is mapped back to source coordinates for
+// -crop and cwebp resizes it to the part's size, so slicing happens after
+// resizing. The cuts are moved to the gutters between panels when there
+// are some nearby, which needs the page decoded: decoded is reused when the
+// page already was, and a page Go cannot decode is cut at fixed heights.
+// Every part after the first also repeats the last opts.SliceOverlap rows of
+// the one before.
+func (converter *Converter) splitAndConvert(ctx context.Context, page *manga.PageFile, inputPath string, decoded image.Image, outputDir string, enc pageEncoding, bounds image.Rectangle, opts options.Conversion) ([]*manga.PageFile, error) {
+	width, height := bounds.Dx(), bounds.Dy()
 	log.Debug().
 		Uint16("page_index", page.Index).
 		Int("width", width).
 		Int("height", height).
-		Int("crop_height", converter.cropHeight).
+		Int("crop_height", converter.sliceHeight(opts)).
+		Int("overlap", opts.SliceOverlap).
 		Msg("Splitting and converting page using cwebp -crop")
 
-	numParts := height / converter.cropHeight
-	if height%converter.cropHeight != 0 {
-		numParts++
+	outputWidth, outputHeight := width, height
+	if enc.ResizeWidth > 0 && enc.ResizeHeight > 0 {
+		outputWidth, outputHeight = enc.ResizeWidth, enc.ResizeHeight
+	}
+
+	sliceHeight := converter.sliceHeight(opts) * height / outputHeight
+	overlap := opts.SliceOverlap * height / outputHeight
+	img := decoded
+	if img == nil {
+		var err error
+		if img, err = imaging.Decode(inputPath); err != nil {
+			log.Debug().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode page to find gutters, cutting at fixed heights")
+		}
+	}
+	var cuts []int
+	if img != nil {
+		cuts = imaging.SliceRows(imaging.Crop(img, bounds), sliceHeight)
+	} else {
+		cuts = imaging.FixedSliceRows(bounds.Min.Y, bounds.Max.Y, sliceHeight)
+	}
+	// outputRow maps a source row to the matching row of the resized page.
+	outputRow := func(y int) int {
+		return (y - bounds.Min.Y) * outputHeight / height
 	}
 
 	var pages []*manga.PageFile
 
-	for i := 0; i < numParts; i++ {
+	for i := 0; i < len(cuts)-1; i++ {
 		select {
 		case <-ctx.Done():
 			return pages, ctx.Err()
 		default:
 		}
 
-		yOffset := i * converter.cropHeight
-		partHeight := converter.cropHeight
-		if i == numParts-1 {
-			partHeight = height - yOffset
+		outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, fmt.Sprintf("-%02d", i), ".webp"))
+		top := cuts[i]
+		if i > 0 {
+			top = max(top-overlap, bounds.Min.Y)
 		}
-
-		outputPath := filepath.Join(outputDir, intermediatePageName(page, fmt.Sprintf("-%02d", i)))
-		err := EncodeFileWithCrop(page.FilePath, outputPath, uint(quality), 0, yOffset, width, partHeight)
+		crop := image.Rect(bounds.Min.X, top, bounds.Max.X, cuts[i+1])
+		partEnc := enc
+		if outputWidth != width || outputHeight != height {
+			partEnc.ResizeWidth, partEnc.ResizeHeight = outputWidth, outputRow(cuts[i+1])-outputRow(top)
+		}
+		err := encodeSmallest(inputPath, outputPath, &crop, partEnc)
 
 		if err != nil {
 			log.Error().
@@ -370,19 +467,395 @@ func (converter *Converter) splitAndConvert(ctx context.Context, page *manga.Pag
 	return pages, nil
 }
 
-// getImageDimensions reads only the image header to determine dimensions.
-// This is much cheaper than a full image.Decode — only a few bytes are read.
-func getImageDimensions(filePath string) (width, height int, err error) {
-	f, err := os.Open(filePath)
+// splitSpread converts the halves of the double-page spread at bounds as
+// separate parts, in the reading order of opts, preceded by the whole spread
+// when opts.KeepSpreads is set. Like splitAndConvert it only drives cwebp
+// -crop; each part is fitted to the resize limits on its own.
+func (converter *Converter) splitSpread(ctx context.Context, page *manga.PageFile, inputPath string, outputDir string, enc pageEncoding, bounds image.Rectangle, opts options.Conversion) ([]*manga.PageFile, error) {
+	regions := imaging.SpreadHalves(bounds, opts.ReadingDirection == constant.ReadingDirectionRTL)
+	if opts.KeepSpreads {
+		regions = append([]image.Rectangle{bounds}, regions...)
+	}
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("width", bounds.Dx()).
+		Int("height", bounds.Dy()).
+		Str("reading_direction", opts.ReadingDirection.String()).
+		Int("parts", len(regions)).
+		Msg("Splitting double-page spread")
+
+	var pages []*manga.PageFile
+	for i, region := range regions {
+		select {
+		case <-ctx.Done():
+			return pages, ctx.Err()
+		default:
+		}
+
+		partEnc := enc
+		partEnc.ResizeWidth, partEnc.ResizeHeight = 0, 0
+		if fitWidth, fitHeight, resize := opts.FitSize(region.Dx(), region.Dy()); resize {
+			partEnc.ResizeWidth, partEnc.ResizeHeight = fitWidth, fitHeight
+		}
+
+		outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, fmt.Sprintf("-%02d", i), ".webp"))
+		if err := encodeSmallest(inputPath, outputPath, &region, partEnc); err != nil {
+			log.Error().
+				Uint16("page_index", page.Index).
+				Int("part", i).
+				Err(err).
+				Msg("Failed to convert spread part")
+			return nil, fmt.Errorf("failed to convert spread part %d of page %d: %w", i, page.Index, err)
+		}
+
+		pages = append(pages, &manga.PageFile{
+			Index:          page.Index,
+			Extension:      ".webp",
+			FilePath:       outputPath,
+			IsSplitted:     true,
+			SplitPartIndex: uint16(i),
+			OriginalName:   page.OriginalName,
+		})
+	}
+	return pages, nil
+}
+
+// pageBounds returns the region of the page at filePath that is encoded:
+// the border crop when there is one, the whole page otherwise.
+func pageBounds(filePath string, region *image.Rectangle) (image.Rectangle, error) {
+	if region != nil {
+		return *region, nil
+	}
+	width, height, err := imaging.Dimensions(filePath)
 	if err != nil {
-		return 0, 0, err
+		return image.Rectangle{}, err
+	}
+	return image.Rect(0, 0, width, height), nil
+}
+
+// convertAnimation converts the animated GIF page to an animated WebP with
+// gif2webp. Animations are not cropped, resized or made grayscale. The GIF
+// is kept when gif2webp is not installed or does not make it smaller.
+func convertAnimation(page *manga.PageFile, outputDir string, opts options.Conversion) ([]*manga.PageFile, error) {
+	outputPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".webp"))
+	encoding := Encoding{Quality: uint(opts.Quality), Mode: opts.WebPMode}
+	if err := EncodeAnimation(page.FilePath, outputPath, encoding); err != nil {
+		_ = os.Remove(outputPath)
+		log.Info().
+			Uint16("page_index", page.Index).
+			Err(err).
+			Msg("Cannot convert animated GIF, keeping original")
+		return []*manga.PageFile{page}, converterrors.NewPageIgnored(
+			fmt.Sprintf("page %d: animated GIF conversion failed (%s)", page.Index, err.Error()))
+	}
+
+	originalInfo, originalErr := os.Stat(page.FilePath)
+	convertedInfo, convertedErr := os.Stat(outputPath)
+	if originalErr == nil && convertedErr == nil && convertedInfo.Size() >= originalInfo.Size() {
+		log.Debug().
+			Uint16("page_index", page.Index).
+			Int64("original_size", originalInfo.Size()).
+			Int64("converted_size", convertedInfo.Size()).
+			Msg("Animated WebP is not smaller, keeping original GIF")
+		_ = os.Remove(outputPath)
+		return []*manga.PageFile{page}, nil
+	}
+
+	log.Debug().Uint16("page_index", page.Index).Msg("Converted animated GIF to animated WebP")
+	return []*manga.PageFile{{
+		Index:        page.Index,
+		Extension:    ".webp",
+		FilePath:     outputPath,
+		OriginalName: page.OriginalName,
+	}}, nil
+}
+
+// contentPresets and contentQualityOffsets are the cwebp preset and the
+// change to the requested quality used for each kind of page content:
+// flat line art hides compression well and photographic color does not.
+var (
+	contentPresets = map[imaging.Content]string{
+		imaging.ContentDrawing: "drawing",
+		imaging.ContentText:    "text",
+		imaging.ContentPhoto:   "photo",
+	}
+	contentQualityOffsets = map[imaging.Content]int{
+		imaging.ContentDrawing: -10,
+		imaging.ContentText:    0,
+		imaging.ContentPhoto:   10,
+	}
+)
+
+// classifyPage adapts enc to the content of page (its cropped region when
+// set), see imaging.ClassifyContent, and returns the decoded page for reuse.
+// Grayscale pages are classified without their color. Pages Go cannot
+// decode keep the plain settings.
+func classifyPage(decoded image.Image, page *manga.PageFile, region *image.Rectangle, grayscale bool, enc *pageEncoding) image.Image {
+	if decoded == nil {
+		var err error
+		if decoded, err = imaging.Decode(page.FilePath); err != nil {
+			log.Debug().
+				Uint16("page_index", page.Index).
+				Err(err).
+				Msg("Cannot decode page, skipping content classification")
+			return nil
+		}
+	}
+	img := decoded
+	if region != nil {
+		img = imaging.Crop(img, *region)
+	}
+	if grayscale {
+		img = imaging.Luma(img)
 	}
-	defer func() { _ = f.Close() }()
 
-	config, _, err := image.DecodeConfig(f)
+	content, stats := imaging.ClassifyContent(img)
+	enc.Preset = contentPresets[content]
+	quality := int(enc.Quality) + contentQualityOffsets[content]
+	enc.Quality = uint(min(max(quality, 0), 100))
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Str("content", content.String()).
+		Float64("edge_ratio", stats.EdgeRatio).
+		Float64("soft_ratio", stats.SoftRatio).
+		Float64("light_ratio", stats.LightRatio).
+		Float64("midtone_ratio", stats.MidtoneRatio).
+		Float64("colorfulness", stats.Colorfulness).
+		Str("preset", enc.Preset).
+		Uint("quality", enc.Quality).
+		Msg("Page content classified")
+	return decoded
+}
+
+// stageGrayscale writes the luma plane of page as a PNG in outputDir and
+// returns the path of that file. img is the already decoded page, or nil to
+// decode it here.
+func stageGrayscale(img image.Image, page *manga.PageFile, outputDir string) (string, error) {
+	if img == nil {
+		var err error
+		if img, err = imaging.Decode(page.FilePath); err != nil {
+			return "", err
+		}
+	}
+	grayPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".webp")+".gray.png")
+	if err := imaging.WritePNG(imaging.Luma(img), grayPath); err != nil {
+		return "", err
+	}
+	return grayPath, nil
+}
+
+// stageQuantized writes page, cropped to region when set and fitted to the
+// resize limits, as a PNG quantized to opts.GrayLevels gray levels in
+// outputDir. It returns the path of that file and the quantized image. img
+// is the already decoded page, or nil to decode it here. Spreads to split
+// are not resized: each half is fitted on its own afterwards.
+func stageQuantized(img image.Image, page *manga.PageFile, region *image.Rectangle, outputDir string, opts options.Conversion) (string, *image.Gray, error) {
+	if img == nil {
+		var err error
+		if img, err = imaging.Decode(page.FilePath); err != nil {
+			return "", nil, err
+		}
+	}
+	if region != nil {
+		img = imaging.Crop(img, *region)
+	}
+	bounds := img.Bounds()
+	if fitWidth, fitHeight, resize := opts.FitSize(bounds.Dx(), bounds.Dy()); resize && !opts.IsSpread(bounds.Dx(), bounds.Dy()) {
+		img = imaging.Resize(img, fitWidth, fitHeight)
+	}
+	quantized := pagefile.Quantize(img, opts)
+	log.Debug().
+		Uint16("page_index", page.Index).
+		Int("gray_levels", opts.GrayLevels).
+		Str("dither", opts.Dither.String()).
+		Msg("Quantized page")
+
+	quantizedPath := filepath.Join(outputDir, pagefile.IntermediateName(page, "", ".webp")+".quantized.png")
+	if err := imaging.WritePNG(quantized, quantizedPath); err != nil {
+		return "", nil, err
+	}
+	return quantizedPath, quantized, nil
+}
+
+// pageEncoding describes how encodeSmallest encodes a page or split part.
+type pageEncoding struct {
+	Encoding
+	// tryLossless also encodes a lossless candidate and keeps the smaller file.
+	tryLossless bool
+	// targetSSIM, when above 0, replaces the fixed quality of lossy encodes
+	// by a search between minQuality and maxQuality, see encodeToTarget.
+	targetSSIM float64
+	minQuality uint
+	maxQuality uint
+}
+
+// encodeSmallest encodes inputPath (or its crop region, when set) to
+// outputPath. When tryLossless is set, a lossless candidate is encoded as
+// well and whichever file is smaller is kept at outputPath. A failing
+// lossless attempt is not an error: the lossy output is already in place.
+func encodeSmallest(inputPath string, outputPath string, crop *image.Rectangle, enc pageEncoding) error {
+	var err error
+	if enc.targetSSIM > 0 && enc.Mode != constant.WebPLossless && enc.Mode != constant.WebPNearLossless {
+		err = encodeToTarget(inputPath, outputPath, crop, enc)
+	} else {
+		err = encodeRegion(inputPath, outputPath, enc.Encoding, crop)
+	}
 	if err != nil {
-		return 0, 0, err
+		return err
+	}
+	if !enc.tryLossless {
+		return nil
+	}
+
+	lossless := enc.Encoding
+	lossless.Mode = constant.WebPLossless
+	candidatePath := outputPath + ".lossless"
+	defer func() { _ = os.Remove(candidatePath) }()
+
+	if err := encodeRegion(inputPath, candidatePath, lossless, crop); err != nil {
+		log.Debug().Str("input", inputPath).Err(err).Msg("Lossless attempt failed, keeping lossy output")
+		return nil
 	}
 
-	return config.Width, config.Height, nil
+	lossyInfo, err := os.Stat(outputPath)
+	if err != nil {
+		return err
+	}
+	losslessInfo, err := os.Stat(candidatePath)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().
+		Str("input", inputPath).
+		Int64("lossy_size", lossyInfo.Size()).
+		Int64("lossless_size", losslessInfo.Size()).
+		Msg("Compared lossy and lossless output")
+
+	if losslessInfo.Size() < lossyInfo.Size() {
+		return os.Rename(candidatePath, outputPath)
+	}
+	return nil
+}
+
+// encodeToTarget binary-searches the lowest quality in [minQuality,
+// maxQuality] whose output reaches targetSSIM against the source and leaves
+// that output at outputPath. When even maxQuality misses the target, the
+// maxQuality output is kept. Unlike the fixed-quality path this decodes the
+// source and every candidate in Go; if the source cannot be decoded the page
+// falls back to the fixed quality.
+func encodeToTarget(inputPath string, outputPath string, crop *image.Rectangle, enc pageEncoding) error {
+	if enc.minQuality > enc.maxQuality {
+		return fmt.Errorf("invalid quality range [%d, %d]", enc.minQuality, enc.maxQuality)
+	}
+
+	candidatePath := outputPath + ".candidate"
+	defer func() { _ = os.Remove(candidatePath) }()
+
+	var reference *image.Gray
+	found := false
+	low, high := enc.minQuality, enc.maxQuality
+	for low <= high {
+		quality := low + (high-low)/2
+		candidate := enc.Encoding
+		candidate.Quality = quality
+		if err := encodeRegion(inputPath, candidatePath, candidate, crop); err != nil {
+			return err
+		}
+
+		// The source is only decoded once cwebp accepted it, so pages too
+		// tall for WebP still fail fast and get split by the caller.
+		if reference == nil {
+			var err error
+			reference, err = referenceLuma(inputPath, crop, enc.Encoding)
+			if err != nil {
+				log.Debug().Str("input", inputPath).Err(err).Msg("Cannot decode source for SSIM, using fixed quality")
+				return encodeRegion(inputPath, outputPath, enc.Encoding, crop)
+			}
+		}
+
+		encoded, err := imaging.DecodeWebPLuma(candidatePath)
+		if err != nil {
+			return err
+		}
+		score, err := imaging.SSIM(reference, encoded)
+		if err != nil {
+			return err
+		}
+
+		log.Trace().
+			Str("input", inputPath).
+			Uint("quality", quality).
+			Float64("ssim", score).
+			Msg("Quality search step")
+
+		if score >= enc.targetSSIM {
+			if err := os.Rename(candidatePath, outputPath); err != nil {
+				return err
+			}
+			found = true
+			if quality == 0 {
+				break
+			}
+			high = quality - 1
+		} else {
+			low = quality + 1
+		}
+
+		if !found && low > enc.maxQuality {
+			// maxQuality itself missed the target: keep it anyway.
+			log.Debug().
+				Str("input", inputPath).
+				Float64("ssim", score).
+				Float64("target_ssim", enc.targetSSIM).
+				Msg("Target SSIM not reached, using max quality")
+			return os.Rename(candidatePath, outputPath)
+		}
+	}
+
+	log.Debug().
+		Str("input", inputPath).
+		Uint("quality", low).
+		Float64("target_ssim", enc.targetSSIM).
+		Msg("Quality search completed")
+	return nil
+}
+
+// referenceLuma decodes the source (or its crop region) for encodeToTarget,
+// resized like cwebp will when encoding sets a resize.
+func referenceLuma(inputPath string, crop *image.Rectangle, encoding Encoding) (*image.Gray, error) {
+	img, err := imaging.Decode(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if crop != nil {
+		bounds := img.Bounds()
+		img = imaging.Crop(img, crop.Add(bounds.Min))
+	}
+	if encoding.ResizeWidth > 0 && encoding.ResizeHeight > 0 {
+		img = imaging.Resize(img, encoding.ResizeWidth, encoding.ResizeHeight)
+	}
+	return imaging.Luma(img), nil
+}
+
+func encodeRegion(inputPath string, outputPath string, encoding Encoding, crop *image.Rectangle) error {
+	if crop == nil {
+		return EncodeFile(inputPath, outputPath, encoding)
+	}
+	return EncodeFileWithCrop(inputPath, outputPath, encoding, crop.Min.X, crop.Min.Y, crop.Dx(), crop.Dy())
+}
+
+// isPaletteLikePage reports whether a page is worth a lossless attempt in
+// auto mode: only PNG pages are considered, since photos and scans stored as
+// JPEG practically never shrink with lossless encoding.
+func isPaletteLikePage(page *manga.PageFile) bool {
+	if strings.ToLower(page.Extension) != ".png" {
+		return false
+	}
+	paletteLike, err := imaging.IsPaletteLike(page.FilePath)
+	if err != nil {
+		log.Debug().Uint16("page_index", page.Index).Err(err).Msg("Cannot analyze page colors, encoding lossy only")
+		return false
+	}
+	return paletteLike
 }
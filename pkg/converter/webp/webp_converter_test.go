@@ -1,20 +1,31 @@
 package webp
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/belphemur/CBZOptimizer/v2/internal/imaging"
 	"github.com/belphemur/CBZOptimizer/v2/internal/manga"
 	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/options"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
 )
 
 func createTestImageFile(t *testing.T, path string, width, height int) {
@@ -111,7 +122,7 @@ func TestConverter_ConvertChapter(t *testing.T) {
 				assert.LessOrEqual(t, current, total)
 			}
 
-			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, 80, tt.split, progress)
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Split: tt.split}, progress)
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -176,7 +187,7 @@ func TestConverter_ConvertChapter_Timeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
 	defer cancel()
 
-	convertedChapter, err := converter.ConvertChapter(ctx, chapter, 80, false, progress)
+	convertedChapter, err := converter.ConvertChapter(ctx, chapter, options.Conversion{Quality: 80}, progress)
 
 	assert.Error(t, err)
 	assert.Nil(t, convertedChapter)
@@ -206,7 +217,7 @@ func TestConverter_ConvertChapter_ManyPages_NoDeadlock(t *testing.T) {
 			var convertErr error
 			go func() {
 				defer close(done)
-				_, convertErr = converter.ConvertChapter(ctx, chapter, 80, false, progress)
+				_, convertErr = converter.ConvertChapter(ctx, chapter, options.Conversion{Quality: 80}, progress)
 			}()
 
 			select {
@@ -256,7 +267,7 @@ func TestConverter_ConvertChapter_ConcurrentChapters_NoDeadlock(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
 			defer cancel()
 
-			_, _ = converter.ConvertChapter(ctx, ch, 80, false, progress)
+			_, _ = converter.ConvertChapter(ctx, ch, options.Conversion{Quality: 80}, progress)
 		}(chapter)
 	}
 
@@ -299,7 +310,7 @@ func TestConverter_SplitAndConvert(t *testing.T) {
 	progress := func(message string, current uint32, total uint32) {}
 
 	// With split=true, the oversized page should be split
-	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, 80, true, progress)
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Split: true}, progress)
 	require.NoError(t, err)
 	require.NotNil(t, convertedChapter)
 
@@ -344,7 +355,7 @@ func TestConverter_OversizedImageNoSplit(t *testing.T) {
 	progress := func(message string, current uint32, total uint32) {}
 
 	// With split=false, the oversized page should be kept as-is with error
-	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, 80, false, progress)
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, progress)
 	assert.Error(t, err, "Should return error for oversized page without split")
 	if convertedChapter != nil {
 		// The page should be kept in original format
@@ -354,46 +365,6 @@ func TestConverter_OversizedImageNoSplit(t *testing.T) {
 	}
 }
 
-func TestGetImageDimensions(t *testing.T) {
-	dir := t.TempDir()
-
-	tests := []struct {
-		name           string
-		width, height  int
-		expectW, expectH int
-	}{
-		{"small image", 100, 200, 100, 200},
-		{"wide image", 1920, 1080, 1920, 1080},
-		{"tall image", 800, 5000, 800, 5000},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			path := filepath.Join(dir, tt.name+".jpg")
-			createTestImageFile(t, path, tt.width, tt.height)
-
-			w, h, err := getImageDimensions(path)
-			require.NoError(t, err)
-			assert.Equal(t, tt.expectW, w)
-			assert.Equal(t, tt.expectH, h)
-		})
-	}
-}
-
-func TestGetImageDimensions_NonexistentFile(t *testing.T) {
-	_, _, err := getImageDimensions("/nonexistent/file.jpg")
-	assert.Error(t, err)
-}
-
-func TestGetImageDimensions_InvalidFile(t *testing.T) {
-	dir := t.TempDir()
-	path := filepath.Join(dir, "invalid.jpg")
-	require.NoError(t, os.WriteFile(path, []byte("not an image"), 0644))
-
-	_, _, err := getImageDimensions(path)
-	assert.Error(t, err)
-}
-
 func TestConverter_ConvertChapter_EmptyChapter(t *testing.T) {
 	converter := New()
 	err := converter.PrepareConverter()
@@ -408,7 +379,7 @@ func TestConverter_ConvertChapter_EmptyChapter(t *testing.T) {
 
 	progress := func(message string, current uint32, total uint32) {}
 
-	_, err = converter.ConvertChapter(context.Background(), chapter, 80, false, progress)
+	_, err = converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, progress)
 	assert.Error(t, err, "Should error on empty chapter")
 }
 
@@ -422,7 +393,7 @@ func TestConverter_ConvertChapter_PreservesComicInfo(t *testing.T) {
 
 	progress := func(message string, current uint32, total uint32) {}
 
-	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, 80, false, progress)
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, progress)
 	require.NoError(t, err)
 	require.NotNil(t, convertedChapter)
 	assert.Equal(t, chapter.ComicInfoXml, convertedChapter.ComicInfoXml)
@@ -437,7 +408,7 @@ func TestConverter_ConvertChapter_OutputInCorrectDir(t *testing.T) {
 
 	progress := func(message string, current uint32, total uint32) {}
 
-	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, 80, false, progress)
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80}, progress)
 	require.NoError(t, err)
 	require.NotNil(t, convertedChapter)
 
@@ -459,7 +430,7 @@ func TestEncodeFile(t *testing.T) {
 
 	createTestImageFile(t, inputPath, 200, 300)
 
-	err = EncodeFile(inputPath, outputPath, 80)
+	err = EncodeFile(inputPath, outputPath, Encoding{Quality: 80})
 	require.NoError(t, err)
 
 	// Verify output exists and is non-empty
@@ -478,7 +449,7 @@ func TestEncodeFileWithCrop(t *testing.T) {
 
 	createTestImageFile(t, inputPath, 200, 600)
 
-	err = EncodeFileWithCrop(inputPath, outputPath, 80, 0, 0, 200, 300)
+	err = EncodeFileWithCrop(inputPath, outputPath, Encoding{Quality: 80}, 0, 0, 200, 300)
 	require.NoError(t, err)
 
 	info, err := os.Stat(outputPath)
@@ -486,35 +457,806 @@ func TestEncodeFileWithCrop(t *testing.T) {
 	assert.Greater(t, info.Size(), int64(0))
 }
 
-// TestIntermediatePageName_StemsAreUnique pins the contract that
-// intermediatePageName must produce a different on-disk filename for two
-// pages whose OriginalNames share a stem via the original archive entry
-// name. ExtractChapter guarantees stem-unique OriginalNames per chapter
-// (so, e.g., a/page.png and b/page.jpg come out as "page.png" and
-// "page_0001.jpg"), and the converter must reflect that: stripping the
-// extension and appending ".webp" must not collapse two distinct stems
-// onto the same intermediate path.
-func TestIntermediatePageName_StemsAreUnique(t *testing.T) {
+// createFlatPNG writes a PNG made of a few flat color bands, the kind of
+// page (line art, screentone-free color) lossless WebP compresses best.
+func createFlatPNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	bands := []color.RGBA{{255, 255, 255, 255}, {0, 0, 0, 255}, {200, 40, 40, 255}}
+	for y := 0; y < height; y++ {
+		c := bands[(y/20)%len(bands)]
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	_ = f.Close()
+}
+
+// webpChunk returns the FourCC of the first chunk in a simple WebP file:
+// "VP8 " for lossy and "VP8L" for lossless bitstreams.
+func webpChunk(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(data), 16)
+	require.Equal(t, "WEBP", string(data[8:12]))
+	return string(data[12:16])
+}
+
+func TestEncodeFile_Modes(t *testing.T) {
+	err := PrepareEncoder()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		encoding      Encoding
+		expectedChunk string
+	}{
+		{name: "lossy", encoding: Encoding{Quality: 80, Mode: constant.WebPLossy}, expectedChunk: "VP8 "},
+		{name: "lossless", encoding: Encoding{Quality: 80, Mode: constant.WebPLossless}, expectedChunk: "VP8L"},
+		{name: "near-lossless", encoding: Encoding{Quality: 80, Mode: constant.WebPNearLossless, NearLosslessLevel: 60}, expectedChunk: "VP8L"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			inputPath := filepath.Join(dir, "input.png")
+			outputPath := filepath.Join(dir, "output.webp")
+			createFlatPNG(t, inputPath, 200, 300)
+
+			require.NoError(t, EncodeFile(inputPath, outputPath, tt.encoding))
+			assert.Equal(t, tt.expectedChunk, webpChunk(t, outputPath))
+		})
+	}
+}
+
+func TestIsPaletteLikePage(t *testing.T) {
+	dir := t.TempDir()
+
+	flatPath := filepath.Join(dir, "flat.png")
+	createFlatPNG(t, flatPath, 100, 100)
+
+	photoPath := filepath.Join(dir, "photo.png")
+	photo := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			photo.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 2), uint8(x + y), 255})
+		}
+	}
+	f, err := os.Create(photoPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, photo))
+	_ = f.Close()
+
+	jpegPath := filepath.Join(dir, "flat.jpg")
+	createTestImageFile(t, jpegPath, 100, 100)
+
+	assert.True(t, isPaletteLikePage(&manga.PageFile{Extension: ".png", FilePath: flatPath}))
+	assert.False(t, isPaletteLikePage(&manga.PageFile{Extension: ".png", FilePath: photoPath}))
+	assert.False(t, isPaletteLikePage(&manga.PageFile{Extension: ".jpg", FilePath: jpegPath}), "only PNG pages are considered")
+	assert.False(t, isPaletteLikePage(&manga.PageFile{Extension: ".png", FilePath: filepath.Join(dir, "missing.png")}))
+}
+
+func TestConverter_ConvertChapter_AutoModeKeepsSmaller(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	dir := t.TempDir()
+	pagePath := filepath.Join(dir, "0000.png")
+	createFlatPNG(t, pagePath, 400, 600)
+
+	lossyPath := filepath.Join(dir, "lossy.webp")
+	require.NoError(t, EncodeFile(pagePath, lossyPath, Encoding{Quality: 80}))
+	losslessPath := filepath.Join(dir, "lossless.webp")
+	require.NoError(t, EncodeFile(pagePath, losslessPath, Encoding{Quality: 80, Mode: constant.WebPLossless}))
+	lossyInfo, err := os.Stat(lossyPath)
+	require.NoError(t, err)
+	losslessInfo, err := os.Stat(losslessPath)
+	require.NoError(t, err)
+
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".png", FilePath: pagePath}},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, WebPMode: constant.WebPAuto}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+
+	info, err := os.Stat(convertedChapter.Pages[0].FilePath)
+	require.NoError(t, err)
+	expected := min(lossyInfo.Size(), losslessInfo.Size())
+	assert.Equal(t, expected, info.Size(), "auto mode should keep the smaller encoding")
+
+	_, err = os.Stat(convertedChapter.Pages[0].FilePath + ".lossless")
+	assert.True(t, os.IsNotExist(err), "lossless candidate should be cleaned up")
+}
+
+// createGradientJPEG writes a detailed JPEG page so that low qualities
+// visibly lose SSIM.
+func createGradientJPEG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*7 + y*3 + (x*y)%17) % 256)
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 95}))
+	_ = f.Close()
+}
+
+func TestEncodeToTarget(t *testing.T) {
+	err := PrepareEncoder()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.jpg")
+	createGradientJPEG(t, inputPath, 256, 256)
+	source, err := imaging.Decode(inputPath)
+	require.NoError(t, err)
+	reference := imaging.Luma(source)
+
+	ssimOf := func(path string) float64 {
+		encoded, err := imaging.DecodeWebPLuma(path)
+		require.NoError(t, err)
+		score, err := imaging.SSIM(reference, encoded)
+		require.NoError(t, err)
+		return score
+	}
+
+	loosePath := filepath.Join(dir, "loose.webp")
+	require.NoError(t, encodeToTarget(inputPath, loosePath, nil, pageEncoding{targetSSIM: 0.80, minQuality: 5, maxQuality: 95}))
+	strictPath := filepath.Join(dir, "strict.webp")
+	require.NoError(t, encodeToTarget(inputPath, strictPath, nil, pageEncoding{targetSSIM: 0.97, minQuality: 5, maxQuality: 95}))
+
+	assert.GreaterOrEqual(t, ssimOf(loosePath), 0.80)
+	strictScore := ssimOf(strictPath)
+	maxPath := filepath.Join(dir, "max.webp")
+	require.NoError(t, EncodeFile(inputPath, maxPath, Encoding{Quality: 95}))
+	if ssimOf(maxPath) >= 0.97 {
+		assert.GreaterOrEqual(t, strictScore, 0.97)
+	}
+
+	looseInfo, err := os.Stat(loosePath)
+	require.NoError(t, err)
+	strictInfo, err := os.Stat(strictPath)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, looseInfo.Size(), strictInfo.Size(), "a lower target should not produce a bigger file")
+
+	_, err = os.Stat(strictPath + ".candidate")
+	assert.True(t, os.IsNotExist(err), "candidate file should be cleaned up")
+}
+
+func TestEncodeToTarget_UnreachableUsesMaxQuality(t *testing.T) {
+	err := PrepareEncoder()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.jpg")
+	createGradientJPEG(t, inputPath, 128, 128)
+
+	outputPath := filepath.Join(dir, "output.webp")
+	require.NoError(t, encodeToTarget(inputPath, outputPath, nil, pageEncoding{targetSSIM: 0.9999999, minQuality: 10, maxQuality: 40}))
+
+	maxPath := filepath.Join(dir, "max.webp")
+	require.NoError(t, EncodeFile(inputPath, maxPath, Encoding{Quality: 40}))
+
+	got, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	want, err := os.ReadFile(maxPath)
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "an unreachable target should keep the max quality output")
+}
+
+func webpSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	config, err := webp.DecodeConfig(f)
+	require.NoError(t, err)
+	return config.Width, config.Height
+}
+
+func TestConverter_ConvertChapter_Resize(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           options.Conversion
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{name: "max width", opts: options.Conversion{Quality: 80, MaxWidth: 400}, expectedWidth: 400, expectedHeight: 600},
+		{name: "max height", opts: options.Conversion{Quality: 80, MaxHeight: 300}, expectedWidth: 200, expectedHeight: 300},
+		{name: "max megapixels", opts: options.Conversion{Quality: 80, MaxMegapixels: 0.24}, expectedWidth: 400, expectedHeight: 600},
+		{name: "never upscales", opts: options.Conversion{Quality: 80, MaxWidth: 2000}, expectedWidth: 800, expectedHeight: 1200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converter := New()
+			require.NoError(t, converter.PrepareConverter())
+
+			chapter, _ := createTestChapter(t, []struct{ w, h int }{{800, 1200}})
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, tt.opts, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, 1)
+
+			width, height := webpSize(t, convertedChapter.Pages[0].FilePath)
+			assert.Equal(t, tt.expectedWidth, width)
+			assert.Equal(t, tt.expectedHeight, height)
+		})
+	}
+}
+
+func TestConverter_ResizeBeforeSplit(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	t.Run("resized page fits without splitting", func(t *testing.T) {
+		// 200x16883 becomes 100x8441, below the WebP limit.
+		chapter, _ := createTestChapter(t, []struct{ w, h int }{{200, webpMaxHeight + 500}})
+		convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Split: true, MaxWidth: 100}, func(string, uint32, uint32) {})
+		require.NoError(t, err)
+		require.Len(t, convertedChapter.Pages, 1)
+		assert.False(t, convertedChapter.Pages[0].IsSplitted)
+
+		width, height := webpSize(t, convertedChapter.Pages[0].FilePath)
+		assert.Equal(t, 100, width)
+		assert.Equal(t, 8441, height)
+	})
+
+	t.Run("slices are cut from the resized page", func(t *testing.T) {
+		// 400x34000 becomes 200x17000: 8 slices of 2000px and one of 1000px.
+		chapter, _ := createTestChapter(t, []struct{ w, h int }{{400, 34000}})
+		convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Split: true, MaxWidth: 200}, func(string, uint32, uint32) {})
+		require.NoError(t, err)
+		require.Len(t, convertedChapter.Pages, 9)
+
+		for i, page := range convertedChapter.Pages {
+			assert.True(t, page.IsSplitted)
+			assert.Equal(t, uint16(i), page.SplitPartIndex)
+			width, height := webpSize(t, page.FilePath)
+			assert.Equal(t, 200, width)
+			if i < 8 {
+				assert.Equal(t, 2000, height)
+			} else {
+				assert.Equal(t, 1000, height)
+			}
+		}
+	})
+}
+
+func TestConverter_ConvertChapter_Grayscale(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+	pagePath := filepath.Join(dir, "0000.jpg")
+	createGradientJPEG(t, pagePath, 128, 96)
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: pagePath}},
+	}
+
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 90, Grayscale: true, MaxWidth: 64}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 1)
+
+	f, err := os.Open(convertedChapter.Pages[0].FilePath)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	img, err := webp.Decode(f)
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(64, 48), img.Bounds().Size())
+
+	ycbcr, ok := img.(*image.YCbCr)
+	require.True(t, ok, "lossy WebP should decode to YCbCr")
+	for i := range ycbcr.Cb {
+		assert.InDelta(t, 128, int(ycbcr.Cb[i]), 2, "chroma should be neutral")
+		assert.InDelta(t, 128, int(ycbcr.Cr[i]), 2, "chroma should be neutral")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "output"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the grayscale staging file should be removed")
+}
+
+// createPageJPEG writes a width x height RGB JPEG page, gray when colored is
+// false.
+func createPageJPEG(t *testing.T, path string, width, height int, colored bool) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x + y) % 256)
+			if colored {
+				img.Set(x, y, color.RGBA{R: v, G: 255 - v, B: 64, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+			}
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 90}))
+	_ = f.Close()
+}
+
+func TestConverter_ConvertChapter_DetectGrayscale(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+	grayPath := filepath.Join(dir, "0000.jpg")
+	colorPath := filepath.Join(dir, "0001.jpg")
+	createPageJPEG(t, grayPath, 100, 150, false)
+	createPageJPEG(t, colorPath, 100, 150, true)
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages: []*manga.PageFile{
+			{Index: 0, Extension: ".jpg", FilePath: grayPath},
+			{Index: 1, Extension: ".jpg", FilePath: colorPath},
+		},
+	}
+
+	opts := options.Conversion{Quality: 85, DetectGrayscale: true, GrayscaleTolerance: options.DefaultGrayscaleTolerance}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 2)
+
+	assert.True(t, convertedChapter.Pages[0].IsGrayscale)
+	assert.False(t, convertedChapter.Pages[1].IsGrayscale)
+	assert.Equal(t, 1, convertedChapter.GrayscalePages)
+}
+
+// createFramedJPEG writes a width x height JPEG page with white borders
+// around a dark content block at content.
+func createFramedJPEG(t *testing.T, path string, width, height int, content image.Rectangle) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if (image.Point{X: x, Y: y}).In(content) {
+				v := uint8((x*5 + y*3) % 128)
+				img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 95}))
+	_ = f.Close()
+}
+
+func TestConverter_ConvertChapter_AutoCrop(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	tests := []struct {
+		name           string
+		opts           options.Conversion
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{name: "crop with margin", opts: options.Conversion{Quality: 85, AutoCrop: true, AutoCropThreshold: 32, AutoCropMargin: 8}, expectedWidth: 336, expectedHeight: 516},
+		{name: "crop then resize", opts: options.Conversion{Quality: 85, AutoCrop: true, AutoCropThreshold: 32, AutoCropMargin: 8, MaxWidth: 168}, expectedWidth: 168, expectedHeight: 258},
+		{name: "disabled", opts: options.Conversion{Quality: 85}, expectedWidth: 400, expectedHeight: 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+			pagePath := filepath.Join(dir, "0000.jpg")
+			createFramedJPEG(t, pagePath, 400, 600, image.Rect(40, 50, 360, 550))
+			chapter := &manga.Chapter{
+				FilePath: filepath.Join(dir, "test.cbz"),
+				TempDir:  dir,
+				Pages:    []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: pagePath}},
+			}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, tt.opts, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, 1)
+
+			width, height := webpSize(t, convertedChapter.Pages[0].FilePath)
+			assert.Equal(t, tt.expectedWidth, width)
+			assert.Equal(t, tt.expectedHeight, height)
+		})
+	}
+}
+
+// createSpreadJPEG writes a width x height spread whose left half is white
+// and right half black, so the order of its halves can be told apart.
+func createSpreadJPEG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width/2; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 95}))
+	_ = f.Close()
+}
+
+func TestConverter_ConvertChapter_SplitSpreads(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	const rightToLeft = `<ComicInfo><Manga>YesAndRightToLeft</Manga></ComicInfo>`
+	tests := []struct {
+		name      string
+		opts      options.Conversion
+		comicInfo string
+		expected  []bool // whether each part is the white half
+		width     int
+	}{
+		{name: "left to right", opts: options.Conversion{Quality: 85, SplitSpreads: true}, expected: []bool{true, false}, width: 400},
+		{name: "right to left from ComicInfo", opts: options.Conversion{Quality: 85, SplitSpreads: true}, comicInfo: rightToLeft, expected: []bool{false, true}, width: 400},
+		{name: "explicit direction wins", opts: options.Conversion{Quality: 85, SplitSpreads: true, ReadingDirection: constant.ReadingDirectionLTR}, comicInfo: rightToLeft, expected: []bool{true, false}, width: 400},
+		{name: "resized halves", opts: options.Conversion{Quality: 85, SplitSpreads: true, ReadingDirection: constant.ReadingDirectionRTL, MaxWidth: 200}, expected: []bool{false, true}, width: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+			pagePath := filepath.Join(dir, "0000.jpg")
+			createSpreadJPEG(t, pagePath, 800, 600)
+			chapter := &manga.Chapter{
+				FilePath:     filepath.Join(dir, "test.cbz"),
+				TempDir:      dir,
+				ComicInfoXml: tt.comicInfo,
+				Pages:        []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: pagePath}},
+			}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, tt.opts, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, len(tt.expected))
+
+			for i, page := range convertedChapter.Pages {
+				assert.True(t, page.IsSplitted)
+				assert.Equal(t, uint16(i), page.SplitPartIndex)
+				width, _ := webpSize(t, page.FilePath)
+				assert.Equal(t, tt.width, width)
+
+				luma, err := imaging.DecodeWebPLuma(page.FilePath)
+				require.NoError(t, err)
+				center := luma.GrayAt(luma.Bounds().Dx()/2, luma.Bounds().Dy()/2).Y
+				assert.Equal(t, tt.expected[i], center > 128, "part %d", i)
+			}
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_KeepSpreads(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+	pagePath := filepath.Join(dir, "0000.jpg")
+	createSpreadJPEG(t, pagePath, 800, 600)
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: pagePath}},
+	}
+
+	opts := options.Conversion{Quality: 85, SplitSpreads: true, KeepSpreads: true}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+
+	widths := make([]int, 0, 3)
+	for _, page := range convertedChapter.Pages {
+		width, _ := webpSize(t, page.FilePath)
+		widths = append(widths, width)
+	}
+	assert.Equal(t, []int{800, 400, 400}, widths, "the whole spread comes before its halves")
+}
+
+func TestConverter_SplitAtGutters(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	// Busy artwork, too tall for WebP, with a white gutter just above the
+	// first fixed cut.
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+	img := image.NewGray(image.Rect(0, 0, 200, 17000))
+	for y := 0; y < 17000; y++ {
+		for x := 0; x < 200; x++ {
+			v := uint8((x*7 + y*13) % 200)
+			if y >= 1800 && y < 1850 {
+				v = 255
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	pagePath := filepath.Join(dir, "0000.jpg")
+	f, err := os.Create(pagePath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 95}))
+	_ = f.Close()
+
+	chapter := &manga.Chapter{
+		FilePath: filepath.Join(dir, "test.cbz"),
+		TempDir:  dir,
+		Pages:    []*manga.PageFile{{Index: 0, Extension: ".jpg", FilePath: pagePath}},
+	}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, Split: true}, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 9)
+
+	// The first cut goes through the middle of the gutter, the others fall
+	// back to the fixed slice height.
+	for i, page := range convertedChapter.Pages {
+		_, height := webpSize(t, page.FilePath)
+		switch i {
+		case 0:
+			assert.Equal(t, 1825, height)
+		case 8:
+			assert.Equal(t, 1175, height)
+		default:
+			assert.Equal(t, 2000, height)
+		}
+	}
+}
+
+func TestConverter_SplitHeightAndOverlap(t *testing.T) {
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
+	// 5000px fits in WebP, but is above the split height: parts start every
+	// 2000px and repeat the last 100px of the previous one.
+	chapter, _ := createTestChapter(t, []struct{ w, h int }{{200, 5000}})
+	opts := options.Conversion{Quality: 80, Split: true, SplitHeight: 3000, SliceHeight: 2000, SliceOverlap: 100}
+	convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, opts, func(string, uint32, uint32) {})
+	require.NoError(t, err)
+	require.Len(t, convertedChapter.Pages, 3)
+
+	heights := make([]int, 0, 3)
+	for _, page := range convertedChapter.Pages {
+		assert.True(t, page.IsSplitted)
+		_, height := webpSize(t, page.FilePath)
+		heights = append(heights, height)
+	}
+	assert.Equal(t, []int{2000, 2100, 1100}, heights)
+}
+
+// createAnimatedGIF writes a width x height GIF of frames frames, each a
+// shifted color gradient dithered to the Plan 9 palette, the kind of
+// content GIF compresses poorly.
+func createAnimatedGIF(t *testing.T, path string, width, height, frames int) {
+	t.Helper()
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		gradient := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				gradient.Set(x, y, color.RGBA{R: uint8(x + i*16), G: uint8(y), B: uint8((x + y) / 2), A: 255})
+			}
+		}
+		frame := image.NewPaletted(gradient.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, frame.Bounds(), gradient, image.Point{})
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 20)
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, gif.EncodeAll(f, animation))
+	_ = f.Close()
+}
+
+func TestConverter_ConvertChapter_AnimatedGIF(t *testing.T) {
+	if _, err := exec.LookPath(gif2webpBinary); err != nil {
+		t.Skip("gif2webp not available")
+	}
+	converter := New()
+	require.NoError(t, converter.PrepareConverter())
+
 	tests := []struct {
-		name         string
-		originalName string
-		splitSuffix  string
+		name     string
+		opts     options.Conversion
+		animated bool
 	}{
-		{name: "bare stem", originalName: "page.png", splitSuffix: ""},
-		{name: "indexed stem (post-fix)", originalName: "page_0001.jpg", splitSuffix: ""},
-		{name: "bare stem + split suffix", originalName: "page.png", splitSuffix: "-00"},
-		{name: "indexed stem + split suffix", originalName: "page_0001.jpg", splitSuffix: "-00"},
+		{name: "animated WebP", opts: options.Conversion{Quality: 80}, animated: true},
+		{name: "flattened", opts: options.Conversion{Quality: 80, FlattenAnimations: true}, animated: false},
 	}
 
-	names := make(map[string]struct{}, len(tests))
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			page := &manga.PageFile{Index: 0, OriginalName: tt.originalName}
-			got := intermediatePageName(page, tt.splitSuffix)
-			if _, dup := names[got]; dup {
-				t.Errorf("intermediate name %q collides with an earlier page's intermediate name", got)
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "output"), 0755))
+			pagePath := filepath.Join(dir, "0000.gif")
+			createAnimatedGIF(t, pagePath, 400, 400, 8)
+			chapter := &manga.Chapter{
+				FilePath: filepath.Join(dir, "test.cbz"),
+				TempDir:  dir,
+				Pages:    []*manga.PageFile{{Index: 0, Extension: ".gif", FilePath: pagePath}},
 			}
-			names[got] = struct{}{}
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, tt.opts, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, 1)
+
+			page := convertedChapter.Pages[0]
+			require.Equal(t, ".webp", page.Extension)
+			data, err := os.ReadFile(page.FilePath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.animated, bytes.Contains(data, []byte("ANIM")), "animated WebP files carry an ANIM chunk")
 		})
 	}
 }
+
+func TestClassifyPage(t *testing.T) {
+	dir := t.TempDir()
+	// Flat color panels: a drawing.
+	flat := image.NewRGBA(image.Rect(0, 0, 200, 300))
+	draw.Draw(flat, image.Rect(0, 0, 200, 150), &image.Uniform{C: color.RGBA{R: 220, G: 60, B: 60, A: 255}}, image.Point{}, draw.Src)
+	draw.Draw(flat, image.Rect(0, 150, 200, 300), &image.Uniform{C: color.RGBA{R: 60, G: 90, B: 220, A: 255}}, image.Point{}, draw.Src)
+	path := filepath.Join(dir, "0000.png")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, flat))
+	require.NoError(t, f.Close())
+	page := &manga.PageFile{Index: 0, Extension: ".png", FilePath: path}
+
+	enc := pageEncoding{Encoding: Encoding{Quality: 80}}
+	decoded := classifyPage(nil, page, nil, false, &enc)
+	require.NotNil(t, decoded, "the decoded page is handed back for reuse")
+	assert.Equal(t, "drawing", enc.Preset)
+	assert.Equal(t, uint(70), enc.Quality)
+
+	enc = pageEncoding{Encoding: Encoding{Quality: 5}}
+	classifyPage(decoded, page, nil, false, &enc)
+	assert.Equal(t, uint(0), enc.Quality, "quality is clamped")
+
+	missing := &manga.PageFile{Index: 1, Extension: ".png", FilePath: filepath.Join(dir, "missing.png")}
+	enc = pageEncoding{Encoding: Encoding{Quality: 80}}
+	assert.Nil(t, classifyPage(nil, missing, nil, false, &enc))
+	assert.Equal(t, pageEncoding{Encoding: Encoding{Quality: 80}}, enc, "undecodable pages keep the plain settings")
+}
+
+func TestStageQuantized(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0000.jpg")
+	createTestImageFile(t, path, 400, 600)
+	spreadPath := filepath.Join(dir, "0001.jpg")
+	createTestImageFile(t, spreadPath, 600, 400)
+
+	tests := []struct {
+		name     string
+		path     string
+		region   *image.Rectangle
+		opts     options.Conversion
+		expected image.Rectangle
+	}{
+		{
+			name:     "whole page",
+			path:     path,
+			opts:     options.Conversion{GrayLevels: 16},
+			expected: image.Rect(0, 0, 400, 600),
+		},
+		{
+			name:     "cropped and resized before dithering",
+			path:     path,
+			region:   &image.Rectangle{Min: image.Pt(0, 0), Max: image.Pt(200, 600)},
+			opts:     options.Conversion{GrayLevels: 4, Dither: constant.DitherOrdered, MaxHeight: 300},
+			expected: image.Rect(0, 0, 100, 300),
+		},
+		{
+			name:     "spreads are resized half by half later",
+			path:     spreadPath,
+			opts:     options.Conversion{GrayLevels: 2, SplitSpreads: true, MaxWidth: 100},
+			expected: image.Rect(0, 0, 600, 400),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &manga.PageFile{Index: 0, Extension: ".jpg", FilePath: tt.path}
+			stagedPath, quantized, err := stageQuantized(nil, page, tt.region, dir, tt.opts)
+			require.NoError(t, err)
+			defer func() { _ = os.Remove(stagedPath) }()
+
+			assert.Equal(t, tt.expected.Size(), quantized.Bounds().Size())
+			step := 255 / (tt.opts.GrayLevels - 1)
+			for _, v := range quantized.Pix {
+				require.Zero(t, int(v)%step, "%d is not one of the %d levels", v, tt.opts.GrayLevels)
+			}
+
+			staged, err := imaging.Decode(stagedPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected.Size(), staged.Bounds().Size())
+		})
+	}
+
+	_, _, err := stageQuantized(nil, &manga.PageFile{FilePath: filepath.Join(dir, "missing.jpg")}, nil, dir, options.Conversion{GrayLevels: 16})
+	assert.Error(t, err)
+}
+
+func TestConverter_ConvertChapter_NativeEncoder(t *testing.T) {
+	tests := []struct {
+		name          string
+		mode          constant.WebPMode
+		expectedChunk string
+	}{
+		{name: "lossy", mode: constant.WebPLossy, expectedChunk: "VP8 "},
+		{name: "lossless", mode: constant.WebPLossless, expectedChunk: "VP8L"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter, _ := createTestChapter(t, []struct{ w, h int }{{300, 400}})
+			converter := New()
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, WebPMode: tt.mode, WebPEncoder: constant.WebPEncoderNative}, func(string, uint32, uint32) {})
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, 1)
+
+			data, err := os.ReadFile(convertedChapter.Pages[0].FilePath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedChunk, string(data[12:16]))
+			img, err := webp.Decode(bytes.NewReader(data))
+			require.NoError(t, err)
+			assert.Equal(t, image.Rect(0, 0, 300, 400), img.Bounds())
+		})
+	}
+}
+
+func TestConverter_ConvertChapter_CWebPUnavailable(t *testing.T) {
+	unavailable := errors.New("cwebp download failed")
+	tests := []struct {
+		name        string
+		encoder     constant.WebPEncoder
+		expectError bool
+	}{
+		{name: "auto falls back to the built-in encoder", encoder: constant.WebPEncoderAuto, expectError: false},
+		{name: "cwebp is required", encoder: constant.WebPEncoderCWebP, expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter, _ := createTestChapter(t, []struct{ w, h int }{{300, 400}})
+			converter := New()
+			converter.isPrepared = true
+			converter.cwebpErr = unavailable
+
+			convertedChapter, err := converter.ConvertChapter(context.Background(), chapter, options.Conversion{Quality: 80, WebPEncoder: tt.encoder}, func(string, uint32, uint32) {})
+			if tt.expectError {
+				assert.ErrorIs(t, err, unavailable)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, convertedChapter.Pages, 1)
+			assert.Equal(t, ".webp", convertedChapter.Pages[0].Extension)
+		})
+	}
+}
+
+func TestConverter_RequireCWebP(t *testing.T) {
+	unavailable := errors.New("cwebp download failed")
+	converter := New()
+	converter.isPrepared = true
+	converter.cwebpErr = unavailable
+
+	assert.NoError(t, converter.PrepareConverter())
+	assert.ErrorIs(t, converter.RequireCWebP(), unavailable)
+}
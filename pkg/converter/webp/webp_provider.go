@@ -2,14 +2,22 @@ package webp
 
 import (
 	"fmt"
+	"image"
+	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/belphemur/CBZOptimizer/v2/pkg/converter/constant"
 	"github.com/belphemur/go-webpbin/v2"
 )
 
 const libwebpVersion = "1.6.0"
 
+// gif2webpBinary converts animated GIFs. go-webpbin only provides cwebp, so
+// it is looked up on the PATH like the AVIF and JPEG XL encoders.
+const gif2webpBinary = "gif2webp"
+
 var config = webpbin.NewConfig()
 
 var prepareMutex sync.Mutex
@@ -35,11 +43,67 @@ func PrepareEncoder() error {
 	return nil
 }
 
+// Encoding describes how cwebp compresses a single image. The zero value
+// (apart from Quality) is plain lossy encoding.
+type Encoding struct {
+	// Quality is the lossy quality, or the compression effort for lossless
+	// modes (0-100).
+	Quality uint
+	// Mode selects lossy or lossless compression. constant.WebPAuto is
+	// resolved by the converter and is encoded as lossy here.
+	Mode constant.WebPMode
+	// NearLosslessLevel is passed to -near_lossless for
+	// constant.WebPNearLossless (0-100, 100 disables the preprocessing).
+	NearLosslessLevel uint8
+	// ResizeWidth and ResizeHeight, when set, scale the image with -resize.
+	// cwebp crops before resizing, so with EncodeFileWithCrop they are the
+	// size of the cropped region once resized.
+	ResizeWidth  int
+	ResizeHeight int
+	// KeepICC copies the input's ICC profile into the WebP with -metadata,
+	// which cwebp otherwise drops.
+	KeepICC bool
+	// Preset, when set, tunes lossy encoding for the content with cwebp's
+	// -preset (drawing, photo, text, ...). Lossless modes ignore it.
+	Preset string
+	// Native encodes with the built-in encoder instead of cwebp, see
+	// encodeNative.
+	Native bool
+}
+
+// newCWebP returns a cwebp invocation configured for encoding. The mode and
+// preset, resize and metadata flags have no dedicated setter on CWebP, so they are added as raw
+// arguments; Run appends quality, crop, input and output after them.
+func newCWebP(encoding Encoding) *webpbin.CWebP {
+	cwebp := webpbin.NewCWebP(config)
+	// -preset resets the other settings, so cwebp requires it first.
+	if encoding.Preset != "" && encoding.Mode != constant.WebPLossless && encoding.Mode != constant.WebPNearLossless {
+		cwebp.Arg("-preset", encoding.Preset)
+	}
+	switch encoding.Mode {
+	case constant.WebPLossless:
+		cwebp.Arg("-lossless")
+	case constant.WebPNearLossless:
+		cwebp.Arg("-lossless")
+		cwebp.Arg("-near_lossless", strconv.Itoa(int(encoding.NearLosslessLevel)))
+	}
+	if encoding.ResizeWidth > 0 && encoding.ResizeHeight > 0 {
+		cwebp.Arg("-resize", strconv.Itoa(encoding.ResizeWidth), strconv.Itoa(encoding.ResizeHeight))
+	}
+	if encoding.KeepICC {
+		cwebp.Arg("-metadata", "icc")
+	}
+	return cwebp.Quality(encoding.Quality)
+}
+
 // EncodeFile converts an image file directly to WebP using cwebp.
-// This is a zero-copy operation: no image data is loaded into Go memory.
-func EncodeFile(inputPath string, outputPath string, quality uint) error {
-	return webpbin.NewCWebP(config).
-		Quality(quality).
+// This is a zero-copy operation: no image data is loaded into Go memory,
+// unless encoding.Native selects the built-in encoder.
+func EncodeFile(inputPath string, outputPath string, encoding Encoding) error {
+	if encoding.Native {
+		return encodeNative(inputPath, outputPath, encoding, nil)
+	}
+	return newCWebP(encoding).
 		InputFile(inputPath).
 		OutputFile(outputPath).
 		Run()
@@ -47,11 +111,41 @@ func EncodeFile(inputPath string, outputPath string, quality uint) error {
 
 // EncodeFileWithCrop converts a cropped region of an image file to WebP.
 // Uses cwebp's native -crop flag — no Go-side image decode needed.
-func EncodeFileWithCrop(inputPath string, outputPath string, quality uint, x, y, width, height int) error {
-	return webpbin.NewCWebP(config).
-		Quality(quality).
+func EncodeFileWithCrop(inputPath string, outputPath string, encoding Encoding, x, y, width, height int) error {
+	if encoding.Native {
+		crop := image.Rect(x, y, x+width, y+height)
+		return encodeNative(inputPath, outputPath, encoding, &crop)
+	}
+	return newCWebP(encoding).
 		Crop(x, y, width, height).
 		InputFile(inputPath).
 		OutputFile(outputPath).
 		Run()
 }
+
+// EncodeAnimation converts the animated GIF at inputPath to an animated WebP
+// with gif2webp, keeping every frame and its timing. gif2webp has no crop or
+// resize option, so those fields of encoding are ignored. Lossless is
+// gif2webp's own default and also stands in for near-lossless;
+// constant.WebPAuto lets gif2webp pick lossy or lossless per frame.
+func EncodeAnimation(inputPath string, outputPath string, encoding Encoding) error {
+	path, err := exec.LookPath(gif2webpBinary)
+	if err != nil {
+		return fmt.Errorf("%s not found: %w", gif2webpBinary, err)
+	}
+
+	args := []string{"-q", strconv.Itoa(int(encoding.Quality))}
+	switch encoding.Mode {
+	case constant.WebPLossy:
+		args = append(args, "-lossy")
+	case constant.WebPAuto:
+		args = append(args, "-mixed")
+	}
+	args = append(args, inputPath, "-o", outputPath)
+
+	output, err := exec.Command(path, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", gif2webpBinary, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}